@@ -120,7 +120,7 @@ func showGroup(db *gorm.DB, groupID uint) {
 	fmt.Println("--------------------------------------")
 	fmt.Printf("名称: %s\n", group.Name)
 	fmt.Printf("描述: %s\n", group.Description)
-	fmt.Printf("创建者: %d\n", group.CreatorID)
+	fmt.Printf("群主: %d\n", group.OwnerID)
 	fmt.Printf("创建时间: %s\n", group.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("是否公开: %v\n", group.IsPublic)
 
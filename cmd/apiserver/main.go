@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"im-go/internal/imtypes" // Import for StorageService interface
 	appKafka "im-go/internal/kafka"
+	kafkahandlers "im-go/internal/kafka/handlers"
 	"im-go/internal/models"
 	"log"
 	"net/http"
@@ -16,20 +17,33 @@ import (
 	"syscall"
 	"time"
 
+	"im-go/internal/auth"
 	"im-go/internal/config"
 	"im-go/internal/handlers/apiserver"
+	"im-go/internal/mailer"
 	"im-go/internal/middleware" // Needed for FriendRequest
 	"im-go/internal/services"
 	"im-go/internal/storage"
 
 	appRedis "im-go/internal/redis" // Alias for your internal redis package
 
+	confluentKafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/gorilla/handlers" // ADDED import
 	"github.com/gorilla/mux"
 	redisDriver "github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+// minSignedURLSecretLength 是附件下载链接签名密钥的最小长度。
+const minSignedURLSecretLength = 32
+
+// 好友请求通知和 Webhook 事件处理失败时在消费者内重试的次数和首次退避时间。
+// 消费者不会重新投递处理失败的消息，重试用尽后该消息会被记录并丢弃。
+const (
+	eventHandlerAttempts = 5
+	eventHandlerBackoff  = 500 * time.Millisecond
+)
+
 func main() {
 	// 1. 加载配置
 	cfg, err := config.LoadConfig("")
@@ -67,6 +81,22 @@ func main() {
 	// 4. 初始化 TokenBlacklist 服务
 	tokenBlacklistService := appRedis.NewRedisTokenBlacklist(redisClient)
 
+	// 4.1 初始化 JWT 签名密钥 (非对称密钥保存在数据库中并定期轮换，HS256 仅用于兼容旧部署)
+	var keyManager auth.KeyManager
+	if cfg.Auth.JWTSigningAlgorithm == auth.AlgorithmHS256 {
+		keyManager = auth.NewHMACKeyManager(cfg.Auth.JWTSecretKey)
+	} else {
+		signingKeys, err := services.NewSigningKeyManager(context.Background(), storage.NewGormSigningKeyRepository(db), cfg.Auth)
+		if err != nil {
+			log.Fatalf("无法初始化 JWT 签名密钥: %v", err)
+		}
+		keyCtx, cancelKeyRotation := context.WithCancel(context.Background())
+		defer cancelKeyRotation()
+		go signingKeys.Run(keyCtx)
+		keyManager = signingKeys
+	}
+	log.Printf("JWT 签名算法: %s", cfg.Auth.JWTSigningAlgorithm)
+
 	// 5. 初始化 Repositories
 	userRepo := storage.NewGormUserRepository(db)
 	convoRepo := storage.NewGormConversationRepository(db)
@@ -74,6 +104,18 @@ func main() {
 	msgRepo := storage.NewGormMessageRepository(db)
 	friendReqRepo := storage.NewGormFriendRequestRepository(db)
 	friendshipRepo := storage.NewGormFriendshipRepository(db)
+	pinRepo := storage.NewGormPinnedMessageRepository(db)
+	announcementRepo := storage.NewGormAnnouncementRepository(db)
+	channelRepo := storage.NewGormChannelRepository(db)
+	sessionRepo := storage.NewGormSessionRepository(db)
+	userTokenRepo := storage.NewGormUserTokenRepository(db)
+	twoFactorRepo := storage.NewGormTwoFactorRepository(db)
+	lockoutRepo := storage.NewGormLoginLockoutRepository(db)
+	identityRepo := storage.NewGormExternalIdentityRepository(db)
+	apiKeyRepo := storage.NewGormAPIKeyRepository(db)
+	webhookRepo := storage.NewGormWebhookRepository(db)
+	botCommandRepo := storage.NewGormBotCommandRepository(db)
+	privacyRepo := storage.NewGormPrivacyRepository(db)
 
 	// 6. 初始化 Kafka Producer
 	log.Printf("DEBUG [Kafka Init]: Brokers from config: %v", cfg.Kafka.Brokers)
@@ -86,17 +128,45 @@ func main() {
 	defer kfkProducer.Close()
 	log.Println("Kafka 生产者初始化成功 (API Server)。")
 
+	// 6.1 初始化邮件发送 (邮箱验证、找回密码)
+	mailSender, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("无法初始化邮件发送: %v", err)
+	}
+	log.Printf("邮件发送方式: %s", cfg.Mail.Type)
+
 	// 7. 初始化 Services
-	authService := services.NewAuthService(userRepo, cfg)
-	userService := services.NewUserService(userRepo)
-	messageService := services.NewMessageService(msgRepo, convoRepo, kfkProducer, cfg)
-	conversationService := services.NewConversationService(convoRepo, userRepo)
-	groupService := services.NewGroupService(groupRepo, userRepo, convoRepo)
-	friendReqService := services.NewFriendRequestService(db, userRepo, friendReqRepo, friendshipRepo, kfkProducer, cfg.Kafka)
+	sessionService := services.NewSessionService(sessionRepo, userRepo, keyManager, tokenBlacklistService, kfkProducer, cfg)
+	rateLimiter := appRedis.NewRedisRateLimiter(redisClient)
+	twoFactorService := services.NewTwoFactorService(twoFactorRepo, userTokenRepo, userRepo, sessionService, rateLimiter, cfg)
+	loginGuard := services.NewLoginGuard(rateLimiter, lockoutRepo, cfg.Auth)
+	authService := services.NewAuthService(userRepo, sessionService, twoFactorService, loginGuard, cfg)
+	accountService := services.NewAccountService(userRepo, userTokenRepo, lockoutRepo, sessionService, mailSender, rateLimiter, cfg)
+	var oidcProvider *auth.OIDCProvider // 未启用单点登录时为 nil
+	if cfg.OIDC.Enabled {
+		oidcProvider = auth.NewOIDCProvider(cfg.OIDC)
+		log.Printf("已启用单点登录，身份提供方: %s", cfg.OIDC.IssuerURL)
+	}
+	oidcService := services.NewOIDCService(oidcProvider, appRedis.NewRedisOIDCStateStore(redisClient), identityRepo, userRepo, sessionService, twoFactorService, cfg.OIDC)
+	privacyService := services.NewPrivacyService(privacyRepo, userRepo, friendshipRepo, friendReqRepo, msgRepo)
+	userService := services.NewUserService(userRepo, privacyService)
+	botService := services.NewBotService(userRepo, apiKeyRepo, botCommandRepo)
+	groupPermissions := services.NewGroupPermissionChecker(groupRepo)
+	sendGuard := services.NewSendRateGuard(rateLimiter, convoRepo, groupRepo, groupPermissions, cfg.RateLimit)
+	// 斜杠命令在 ChatServer 消费消息时路由，API 服务器不处理 MessagesTopic，因此不需要命令路由
+	messageService := services.NewMessageService(msgRepo, convoRepo, pinRepo, kfkProducer, groupPermissions, sendGuard, nil, nil, privacyService, cfg)
+	conversationService := services.NewConversationService(convoRepo, userRepo, channelRepo, privacyService, messageService)
+	channelService := services.NewChannelService(channelRepo, convoRepo, kfkProducer, cfg)
+	groupService := services.NewGroupService(groupRepo, userRepo, convoRepo, announcementRepo, groupPermissions, messageService, privacyService)
+	friendReqService := services.NewFriendRequestService(db, userRepo, friendReqRepo, friendshipRepo, groupRepo, privacyService, kfkProducer, cfg.Kafka, cfg.FriendRequest)
+	contactService := services.NewContactService(friendshipRepo, userRepo, storage.NewGormSuggestionRepository(db), appRedis.NewRedisSuggestionCache(redisClient))
+	webhookService := services.NewWebhookService(webhookRepo, userRepo, groupPermissions, cfg.Webhook)
+	// API 服务器只签发连接票据，令牌由 ChatServer 校验，因此不需要 KeySet
+	wsAuthService := services.NewWSAuthService(appRedis.NewRedisWSTicketStore(redisClient), nil, tokenBlacklistService, cfg.WebSocket)
 
 	// 7.1 初始化存储服务 (New)
 	var storageService imtypes.StorageService // Use interface type from imtypes
-	storageBaseURL := "/uploads"              // Base URL for accessing uploaded files
+	storageBaseURL := "/api/v1/files"         // 只用于 FileInfo.URL，不会返回给客户端，文件通过附件接口下载
 	if cfg.Storage.Type == "local" {
 		storageService, err = storage.NewLocalStorageService(cfg.Storage, storageBaseURL)
 		if err != nil {
@@ -104,30 +174,67 @@ func main() {
 		}
 		log.Println("本地存储服务初始化成功。")
 	} else if cfg.Storage.Type == "s3" {
-		// TODO: Initialize S3 storage service
-		log.Fatalf("S3 存储服务尚未实现")
+		s3Ctx, cancelS3 := context.WithTimeout(context.Background(), 10*time.Second)
+		storageService, err = storage.NewS3StorageService(s3Ctx, cfg.Storage, storageBaseURL)
+		cancelS3()
+		if err != nil {
+			log.Fatalf("无法初始化 S3 存储服务: %v", err)
+		}
+		log.Printf("S3 存储服务初始化成功，存储桶: %s", cfg.Storage.S3.BucketName)
 	} else {
 		log.Fatalf("不支持的存储类型: %s", cfg.Storage.Type)
 	}
 
+	// 附件下载链接的签名密钥，多个实例需要相同。持有密钥即可为任意附件伪造下载链接，因此必须单独配置
+	if len(cfg.Storage.SignedURLSecret) < minSignedURLSecretLength {
+		log.Fatalf("STORAGE.SIGNED_URL_SECRET 未配置或少于 %d 个字符，可以用 `openssl rand -hex 32` 生成", minSignedURLSecretLength)
+	}
+	attachmentService := services.NewAttachmentService(storage.NewGormAttachmentRepository(db), convoRepo, channelRepo, storageService, cfg.Storage.SignedURLSecret, cfg.Storage.SignedURLExpiry)
+
 	// 8. 初始化 Handlers
-	authHandler := apiserver.NewAuthHandler(authService, tokenBlacklistService)
+	authHandler := apiserver.NewAuthHandler(authService, sessionService, accountService, tokenBlacklistService, wsAuthService)
+	accountHandler := apiserver.NewAccountHandler(accountService)
+	twoFactorHandler := apiserver.NewTwoFactorHandler(twoFactorService)
+	oidcHandler := apiserver.NewOIDCHandler(oidcService)
+	sessionHandler := apiserver.NewSessionHandler(sessionService)
+	botHandler := apiserver.NewBotHandler(botService)
+	webhookHandler := apiserver.NewWebhookHandler(webhookService)
+	jwksHandler := apiserver.NewJWKSHandler(keyManager)
 	userHandler := apiserver.NewUserHandler(userService)
-	convoHandler := apiserver.NewConversationHandler(conversationService, messageService, groupService)
-	groupHandler := apiserver.NewGroupHandler(groupService, conversationService)
-	uploadHandler := apiserver.NewUploadHandler(storageService, cfg.Storage)
+	privacyHandler := apiserver.NewPrivacyHandler(privacyService)
+	convoHandler := apiserver.NewConversationHandler(conversationService, messageService, groupService, channelService)
+	channelHandler := apiserver.NewChannelHandler(channelService)
+	groupHandler := apiserver.NewGroupHandler(groupService, conversationService, privacyService, contactService)
+	uploadHandler := apiserver.NewUploadHandler(storageService, attachmentService, cfg.Storage)
 	friendReqHandler := apiserver.NewFriendRequestHandler(friendReqService)
+	contactHandler := apiserver.NewContactHandler(contactService)
 
 	// 9. 设置 HTTP 路由
 	r := mux.NewRouter()
+	// 解析客户端 IP，登录限流和会话记录都依赖它
+	clientIPMW, err := middleware.ClientIPMiddleware(cfg.APIServer.TrustedProxies)
+	if err != nil {
+		log.Fatalf("受信任代理配置无效: %v", err)
+	}
+	r.Use(clientIPMW)
 
 	// 9.1 认证路由
 	authRouter := r.PathPrefix("/auth").Subrouter()
 	authRouter.HandleFunc("/register", authHandler.Register).Methods(http.MethodPost)
 	authRouter.HandleFunc("/login", authHandler.Login).Methods(http.MethodPost)
-
-	// 创建 AuthMiddleware 实例
-	authMW := middleware.AuthMiddleware(cfg.Auth.JWTSecretKey, tokenBlacklistService)
+	authRouter.HandleFunc("/refresh", authHandler.RefreshHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/2fa/verify", twoFactorHandler.VerifyLoginHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/oidc", oidcHandler.GetConfigHandler).Methods(http.MethodGet)
+	authRouter.HandleFunc("/oidc/authorize", oidcHandler.AuthorizeHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/oidc/callback", oidcHandler.CallbackHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/verify-email", accountHandler.VerifyEmailHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/password-reset", accountHandler.RequestPasswordResetHandler).Methods(http.MethodPost)
+	authRouter.HandleFunc("/password-reset/confirm", accountHandler.ConfirmPasswordResetHandler).Methods(http.MethodPost)
+	// 验证 JWT 所需的公钥，ChatServer 等服务从这里获取
+	r.HandleFunc("/.well-known/jwks.json", jwksHandler.GetJWKSHandler).Methods(http.MethodGet)
+
+	// 创建 AuthMiddleware 实例，机器人的 API Key 只能访问下面用 middleware.AllowAPIKey 声明的路由
+	authMW := middleware.AuthMiddleware(keyManager, tokenBlacklistService, botService)
 
 	// 7.2 API 子路由 (需要认证)
 	apiRouter := r.PathPrefix("/api/v1").Subrouter()
@@ -137,32 +244,106 @@ func main() {
 	// 确保 authHandler 已经初始化并且 LogoutHandler 可以工作
 	// 如果 AuthHandler 自身需要 tokenBlacklistService (例如在 NewAuthHandler 中注入)，请确保已完成
 	apiRouter.HandleFunc("/auth/logout", authHandler.LogoutHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/auth/ws-ticket", authHandler.WSTicketHandler).Methods(http.MethodPost)
+	// 登录会话管理路由
+	apiRouter.HandleFunc("/sessions", sessionHandler.ListSessionsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/sessions", sessionHandler.RevokeAllSessionsHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/sessions/{sessionID:[0-9]+}", sessionHandler.RevokeSessionHandler).Methods(http.MethodDelete)
 
 	// 用户路由
 	apiRouter.HandleFunc("/users/me", userHandler.GetMyProfileHandler).Methods(http.MethodGet)
 	apiRouter.HandleFunc("/users/me", userHandler.UpdateMyProfileHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/users/me/email-verification", accountHandler.ResendEmailVerificationHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/2fa", twoFactorHandler.GetStatusHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/users/me/2fa/totp", twoFactorHandler.BeginEnrollmentHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/2fa/totp/confirm", twoFactorHandler.ConfirmEnrollmentHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodesHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/2fa/disable", twoFactorHandler.DisableHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/identities", oidcHandler.ListIdentitiesHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/users/me/identities/oidc", oidcHandler.LinkHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/blocks", privacyHandler.ListBlockedUsersHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/users/me/blocks", privacyHandler.BlockUserHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/users/me/blocks/{userID:[0-9]+}", privacyHandler.UnblockUserHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/users/me/privacy", privacyHandler.GetPrivacySettingsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/users/me/privacy", privacyHandler.UpdatePrivacySettingsHandler).Methods(http.MethodPut)
 	apiRouter.HandleFunc("/users/search", userHandler.SearchUsersHandler).Methods(http.MethodGet)
+	// 登录用户查看其他用户的资料，未被对方拉黑时可以看到在线状态
+	apiRouter.HandleFunc("/users/{userID:[0-9]+}", userHandler.GetUserProfileHandler).Methods(http.MethodGet)
+	// 机器人和 API Key 管理路由
+	apiRouter.HandleFunc("/bots", botHandler.CreateBotHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/bots", botHandler.ListBotsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/keys", botHandler.CreateAPIKeyHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/keys", botHandler.ListAPIKeysHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/keys/{keyID:[0-9]+}", botHandler.RevokeAPIKeyHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/commands", botHandler.SetCommandsHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/commands", botHandler.ListCommandsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/webhooks", webhookHandler.CreateBotWebhookHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/bots/{botID:[0-9]+}/webhooks", webhookHandler.ListBotWebhooksHandler).Methods(http.MethodGet)
+	// Webhook 路由 (群组和机器人共用)
+	apiRouter.HandleFunc("/webhooks/{webhookID:[0-9]+}", webhookHandler.UpdateWebhookHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/webhooks/{webhookID:[0-9]+}", webhookHandler.DeleteWebhookHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/webhooks/{webhookID:[0-9]+}/deliveries", webhookHandler.ListDeliveriesHandler).Methods(http.MethodGet)
 	// 联系人/好友路由 (ADDED)
-	apiRouter.HandleFunc("/friends", friendReqHandler.ListFriendsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/friends", contactHandler.ListFriendsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/friends/tags", contactHandler.ListTagsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/friends/suggestions", contactHandler.SuggestFriendsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/friends/{userID:[0-9]+}", contactHandler.UpdateFriendHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/friends/{userID:[0-9]+}", friendReqHandler.RemoveFriendHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/contact-groups", contactHandler.ListContactGroupsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/contact-groups", contactHandler.CreateContactGroupHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/contact-groups/{groupID:[0-9]+}", contactHandler.RenameContactGroupHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/contact-groups/{groupID:[0-9]+}", contactHandler.DeleteContactGroupHandler).Methods(http.MethodDelete)
 	// 会话路由
-	apiRouter.HandleFunc("/conversations", convoHandler.GetUserConversationsHandler).Methods(http.MethodGet)
+	apiRouter.Handle("/conversations", middleware.AllowAPIKey(models.ScopeConversationsRead, convoHandler.GetUserConversationsHandler)).Methods(http.MethodGet)
 	apiRouter.HandleFunc("/conversations/private", convoHandler.CreateOrGetPrivateConversationHandler).Methods(http.MethodPost)
-	apiRouter.HandleFunc("/conversations/{conversationID:[0-9]+}/messages", convoHandler.GetConversationMessagesHandler).Methods(http.MethodGet)
+	apiRouter.Handle("/conversations/{conversationID:[0-9]+}/messages", middleware.AllowAPIKey(models.ScopeMessagesRead, convoHandler.GetConversationMessagesHandler)).Methods(http.MethodGet)
+	apiRouter.Handle("/conversations/{conversationID:[0-9]+}/messages", middleware.AllowAPIKey(models.ScopeMessagesSend, convoHandler.SendMessageHandler)).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/conversations/{conversationID:[0-9]+}/pins", convoHandler.ListPinnedMessagesHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/conversations/{conversationID:[0-9]+}/pins", convoHandler.PinMessageHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/conversations/{conversationID:[0-9]+}/pins/{messageID:[0-9]+}", convoHandler.UnpinMessageHandler).Methods(http.MethodDelete)
+	apiRouter.HandleFunc("/messages/{messageID:[0-9]+}/recall", convoHandler.RecallMessageHandler).Methods(http.MethodPost)
 	// 群组路由
 	apiRouter.HandleFunc("/groups", groupHandler.CreateGroupHandler).Methods(http.MethodPost)
 	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/join", groupHandler.JoinGroupHandler).Methods(http.MethodPost)
 	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/leave", groupHandler.LeaveGroupHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}", groupHandler.UpdateGroupInfoHandler).Methods(http.MethodPut)
 	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/members", groupHandler.GetGroupMembersHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/members", groupHandler.InviteMemberHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/members/batch", groupHandler.InviteMembersHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/members/{userID:[0-9]+}/role", groupHandler.UpdateMemberRoleHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/transfer", groupHandler.TransferOwnershipHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/permissions", groupHandler.GetGroupPermissionsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/permissions", groupHandler.UpdateGroupPermissionsHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/slow-mode", groupHandler.SetSlowModeHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/announcement", groupHandler.GetAnnouncementHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/announcement", groupHandler.SetAnnouncementHandler).Methods(http.MethodPut)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/announcement/ack", groupHandler.AckAnnouncementHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/announcement/acks", groupHandler.ListAnnouncementAcksHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/webhooks", webhookHandler.CreateGroupWebhookHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/groups/{groupID:[0-9]+}/webhooks", webhookHandler.ListGroupWebhooksHandler).Methods(http.MethodGet)
 	apiRouter.HandleFunc("/groups/{id:[0-9]+}/fix-participants", groupHandler.FixGroupConversationParticipants).Methods(http.MethodPost)
+	// 频道路由
+	apiRouter.HandleFunc("/channels", channelHandler.CreateChannelHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/channels", channelHandler.GetUserChannelsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/channels/search", channelHandler.SearchPublicChannelsHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/channels/{channelID:[0-9]+}", channelHandler.GetChannelHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/channels/{channelID:[0-9]+}/subscribe", channelHandler.SubscribeChannelHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/channels/{channelID:[0-9]+}/unsubscribe", channelHandler.UnsubscribeChannelHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/channels/{channelID:[0-9]+}/admins/{userID:[0-9]+}", channelHandler.SetChannelAdminHandler).Methods(http.MethodPut)
 	// 文件上传路由 (New)
 	apiRouter.HandleFunc("/upload", uploadHandler.UploadFileHandler).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/attachments/{attachmentID:[0-9]+}", uploadHandler.GetAttachmentHandler).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/attachments/{attachmentID:[0-9]+}/download", uploadHandler.DownloadAttachmentHandler).Methods(http.MethodGet, http.MethodHead)
+	apiRouter.HandleFunc("/attachments/{attachmentID:[0-9]+}/signed-url", uploadHandler.SignAttachmentURLHandler).Methods(http.MethodPost)
 
 	// 好友请求路由
 	friendRequestRouter := apiRouter.PathPrefix("/friend-requests").Subrouter() // Create subrouter for friend requests
 	friendRequestRouter.HandleFunc("", friendReqHandler.SendFriendRequestHandler).Methods(http.MethodPost)
 	friendRequestRouter.HandleFunc("/pending", friendReqHandler.ListPendingRequestsHandler).Methods(http.MethodGet)
+	friendRequestRouter.HandleFunc("/sent", friendReqHandler.ListOutgoingRequestsHandler).Methods(http.MethodGet)
 	friendRequestRouter.HandleFunc("/{requestID:[0-9]+}/accept", friendReqHandler.AcceptFriendRequestHandler).Methods(http.MethodPost)
 	friendRequestRouter.HandleFunc("/{requestID:[0-9]+}/reject", friendReqHandler.RejectFriendRequestHandler).Methods(http.MethodPost)
+	friendRequestRouter.HandleFunc("/{requestID:[0-9]+}/cancel", friendReqHandler.CancelFriendRequestHandler).Methods(http.MethodPost)
 
 	// 7.3 公开路由 (不需要认证)
 	// 获取其他用户公开信息
@@ -172,13 +353,8 @@ func main() {
 	// 获取公开群组详情
 	r.HandleFunc("/groups/{groupID:[0-9]+}", groupHandler.GetGroupDetailsHandler).Methods(http.MethodGet)
 
-	// 7.4 静态文件服务路由 (New) - 用于访问上传的文件
-	if cfg.Storage.Type == "local" {
-		staticPath := strings.TrimSuffix(storageBaseURL, "/") + "/"
-		localDir := http.Dir(cfg.Storage.LocalPath)
-		r.PathPrefix(staticPath).Handler(http.StripPrefix(staticPath, http.FileServer(localDir)))
-		log.Printf("提供静态文件服务于 %s -> %s", staticPath, cfg.Storage.LocalPath)
-	}
+	// 7.4 签名的附件下载链接，由链接中的签名授权
+	r.HandleFunc("/files/{attachmentID:[0-9]+}", uploadHandler.SignedDownloadHandler).Methods(http.MethodGet, http.MethodHead)
 
 	// 7.5 静态文件服务路由 (前端应用) - ADDED
 	frontendBuildPath := "./site/dist" // ADJUST THIS to where your frontend build output is
@@ -210,29 +386,85 @@ func main() {
 	})
 	log.Printf("为前端应用提供静态文件服务，根路径指向 %s/index.html", frontendBuildPath)
 
-	// 8. 初始化并启动 Kafka 消费者 (用于处理 FriendRequest)
+	// 8. 启动发件箱转发器，并初始化 Kafka 消费者 (把好友请求事件推送给相关用户)
+	consumerCtx, cancelConsumers := context.WithCancel(context.Background())
+	defer cancelConsumers()
+
+	outboxRelay := services.NewOutboxRelay(storage.NewGormOutboxRepository(db), kfkProducer, cfg.Outbox)
+	go outboxRelay.Run(consumerCtx)
+	// 邮箱验证和找回密码的邮件在后台发送
+	go accountService.Run(consumerCtx)
+
+	// 8.0 定期把超过有效期的待处理好友请求标记为已过期
+	if cfg.FriendRequest.PendingTTL > 0 && cfg.FriendRequest.ExpirySweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.FriendRequest.ExpirySweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-consumerCtx.Done():
+					return
+				case <-ticker.C:
+					expired, err := friendReqService.ExpireStaleRequests(consumerCtx)
+					if err != nil {
+						log.Printf("清理过期好友请求失败: %v", err)
+					}
+					if expired > 0 {
+						log.Printf("已将 %d 条好友请求标记为已过期", expired)
+					}
+				}
+			}
+		}()
+	}
+
 	friendReqConsumer, err := appKafka.NewConfluentKafkaConsumer(cfg.Kafka)
 	if err != nil {
 		log.Fatalf("无法创建好友请求 Kafka 消费者: %v", err)
 	}
 	defer friendReqConsumer.Close()
-
-	consumerCtx, cancelConsumers := context.WithCancel(context.Background())
-	defer cancelConsumers()
+	friendReqEventHandler := kafkahandlers.NewFriendRequestEventHandler(friendReqService)
 
 	go func() {
 		topics := []string{cfg.Kafka.FriendRequestTopic}
 		log.Printf("Kafka 好友请求消费者启动，监听 topic: %s, GroupID: %s", cfg.Kafka.FriendRequestTopic, cfg.Kafka.ConsumerGroup)
-		err := friendReqConsumer.Consume(consumerCtx, topics, cfg.Kafka.ConsumerGroup, friendReqService.ProcessFriendRequest)
+		err := friendReqConsumer.Consume(consumerCtx, topics, cfg.Kafka.ConsumerGroup, appKafka.RetryHandler(friendReqEventHandler.Handle, eventHandlerAttempts, eventHandlerBackoff))
 		if err != nil && !errors.Is(err, context.Canceled) {
 			log.Printf("Kafka 好友请求消费者错误: %v", err)
 		}
 		log.Println("Kafka 好友请求消费者 goroutine 已停止。")
 	}()
 
+	// 8.1 启动 Webhook 投递：从广播主题和出站主题生成投递记录，并定期投递到期的记录
+	if cfg.Webhook.Enabled {
+		webhookDispatcher := services.NewWebhookDispatcher(webhookRepo, convoRepo, cfg.Webhook)
+
+		webhookConsumer, err := appKafka.NewConfluentKafkaConsumer(cfg.Kafka)
+		if err != nil {
+			log.Fatalf("无法创建 Webhook Kafka 消费者: %v", err)
+		}
+		defer webhookConsumer.Close()
+
+		go func() {
+			topics := []string{cfg.Kafka.BroadcastTopic, cfg.Kafka.WebSocketOutgoingTopic}
+			handler := func(ctx context.Context, msg *confluentKafka.Message) error {
+				if msg.TopicPartition.Topic != nil && *msg.TopicPartition.Topic == cfg.Kafka.WebSocketOutgoingTopic {
+					return webhookDispatcher.HandleOutgoing(ctx, msg)
+				}
+				return webhookDispatcher.HandleBroadcast(ctx, msg)
+			}
+			err := webhookConsumer.Consume(consumerCtx, topics, cfg.Webhook.ConsumerGroup, appKafka.RetryHandler(handler, eventHandlerAttempts, eventHandlerBackoff))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("Webhook Kafka 消费者错误: %v", err)
+			}
+			log.Println("Webhook Kafka 消费者 goroutine 已停止。")
+		}()
+		go webhookDispatcher.Run(consumerCtx)
+		log.Printf("Webhook 投递已启动，消费组: %s", cfg.Webhook.ConsumerGroup)
+	}
+
 	// 添加修复命令
 	if len(os.Args) > 1 && os.Args[1] == "fix-group-conversations" {
-		fixGroupConversations(db)
+		fixGroupConversations(db, messageService)
 		return
 	}
 
@@ -296,7 +528,8 @@ func main() {
 }
 
 // 修复群组会话参与者
-func fixGroupConversations(db *gorm.DB) {
+// notifier 通知正在运行的 ChatServer 丢弃补充了参与者的会话的成员缓存。
+func fixGroupConversations(db *gorm.DB, notifier services.MembershipChangeNotifier) {
 	ctx := context.Background()
 
 	// 初始化存储库
@@ -304,7 +537,8 @@ func fixGroupConversations(db *gorm.DB) {
 	convoRepo := storage.NewGormConversationRepository(db)
 
 	// 初始化服务
-	convoService := services.NewConversationService(convoRepo, userRepo)
+	// 修复群组会话参与者不涉及私聊，不需要隐私检查
+	convoService := services.NewConversationService(convoRepo, userRepo, storage.NewGormChannelRepository(db), nil, notifier)
 
 	// 获取所有群组
 	var groups []models.Group
@@ -15,6 +15,7 @@ import (
 
 	confluentKafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 
+	"im-go/internal/auth"
 	"im-go/internal/config"
 	"im-go/internal/handlers/chatserver"
 	appKafka "im-go/internal/kafka"
@@ -68,6 +69,14 @@ func main() {
 	// 3.6 初始化 TokenBlacklist 服务 (NEW)
 	tokenBlacklistService := appRedis.NewRedisTokenBlacklist(redisClient)
 
+	// 3.7 初始化 JWT 验证公钥：从 API 服务器的 JWKS 拉取，ChatServer 不再需要签名密钥
+	var tokenKeys auth.KeySet
+	if cfg.Auth.JWTSigningAlgorithm == auth.AlgorithmHS256 {
+		tokenKeys = auth.NewHMACKeyManager(cfg.Auth.JWTSecretKey)
+	} else {
+		tokenKeys = auth.NewRemoteKeySet(cfg.Auth.JWKSURL, cfg.Auth.JWKSRefreshInterval)
+	}
+
 	// 4. 初始化 Kafka Producer
 	kfkProducer, err := appKafka.NewConfluentKafkaProducer(cfg.Kafka)
 	if err != nil {
@@ -79,12 +88,27 @@ func main() {
 	// 5. 初始化 Repositories (MessageService 需要)
 	msgRepo := storage.NewGormMessageRepository(db)
 	convoRepo := storage.NewGormConversationRepository(db)
-	userRepo := storage.NewGormUserRepository(db) // UserService 可能被 WebSocketHandler 使用
+	userRepo := storage.NewGormUserRepository(db)   // UserService 可能被 WebSocketHandler 使用
+	groupRepo := storage.NewGormGroupRepository(db) // 群聊发言权限校验需要
+	pinRepo := storage.NewGormPinnedMessageRepository(db)
+	channelRepo := storage.NewGormChannelRepository(db) // 连接建立时加载用户订阅的频道
+	webhookRepo := storage.NewGormWebhookRepository(db) // 斜杠命令投递给机器人的 Webhook
+	botCommandRepo := storage.NewGormBotCommandRepository(db)
+	privacyRepo := storage.NewGormPrivacyRepository(db) // 私聊消息的拉黑和隐私设置检查
 
 	// 6. 初始化 Services
 	// ChatServer 主要关注 MessageService，其他服务按需添加
-	messageService := services.NewMessageService(msgRepo, convoRepo, kfkProducer, cfg)
-	userService := services.NewUserService(userRepo) // WebSocketHandler 可能用它来获取用户信息
+	groupPermissions := services.NewGroupPermissionChecker(groupRepo)
+	sendGuard := services.NewSendRateGuard(appRedis.NewRedisRateLimiter(redisClient), convoRepo, groupRepo, groupPermissions, cfg.RateLimit)
+	commandRouter := services.NewCommandRouter(botCommandRepo, webhookRepo, userRepo, cfg.Webhook)
+	// 命令和按钮回调在独立的工作池中调用机器人，不阻塞入站消息的消费
+	commandWorkers := services.NewCommandWorkerPool(cfg.Webhook.CommandWorkers, cfg.Webhook.CommandQueueSize)
+	privacyService := services.NewPrivacyService(privacyRepo, userRepo, storage.NewGormFriendshipRepository(db), storage.NewGormFriendRequestRepository(db), msgRepo)
+	messageService := services.NewMessageService(msgRepo, convoRepo, pinRepo, kfkProducer, groupPermissions, sendGuard, commandRouter, commandWorkers, privacyService, cfg)
+	userService := services.NewUserService(userRepo, privacyService) // WebSocketHandler 可能用它来获取用户信息
+	channelService := services.NewChannelService(channelRepo, convoRepo, kfkProducer, cfg)
+	// 群聊广播在本实例展开时使用的成员缓存
+	membershipCache := services.NewConversationMembershipCache(convoRepo, time.Duration(cfg.WebSocket.MembershipCacheTTLSeconds)*time.Second)
 
 	// 7. 初始化 WebSocket Hub
 	hub := websocket.NewHub()
@@ -92,7 +116,8 @@ func main() {
 	log.Println("WebSocket Hub 已启动。")
 
 	// 8. 初始化 WebSocket Handler
-	wsHandler := chatserver.NewWebSocketHandler(hub, messageService, userService, cfg, tokenBlacklistService)
+	wsAuthService := services.NewWSAuthService(appRedis.NewRedisWSTicketStore(redisClient), tokenKeys, tokenBlacklistService, cfg.WebSocket)
+	wsHandler := chatserver.NewWebSocketHandler(hub, messageService, userService, channelService, wsAuthService, cfg)
 
 	// 9. 初始化 Kafka 消费者 (用于处理入站消息)
 	inboundConsumer, err := appKafka.NewConfluentKafkaConsumer(cfg.Kafka)
@@ -108,10 +133,22 @@ func main() {
 	}
 	defer outboundConsumer.Close()
 
+	// 9.1.1 初始化 Kafka 消费者 (用于处理广播消息)
+	// 每个实例使用独立的消费者组，确保所有 ChatServer 都能收到全部广播，再各自投递给本地连接。
+	// 广播只对当前连接有意义：消费者从最新位置开始且不提交位移，新实例或重启后不会重放主题中的旧广播。
+	broadcastConsumer, err := appKafka.NewConfluentKafkaFanoutConsumer(cfg.Kafka)
+	if err != nil {
+		log.Fatalf("无法创建广播 Kafka 消费者: %v", err)
+	}
+	defer broadcastConsumer.Close()
+	broadcastGroup := broadcastConsumerGroup(cfg.Kafka.BroadcastConsumerGroup)
+
 	// 为 Kafka 消费者创建可以取消的上下文
 	consumerCtx, cancelConsumers := context.WithCancel(context.Background())
 	defer cancelConsumers()
 
+	go commandWorkers.Run(consumerCtx)
+
 	// 9.2 启动入站消息消费者 Goroutine
 	go func() {
 		log.Printf("Kafka 入站消费者 goroutine 启动，监听 topic: %s", cfg.Kafka.MessagesTopic)
@@ -150,6 +187,52 @@ func main() {
 		log.Println("Kafka 出站消费者 goroutine 已停止。")
 	}()
 
+	// 9.4 启动广播消费者 Goroutine
+	go func() {
+		log.Printf("Kafka 广播消费者 goroutine 启动，监听 topic: %s, GroupID: %s", cfg.Kafka.BroadcastTopic, broadcastGroup)
+		topicsToConsume := []string{cfg.Kafka.BroadcastTopic}
+		if err := broadcastConsumer.Consume(consumerCtx, topicsToConsume, broadcastGroup,
+			func(ctx context.Context, kafkaMsg *confluentKafka.Message) error {
+				var envelope imtypes.BroadcastEnvelope
+				if err := json.Unmarshal(kafkaMsg.Value, &envelope); err != nil {
+					log.Printf("错误: 无法从 Kafka 反序列化广播信封: %v, 原始值: %s", err, string(kafkaMsg.Value))
+					return nil
+				}
+				switch envelope.Kind {
+				case imtypes.BroadcastMessage:
+					if envelope.Message != nil {
+						hub.PublishToTopic(envelope.Topic, envelope.Message, envelope.ExcludeUserID)
+					}
+				case imtypes.BroadcastConversation:
+					if envelope.Message == nil {
+						return nil
+					}
+					members, err := membershipCache.Members(ctx, envelope.ConversationID)
+					if err != nil {
+						log.Printf("错误: 无法展开会话 %d 的广播消息: %v", envelope.ConversationID, err)
+						return nil
+					}
+					hub.DeliverToUsers(members, envelope.Message, envelope.ExcludeUserID)
+				case imtypes.BroadcastMembership:
+					membershipCache.Invalidate(envelope.ConversationID)
+				case imtypes.BroadcastSessionRevoked:
+					hub.DisconnectSession(envelope.UserID, envelope.SessionID)
+				case imtypes.BroadcastSubscription:
+					if envelope.Subscribed {
+						hub.SubscribeTopics(envelope.UserID, envelope.Topic)
+					} else {
+						hub.UnsubscribeTopics(envelope.UserID, envelope.Topic)
+					}
+				default:
+					log.Printf("警告: 未知的广播类型: %s", envelope.Kind)
+				}
+				return nil
+			}); err != nil {
+			log.Printf("Kafka 广播消费者错误: %v", err)
+		}
+		log.Println("Kafka 广播消费者 goroutine 已停止。")
+	}()
+
 	// 10. 配置 HTTP 服务器路由
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws/chat", wsHandler.ServeWS)
@@ -184,3 +267,12 @@ func main() {
 	}
 	log.Println("Chat 服务器已优雅关闭。")
 }
+
+// broadcastConsumerGroup 为当前实例生成独立的广播消费者组名 (前缀 + 主机名)。
+func broadcastConsumerGroup(prefix string) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = fmt.Sprintf("pid-%d", os.Getpid())
+	}
+	return fmt.Sprintf("%s-%s", prefix, hostname)
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// remoteKeySetMinRefresh 是遇到未知 kid 时重新拉取 JWKS 的最小间隔，避免伪造的 kid 造成请求风暴。
+const remoteKeySetMinRefresh = 10 * time.Second
+
+// JWK 是 RFC 7517 中的一个公钥，只包含 RSA 和 Ed25519 (OKP) 所需的字段。
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS 是 /.well-known/jwks.json 返回的公钥集合。
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK 将签名密钥的公钥部分编码为 JWK。
+func NewJWK(key *SigningKey) (JWK, error) {
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return JWK{}, fmt.Errorf("密钥 %s 的公钥类型 %T 不能发布为 JWK", key.ID, key.PublicKey)
+	}
+	return jwk, nil
+}
+
+// VerificationKey 将 JWK 还原为只含公钥的 SigningKey。
+// JWK 未声明 alg 时按密钥类型推断 (RSA 为 RS256，Ed25519 为 EdDSA)。
+func (k JWK) VerificationKey() (*SigningKey, error) {
+	key := &SigningKey{ID: k.KeyID, Algorithm: k.Algorithm}
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("解析 JWK %s 的模数失败: %w", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("解析 JWK %s 的指数失败: %w", k.KeyID, err)
+		}
+		key.PublicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.Algorithm == "" {
+			key.Algorithm = AlgorithmRS256
+		}
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("JWK %s 的曲线 %s 不受支持", k.KeyID, k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWK %s 的 Ed25519 公钥无效", k.KeyID)
+		}
+		key.PublicKey = ed25519.PublicKey(x)
+		if key.Algorithm == "" {
+			key.Algorithm = AlgorithmEdDSA
+		}
+	default:
+		return nil, fmt.Errorf("JWK %s 的类型 %s 不受支持", k.KeyID, k.KeyType)
+	}
+	return key, nil
+}
+
+// remoteKeySet 是从远端 JWKS 地址拉取公钥的 KeySet，用于只需要验证令牌的服务 (如 ChatServer)。
+type remoteKeySet struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*SigningKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewRemoteKeySet 创建一个从 url 拉取 JWKS 的 KeySet。公钥缓存 refreshInterval，
+// 遇到未知的 kid (例如签发方刚轮换了密钥) 时会提前重新拉取。
+func NewRemoteKeySet(url string, refreshInterval time.Duration) KeySet {
+	return &remoteKeySet{
+		url:             url,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]*SigningKey),
+	}
+}
+
+// VerificationKey 返回 kid 对应的公钥。
+func (s *remoteKeySet) VerificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	key, fresh := s.lookup(kid)
+	if key == nil || !fresh {
+		if err := s.refresh(ctx, key == nil); err != nil && key == nil {
+			return nil, err
+		}
+		key, _ = s.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSigningKey, kid)
+	}
+	if err := checkKeyAlgorithm(key, alg); err != nil {
+		return nil, err
+	}
+	return key.PublicKey, nil
+}
+
+// lookup 查找缓存中的公钥，并返回缓存是否仍在有效期内。
+func (s *remoteKeySet) lookup(kid string) (*SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[kid], time.Since(s.fetchedAt) < s.refreshInterval
+}
+
+// refresh 重新拉取 JWKS。unknownKID 为 true 时受最小间隔限制。
+func (s *remoteKeySet) refresh(ctx context.Context, unknownKID bool) error {
+	s.mu.Lock()
+	if unknownKID && time.Since(s.lastAttempt) < remoteKeySetMinRefresh {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: JWKS 刚刚拉取过", ErrUnknownSigningKey)
+	}
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("创建 JWKS 请求失败: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("拉取 JWKS 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("拉取 JWKS 失败: 状态码 %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("解析 JWKS 失败: %w", err)
+	}
+	keys := make(map[string]*SigningKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.VerificationKey()
+		if err != nil {
+			continue // 忽略不支持的密钥类型，其余密钥仍然可用
+		}
+		keys[key.ID] = key
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
@@ -16,23 +16,40 @@ import (
 type Claims struct {
 	UserID   uint   `json:"userId"`
 	Username string `json:"username"`
+	// SessionID 是签发该令牌的登录会话，会话被吊销后其名下所有未过期的令牌一并失效。
+	SessionID uint `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 为指定用户生成一个新的 JWT。
-// jwtKey 是用于签发令牌的密钥。
-// expiry 是令牌的有效期。
-func GenerateToken(userID uint, username string, authCfg config.AuthConfig) (string, error) {
+// SessionRevocationID 返回会话吊销标记在黑名单中使用的 ID。
+// 会话被吊销时该 ID 会被加入黑名单，使该会话此前签发、尚未过期的访问令牌全部失效。
+func SessionRevocationID(sessionID uint) string {
+	return fmt.Sprintf("session:%d", sessionID)
+}
+
+// GenerateToken 为指定用户的登录会话生成一个新的 JWT，同时返回其 Claims (包含 JTI 和过期时间)。
+// 令牌使用 keys 的当前签名密钥签发，非对称密钥会在令牌头中写入 kid；authCfg 提供令牌的有效期。
+func GenerateToken(ctx context.Context, userID uint, username string, sessionID uint, authCfg config.AuthConfig, keys KeyManager) (string, *Claims, error) {
+	signingKey, err := keys.CurrentSigningKey(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("获取签名密钥失败: %w", err)
+	}
+	method := jwt.GetSigningMethod(signingKey.Algorithm)
+	if method == nil {
+		return "", nil, fmt.Errorf("不支持的签名算法: %s", signingKey.Algorithm)
+	}
+
 	// 生成 JWT ID (jti)
 	jwtID, err := uuid.NewRandom()
 	if err != nil {
-		return "", fmt.Errorf("生成 JWT ID 失败: %w", err)
+		return "", nil, fmt.Errorf("生成 JWT ID 失败: %w", err)
 	}
 
 	expirationTime := time.Now().Add(authCfg.JWTExpiry)
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			ID:        jwtID.String(), // 设置 JTI
@@ -41,28 +58,29 @@ func GenerateToken(userID uint, username string, authCfg config.AuthConfig) (str
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(authCfg.JWTSecretKey))
+	token := jwt.NewWithClaims(method, claims)
+	if signingKey.ID != "" {
+		token.Header["kid"] = signingKey.ID
+	}
+	tokenString, err := token.SignedString(signingKey.PrivateKey)
 	if err != nil {
-		return "", fmt.Errorf("生成 JWT 失败: %w", err)
+		return "", nil, fmt.Errorf("生成 JWT 失败: %w", err)
 	}
-	return tokenString, nil
+	return tokenString, claims, nil
 }
 
 // ValidateToken 验证给定的 JWT 字符串的有效性。
 // 如果令牌有效，它会返回 Claims。否则返回错误。
-// jwtKey 是用于验证令牌签名的密钥。
+// keys 按令牌头中的 kid 提供验证签名的密钥。
 // blacklist 是用于检查 Token 是否已被吊销的实例。
-func ValidateToken(ctx context.Context, tokenString string, jwtKey string, blacklist TokenBlacklist) (*Claims, error) {
+func ValidateToken(ctx context.Context, tokenString string, keys KeySet, blacklist TokenBlacklist) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// 确保签名算法是我们期望的
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("非预期的签名算法: %v", token.Header["alg"])
-		}
-		return []byte(jwtKey), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		// 由 KeySet 校验算法与密钥一致，确保签名算法是我们期望的
+		return keys.VerificationKey(ctx, kid, token.Method.Alg())
+	}, jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}))
 
 	if err != nil {
 		return nil, fmt.Errorf("解析或验证 JWT 失败: %w", err)
@@ -87,6 +105,15 @@ func ValidateToken(ctx context.Context, tokenString string, jwtKey string, black
 		if isRevoked {
 			return nil, fmt.Errorf("JWT 已被吊销")
 		}
+		if claims.SessionID != 0 {
+			isRevoked, err = blacklist.IsBlacklisted(ctx, SessionRevocationID(claims.SessionID))
+			if err != nil {
+				return nil, fmt.Errorf("检查会话吊销状态失败: %w", err)
+			}
+			if isRevoked {
+				return nil, fmt.Errorf("登录会话已被吊销")
+			}
+		}
 	}
 
 	return claims, nil
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// 支持的 JWT 签名算法。
+const (
+	AlgorithmHS256 = "HS256" // 共享密钥，仅用于兼容旧部署
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// rsaKeyBits 是新生成的 RSA 签名密钥长度。
+const rsaKeyBits = 2048
+
+// ErrUnknownSigningKey 表示令牌的 kid 不对应任何有效的验证密钥 (密钥不存在或已过期下线)。
+var ErrUnknownSigningKey = errors.New("未知的签名密钥")
+
+// SigningKey 是一把带 kid 的签名密钥。
+// PrivateKey 为 *rsa.PrivateKey、ed25519.PrivateKey 或 HS256 的 []byte；
+// PublicKey 为对应的 *rsa.PublicKey、ed25519.PublicKey (HS256 时与 PrivateKey 相同)。
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// KeySet 提供验证 JWT 签名所需的公钥，按令牌头中的 kid 选择。
+type KeySet interface {
+	// VerificationKey 返回 kid 对应的验证密钥。密钥的算法与 alg 不一致时返回错误，防止算法混淆攻击。
+	VerificationKey(ctx context.Context, kid, alg string) (interface{}, error)
+}
+
+// KeyManager 在 KeySet 的基础上提供当前签名密钥和对外发布的 JWKS，由签发令牌的 API 服务器使用。
+type KeyManager interface {
+	KeySet
+	// CurrentSigningKey 返回用于签发新令牌的密钥。
+	CurrentSigningKey(ctx context.Context) (*SigningKey, error)
+	// JWKS 返回所有仍可用于验证的公钥。
+	JWKS(ctx context.Context) (*JWKS, error)
+}
+
+// GenerateSigningKey 按算法生成一把新的非对称签名密钥，kid 为随机 UUID。
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	key := &SigningKey{ID: uuid.NewString(), Algorithm: algorithm}
+	switch algorithm {
+	case AlgorithmRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("生成 RSA 密钥失败: %w", err)
+		}
+		key.PrivateKey, key.PublicKey = privateKey, &privateKey.PublicKey
+	case AlgorithmEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("生成 Ed25519 密钥失败: %w", err)
+		}
+		key.PrivateKey, key.PublicKey = privateKey, publicKey
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+	return key, nil
+}
+
+// EncodePrivateKeyPEM 将私钥编码为 PKCS#8 PEM，用于持久化。
+func EncodePrivateKeyPEM(privateKey interface{}) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("编码私钥失败: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ParseSigningKeyPEM 从 PKCS#8 PEM 还原签名密钥，并校验其类型与算法一致。
+func ParseSigningKeyPEM(kid, algorithm, privateKeyPEM string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("密钥 %s 的 PEM 格式无效", kid)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析密钥 %s 失败: %w", kid, err)
+	}
+
+	key := &SigningKey{ID: kid, Algorithm: algorithm, PrivateKey: parsed}
+	switch privateKey := parsed.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("密钥 %s 的类型与算法 %s 不匹配", kid, algorithm)
+		}
+		key.PublicKey = &privateKey.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("密钥 %s 的类型与算法 %s 不匹配", kid, algorithm)
+		}
+		key.PublicKey = privateKey.Public().(ed25519.PublicKey)
+	default:
+		return nil, fmt.Errorf("密钥 %s 的类型 %T 不受支持", kid, parsed)
+	}
+	return key, nil
+}
+
+// checkKeyAlgorithm 校验令牌声明的算法与密钥算法一致。
+func checkKeyAlgorithm(key *SigningKey, alg string) error {
+	if key.Algorithm != alg {
+		return fmt.Errorf("令牌算法 %s 与密钥 %s 的算法 %s 不一致", alg, key.ID, key.Algorithm)
+	}
+	return nil
+}
+
+// hmacKeyManager 是使用单一共享密钥 (HS256) 的 KeyManager，用于兼容未迁移到非对称签名的部署。
+type hmacKeyManager struct {
+	key *SigningKey
+}
+
+// NewHMACKeyManager 创建一个使用共享密钥 HS256 签名的 KeyManager。该模式下不发布 JWKS。
+func NewHMACKeyManager(secret string) KeyManager {
+	return &hmacKeyManager{key: &SigningKey{
+		Algorithm:  AlgorithmHS256,
+		PrivateKey: []byte(secret),
+		PublicKey:  []byte(secret),
+	}}
+}
+
+// VerificationKey 返回共享密钥。HS256 令牌不带 kid。
+func (m *hmacKeyManager) VerificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	if err := checkKeyAlgorithm(m.key, alg); err != nil {
+		return nil, err
+	}
+	return m.key.PublicKey, nil
+}
+
+// CurrentSigningKey 返回共享密钥。
+func (m *hmacKeyManager) CurrentSigningKey(ctx context.Context) (*SigningKey, error) {
+	return m.key, nil
+}
+
+// JWKS 共享密钥不能公开，返回空集合。
+func (m *hmacKeyManager) JWKS(ctx context.Context) (*JWKS, error) {
+	return &JWKS{Keys: []JWK{}}, nil
+}
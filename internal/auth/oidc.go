@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"im-go/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcJWKSRefreshInterval 是身份提供方公钥的缓存时间，遇到未知 kid 时会提前刷新。
+	oidcJWKSRefreshInterval = time.Hour
+	// oidcDiscoveryRetryInterval 是发现文档拉取失败后重试的最小间隔。
+	oidcDiscoveryRetryInterval = 10 * time.Second
+)
+
+var (
+	// ErrOIDCStateNotFound 表示登录状态不存在、已过期或已被使用。
+	ErrOIDCStateNotFound = errors.New("OIDC 登录状态无效或已过期")
+	// ErrOIDCTokenInvalid 表示身份提供方返回的 ID Token 校验失败。
+	ErrOIDCTokenInvalid = errors.New("OIDC ID Token 无效")
+)
+
+// OIDCLoginState 是发起授权请求时保存、回调时取回的一次性状态，以 state 参数为键。
+type OIDCLoginState struct {
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	// LinkUserID 非零时表示已登录用户发起的关联操作，回调成功后外部身份关联到该用户。
+	LinkUserID uint `json:"linkUserId,omitempty"`
+}
+
+// OIDCStateStore 定义了 OIDC 登录状态的存储接口，状态只能取出一次。
+type OIDCStateStore interface {
+	Save(ctx context.Context, state string, data *OIDCLoginState, ttl time.Duration) error
+	// Consume 取出并删除状态，不存在时返回 ErrOIDCStateNotFound。
+	Consume(ctx context.Context, state string) (*OIDCLoginState, error)
+}
+
+// OIDCIdentity 是从 ID Token 中取出的外部身份信息。
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Picture           string
+}
+
+// oidcClaims 是 ID Token 中使用到的声明。
+type oidcClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// oidcDiscovery 是 /.well-known/openid-configuration 中使用到的字段。
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse 是令牌端点的响应。
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// OIDCProvider 是 OpenID Connect 身份提供方的客户端，实现授权码模式 + PKCE。
+// 端点和公钥在第一次使用时通过发现文档获取，提供方暂时不可用不影响服务启动。
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        KeySet
+	lastAttempt time.Time
+}
+
+// NewOIDCProvider 创建一个新的 OIDCProvider。
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer 返回提供方的 issuer 标识，用于区分外部身份的来源。
+func (p *OIDCProvider) Issuer() string {
+	return p.cfg.IssuerURL
+}
+
+// AuthCodeURL 返回跳转到提供方的授权地址，codeChallenge 为 PKCE 的 S256 挑战值。
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, _, err := p.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange 使用授权码和 PKCE 校验值换取 ID Token，校验其签名、issuer、audience、有效期和 nonce。
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	discovery, keys, err := p.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("创建 OIDC 令牌请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 OIDC 令牌端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+	var tokenResp oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("解析 OIDC 令牌响应失败 (状态码 %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResp.Error != "" {
+		return nil, fmt.Errorf("OIDC 令牌端点返回错误 (状态码 %d): %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("%w: 令牌响应中没有 id_token", ErrOIDCTokenInvalid)
+	}
+
+	claims := &oidcClaims{}
+	_, err = jwt.ParseWithClaims(tokenResp.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keys.VerificationKey(ctx, kid, token.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCTokenInvalid, err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce 不匹配", ErrOIDCTokenInvalid)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少 sub", ErrOIDCTokenInvalid)
+	}
+
+	return &OIDCIdentity{
+		Issuer:            discovery.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+		Picture:           claims.Picture,
+	}, nil
+}
+
+// load 返回缓存的发现文档和公钥集合，尚未获取时拉取发现文档。
+func (p *OIDCProvider) load(ctx context.Context) (*oidcDiscovery, KeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+	if time.Since(p.lastAttempt) < oidcDiscoveryRetryInterval {
+		return nil, nil, fmt.Errorf("OIDC 身份提供方暂时不可用")
+	}
+	p.lastAttempt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建 OIDC 发现请求失败: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("拉取 OIDC 发现文档失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("拉取 OIDC 发现文档失败: 状态码 %d", resp.StatusCode)
+	}
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, nil, fmt.Errorf("解析 OIDC 发现文档失败: %w", err)
+	}
+	// OpenID Connect Discovery 1.0 第 4.3 节：issuer 必须与请求的地址完全一致
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, nil, fmt.Errorf("OIDC 发现文档的 issuer %q 与配置 %q 不一致", discovery.Issuer, p.cfg.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("OIDC 发现文档缺少必要的端点")
+	}
+
+	p.discovery = &discovery
+	p.keys = NewRemoteKeySet(discovery.JWKSURI, oidcJWKSRefreshInterval)
+	return p.discovery, p.keys, nil
+}
+
+// NewPKCEVerifier 生成 PKCE 校验值及其 S256 挑战值 (RFC 7636)。
+func NewPKCEVerifier() (verifier, challenge string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("生成 PKCE 校验值失败: %w", err)
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
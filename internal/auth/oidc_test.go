@@ -0,0 +1,131 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/auth/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testUser = oidctest.User{
+	Subject:           "user-1",
+	Email:             "alice@example.com",
+	EmailVerified:     true,
+	Name:              "Alice",
+	PreferredUsername: "alice",
+}
+
+// beginAuthorization 像 OIDCService.BeginLogin 一样生成 PKCE 校验值和 nonce 并构造授权地址。
+func beginAuthorization(t *testing.T, provider *auth.OIDCProvider) (authURL, verifier, nonce string) {
+	t.Helper()
+	verifier, challenge, err := auth.NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce = "nonce-" + t.Name()
+	authURL, err = provider.AuthCodeURL(context.Background(), "state-"+t.Name(), nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	return authURL, verifier, nonce
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	provider := auth.NewOIDCProvider(issuer.Config())
+
+	authURL, verifier, nonce := beginAuthorization(t, provider)
+	u, _ := url.Parse(authURL)
+	if scope := u.Query().Get("scope"); scope != "openid email profile" {
+		t.Errorf("scope = %q", scope)
+	}
+	code, _ := issuer.Authorize(t, authURL, testUser)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := auth.OIDCIdentity{
+		Issuer:            issuer.URL(),
+		Subject:           testUser.Subject,
+		Email:             testUser.Email,
+		EmailVerified:     true,
+		Name:              testUser.Name,
+		PreferredUsername: testUser.PreferredUsername,
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+	if provider.Issuer() != issuer.URL() {
+		t.Errorf("Issuer() = %q, want %q", provider.Issuer(), issuer.URL())
+	}
+}
+
+func TestOIDCProviderExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	provider := auth.NewOIDCProvider(issuer.Config())
+
+	authURL, _, nonce := beginAuthorization(t, provider)
+	code, _ := issuer.Authorize(t, authURL, testUser)
+	otherVerifier, _, _ := auth.NewPKCEVerifier()
+
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, nonce); err == nil {
+		t.Fatal("PKCE 校验值不匹配时应返回错误")
+	}
+}
+
+func TestOIDCProviderExchangeRejectsReusedCode(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	provider := auth.NewOIDCProvider(issuer.Config())
+
+	authURL, verifier, nonce := beginAuthorization(t, provider)
+	code, _ := issuer.Authorize(t, authURL, testUser)
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Fatal("授权码重复使用时应返回错误")
+	}
+}
+
+func TestOIDCProviderExchangeRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		nonce string // 为空时使用授权请求中的 nonce
+		opt   oidctest.ClaimsOption
+	}{
+		{name: "nonce mismatch", nonce: "other-nonce"},
+		{name: "wrong issuer", opt: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", opt: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{name: "expired", opt: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "missing exp", opt: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "missing sub", opt: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(t)
+			provider := auth.NewOIDCProvider(issuer.Config())
+
+			authURL, verifier, nonce := beginAuthorization(t, provider)
+			var opts []oidctest.ClaimsOption
+			if tt.opt != nil {
+				opts = append(opts, tt.opt)
+			}
+			code, _ := issuer.Authorize(t, authURL, testUser, opts...)
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if !errors.Is(err, auth.ErrOIDCTokenInvalid) {
+				t.Fatalf("err = %v, want ErrOIDCTokenInvalid", err)
+			}
+		})
+	}
+}
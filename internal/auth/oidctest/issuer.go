@@ -0,0 +1,237 @@
+// Package oidctest 提供一个进程内的 OpenID Connect 身份提供方，用于测试授权码模式 + PKCE 的登录流程。
+package oidctest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User 是在身份提供方登录的用户，决定 ID Token 中的声明。
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// ClaimsOption 在签名前修改 ID Token 的声明，用于构造无效的令牌。
+type ClaimsOption func(claims jwt.MapClaims)
+
+// Issuer 是一个提供发现文档、JWKS 和令牌端点的身份提供方。授权端点不提供页面，
+// 由 Authorize 模拟用户在提供方登录并同意授权。令牌端点校验客户端凭据、redirect_uri 和 PKCE 校验值，
+// 授权码只能使用一次。
+type Issuer struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	server *httptest.Server
+	key    *auth.SigningKey
+
+	mu            sync.Mutex
+	grants        map[string]*grant
+	nextCode      int
+	tokenRequests int
+}
+
+type grant struct {
+	redirectURI   string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+// NewIssuer 启动身份提供方，测试结束时关闭。
+func NewIssuer(t testing.TB) *Issuer {
+	t.Helper()
+	key, err := auth.GenerateSigningKey(auth.AlgorithmRS256)
+	if err != nil {
+		t.Fatalf("生成签名密钥失败: %v", err)
+	}
+	i := &Issuer{
+		ClientID:     "im-go-test",
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://localhost:3000/oidc/callback",
+		key:          key,
+		grants:       map[string]*grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("GET /jwks", i.jwks)
+	mux.HandleFunc("POST /token", i.token)
+	i.server = httptest.NewServer(mux)
+	t.Cleanup(i.server.Close)
+	return i
+}
+
+// URL 返回提供方的 issuer 标识。
+func (i *Issuer) URL() string {
+	return i.server.URL
+}
+
+// Config 返回连接到该提供方的单点登录配置。
+func (i *Issuer) Config() config.OIDCConfig {
+	return config.OIDCConfig{
+		Enabled:      true,
+		IssuerURL:    i.server.URL,
+		ClientID:     i.ClientID,
+		ClientSecret: i.ClientSecret,
+		RedirectURL:  i.RedirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		DisplayName:  "Test IdP",
+		StateTTL:     10 * time.Minute,
+	}
+}
+
+// TokenRequests 返回令牌端点收到的请求数。
+func (i *Issuer) TokenRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.tokenRequests
+}
+
+// Authorize 模拟 user 在授权地址上登录，返回重定向回客户端时带的授权码和 state。
+func (i *Issuer) Authorize(t testing.TB, authorizationURL string, user User, opts ...ClaimsOption) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatalf("解析授权地址失败: %v", err)
+	}
+	query := u.Query()
+	switch {
+	case u.Scheme+"://"+u.Host+u.Path != i.server.URL+"/authorize":
+		t.Fatalf("授权地址 %s 不属于该提供方", authorizationURL)
+	case query.Get("response_type") != "code":
+		t.Fatalf("response_type = %q, want code", query.Get("response_type"))
+	case query.Get("client_id") != i.ClientID:
+		t.Fatalf("client_id = %q, want %q", query.Get("client_id"), i.ClientID)
+	case query.Get("redirect_uri") != i.RedirectURL:
+		t.Fatalf("redirect_uri = %q, want %q", query.Get("redirect_uri"), i.RedirectURL)
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		t.Fatal("授权请求缺少 S256 PKCE 挑战值")
+	case query.Get("state") == "" || query.Get("nonce") == "":
+		t.Fatal("授权请求缺少 state 或 nonce")
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                i.server.URL,
+		"sub":                user.Subject,
+		"aud":                i.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              query.Get("nonce"),
+		"email":              user.Email,
+		"email_verified":     user.EmailVerified,
+		"name":               user.Name,
+		"preferred_username": user.PreferredUsername,
+	}
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.nextCode++
+	code = "code-" + strconv.Itoa(i.nextCode)
+	i.grants[code] = &grant{
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        claims,
+	}
+	return code, query.Get("state")
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.server.URL,
+		"authorization_endpoint": i.server.URL + "/authorize",
+		"token_endpoint":         i.server.URL + "/token",
+		"jwks_uri":               i.server.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, err := auth.NewJWK(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, auth.JWKS{Keys: []auth.JWK{jwk}})
+}
+
+// token 实现授权码换取令牌 (RFC 6749 4.1.3) 和 PKCE 校验 (RFC 7636 4.6)。
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.tokenRequests++
+
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != i.ClientID || clientSecret != i.ClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "客户端认证失败")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", r.PostForm.Get("grant_type"))
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	g, ok := i.grants[code]
+	if !ok {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "授权码无效或已使用")
+		return
+	}
+	delete(i.grants, code)
+	if r.PostForm.Get("redirect_uri") != g.redirectURI {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri 不匹配")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "PKCE 校验失败")
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, g.claims)
+	token.Header["kid"] = i.key.ID
+	idToken, err := token.SignedString(i.key.PrivateKey)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
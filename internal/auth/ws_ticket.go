@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWSTicketNotFound 表示 WebSocket 连接票据不存在、已过期或已被使用。
+var ErrWSTicketNotFound = errors.New("连接票据无效或已过期")
+
+// WSTicket 是 API 服务器为 WebSocket 连接签发的一次性票据所代表的身份，取自申请票据时使用的访问令牌。
+type WSTicket struct {
+	UserID    uint   `json:"userId"`
+	Username  string `json:"username"`
+	SessionID uint   `json:"sid,omitempty"`
+	// TokenID 和 ExpiresAt 是申请票据时所用访问令牌的 JTI 和过期时间，建立的连接与该令牌同时失效。
+	TokenID   string    `json:"jti"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// WSTicketStore 定义了 WebSocket 连接票据的存储接口，由 API 服务器写入、ChatServer 取出，票据只能取出一次。
+type WSTicketStore interface {
+	Save(ctx context.Context, ticket string, data *WSTicket, ttl time.Duration) error
+	// Consume 取出并删除票据，不存在时返回 ErrWSTicketNotFound。
+	Consume(ctx context.Context, ticket string) (*WSTicket, error)
+}
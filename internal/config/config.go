@@ -12,6 +12,10 @@ type APIServerConfig struct {
 	Host string     `mapstructure:"HOST"`
 	Port string     `mapstructure:"PORT"`
 	CORS CORSConfig `mapstructure:"CORS"` // ADDED: CORS configuration
+
+	// TrustedProxies 是部署在 API 服务器前的反向代理地址 (IP 或 CIDR)。
+	// 只有来自这些地址的请求才采用 X-Forwarded-For / X-Real-IP 中的客户端地址。
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
 }
 
 // ADDED: CORSConfig holds configuration for CORS.
@@ -31,6 +35,101 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"DB"`
 }
 
+// RateLimitConfig 定义了消息发送频率限制，计数保存在 Redis 中，对所有 ChatServer 节点生效。
+type RateLimitConfig struct {
+	MessagesPerWindow int `mapstructure:"MESSAGES_PER_WINDOW"` // 每个用户在一个窗口内最多可发送的消息数，<=0 表示不限制
+	WindowSeconds     int `mapstructure:"WINDOW_SECONDS"`      // 滑动窗口长度
+}
+
+// MailConfig 定义了系统邮件 (邮箱验证、找回密码) 的发送方式。
+type MailConfig struct {
+	Type    string     `mapstructure:"TYPE"` // "smtp"、"file" (写入 FILE_DIR) 或 "log" (只输出到日志)
+	From    string     `mapstructure:"FROM"`
+	FileDir string     `mapstructure:"FILE_DIR"`
+	SMTP    SMTPConfig `mapstructure:"SMTP"`
+	// LinkBaseURL 是邮件中链接指向的前端地址，例如 http://localhost:5173。
+	LinkBaseURL string `mapstructure:"LINK_BASE_URL"`
+	// Workers 和 QueueSize 限制后台发送邮件的并发数和排队数，队列已满时新的邮件请求被拒绝。
+	Workers   int `mapstructure:"WORKERS"`
+	QueueSize int `mapstructure:"QUEUE_SIZE"`
+}
+
+// OIDCConfig 定义了通过外部 OpenID Connect 身份提供方 (企业 SSO) 登录的配置。
+// 使用授权码模式 + PKCE，提供方的端点通过 IssuerURL 下的 /.well-known/openid-configuration 发现，
+// 因此也可以指向本地的模拟提供方用于开发和集成测试。
+type OIDCConfig struct {
+	Enabled      bool     `mapstructure:"ENABLED"`
+	IssuerURL    string   `mapstructure:"ISSUER_URL"`
+	ClientID     string   `mapstructure:"CLIENT_ID"`
+	ClientSecret string   `mapstructure:"CLIENT_SECRET"` // 公共客户端 (只使用 PKCE) 可以留空
+	RedirectURL  string   `mapstructure:"REDIRECT_URL"`  // 前端回调页面，需在提供方登记
+	Scopes       []string `mapstructure:"SCOPES"`
+	DisplayName  string   `mapstructure:"DISPLAY_NAME"` // 登录按钮上显示的名称
+	// AutoProvision 为 true 时，首次登录且无法关联到已有账号的外部身份会自动创建新用户。
+	AutoProvision bool `mapstructure:"AUTO_PROVISION"`
+	// LinkVerifiedEmail 为 true 时，提供方声明已验证的邮箱与本地已验证邮箱一致的外部身份会自动关联到该账号。
+	LinkVerifiedEmail bool `mapstructure:"LINK_VERIFIED_EMAIL"`
+	// StateTTL 是从跳转到提供方到回调完成的最长时间。
+	StateTTL time.Duration `mapstructure:"STATE_TTL"`
+}
+
+// WebhookConfig 定义了向外部 HTTP 端点投递群组和机器人事件 (Webhook) 的配置。
+// 事件从 Kafka 广播主题和出站主题中消费，投递失败按指数退避重试，投递记录保存在数据库中。
+type WebhookConfig struct {
+	Enabled       bool   `mapstructure:"ENABLED"`
+	ConsumerGroup string `mapstructure:"CONSUMER_GROUP"` // 所有 API 服务器实例共用，每个事件只处理一次
+	Workers       int    `mapstructure:"WORKERS"`        // 每个实例同时进行的投递数
+	// MaxAttempts 是每个事件的最大投递次数 (含第一次)，重试间隔从 RetryBaseDelay 开始翻倍，最长 RetryMaxDelay。
+	MaxAttempts    int           `mapstructure:"MAX_ATTEMPTS"`
+	RetryBaseDelay time.Duration `mapstructure:"RETRY_BASE_DELAY"`
+	RetryMaxDelay  time.Duration `mapstructure:"RETRY_MAX_DELAY"`
+	Timeout        time.Duration `mapstructure:"TIMEOUT"`       // 单次请求的超时时间
+	PollInterval   time.Duration `mapstructure:"POLL_INTERVAL"` // 检查到期重试的间隔
+	// CommandTimeout 是投递斜杠命令和按钮事件 (command.invoked、button.clicked) 的超时时间，超时不重试。
+	CommandTimeout time.Duration `mapstructure:"COMMAND_TIMEOUT"`
+	// 命令和按钮事件由每个 ChatServer 实例上的 CommandWorkers 个 goroutine 处理，最多 CommandQueueSize 个排队，
+	// 队列满时调用者会收到稍后重试的提示。
+	CommandWorkers   int `mapstructure:"COMMAND_WORKERS"`
+	CommandQueueSize int `mapstructure:"COMMAND_QUEUE_SIZE"`
+	// DisableAfterFailures 是端点被自动停用前允许的连续投递失败 (重试耗尽) 事件数，<=0 表示不自动停用。
+	DisableAfterFailures int `mapstructure:"DISABLE_AFTER_FAILURES"`
+	// AllowInsecureURLs 允许注册 http:// 端点，AllowPrivateNetworks 允许投递到回环和内网地址，仅用于本地开发。
+	AllowInsecureURLs    bool `mapstructure:"ALLOW_INSECURE_URLS"`
+	AllowPrivateNetworks bool `mapstructure:"ALLOW_PRIVATE_NETWORKS"`
+}
+
+// FriendRequestConfig 定义了好友请求的防骚扰限制和过期时间。
+type FriendRequestConfig struct {
+	MaxPerDay        int `mapstructure:"MAX_PER_DAY"`        // 每个用户 24 小时内最多发出的好友请求数 (不论之后是否被撤回或处理)，<=0 表示不限制
+	MaxMessageLength int `mapstructure:"MAX_MESSAGE_LENGTH"` // 附言的最大字符数
+	// PendingTTL 是待处理请求的有效期，超过后由后台任务标记为 expired，<=0 表示永不过期。
+	PendingTTL          time.Duration `mapstructure:"PENDING_TTL"`
+	ExpirySweepInterval time.Duration `mapstructure:"EXPIRY_SWEEP_INTERVAL"` // 检查过期请求的间隔
+}
+
+// OutboxConfig 定义了事务性发件箱的转发方式。业务数据和待发布的 Kafka 事件在同一个数据库事务中写入，
+// 由每个 API 服务器实例上的转发器定期取出并发布到 Kafka。
+type OutboxConfig struct {
+	PollInterval time.Duration `mapstructure:"POLL_INTERVAL"` // 检查待发布事件的间隔
+	BatchSize    int           `mapstructure:"BATCH_SIZE"`    // 每批取出的事件数
+	// MaxAttempts 是每个事件的最大发布次数 (含第一次)，重试间隔从 RetryBaseDelay 开始翻倍，最长 RetryMaxDelay。
+	MaxAttempts    int           `mapstructure:"MAX_ATTEMPTS"`
+	RetryBaseDelay time.Duration `mapstructure:"RETRY_BASE_DELAY"`
+	RetryMaxDelay  time.Duration `mapstructure:"RETRY_MAX_DELAY"`
+	// Retention 是已发布事件的保留时间，之后被清理；发布失败的事件保留以便排查。
+	Retention time.Duration `mapstructure:"RETENTION"`
+}
+
+// SMTPConfig holds configuration for the SMTP server.
+type SMTPConfig struct {
+	Host     string `mapstructure:"HOST"`
+	Port     int    `mapstructure:"PORT"`
+	Username string `mapstructure:"USERNAME"`
+	Password string `mapstructure:"PASSWORD"`
+	// Timeout 是一次发送 (连接、认证、投递) 的最长时间。
+	Timeout time.Duration `mapstructure:"TIMEOUT"`
+}
+
 // Config holds all configuration for the application.
 // The values are read by viper from a config file or environment variables.
 type Config struct {
@@ -45,6 +144,13 @@ type Config struct {
 	Auth       AuthConfig      `mapstructure:"AUTH"`
 	WebSocket  WebSocketConfig `mapstructure:"WEBSOCKET"`
 	Redis      RedisConfig     `mapstructure:"REDIS"` // ADDED RedisConfig
+	RateLimit  RateLimitConfig `mapstructure:"RATE_LIMIT"`
+	Mail       MailConfig      `mapstructure:"MAIL"`
+	OIDC       OIDCConfig      `mapstructure:"OIDC"`
+	Webhook    WebhookConfig   `mapstructure:"WEBHOOK"`
+	Outbox     OutboxConfig    `mapstructure:"OUTBOX"`
+
+	FriendRequest FriendRequestConfig `mapstructure:"FRIEND_REQUEST"`
 }
 
 // ServerConfig holds configuration for the HTTP server.
@@ -70,6 +176,8 @@ type KafkaConfig struct {
 	WebSocketOutgoingTopic string   `mapstructure:"WEBSOCKET_OUTGOING_TOPIC"` // 新增：用于服务端推向客户端的消息
 	ConsumerGroup          string   `mapstructure:"CONSUMER_GROUP"`           // ChatServer 主消费者组
 	FriendRequestTopic     string   `mapstructure:"FRIEND_REQUEST_TOPIC"`     // ADDED
+	BroadcastTopic         string   `mapstructure:"BROADCAST_TOPIC"`          // 一对多投递 (频道消息、订阅变更)，每个 ChatServer 实例都消费全部记录
+	BroadcastConsumerGroup string   `mapstructure:"BROADCAST_CONSUMER_GROUP"` // 广播消费者组前缀，实际组名会追加实例主机名；从最新位置开始且不提交位移，不会重放旧广播
 	Protocol               string   `mapstructure:"PROTOCOL"`
 	// 可以为 WebSocketOutgoingTopic 定义一个单独的消费者组，如果需要每个 ChatServer 实例都收到所有出站消息
 	// OutgoingConsumerGroup string   `mapstructure:"OUTGOING_CONSUMER_GROUP"`
@@ -92,6 +200,10 @@ type StorageConfig struct {
 	LocalPath     string   `mapstructure:"LOCAL_PATH"`
 	MaxFileSizeMB int64    `mapstructure:"MAX_FILE_SIZE_MB"`
 	S3            S3Config `mapstructure:"S3"`
+	// SignedURLSecret 是附件下载签名 URL 的 HMAC 密钥，至少 32 个字符，未配置时 API 服务器拒绝启动。
+	SignedURLSecret string `mapstructure:"SIGNED_URL_SECRET"`
+	// SignedURLExpiry 是附件下载签名 URL 的有效期。
+	SignedURLExpiry time.Duration `mapstructure:"SIGNED_URL_EXPIRY"`
 }
 
 // S3Config holds configuration for AWS S3.
@@ -101,12 +213,51 @@ type S3Config struct {
 	AccessKeyID     string `mapstructure:"ACCESS_KEY_ID"`
 	SecretAccessKey string `mapstructure:"SECRET_ACCESS_KEY"`
 	Endpoint        string `mapstructure:"ENDPOINT"` // For S3 compatible storage like MinIO
+	// UseSSL 在 Endpoint 没有写明 http:// 或 https:// 时决定是否使用 HTTPS。
+	UseSSL bool `mapstructure:"USE_SSL"`
+	// PartSizeMB 是分片上传每个分片的大小，超过该大小的文件使用分片上传，S3 要求至少 5 MB。
+	PartSizeMB int64 `mapstructure:"PART_SIZE_MB"`
+	// PresignExpiry 是下载文件时生成的预签名 URL 的有效期。
+	PresignExpiry time.Duration `mapstructure:"PRESIGN_EXPIRY"`
+	// CreateBucket 为 true 时在启动时创建不存在的存储桶，便于本地使用 MinIO 开发。
+	CreateBucket bool `mapstructure:"CREATE_BUCKET"`
 }
 
 // AuthConfig holds configuration for authentication (e.g., JWT).
 type AuthConfig struct {
 	JWTSecretKey string        `mapstructure:"JWT_SECRET_KEY"`
 	JWTExpiry    time.Duration `mapstructure:"JWT_EXPIRY"`
+	// RefreshTokenExpiry 是刷新令牌的有效期，每次刷新都会轮换令牌并重新计算有效期。
+	RefreshTokenExpiry time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRY"`
+	// JWTSigningAlgorithm 是签发 JWT 的算法：RS256、EdDSA，或仅用于兼容的 HS256 (使用 JWTSecretKey)。
+	JWTSigningAlgorithm string `mapstructure:"JWT_SIGNING_ALGORITHM"`
+	// JWTKeyRotationInterval 是非对称签名密钥的轮换周期，旧密钥在其签发的令牌过期前仍可用于验证。
+	JWTKeyRotationInterval time.Duration `mapstructure:"JWT_KEY_ROTATION_INTERVAL"`
+	// JWKSURL 是只验证令牌的服务 (ChatServer) 拉取公钥的地址，即 API 服务器的 /.well-known/jwks.json。
+	JWKSURL string `mapstructure:"JWKS_URL"`
+	// JWKSRefreshInterval 是 JWKS 公钥缓存的刷新周期，遇到未知 kid 时会提前刷新。
+	JWKSRefreshInterval time.Duration `mapstructure:"JWKS_REFRESH_INTERVAL"`
+	// EmailVerificationExpiry 和 PasswordResetExpiry 是邮件中一次性令牌的有效期。
+	EmailVerificationExpiry time.Duration `mapstructure:"EMAIL_VERIFICATION_EXPIRY"`
+	PasswordResetExpiry     time.Duration `mapstructure:"PASSWORD_RESET_EXPIRY"`
+
+	// TwoFactorChallengeExpiry 是开启两步验证的用户通过密码校验后，提交验证码的时限。
+	TwoFactorChallengeExpiry time.Duration `mapstructure:"TWO_FACTOR_CHALLENGE_EXPIRY"`
+	// TwoFactorMaxAttempts 是每个用户在 TwoFactorAttemptWindow 内最多可提交的验证码次数，<=0 表示不限制。
+	TwoFactorMaxAttempts   int           `mapstructure:"TWO_FACTOR_MAX_ATTEMPTS"`
+	TwoFactorAttemptWindow time.Duration `mapstructure:"TWO_FACTOR_ATTEMPT_WINDOW"`
+
+	// 登录防暴力破解，计数保存在 Redis 中，对所有 API 服务器实例生效。<=0 的次数表示不限制。
+	LoginMaxAttemptsPerIP   int           `mapstructure:"LOGIN_MAX_ATTEMPTS_PER_IP"`  // 每个 IP 在窗口内最多可尝试登录的次数 (不论成功与否)
+	LoginMaxFailures        int           `mapstructure:"LOGIN_MAX_FAILURES"`         // 每个登录标识 (用户名或邮箱) 在窗口内连续失败达到该次数后临时锁定
+	LoginDelayAfterFailures int           `mapstructure:"LOGIN_DELAY_AFTER_FAILURES"` // 失败超过该次数后，每次失败的响应按指数递增延迟
+	LoginAttemptWindow      time.Duration `mapstructure:"LOGIN_ATTEMPT_WINDOW"`
+	LoginLockoutDuration    time.Duration `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+
+	// 申请重置密码的频率限制，同样保存在 Redis 中。<=0 的次数表示不限制。
+	PasswordResetMaxPerEmail int           `mapstructure:"PASSWORD_RESET_MAX_PER_EMAIL"` // 每个邮箱在窗口内最多可申请的次数
+	PasswordResetMaxPerIP    int           `mapstructure:"PASSWORD_RESET_MAX_PER_IP"`    // 每个 IP 在窗口内最多可申请的次数
+	PasswordResetWindow      time.Duration `mapstructure:"PASSWORD_RESET_WINDOW"`
 }
 
 // WebSocketConfig holds configuration for WebSocket connections.
@@ -115,6 +266,12 @@ type WebSocketConfig struct {
 	PongWaitSeconds     int `mapstructure:"PONG_WAIT_SECONDS"`
 	PingPeriodSeconds   int `mapstructure:"PING_PERIOD_SECONDS"`
 	MaxMessageSizeBytes int `mapstructure:"MAX_MESSAGE_SIZE_BYTES"`
+	// MembershipCacheTTLSeconds 是 ChatServer 缓存会话成员列表 (用于展开群聊广播) 的最长时间，成员变更时会主动失效。
+	MembershipCacheTTLSeconds int `mapstructure:"MEMBERSHIP_CACHE_TTL_SECONDS"`
+	// TicketTTLSeconds 是 API 服务器签发的一次性连接票据的有效期。
+	TicketTTLSeconds int `mapstructure:"TICKET_TTL_SECONDS"`
+	// ReauthNoticeSeconds 是连接的访问令牌过期前多久提醒客户端重新认证，到期仍未认证的连接会被关闭。
+	ReauthNoticeSeconds int `mapstructure:"REAUTH_NOTICE_SECONDS"`
 }
 
 // LoadConfig reads configuration from file or environment variables.
@@ -143,6 +300,7 @@ func LoadConfig(path string) (config Config, err error) {
 	v.SetDefault("API_SERVER.CORS.EXPOSED_HEADERS", []string{"Content-Length"})
 	v.SetDefault("API_SERVER.CORS.ALLOW_CREDENTIALS", true)
 	v.SetDefault("API_SERVER.CORS.MAX_AGE", 300) // 5 minutes
+	v.SetDefault("API_SERVER.TRUSTED_PROXIES", []string{})
 
 	// Kafka Defaults
 	v.SetDefault("KAFKA.BROKERS", []string{"localhost:9092"})
@@ -153,6 +311,8 @@ func LoadConfig(path string) (config Config, err error) {
 	v.SetDefault("KAFKA.WEBSOCKET_OUTGOING_TOPIC", "im-websocket-outgoing")
 	v.SetDefault("KAFKA.CONSUMER_GROUP", "im-chat-server-group")
 	v.SetDefault("KAFKA.FRIEND_REQUEST_TOPIC", "im-friend-request")
+	v.SetDefault("KAFKA.BROADCAST_TOPIC", "im-conversation-broadcast")
+	v.SetDefault("KAFKA.BROADCAST_CONSUMER_GROUP", "im-chat-server-broadcast")
 
 	// Database Defaults (Example for PostgreSQL)
 	v.SetDefault("DATABASE.TYPE", "postgres")
@@ -167,21 +327,101 @@ func LoadConfig(path string) (config Config, err error) {
 	v.SetDefault("STORAGE.TYPE", "local")
 	v.SetDefault("STORAGE.LOCAL_PATH", "./uploads")
 	v.SetDefault("STORAGE.MAX_FILE_SIZE_MB", 100) // 100 MB
+	v.SetDefault("STORAGE.SIGNED_URL_EXPIRY", 10*time.Minute)
+	v.SetDefault("STORAGE.S3.REGION", "us-east-1")
+	v.SetDefault("STORAGE.S3.USE_SSL", true)
+	v.SetDefault("STORAGE.S3.PART_SIZE_MB", 16)
+	v.SetDefault("STORAGE.S3.PRESIGN_EXPIRY", 15*time.Minute)
+	v.SetDefault("STORAGE.S3.CREATE_BUCKET", false)
 
 	// Auth Defaults
 	v.SetDefault("AUTH.JWT_SECRET_KEY", "a_very_secret_key_that_should_be_changed")
 	v.SetDefault("AUTH.JWT_EXPIRY", 15*time.Minute) // 15 minutes
+	v.SetDefault("AUTH.REFRESH_TOKEN_EXPIRY", 30*24*time.Hour)
+	v.SetDefault("AUTH.JWT_SIGNING_ALGORITHM", "RS256")
+	v.SetDefault("AUTH.JWT_KEY_ROTATION_INTERVAL", 7*24*time.Hour)
+	v.SetDefault("AUTH.JWKS_URL", "http://localhost:8081/.well-known/jwks.json")
+	v.SetDefault("AUTH.JWKS_REFRESH_INTERVAL", 10*time.Minute)
+	v.SetDefault("AUTH.EMAIL_VERIFICATION_EXPIRY", 24*time.Hour)
+	v.SetDefault("AUTH.PASSWORD_RESET_EXPIRY", time.Hour)
+	v.SetDefault("AUTH.TWO_FACTOR_CHALLENGE_EXPIRY", 5*time.Minute)
+	v.SetDefault("AUTH.TWO_FACTOR_MAX_ATTEMPTS", 5)
+	v.SetDefault("AUTH.TWO_FACTOR_ATTEMPT_WINDOW", 15*time.Minute)
+	v.SetDefault("AUTH.LOGIN_MAX_ATTEMPTS_PER_IP", 50)
+	v.SetDefault("AUTH.LOGIN_MAX_FAILURES", 10)
+	v.SetDefault("AUTH.LOGIN_DELAY_AFTER_FAILURES", 3)
+	v.SetDefault("AUTH.LOGIN_ATTEMPT_WINDOW", 15*time.Minute)
+	v.SetDefault("AUTH.LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	v.SetDefault("AUTH.PASSWORD_RESET_MAX_PER_EMAIL", 3)
+	v.SetDefault("AUTH.PASSWORD_RESET_MAX_PER_IP", 20)
+	v.SetDefault("AUTH.PASSWORD_RESET_WINDOW", time.Hour)
+
+	// Mail Defaults (本地开发默认只把邮件输出到日志)
+	v.SetDefault("MAIL.TYPE", "log")
+	v.SetDefault("MAIL.FROM", "IM-Go <noreply@localhost>")
+	v.SetDefault("MAIL.FILE_DIR", "./mail")
+	v.SetDefault("MAIL.SMTP.PORT", 587)
+	v.SetDefault("MAIL.SMTP.TIMEOUT", 30*time.Second)
+	v.SetDefault("MAIL.LINK_BASE_URL", "http://localhost:5173")
+	v.SetDefault("MAIL.WORKERS", 4)
+	v.SetDefault("MAIL.QUEUE_SIZE", 100)
+
+	// OIDC Defaults (默认关闭)
+	v.SetDefault("OIDC.ENABLED", false)
+	v.SetDefault("OIDC.REDIRECT_URL", "http://localhost:5173/oidc/callback")
+	v.SetDefault("OIDC.SCOPES", []string{"openid", "profile", "email"})
+	v.SetDefault("OIDC.DISPLAY_NAME", "SSO")
+	v.SetDefault("OIDC.AUTO_PROVISION", true)
+	v.SetDefault("OIDC.LINK_VERIFIED_EMAIL", true)
+	v.SetDefault("OIDC.STATE_TTL", 10*time.Minute)
+
+	// Webhook Defaults
+	v.SetDefault("WEBHOOK.ENABLED", true)
+	v.SetDefault("WEBHOOK.CONSUMER_GROUP", "im-webhook-dispatcher")
+	v.SetDefault("WEBHOOK.WORKERS", 4)
+	v.SetDefault("WEBHOOK.MAX_ATTEMPTS", 6)
+	v.SetDefault("WEBHOOK.RETRY_BASE_DELAY", 10*time.Second)
+	v.SetDefault("WEBHOOK.RETRY_MAX_DELAY", time.Hour)
+	v.SetDefault("WEBHOOK.TIMEOUT", 10*time.Second)
+	v.SetDefault("WEBHOOK.COMMAND_TIMEOUT", 3*time.Second)
+	v.SetDefault("WEBHOOK.COMMAND_WORKERS", 16)
+	v.SetDefault("WEBHOOK.COMMAND_QUEUE_SIZE", 256)
+	v.SetDefault("WEBHOOK.POLL_INTERVAL", 5*time.Second)
+	v.SetDefault("WEBHOOK.DISABLE_AFTER_FAILURES", 5)
+	v.SetDefault("WEBHOOK.ALLOW_INSECURE_URLS", false)
+	v.SetDefault("WEBHOOK.ALLOW_PRIVATE_NETWORKS", false)
+
+	// Friend Request Defaults
+	v.SetDefault("FRIEND_REQUEST.MAX_PER_DAY", 30)
+	v.SetDefault("FRIEND_REQUEST.MAX_MESSAGE_LENGTH", 200)
+	v.SetDefault("FRIEND_REQUEST.PENDING_TTL", 30*24*time.Hour)
+	v.SetDefault("FRIEND_REQUEST.EXPIRY_SWEEP_INTERVAL", 10*time.Minute)
+
+	// Outbox Defaults
+	v.SetDefault("OUTBOX.POLL_INTERVAL", time.Second)
+	v.SetDefault("OUTBOX.BATCH_SIZE", 100)
+	v.SetDefault("OUTBOX.MAX_ATTEMPTS", 10)
+	v.SetDefault("OUTBOX.RETRY_BASE_DELAY", time.Second)
+	v.SetDefault("OUTBOX.RETRY_MAX_DELAY", 5*time.Minute)
+	v.SetDefault("OUTBOX.RETENTION", 24*time.Hour)
 
 	// ADDED: Redis Defaults
 	v.SetDefault("REDIS.ADDR", "localhost:6379")
 	v.SetDefault("REDIS.PASSWORD", "")
 	v.SetDefault("REDIS.DB", 0)
 
+	// Rate Limit Defaults
+	v.SetDefault("RATE_LIMIT.MESSAGES_PER_WINDOW", 20)
+	v.SetDefault("RATE_LIMIT.WINDOW_SECONDS", 10)
+
 	// WebSocket Defaults (values similar to existing constants)
 	v.SetDefault("WEBSOCKET.WRITE_WAIT_SECONDS", 10)
 	v.SetDefault("WEBSOCKET.PONG_WAIT_SECONDS", 60)
 	v.SetDefault("WEBSOCKET.PING_PERIOD_SECONDS", 54) // (60 * 9) / 10
 	v.SetDefault("WEBSOCKET.MAX_MESSAGE_SIZE_BYTES", 512)
+	v.SetDefault("WEBSOCKET.MEMBERSHIP_CACHE_TTL_SECONDS", 300)
+	v.SetDefault("WEBSOCKET.TICKET_TTL_SECONDS", 30)
+	v.SetDefault("WEBSOCKET.REAUTH_NOTICE_SECONDS", 60)
 
 	if path != "" {
 		v.SetConfigFile(path) // Path to look for the config file in.
@@ -0,0 +1,127 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+)
+
+// AccountHandler 封装了邮箱验证和找回密码相关的 HTTP 处理器方法。
+type AccountHandler struct {
+	accountService services.AccountService
+}
+
+// NewAccountHandler 创建一个新的 AccountHandler 实例。
+func NewAccountHandler(accountService services.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// VerifyEmailRequest 是确认邮箱的请求结构体。
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// PasswordResetRequest 是申请重置密码的请求结构体。
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// ConfirmPasswordResetRequest 是使用重置令牌设置新密码的请求结构体。
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// VerifyEmailHandler 使用邮件中的令牌确认邮箱。
+func (h *AccountHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, err := h.accountService.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidUserToken) {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+		} else {
+			writeJSONError(w, "验证邮箱失败", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "邮箱验证成功", "email": user.Email})
+}
+
+// ResendEmailVerificationHandler 重新向当前用户的邮箱发送验证邮件。
+func (h *AccountHandler) ResendEmailVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.accountService.SendEmailVerification(r.Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailNotSet):
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrEmailAlreadyVerified):
+			writeJSONError(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrMailQueueFull):
+			writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			writeJSONError(w, "发送验证邮件失败", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "验证邮件已发送"})
+}
+
+// RequestPasswordResetHandler 申请重置密码。无论邮箱是否存在都返回相同的响应。
+func (h *AccountHandler) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.accountService.RequestPasswordReset(r.Context(), req.Email, sessionClientInfo(r, "").IPAddress); err != nil {
+		var limitErr *services.AttemptLimitError
+		switch {
+		case errors.As(err, &limitErr):
+			w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+			writeJSONError(w, limitErr.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, services.ErrMailQueueFull):
+			writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			writeJSONError(w, "申请重置密码失败", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusAccepted, map[string]string{"message": "如果该邮箱已注册，重置密码的邮件将很快送达"})
+}
+
+// ConfirmPasswordResetHandler 使用重置令牌设置新密码，成功后所有登录会话失效。
+func (h *AccountHandler) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.accountService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidUserToken) || errors.Is(err, services.ErrPasswordTooShort) {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+		} else {
+			writeJSONError(w, "重置密码失败", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "密码已重置，请重新登录"})
+}
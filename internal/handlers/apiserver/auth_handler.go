@@ -3,7 +3,11 @@ package apiserver
 import (
 	"encoding/json"
 	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"im-go/internal/auth"       // Import for TokenBlacklist interface
 	"im-go/internal/middleware" // Import for GetClaimsFromContext
@@ -14,14 +18,20 @@ import (
 // AuthHandler 封装了认证相关的 HTTP 处理器方法。
 type AuthHandler struct {
 	AuthService    services.AuthService
-	TokenBlacklist auth.TokenBlacklist // Added TokenBlacklist service
+	SessionService services.SessionService
+	AccountService services.AccountService // 注册后发送邮箱验证邮件
+	TokenBlacklist auth.TokenBlacklist     // Added TokenBlacklist service
+	WSAuthService  services.WSAuthService  // 签发 WebSocket 连接票据
 }
 
 // NewAuthHandler 创建一个新的 AuthHandler 实例。
-func NewAuthHandler(authService services.AuthService, tokenBlacklist auth.TokenBlacklist) *AuthHandler {
+func NewAuthHandler(authService services.AuthService, sessionService services.SessionService, accountService services.AccountService, tokenBlacklist auth.TokenBlacklist, wsAuthService services.WSAuthService) *AuthHandler {
 	return &AuthHandler{
 		AuthService:    authService,
+		SessionService: sessionService,
+		AccountService: accountService,
 		TokenBlacklist: tokenBlacklist, // Store the injected service
+		WSAuthService:  wsAuthService,
 	}
 }
 
@@ -37,12 +47,60 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	UsernameOrEmail string `json:"username"` // 可以是用户名或邮箱
 	Password        string `json:"password"`
+	DeviceName      string `json:"deviceName,omitempty"` // 可选，显示在会话列表中
 }
 
-// LoginResponse 是成功登录后返回的结构体。
+// LoginResponse 是成功登录或刷新令牌后返回的结构体。
 type LoginResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"` // 返回一些用户信息，注意过滤敏感数据
+	Token                 string       `json:"token"`
+	ExpiresAt             time.Time    `json:"expiresAt"`
+	RefreshToken          string       `json:"refreshToken"`
+	RefreshTokenExpiresAt time.Time    `json:"refreshTokenExpiresAt"`
+	SessionID             uint         `json:"sessionId"`
+	User                  *models.User `json:"user"` // 返回一些用户信息，注意过滤敏感数据
+}
+
+// TwoFactorChallengeResponse 是开启了两步验证的用户通过密码校验后返回的结构体，
+// 客户端需将 ChallengeToken 和验证码提交到 /auth/2fa/verify 完成登录。
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired  bool      `json:"twoFactorRequired"`
+	ChallengeToken     string    `json:"challengeToken"`
+	ChallengeExpiresAt time.Time `json:"challengeExpiresAt"`
+}
+
+// RefreshTokenRequest 是刷新令牌请求的结构体。
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// newLoginResponse 根据签发的令牌构造登录响应。
+func newLoginResponse(tokens *services.AuthTokens, user *models.User) LoginResponse {
+	user.PasswordHash = "" // 清除敏感信息
+	return LoginResponse{
+		Token:                 tokens.AccessToken,
+		ExpiresAt:             tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		SessionID:             tokens.SessionID,
+		User:                  user,
+	}
+}
+
+// sessionClientInfo 从请求中提取客户端信息，用于记录到登录会话。
+func sessionClientInfo(r *http.Request, deviceName string) services.SessionClientInfo {
+	// 客户端地址由 middleware.ClientIPMiddleware 解析，只在请求来自受信任的代理时采用转发请求头
+	ip, ok := middleware.GetClientIPFromContext(r.Context())
+	if !ok {
+		ip = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	return services.SessionClientInfo{
+		DeviceName: deviceName,
+		IPAddress:  ip,
+		UserAgent:  r.UserAgent(),
+	}
 }
 
 // ErrorResponse 是 API 错误响应的通用结构体。
@@ -77,6 +135,13 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Email != "" {
+		// 验证邮件发送失败不影响注册，用户可以稍后重新发送
+		if err := h.AccountService.SendEmailVerification(r.Context(), user.ID); err != nil {
+			log.Printf("向用户 %d 发送邮箱验证邮件失败: %v", user.ID, err)
+		}
+	}
+
 	// 注册成功，可以考虑直接登录并返回token，或者仅返回成功信息
 	// 这里我们返回创建的用户信息（不含密码）
 	user.PasswordHash = "" // 清除敏感信息
@@ -97,21 +162,64 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.AuthService.Login(r.Context(), req.UsernameOrEmail, req.Password)
+	result, err := h.AuthService.Login(r.Context(), req.UsernameOrEmail, req.Password, sessionClientInfo(r, req.DeviceName))
 	if err != nil {
-		if errors.Is(err, services.ErrUserNotFound) || errors.Is(err, services.ErrInvalidCredentials) {
+		var limitErr *services.AttemptLimitError
+		var lockedErr *services.AccountLockedError
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
 			writeJSONError(w, "用户名或密码错误", http.StatusUnauthorized)
-		} else {
+		case errors.As(err, &limitErr):
+			w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+			writeJSONError(w, limitErr.Error(), http.StatusTooManyRequests)
+		case errors.As(err, &lockedErr):
+			w.Header().Set("Retry-After", strconv.Itoa(lockedErr.RetryAfterSeconds()))
+			writeJSONError(w, lockedErr.Error(), http.StatusTooManyRequests)
+		default:
 			writeJSONError(w, "登录失败", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	user.PasswordHash = "" // 清除敏感信息
-	writeJSONResponse(w, http.StatusOK, LoginResponse{Token: token, User: user})
+	if result.Challenge != nil {
+		writeJSONResponse(w, http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     result.Challenge.Token,
+			ChallengeExpiresAt: result.Challenge.ExpiresAt,
+		})
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newLoginResponse(result.Tokens, result.User))
+}
+
+// RefreshHandler 使用刷新令牌换取新的访问令牌，旧的刷新令牌随即失效。
+func (h *AuthHandler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		writeJSONError(w, "刷新令牌不能为空", http.StatusBadRequest)
+		return
+	}
+
+	tokens, user, err := h.SessionService.Refresh(r.Context(), req.RefreshToken, sessionClientInfo(r, ""))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			writeJSONError(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			writeJSONError(w, "刷新令牌失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, newLoginResponse(tokens, user))
 }
 
-// LogoutHandler 处理用户登出请求，将当前 Token 加入黑名单。
+// LogoutHandler 处理用户登出请求，将当前 Token 加入黑名单并结束其所属的登录会话。
 func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := middleware.GetClaimsFromContext(r.Context())
 	if !ok {
@@ -136,9 +244,38 @@ func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 结束登录会话，使其刷新令牌失效
+	if claims.SessionID != 0 {
+		if err := h.SessionService.RevokeSession(r.Context(), claims.UserID, claims.SessionID); err != nil {
+			log.Printf("登出时吊销会话 %d 失败: %v", claims.SessionID, err)
+		}
+	}
+
 	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "登出成功"})
 }
 
+// WSTicketHandler 为当前访问令牌签发一次性 WebSocket 连接票据。
+// 票据有效期很短且只能使用一次，建立的连接与签发票据时使用的访问令牌同时失效。
+func (h *AuthHandler) WSTicketHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证或无法解析用户声明", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := h.WSAuthService.IssueTicket(r.Context(), claims)
+	if err != nil {
+		if errors.Is(err, services.ErrWSCredentialsInvalid) {
+			writeJSONError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.Printf("为用户 %d 签发连接票据失败: %v", claims.UserID, err)
+		writeJSONError(w, "签发连接票据失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, ticket)
+}
+
 // writeJSONResponse 是一个辅助函数，用于发送 JSON 响应。
 func writeJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
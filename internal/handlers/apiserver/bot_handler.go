@@ -0,0 +1,273 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"im-go/internal/middleware"
+	"im-go/internal/models"
+	"im-go/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// maxAPIKeyExpiresInDays 是创建 API Key 时可以指定的最长有效天数。
+const maxAPIKeyExpiresInDays = 3650
+
+// BotHandler 封装了机器人和 API Key 管理相关的 HTTP 处理器方法。
+type BotHandler struct {
+	botService services.BotService
+}
+
+// NewBotHandler 创建一个新的 BotHandler 实例。
+func NewBotHandler(botService services.BotService) *BotHandler {
+	return &BotHandler{botService: botService}
+}
+
+// CreateBotRequest 是创建机器人的请求结构体。
+type CreateBotRequest struct {
+	Username  string `json:"username"`
+	Nickname  string `json:"nickname,omitempty"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
+	Bio       string `json:"bio,omitempty"`
+}
+
+// CreateAPIKeyRequest 是创建 API Key 的请求结构体。
+type CreateAPIKeyRequest struct {
+	Name          string               `json:"name"`
+	Scopes        []models.APIKeyScope `json:"scopes"`
+	ExpiresInDays int                  `json:"expiresInDays,omitempty"` // 0 表示不过期
+}
+
+// BotCommandRequest 是登记的一条斜杠命令。
+type BotCommandRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// SetBotCommandsRequest 是替换机器人斜杠命令的请求结构体。
+type SetBotCommandsRequest struct {
+	Commands []BotCommandRequest `json:"commands"`
+}
+
+// APIKeyResponse 是 API Key 的展示结构，不包含 Key 明文和哈希。
+type APIKeyResponse struct {
+	*models.APIKey
+	Scopes []models.APIKeyScope `json:"scopes"`
+}
+
+// CreateAPIKeyResponse 是创建 API Key 的响应，Key 明文只在这里返回一次。
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// CreateBotHandler 为当前用户创建一个机器人。
+func (h *BotHandler) CreateBotHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateBotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	bot, err := h.botService.CreateBot(r.Context(), userID, req.Username, req.Nickname, req.AvatarURL, req.Bio)
+	if err != nil {
+		writeBotError(w, err, "创建机器人失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, bot)
+}
+
+// ListBotsHandler 列出当前用户创建的机器人。
+func (h *BotHandler) ListBotsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	bots, err := h.botService.ListBots(r.Context(), userID)
+	if err != nil {
+		writeBotError(w, err, "获取机器人列表失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, bots)
+}
+
+// CreateAPIKeyHandler 为当前用户的机器人签发 API Key。
+func (h *BotHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPIKeyExpiresInDays {
+		writeJSONError(w, "expiresInDays 必须在 0 到 "+strconv.Itoa(maxAPIKeyExpiresInDays)+" 之间", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.botService.CreateAPIKey(r.Context(), userID, botID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		writeBotError(w, err, "创建 API Key 失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(created.APIKey),
+		Key:            created.Key,
+	})
+}
+
+// ListAPIKeysHandler 列出机器人的 API Key。
+func (h *BotHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+
+	keys, err := h.botService.ListAPIKeys(r.Context(), userID, botID)
+	if err != nil {
+		writeBotError(w, err, "获取 API Key 列表失败")
+		return
+	}
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, toAPIKeyResponse(key))
+	}
+	writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// RevokeAPIKeyHandler 吊销机器人的一个 API Key。
+func (h *BotHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+	keyID, ok := parseUintVar(w, r, "keyID", "无效的 API Key ID 格式")
+	if !ok {
+		return
+	}
+
+	if err := h.botService.RevokeAPIKey(r.Context(), userID, botID, keyID); err != nil {
+		writeBotError(w, err, "吊销 API Key 失败")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCommandsHandler 替换机器人登记的斜杠命令。
+func (h *BotHandler) SetCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+
+	var req SetBotCommandsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	commands := make([]*models.BotCommand, 0, len(req.Commands))
+	for _, command := range req.Commands {
+		commands = append(commands, &models.BotCommand{Name: command.Name, Description: command.Description})
+	}
+	saved, err := h.botService.SetCommands(r.Context(), userID, botID, commands)
+	if err != nil {
+		writeBotError(w, err, "保存机器人命令失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, saved)
+}
+
+// ListCommandsHandler 列出机器人登记的斜杠命令。
+func (h *BotHandler) ListCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+
+	commands, err := h.botService.ListCommands(r.Context(), userID, botID)
+	if err != nil {
+		writeBotError(w, err, "获取机器人命令失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, commands)
+}
+
+// toAPIKeyResponse 将 API Key 记录转换为展示结构。
+func toAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{APIKey: key, Scopes: key.ScopeList()}
+}
+
+// parseUintVar 解析路径参数，失败时写入 400 响应并返回 false。
+func parseUintVar(w http.ResponseWriter, r *http.Request, name, message string) (uint, bool) {
+	value, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		writeJSONError(w, message, http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(value), true
+}
+
+// writeBotError 将 BotService 的错误映射为 HTTP 响应。
+func writeBotError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, services.ErrBotNotFound), errors.Is(err, services.ErrAPIKeyNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrUserAlreadyExists):
+		writeJSONError(w, "用户名已存在", http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidBotUsername), errors.Is(err, services.ErrInvalidAPIKeyScope),
+		errors.Is(err, services.ErrAPIKeyNameRequired), errors.Is(err, services.ErrAPIKeyScopeRequired),
+		errors.Is(err, services.ErrInvalidBotCommand), errors.Is(err, services.ErrBotCommandLimit):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrBotLimitReached), errors.Is(err, services.ErrAPIKeyLimitReached),
+		errors.Is(err, services.ErrBotCannotOwnBots):
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("%s: %v", failure, err)
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,212 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ChannelHandler 封装了广播频道相关的 HTTP 处理器方法。
+type ChannelHandler struct {
+	channelService services.ChannelService
+}
+
+// NewChannelHandler 创建一个新的 ChannelHandler 实例。
+func NewChannelHandler(channelService services.ChannelService) *ChannelHandler {
+	return &ChannelHandler{channelService: channelService}
+}
+
+// writeChannelServiceError 根据频道服务返回的错误类型选择 HTTP 状态码。
+func writeChannelServiceError(w http.ResponseWriter, prefix string, err error, fallbackStatus int) {
+	status := fallbackStatus
+	switch {
+	case errors.Is(err, services.ErrChannelNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrChannelPermissionDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrChannelOwnerCannotLeave), errors.Is(err, services.ErrNotChannelSubscriber):
+		status = http.StatusConflict
+	}
+	writeJSONError(w, fmt.Sprintf("%s: %v", prefix, err), status)
+}
+
+// parseChannelID 从路径参数中解析频道ID。
+func parseChannelID(r *http.Request) (uint, error) {
+	channelID, err := strconv.ParseUint(mux.Vars(r)["channelID"], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(channelID), nil
+}
+
+// CreateChannelRequest 是创建频道的请求结构体。
+type CreateChannelRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+	IsPublic    bool   `json:"isPublic"`
+}
+
+// CreateChannelHandler 创建一个新的广播频道，创建者成为所有者和管理员。
+func (h *ChannelHandler) CreateChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	channel, err := h.channelService.CreateChannel(r.Context(), userID, req.Name, req.Description, req.AvatarURL, req.IsPublic)
+	if err != nil {
+		writeChannelServiceError(w, "创建频道失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, channel)
+}
+
+// GetChannelHandler 获取频道详情。
+func (h *ChannelHandler) GetChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := parseChannelID(r)
+	if err != nil {
+		writeJSONError(w, "无效的频道ID格式", http.StatusBadRequest)
+		return
+	}
+
+	channel, err := h.channelService.GetChannel(r.Context(), userID, channelID)
+	if err != nil {
+		writeChannelServiceError(w, "获取频道详情失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, channel)
+}
+
+// SearchPublicChannelsHandler 搜索公开频道。
+func (h *ChannelHandler) SearchPublicChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	channels, err := h.channelService.SearchPublicChannels(r.Context(), query, limit, offset)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("搜索频道失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, channels)
+}
+
+// GetUserChannelsHandler 获取当前用户订阅的频道列表。
+func (h *ChannelHandler) GetUserChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	channels, err := h.channelService.GetUserChannels(r.Context(), userID, 100, 0)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("获取订阅频道失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, channels)
+}
+
+// SubscribeChannelHandler 订阅频道。
+func (h *ChannelHandler) SubscribeChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := parseChannelID(r)
+	if err != nil {
+		writeJSONError(w, "无效的频道ID格式", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.channelService.Subscribe(r.Context(), userID, channelID); err != nil {
+		writeChannelServiceError(w, "订阅频道失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "订阅成功"})
+}
+
+// UnsubscribeChannelHandler 取消订阅频道。
+func (h *ChannelHandler) UnsubscribeChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := parseChannelID(r)
+	if err != nil {
+		writeJSONError(w, "无效的频道ID格式", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.channelService.Unsubscribe(r.Context(), userID, channelID); err != nil {
+		writeChannelServiceError(w, "取消订阅失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "已取消订阅"})
+}
+
+// SetChannelAdminRequest 是授予或撤销频道管理员的请求结构体。
+type SetChannelAdminRequest struct {
+	IsAdmin bool `json:"isAdmin"`
+}
+
+// SetChannelAdminHandler 授予或撤销订阅者的频道管理员 (发言) 权限，仅所有者可操作。
+func (h *ChannelHandler) SetChannelAdminHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := parseChannelID(r)
+	if err != nil {
+		writeJSONError(w, "无效的频道ID格式", http.StatusBadRequest)
+		return
+	}
+	targetID, err := strconv.ParseUint(mux.Vars(r)["userID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的用户ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req SetChannelAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.channelService.SetAdmin(r.Context(), userID, channelID, uint(targetID), req.IsAdmin); err != nil {
+		writeChannelServiceError(w, "设置频道管理员失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{"userId": targetID, "isAdmin": req.IsAdmin})
+}
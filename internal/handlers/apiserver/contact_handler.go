@@ -0,0 +1,218 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+)
+
+// ContactHandler handles HTTP requests for the friends list, friend remarks and tags, contact groups and friend suggestions.
+type ContactHandler struct {
+	contactService services.ContactService
+}
+
+// NewContactHandler creates a new ContactHandler.
+func NewContactHandler(contactService services.ContactService) *ContactHandler {
+	return &ContactHandler{contactService: contactService}
+}
+
+// ContactGroupPayload is the JSON body for creating or renaming a contact group.
+type ContactGroupPayload struct {
+	Name string `json:"name"`
+}
+
+// ListFriendsHandler handles GET /api/v1/friends?q=&tag=&contactGroupId=
+func (h *ContactHandler) ListFriendsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.FriendFilter{Query: query.Get("q"), Tag: query.Get("tag")}
+	if groupIDStr := query.Get("contactGroupId"); groupIDStr != "" {
+		groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
+		if err != nil {
+			writeJSONError(w, "无效的联系人分组ID格式", http.StatusBadRequest)
+			return
+		}
+		filter.ContactGroupID = uint(groupID)
+	}
+
+	friends, err := h.contactService.ListFriends(r.Context(), userID, filter)
+	if err != nil {
+		writeContactError(w, err, "获取好友列表失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, friends)
+}
+
+// UpdateFriendHandler handles PUT /api/v1/friends/{userID}
+func (h *ContactHandler) UpdateFriendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	friendID, ok := parseUintVar(w, r, "userID", "无效的用户ID格式")
+	if !ok {
+		return
+	}
+
+	var changes services.FriendProfileChanges
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	friend, err := h.contactService.UpdateFriend(r.Context(), userID, friendID, changes)
+	if err != nil {
+		writeContactError(w, err, "修改好友备注失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, friend)
+}
+
+// ListTagsHandler handles GET /api/v1/friends/tags
+func (h *ContactHandler) ListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	tags, err := h.contactService.ListTags(r.Context(), userID)
+	if err != nil {
+		writeContactError(w, err, "获取好友标签失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, tags)
+}
+
+// SuggestFriendsHandler handles GET /api/v1/friends/suggestions?limit=
+func (h *ContactHandler) SuggestFriendsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, "无效的 limit 参数", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	suggestions, err := h.contactService.SuggestFriends(r.Context(), userID, limit)
+	if err != nil {
+		writeContactError(w, err, "获取好友推荐失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, suggestions)
+}
+
+// ListContactGroupsHandler handles GET /api/v1/contact-groups
+func (h *ContactHandler) ListContactGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	groups, err := h.contactService.ListContactGroups(r.Context(), userID)
+	if err != nil {
+		writeContactError(w, err, "获取联系人分组失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, groups)
+}
+
+// CreateContactGroupHandler handles POST /api/v1/contact-groups
+func (h *ContactHandler) CreateContactGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	var payload ContactGroupPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	group, err := h.contactService.CreateContactGroup(r.Context(), userID, payload.Name)
+	if err != nil {
+		writeContactError(w, err, "创建联系人分组失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, group)
+}
+
+// RenameContactGroupHandler handles PUT /api/v1/contact-groups/{groupID}
+func (h *ContactHandler) RenameContactGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	groupID, ok := parseUintVar(w, r, "groupID", "无效的联系人分组ID格式")
+	if !ok {
+		return
+	}
+	var payload ContactGroupPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	group, err := h.contactService.RenameContactGroup(r.Context(), userID, groupID, payload.Name)
+	if err != nil {
+		writeContactError(w, err, "重命名联系人分组失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, group)
+}
+
+// DeleteContactGroupHandler handles DELETE /api/v1/contact-groups/{groupID}
+func (h *ContactHandler) DeleteContactGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	groupID, ok := parseUintVar(w, r, "groupID", "无效的联系人分组ID格式")
+	if !ok {
+		return
+	}
+	if err := h.contactService.DeleteContactGroup(r.Context(), userID, groupID); err != nil {
+		writeContactError(w, err, "删除联系人分组失败")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeContactError maps ContactService errors to HTTP responses.
+func writeContactError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, services.ErrNotFriends), errors.Is(err, services.ErrContactGroupNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrContactGroupExists):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidRemark), errors.Is(err, services.ErrInvalidFriendTags),
+		errors.Is(err, services.ErrInvalidContactGroupName):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", failure, err)
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
@@ -2,11 +2,16 @@ package apiserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"im-go/internal/imtypes"
 	"im-go/internal/middleware"
 	"im-go/internal/models"
 	"im-go/internal/services"
@@ -19,14 +24,16 @@ type ConversationHandler struct {
 	convoService   services.ConversationService
 	messageService services.MessageService // 用于获取会话消息
 	groupService   services.GroupService   // ADDED: For fetching group details
+	channelService services.ChannelService // 用于获取频道会话的名称、头像等
 }
 
 // NewConversationHandler 创建一个新的 ConversationHandler 实例。
-func NewConversationHandler(convoService services.ConversationService, messageService services.MessageService, groupService services.GroupService) *ConversationHandler {
+func NewConversationHandler(convoService services.ConversationService, messageService services.MessageService, groupService services.GroupService, channelService services.ChannelService) *ConversationHandler {
 	return &ConversationHandler{
 		convoService:   convoService,
 		messageService: messageService,
 		groupService:   groupService,
+		channelService: channelService,
 	}
 }
 
@@ -98,7 +105,7 @@ func (h *ConversationHandler) GetUserConversationsHandler(w http.ResponseWriter,
 					item["description"] = group.Description
 
 					// 获取群组成员数量
-					members, _ := h.groupService.GetGroupMembers(r.Context(), groupID, 1000, 0)
+					members, _ := h.groupService.GetGroupMembers(r.Context(), userID, groupID, 1000, 0)
 					if members != nil {
 						item["memberCount"] = len(members)
 					}
@@ -110,6 +117,18 @@ func (h *ConversationHandler) GetUserConversationsHandler(w http.ResponseWriter,
 				log.Printf("Group conversation %d has nil or invalid TargetID (GroupID)", convo.ID)
 				item["name"] = "Unknown Group"
 			}
+		} else if convo.Type == models.ChannelConversation {
+			item["targetId"] = convo.TargetID
+			channel, errChannelService := h.channelService.GetChannel(r.Context(), userID, convo.TargetID)
+			if errChannelService == nil && channel != nil {
+				item["name"] = channel.Name
+				item["avatar"] = channel.AvatarURL
+				item["description"] = channel.Description
+				item["subscriberCount"] = channel.SubscriberCount
+			} else {
+				log.Printf("Error fetching channel %d for convo %d: %v", convo.TargetID, convo.ID, errChannelService)
+				item["name"] = fmt.Sprintf("Channel %d", convo.TargetID)
+			}
 		}
 
 		if convo.LastMessageID != nil && *convo.LastMessageID > 0 {
@@ -161,6 +180,10 @@ func (h *ConversationHandler) CreateOrGetPrivateConversationHandler(w http.Respo
 	}
 
 	conversation, _, err := h.convoService.GetOrCreatePrivateConversation(r.Context(), userID, req.TargetId)
+	if errors.Is(err, services.ErrUserBlocked) || errors.Is(err, services.ErrPrivacyRestricted) {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		writeJSONError(w, fmt.Sprintf("获取或创建私聊会话失败: %v", err), http.StatusInternalServerError)
 		return
@@ -258,3 +281,223 @@ func (h *ConversationHandler) GetConversationMessagesHandler(w http.ResponseWrit
 	}
 	writeJSONResponse(w, http.StatusOK, messages)
 }
+
+// maxMessageContentLength 是通过 REST 接口发送的消息内容的最大字符数。
+const maxMessageContentLength = 4000
+
+// SendMessageRequest 是通过 REST 接口发送消息的请求结构体，供机器人等程序化调用方使用。
+type SendMessageRequest struct {
+	ID      string `json:"id,omitempty"`   // 客户端生成的消息ID (可选)
+	Type    string `json:"type,omitempty"` // 目前只支持 text，默认为 text
+	Content string `json:"content"`
+}
+
+// SendMessageHandler 向会话发送一条消息。消息与 WebSocket 发送的消息一样进入 Kafka 异步持久化和投递，
+// 因此成功时返回 202；超过发送频率限制或群组慢速模式时返回 429。
+func (h *ConversationHandler) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	conversationID, err := strconv.ParseUint(vars["conversationID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req SendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if req.Type == "" {
+		req.Type = string(models.TextMessageTypeDB)
+	}
+	if req.Type != string(models.TextMessageTypeDB) {
+		writeJSONError(w, "目前只支持发送 text 类型的消息", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeJSONError(w, "消息内容不能为空", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Content) > maxMessageContentLength {
+		writeJSONError(w, fmt.Sprintf("消息内容不能超过 %d 个字符", maxMessageContentLength), http.StatusBadRequest)
+		return
+	}
+
+	conversation, err := h.convoService.GetConversationDetails(r.Context(), uint(conversationID), userID)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("无权访问会话或会话不存在: %v", err), http.StatusForbidden)
+		return
+	}
+
+	// 私聊的接收者是另一位参与者，群聊和频道的接收者是群组或频道本身
+	receiverID := conversation.TargetID
+	if conversation.Type == models.PrivateConversation {
+		participants, err := h.convoService.GetConversationParticipants(r.Context(), conversation.ID)
+		if err != nil {
+			writeJSONError(w, fmt.Sprintf("获取会话参与者失败: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, p := range participants {
+			if p.UserID != userID {
+				receiverID = p.UserID
+			}
+		}
+	}
+
+	input := imtypes.RawMessageInput{
+		ID:             req.ID,
+		Type:           req.Type,
+		Content:        []byte(req.Content),
+		SenderID:       strconv.FormatUint(uint64(userID), 10),
+		ReceiverID:     strconv.FormatUint(uint64(receiverID), 10),
+		Timestamp:      time.Now(),
+		ConversationID: strconv.FormatUint(uint64(conversation.ID), 10),
+	}
+	if err := h.messageService.SendMessage(r.Context(), input); err != nil {
+		var rateErr *services.RateLimitError
+		if errors.As(err, &rateErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(rateErr.RetryAfterSeconds()))
+			writeJSONError(w, rateErr.Error(), http.StatusTooManyRequests)
+			return
+		}
+		log.Printf("用户 %d 通过 REST 接口向会话 %d 发送消息失败: %v", userID, conversation.ID, err)
+		writeJSONError(w, "发送消息失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+		"id":             req.ID,
+		"conversationId": conversation.ID,
+		"status":         "accepted",
+	})
+}
+
+// RecallMessageHandler 撤回一条消息。
+func (h *ConversationHandler) RecallMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	messageID, err := strconv.ParseUint(vars["messageID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的消息ID格式", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.messageService.RecallMessage(r.Context(), userID, uint(messageID))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMessageNotFound):
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, services.ErrMessageRecallDenied):
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		default:
+			writeJSONError(w, fmt.Sprintf("撤回消息失败: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, message)
+}
+
+// writePinError 将置顶相关的服务错误映射为 HTTP 状态码。
+func writePinError(w http.ResponseWriter, prefix string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound), errors.Is(err, services.ErrMessageNotPinned):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrMessageAlreadyPinned):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrNotConversationMember), errors.Is(err, services.ErrGroupPermissionDenied), errors.Is(err, services.ErrNotGroupMember):
+		status = http.StatusForbidden
+	}
+	writeJSONError(w, fmt.Sprintf("%s: %v", prefix, err), status)
+}
+
+// PinMessageRequest 是置顶消息的请求结构体。
+type PinMessageRequest struct {
+	MessageID uint `json:"messageId"`
+}
+
+// PinMessageHandler 置顶会话中的一条消息。
+func (h *ConversationHandler) PinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	conversationID, err := strconv.ParseUint(mux.Vars(r)["conversationID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req PinMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == 0 {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	pin, err := h.messageService.PinMessage(r.Context(), userID, uint(conversationID), req.MessageID)
+	if err != nil {
+		writePinError(w, "置顶消息失败", err)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, pin)
+}
+
+// UnpinMessageHandler 取消置顶会话中的一条消息。
+func (h *ConversationHandler) UnpinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	vars := mux.Vars(r)
+	conversationID, err := strconv.ParseUint(vars["conversationID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+		return
+	}
+	messageID, err := strconv.ParseUint(vars["messageID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的消息ID格式", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.messageService.UnpinMessage(r.Context(), userID, uint(conversationID), uint(messageID)); err != nil {
+		writePinError(w, "取消置顶失败", err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "已取消置顶"})
+}
+
+// ListPinnedMessagesHandler 获取会话的置顶消息列表，最近置顶的排在最前。
+func (h *ConversationHandler) ListPinnedMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	conversationID, err := strconv.ParseUint(mux.Vars(r)["conversationID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+		return
+	}
+
+	pins, err := h.messageService.ListPinnedMessages(r.Context(), userID, uint(conversationID))
+	if err != nil {
+		writePinError(w, "获取置顶消息失败", err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, pins)
+}
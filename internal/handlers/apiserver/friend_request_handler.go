@@ -24,8 +24,10 @@ func NewFriendRequestHandler(fs services.FriendRequestService) *FriendRequestHan
 }
 
 // SendFriendRequestPayload defines the expected JSON body for sending a friend request.
+// The optional message and source are shown to the recipient.
 type SendFriendRequestPayload struct {
 	RecipientID uint `json:"recipientId"`
+	services.FriendRequestOptions
 }
 
 // SendFriendRequestHandler handles POST /api/v1/friend-requests
@@ -48,19 +50,24 @@ func (h *FriendRequestHandler) SendFriendRequestHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err := h.friendService.SendFriendRequest(r.Context(), requesterID, payload.RecipientID)
+	request, err := h.friendService.SendFriendRequest(r.Context(), requesterID, payload.RecipientID, payload.FriendRequestOptions)
 	if err != nil {
-		if errors.Is(err, services.ErrFriendRequestSelf) || errors.Is(err, services.ErrRecipientNotFound) || errors.Is(err, services.ErrAlreadyFriends) {
+		if errors.Is(err, services.ErrFriendRequestSelf) || errors.Is(err, services.ErrRecipientNotFound) || errors.Is(err, services.ErrAlreadyFriends) ||
+			errors.Is(err, services.ErrFriendRequestMessage) || errors.Is(err, services.ErrFriendRequestSource) {
 			writeJSONError(w, err.Error(), http.StatusBadRequest) // Bad request for these known business errors
 		} else if errors.Is(err, services.ErrFriendRequestExists) {
 			writeJSONError(w, err.Error(), http.StatusConflict) // Conflict if request already exists
+		} else if errors.Is(err, services.ErrUserBlocked) || errors.Is(err, services.ErrNotInSourceGroup) {
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		} else if errors.Is(err, services.ErrFriendRequestLimit) {
+			writeJSONError(w, err.Error(), http.StatusTooManyRequests)
 		} else {
 			log.Printf("Error sending friend request from %d to %d: %v", requesterID, payload.RecipientID, err)
 			writeJSONError(w, "发送好友请求失败", http.StatusInternalServerError)
 		}
 		return
 	}
-	writeJSONResponse(w, http.StatusAccepted, map[string]string{"message": "好友请求已发送处理"})
+	writeJSONResponse(w, http.StatusCreated, request)
 }
 
 // AcceptFriendRequestHandler handles POST /api/v1/friend-requests/{requestID}/accept
@@ -86,6 +93,8 @@ func (h *FriendRequestHandler) AcceptFriendRequestHandler(w http.ResponseWriter,
 	if err := h.friendService.AcceptFriendRequest(r.Context(), recipientUserID, uint(requestID)); err != nil {
 		if errors.Is(err, services.ErrFriendRequestNotFound) || errors.Is(err, services.ErrNotRecipientOfRequest) || errors.Is(err, services.ErrRequestNotPending) {
 			writeJSONError(w, err.Error(), http.StatusForbidden) // Or StatusBadRequest depending on policy
+		} else if errors.Is(err, services.ErrFriendRequestExpired) {
+			writeJSONError(w, err.Error(), http.StatusGone)
 		} else if errors.Is(err, services.ErrFriendshipExists) {
 			// This case might be treated as success by some, or a specific conflict.
 			// For now, let's assume it's a conflict if the service layer didn't handle it as a success.
@@ -146,6 +155,8 @@ func (h *FriendRequestHandler) RejectFriendRequestHandler(w http.ResponseWriter,
 	if err := h.friendService.RejectFriendRequest(r.Context(), recipientUserID, uint(requestID)); err != nil {
 		if errors.Is(err, services.ErrFriendRequestNotFound) || errors.Is(err, services.ErrNotRecipientOfRequest) || errors.Is(err, services.ErrRequestNotPending) {
 			writeJSONError(w, err.Error(), http.StatusForbidden)
+		} else if errors.Is(err, services.ErrFriendRequestExpired) {
+			writeJSONError(w, err.Error(), http.StatusGone)
 		} else {
 			log.Printf("Error rejecting friend request %d by user %d: %v", requestID, recipientUserID, err)
 			writeJSONError(w, "处理好友请求失败", http.StatusInternalServerError)
@@ -156,26 +167,72 @@ func (h *FriendRequestHandler) RejectFriendRequestHandler(w http.ResponseWriter,
 	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "好友请求已拒绝"})
 }
 
-// ListFriendsHandler handles GET /api/v1/friends
-func (h *FriendRequestHandler) ListFriendsHandler(w http.ResponseWriter, r *http.Request) {
+// CancelFriendRequestHandler handles POST /api/v1/friend-requests/{requestID}/cancel
+func (h *FriendRequestHandler) CancelFriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterUserID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	requestID, ok := parseUintVar(w, r, "requestID", "无效的好友请求ID格式")
+	if !ok {
+		return
+	}
+
+	if err := h.friendService.CancelFriendRequest(r.Context(), requesterUserID, requestID); err != nil {
+		if errors.Is(err, services.ErrFriendRequestNotFound) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		} else if errors.Is(err, services.ErrNotRequesterOfRequest) || errors.Is(err, services.ErrRequestNotPending) {
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		} else {
+			log.Printf("Error cancelling friend request %d by user %d: %v", requestID, requesterUserID, err)
+			writeJSONError(w, "撤回好友请求失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "好友请求已撤回"})
+}
+
+// ListOutgoingRequestsHandler handles GET /api/v1/friend-requests/sent
+func (h *FriendRequestHandler) ListOutgoingRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
 		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
 		return
 	}
 
-	friendsList, err := h.friendService.GetFriendsList(r.Context(), userID)
+	requests, err := h.friendService.ListOutgoingRequests(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error fetching friends list for user %d: %v", userID, err)
-		writeJSONError(w, "获取好友列表失败", http.StatusInternalServerError)
+		log.Printf("Error fetching outgoing requests for user %d: %v", userID, err)
+		writeJSONError(w, "获取已发送的好友请求失败", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSONResponse(w, http.StatusOK, requests)
+}
+
+// RemoveFriendHandler handles DELETE /api/v1/friends/{userID}
+func (h *FriendRequestHandler) RemoveFriendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	friendID, ok := parseUintVar(w, r, "userID", "无效的用户ID格式")
+	if !ok {
 		return
 	}
 
-	if friendsList == nil {
-		friendsList = []*models.UserBasicInfo{} // Ensure empty list, not null, for JSON
+	if err := h.friendService.RemoveFriend(r.Context(), userID, friendID); err != nil {
+		if errors.Is(err, services.ErrNotFriends) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			log.Printf("Error removing friend %d for user %d: %v", friendID, userID, err)
+			writeJSONError(w, "删除好友失败", http.StatusInternalServerError)
+		}
+		return
 	}
 
-	writeJSONResponse(w, http.StatusOK, friendsList)
+	w.WriteHeader(http.StatusNoContent)
 }
-
-// TODO: Add handlers for rejecting, listing pending requests etc.
@@ -1,8 +1,8 @@
 package apiserver
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -20,15 +20,19 @@ import (
 type GroupHandler struct {
 	groupService   services.GroupService
 	convoService   services.ConversationService
+	privacy        services.PrivacyChecker // 创建群组时过滤不允许被拉入群组的初始成员
+	contacts       services.ContactService // 按联系人分组或标签批量选择好友
 	requestLock    sync.Mutex
 	recentRequests map[string]time.Time
 }
 
 // NewGroupHandler 创建一个新的 GroupHandler 实例。
-func NewGroupHandler(groupService services.GroupService, convoService services.ConversationService) *GroupHandler {
+func NewGroupHandler(groupService services.GroupService, convoService services.ConversationService, privacy services.PrivacyChecker, contacts services.ContactService) *GroupHandler {
 	return &GroupHandler{
 		groupService:   groupService,
 		convoService:   convoService,
+		privacy:        privacy,
+		contacts:       contacts,
 		recentRequests: make(map[string]time.Time),
 	}
 }
@@ -64,6 +68,8 @@ type CreateGroupRequest struct {
 	IsPublic      bool   `json:"isPublic"`
 	JoinCondition string `json:"joinCondition,omitempty"` // 例如 models.DirectJoin, models.ApprovalRequired
 	MemberIds     []uint `json:"memberIds,omitempty"`     // 初始成员ID列表
+	// 按联系人分组 (contactGroupIds) 或标签 (contactTags) 选中的好友也会作为初始成员
+	services.FriendSelector
 }
 
 // CreateGroupHandler 处理创建新群组的请求。
@@ -81,19 +87,29 @@ func (h *GroupHandler) CreateGroupHandler(w http.ResponseWriter, r *http.Request
 	}
 	defer r.Body.Close()
 
+	selected, err := h.contacts.SelectFriendIDs(r.Context(), userID, req.FriendSelector)
+	if err != nil {
+		writeJSONError(w, "按联系人分组或标签选择好友失败", http.StatusInternalServerError)
+		return
+	}
+	req.MemberIds = mergeUserIDs(req.MemberIds, selected)
+
 	// 添加更详细的日志
 	fmt.Printf("收到创建群组请求: 名称=%s, 成员数量=%d, 创建者ID=%d\n", req.Name, len(req.MemberIds), userID)
 	fmt.Printf("成员IDs原始数据: %#v，类型: %T\n", req.MemberIds, req.MemberIds)
 
-	// 确保MemberIds是有效的数字
+	// 确保MemberIds是有效的数字，并跳过与创建者存在拉黑关系或隐私设置不允许被拉入群组的用户
 	var validMembers []uint
 	for i, id := range req.MemberIds {
-		if id > 0 {
-			validMembers = append(validMembers, id)
-			fmt.Printf("有效成员 #%d: ID=%d\n", i+1, id)
-		} else {
+		if id == 0 {
 			fmt.Printf("忽略无效成员ID: %d 在位置 %d\n", id, i)
+			continue
 		}
+		if err := h.privacy.CheckGroupAdd(r.Context(), userID, id); err != nil {
+			continue
+		}
+		validMembers = append(validMembers, id)
+		fmt.Printf("有效成员 #%d: ID=%d\n", i+1, id)
 	}
 
 	// 验证创建者自己是否也在成员列表中
@@ -199,6 +215,10 @@ func (h *GroupHandler) JoinGroupHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	member, err := h.groupService.JoinGroup(r.Context(), userID, uint(groupID))
+	if errors.Is(err, services.ErrBotMustBeInvited) {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		// 根据错误类型返回不同状态码，例如冲突 (已是成员) 或禁止 (不允许加入)
 		writeJSONError(w, fmt.Sprintf("加入群组失败: %v", err), http.StatusInternalServerError) // 简化处理
@@ -232,6 +252,11 @@ func (h *GroupHandler) LeaveGroupHandler(w http.ResponseWriter, r *http.Request)
 
 // GetGroupMembersHandler 获取群组成员列表。
 func (h *GroupHandler) GetGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
 	vars := mux.Vars(r)
 	groupIDStr, _ := vars["groupID"]
 	groupID, err := strconv.ParseUint(groupIDStr, 10, 32)
@@ -242,7 +267,7 @@ func (h *GroupHandler) GetGroupMembersHandler(w http.ResponseWriter, r *http.Req
 	// TODO: 分页参数
 	limit := 100
 	offset := 0
-	members, err := h.groupService.GetGroupMembers(r.Context(), uint(groupID), limit, offset)
+	members, err := h.groupService.GetGroupMembers(r.Context(), userID, uint(groupID), limit, offset)
 	if err != nil {
 		writeJSONError(w, fmt.Sprintf("获取群组成员失败: %v", err), http.StatusInternalServerError)
 		return
@@ -305,11 +330,8 @@ func (h *GroupHandler) FixGroupConversationParticipants(w http.ResponseWriter, r
 		return
 	}
 
-	// 检查用户是否是群主或管理员
-	member, err := h.groupService.(interface {
-		GetMember(context.Context, uint, uint) (*models.GroupMember, error)
-	}).GetMember(r.Context(), uint(groupID), userID)
-	if err != nil || (member.Role != models.AdminRole) {
+	// 检查用户是否有修改群资料的权限 (默认为管理员及以上)
+	if _, err := h.groupService.CheckPermission(r.Context(), uint(groupID), userID, models.PermEditInfo); err != nil {
 		RespondWithError(w, http.StatusForbidden, "您没有权限修复此群组会话")
 		return
 	}
@@ -333,4 +355,455 @@ func RespondWithError(w http.ResponseWriter, statusCode int, message string) {
 	writeJSONResponse(w, statusCode, map[string]string{"error": message})
 }
 
-// TODO: 添加其他群组管理相关的 Handler，如 UpdateGroupInfo, UpdateMemberRole 等。
+// writeGroupServiceError 将群组服务返回的权限类错误映射为 403，其余错误使用给定的状态码。
+func writeGroupServiceError(w http.ResponseWriter, prefix string, err error, fallbackStatus int) {
+	status := fallbackStatus
+	if errors.Is(err, services.ErrGroupPermissionDenied) || errors.Is(err, services.ErrNotGroupMember) ||
+		errors.Is(err, services.ErrUserBlocked) || errors.Is(err, services.ErrPrivacyRestricted) {
+		status = http.StatusForbidden
+	}
+	writeJSONError(w, fmt.Sprintf("%s: %v", prefix, err), status)
+}
+
+// parseGroupID 从路径参数中解析群组ID。
+func parseGroupID(r *http.Request) (uint, error) {
+	groupID, err := strconv.ParseUint(mux.Vars(r)["groupID"], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(groupID), nil
+}
+
+// UpdateGroupRequest 是更新群组资料的请求结构体，未提供的字段保持不变。
+type UpdateGroupRequest struct {
+	Name          string `json:"name,omitempty"`
+	Description   string `json:"description,omitempty"`
+	AvatarURL     string `json:"avatarUrl,omitempty"`
+	IsPublic      *bool  `json:"isPublic,omitempty"`
+	JoinCondition string `json:"joinCondition,omitempty"`
+}
+
+// UpdateGroupInfoHandler 更新群组资料 (需要 edit_info 权限)。
+func (h *GroupHandler) UpdateGroupInfoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	group, err := h.groupService.GetGroupDetailsByID(r.Context(), groupID)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("获取群组失败: %v", err), http.StatusNotFound)
+		return
+	}
+	isPublic := group.IsPublic
+	if req.IsPublic != nil {
+		isPublic = *req.IsPublic
+	}
+
+	updated, err := h.groupService.UpdateGroupInfo(r.Context(), userID, groupID, req.Name, req.Description, req.AvatarURL, isPublic, req.JoinCondition)
+	if err != nil {
+		writeGroupServiceError(w, "更新群组资料失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, updated)
+}
+
+// InviteMemberRequest 是邀请用户入群的请求结构体。
+type InviteMemberRequest struct {
+	UserID uint `json:"userId"`
+}
+
+// InviteMemberHandler 邀请用户加入群组 (需要 invite_members 权限)。
+func (h *GroupHandler) InviteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req InviteMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	member, err := h.groupService.InviteUserToGroup(r.Context(), userID, groupID, req.UserID)
+	if err != nil {
+		writeGroupServiceError(w, "邀请成员失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, member)
+}
+
+// InviteMembersRequest 是批量邀请用户入群的请求结构体，被邀请者是 userIds 与按联系人分组或标签选中的好友的并集。
+type InviteMembersRequest struct {
+	UserIDs []uint `json:"userIds,omitempty"`
+	services.FriendSelector
+}
+
+// InviteFailure 是批量邀请中未能入群的用户及原因。
+type InviteFailure struct {
+	UserID uint   `json:"userId"`
+	Error  string `json:"error"`
+}
+
+// InviteMembersResponse 是批量邀请的结果。
+type InviteMembersResponse struct {
+	Added  []*models.GroupMember `json:"added"`
+	Failed []InviteFailure       `json:"failed"`
+}
+
+// InviteMembersHandler 批量邀请用户加入群组 (需要 invite_members 权限)。
+// 每个用户单独邀请，已是成员或隐私设置不允许的用户记入 failed，不影响其他用户。
+func (h *GroupHandler) InviteMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req InviteMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if _, err := h.groupService.CheckPermission(r.Context(), groupID, userID, models.PermInviteMembers); err != nil {
+		writeGroupServiceError(w, "邀请成员失败", err, http.StatusBadRequest)
+		return
+	}
+	selected, err := h.contacts.SelectFriendIDs(r.Context(), userID, req.FriendSelector)
+	if err != nil {
+		writeJSONError(w, "按联系人分组或标签选择好友失败", http.StatusInternalServerError)
+		return
+	}
+	inviteeIDs := mergeUserIDs(req.UserIDs, selected)
+	if len(inviteeIDs) == 0 {
+		writeJSONError(w, "没有要邀请的用户", http.StatusBadRequest)
+		return
+	}
+
+	resp := InviteMembersResponse{Added: []*models.GroupMember{}, Failed: []InviteFailure{}}
+	for _, inviteeID := range inviteeIDs {
+		member, err := h.groupService.InviteUserToGroup(r.Context(), userID, groupID, inviteeID)
+		if err != nil {
+			resp.Failed = append(resp.Failed, InviteFailure{UserID: inviteeID, Error: err.Error()})
+			continue
+		}
+		resp.Added = append(resp.Added, member)
+	}
+	writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// mergeUserIDs 合并两个用户ID列表，去掉 0 和重复的ID并保持原有顺序。
+func mergeUserIDs(ids, more []uint) []uint {
+	seen := make(map[uint]bool, len(ids)+len(more))
+	merged := make([]uint, 0, len(ids)+len(more))
+	for _, id := range append(append([]uint{}, ids...), more...) {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		merged = append(merged, id)
+	}
+	return merged
+}
+
+// UpdateMemberRoleRequest 是修改成员角色的请求结构体。
+type UpdateMemberRoleRequest struct {
+	Role models.GroupMemberRole `json:"role"`
+}
+
+// UpdateMemberRoleHandler 修改群成员的角色。
+func (h *GroupHandler) UpdateMemberRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+	memberID, err := strconv.ParseUint(mux.Vars(r)["userID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的用户ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	member, err := h.groupService.UpdateMemberRole(r.Context(), userID, groupID, uint(memberID), req.Role)
+	if err != nil {
+		writeGroupServiceError(w, "修改成员角色失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, member)
+}
+
+// TransferOwnershipRequest 是转让群主的请求结构体。
+type TransferOwnershipRequest struct {
+	NewOwnerID uint `json:"newOwnerId"`
+}
+
+// TransferOwnershipHandler 将群主身份转让给另一位成员。
+func (h *GroupHandler) TransferOwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req TransferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewOwnerID == 0 {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.groupService.TransferOwnership(r.Context(), userID, groupID, req.NewOwnerID); err != nil {
+		writeGroupServiceError(w, "转让群主失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "群主已转让"})
+}
+
+// SetSlowModeRequest 是设置群组慢速模式的请求结构体。
+type SetSlowModeRequest struct {
+	Seconds int `json:"seconds"` // 0 表示关闭
+}
+
+// SetSlowModeHandler 设置群组慢速模式 (需要 edit_info 权限)。
+func (h *GroupHandler) SetSlowModeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req SetSlowModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	group, err := h.groupService.SetSlowMode(r.Context(), userID, groupID, req.Seconds)
+	if err != nil {
+		writeGroupServiceError(w, "设置慢速模式失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, group)
+}
+
+// GetGroupPermissionsHandler 获取群组当前生效的权限矩阵。
+func (h *GroupHandler) GetGroupPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	matrix, err := h.groupService.GetPermissions(r.Context(), userID, groupID)
+	if err != nil {
+		writeGroupServiceError(w, "获取群组权限失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, matrix)
+}
+
+// UpdateGroupPermissionsHandler 修改群组的权限矩阵 (仅群主)。
+// 请求体为 权限 -> 最低角色 的映射，例如 {"send_message": "moderator"}。
+func (h *GroupHandler) UpdateGroupPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req map[models.GroupPermission]models.GroupMemberRole
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	matrix, err := h.groupService.UpdatePermissions(r.Context(), userID, groupID, req)
+	if err != nil {
+		writeGroupServiceError(w, "修改群组权限失败", err, http.StatusBadRequest)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, matrix)
+}
+
+// SetAnnouncementRequest 是发布群公告的请求结构体。
+type SetAnnouncementRequest struct {
+	Content string `json:"content"`
+}
+
+// SetAnnouncementHandler 发布新的群公告 (需要 announce 权限)。
+func (h *GroupHandler) SetAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req SetAnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Content == "" {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	announcement, err := h.groupService.SetAnnouncement(r.Context(), userID, groupID, req.Content)
+	if err != nil {
+		writeGroupServiceError(w, "发布群公告失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, announcement)
+}
+
+// GetAnnouncementHandler 获取群组当前公告及当前用户的确认状态。
+func (h *GroupHandler) GetAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	view, err := h.groupService.GetAnnouncement(r.Context(), userID, groupID)
+	if err != nil {
+		if errors.Is(err, services.ErrAnnouncementNotFound) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeGroupServiceError(w, "获取群公告失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, view)
+}
+
+// AckAnnouncementRequest 是确认群公告的请求结构体。AnnouncementID 可选，提供时必须是当前公告。
+type AckAnnouncementRequest struct {
+	AnnouncementID uint `json:"announcementId,omitempty"`
+}
+
+// AckAnnouncementHandler 确认 (已读) 群组当前公告。
+func (h *GroupHandler) AckAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	var req AckAnnouncementRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, "请求体无效", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	if err := h.groupService.AcknowledgeAnnouncement(r.Context(), userID, groupID, req.AnnouncementID); err != nil {
+		if errors.Is(err, services.ErrAnnouncementNotFound) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeGroupServiceError(w, "确认群公告失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "已确认群公告"})
+}
+
+// ListAnnouncementAcksHandler 获取当前公告的确认记录 (需要 announce 权限)。
+func (h *GroupHandler) ListAnnouncementAcksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := parseGroupID(r)
+	if err != nil {
+		writeJSONError(w, "无效的群组ID格式", http.StatusBadRequest)
+		return
+	}
+
+	acks, err := h.groupService.ListAnnouncementAcks(r.Context(), userID, groupID)
+	if err != nil {
+		if errors.Is(err, services.ErrAnnouncementNotFound) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeGroupServiceError(w, "获取公告确认记录失败", err, http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, acks)
+}
@@ -0,0 +1,31 @@
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"im-go/internal/auth"
+)
+
+// JWKSHandler 发布验证 JWT 签名所需的公钥。
+type JWKSHandler struct {
+	keys auth.KeyManager
+}
+
+// NewJWKSHandler 创建一个新的 JWKSHandler 实例。
+func NewJWKSHandler(keys auth.KeyManager) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKSHandler 返回当前所有可用于验证的公钥 (RFC 7517 JWK Set)。
+// 轮换后的旧密钥在其签发的令牌过期之前仍会出现在列表中。
+func (h *JWKSHandler) GetJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.keys.JWKS(r.Context())
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("获取公钥失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// 允许验证方短时间缓存，验证方遇到未知 kid 时会主动重新拉取
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSONResponse(w, http.StatusOK, jwks)
+}
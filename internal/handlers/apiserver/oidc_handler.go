@@ -0,0 +1,141 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+)
+
+// OIDCHandler 封装了单点登录 (OpenID Connect) 相关的 HTTP 处理器方法。
+type OIDCHandler struct {
+	oidcService services.OIDCService
+}
+
+// NewOIDCHandler 创建一个新的 OIDCHandler 实例。
+func NewOIDCHandler(oidcService services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService}
+}
+
+// OIDCConfigResponse 告诉前端是否显示单点登录按钮。
+type OIDCConfigResponse struct {
+	Enabled     bool   `json:"enabled"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// OIDCAuthorizationResponse 是发起单点登录的响应结构体。
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// OIDCCallbackRequest 是前端回调页面提交授权码的请求结构体。
+type OIDCCallbackRequest struct {
+	Code       string `json:"code"`
+	State      string `json:"state"`
+	DeviceName string `json:"deviceName,omitempty"`
+}
+
+// GetConfigHandler 返回单点登录是否可用。
+func (h *OIDCHandler) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
+	resp := OIDCConfigResponse{Enabled: h.oidcService.Enabled()}
+	if resp.Enabled {
+		resp.DisplayName = h.oidcService.DisplayName()
+	}
+	writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// AuthorizeHandler 发起单点登录，返回跳转到身份提供方的地址。
+func (h *OIDCHandler) AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	h.authorize(w, r, 0)
+}
+
+// LinkHandler 为当前用户发起外部账号关联，回调流程与登录相同。
+func (h *OIDCHandler) LinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	h.authorize(w, r, userID)
+}
+
+// authorize 生成授权地址。
+func (h *OIDCHandler) authorize(w http.ResponseWriter, r *http.Request, linkUserID uint) {
+	authorization, err := h.oidcService.BeginLogin(r.Context(), linkUserID)
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			log.Printf("发起单点登录失败: %v", err)
+			writeJSONError(w, "身份提供方暂时不可用", http.StatusBadGateway)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, OIDCAuthorizationResponse{
+		AuthorizationURL: authorization.AuthorizationURL,
+		State:            authorization.State,
+	})
+}
+
+// CallbackHandler 使用身份提供方回调的授权码完成登录，与密码登录一样返回令牌或两步验证挑战。
+func (h *OIDCHandler) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req OIDCCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Code == "" || req.State == "" {
+		writeJSONError(w, "授权码和 state 不能为空", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.oidcService.CompleteLogin(r.Context(), req.State, req.Code, sessionClientInfo(r, req.DeviceName))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidOIDCLogin):
+			writeJSONError(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, services.ErrOIDCAccountNotLinked):
+			writeJSONError(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, services.ErrOIDCIdentityLinked), errors.Is(err, services.ErrOIDCEmailInUse):
+			writeJSONError(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("单点登录失败: %v", err)
+			writeJSONError(w, "单点登录失败", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if result.Challenge != nil {
+		writeJSONResponse(w, http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     result.Challenge.Token,
+			ChallengeExpiresAt: result.Challenge.ExpiresAt,
+		})
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newLoginResponse(result.Tokens, result.User))
+}
+
+// ListIdentitiesHandler 返回当前用户关联的外部身份。
+func (h *OIDCHandler) ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.oidcService.ListIdentities(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, "获取外部身份失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, identities)
+}
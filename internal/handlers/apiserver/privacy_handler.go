@@ -0,0 +1,133 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+)
+
+// PrivacyHandler 封装了拉黑名单和隐私设置相关的 HTTP 处理器方法。
+type PrivacyHandler struct {
+	privacyService services.PrivacyService
+}
+
+// NewPrivacyHandler 创建一个新的 PrivacyHandler 实例。
+func NewPrivacyHandler(privacyService services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{privacyService: privacyService}
+}
+
+// BlockUserRequest 是拉黑用户的请求结构体。
+type BlockUserRequest struct {
+	UserID uint `json:"userId"`
+}
+
+// ListBlockedUsersHandler 返回当前用户的拉黑名单。
+func (h *PrivacyHandler) ListBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	blocked, err := h.privacyService.ListBlockedUsers(r.Context(), userID)
+	if err != nil {
+		writePrivacyError(w, err, "获取拉黑名单失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, blocked)
+}
+
+// BlockUserHandler 拉黑用户。
+func (h *PrivacyHandler) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	var req BlockUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		writeJSONError(w, "请求体无效，缺少 userId", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.privacyService.BlockUser(r.Context(), userID, req.UserID); err != nil {
+		writePrivacyError(w, err, "拉黑用户失败")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnblockUserHandler 取消拉黑路径中的用户。
+func (h *PrivacyHandler) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	targetID, ok := parseUintVar(w, r, "userID", "无效的用户ID格式")
+	if !ok {
+		return
+	}
+
+	if err := h.privacyService.UnblockUser(r.Context(), userID, targetID); err != nil {
+		writePrivacyError(w, err, "取消拉黑失败")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPrivacySettingsHandler 返回当前用户的隐私设置。
+func (h *PrivacyHandler) GetPrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	settings, err := h.privacyService.GetSettings(r.Context(), userID)
+	if err != nil {
+		writePrivacyError(w, err, "获取隐私设置失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, settings)
+}
+
+// UpdatePrivacySettingsHandler 修改当前用户的隐私设置，未提供的字段保持不变。
+func (h *PrivacyHandler) UpdatePrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	var changes services.PrivacySettingsChanges
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	settings, err := h.privacyService.UpdateSettings(r.Context(), userID, changes)
+	if err != nil {
+		writePrivacyError(w, err, "修改隐私设置失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, settings)
+}
+
+// writePrivacyError 将 PrivacyService 的错误映射为 HTTP 响应。
+func writePrivacyError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrBlockNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrBlockSelf), errors.Is(err, services.ErrInvalidPrivacySetting):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrUserBlocked), errors.Is(err, services.ErrPrivacyRestricted):
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("%s: %v", failure, err)
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,106 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"im-go/internal/middleware"
+	"im-go/internal/models"
+	"im-go/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionHandler 封装了登录会话管理相关的 HTTP 处理器方法。
+type SessionHandler struct {
+	sessionService services.SessionService
+}
+
+// NewSessionHandler 创建一个新的 SessionHandler 实例。
+func NewSessionHandler(sessionService services.SessionService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService}
+}
+
+// SessionResponse 是会话列表中的一项，Current 标记发起请求的会话。
+type SessionResponse struct {
+	*models.Session
+	Current bool `json:"current"`
+}
+
+// currentSessionID 返回当前请求令牌所属的会话 ID，旧令牌没有会话时返回 0。
+func currentSessionID(r *http.Request) uint {
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		return 0
+	}
+	return claims.SessionID
+}
+
+// ListSessionsHandler 列出当前用户的有效登录会话。
+func (h *SessionHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.sessionService.ListSessions(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("获取会话列表失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	current := currentSessionID(r)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{Session: session, Current: session.ID == current})
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// RevokeSessionHandler 吊销当前用户的指定会话。
+func (h *SessionHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	sessionID, err := strconv.ParseUint(mux.Vars(r)["sessionID"], 10, 32)
+	if err != nil {
+		writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sessionService.RevokeSession(r.Context(), userID, uint(sessionID)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		} else {
+			writeJSONError(w, fmt.Sprintf("吊销会话失败: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]string{"message": "会话已吊销"})
+}
+
+// RevokeAllSessionsHandler 吊销当前用户的所有其他会话，includeCurrent=true 时连同当前会话一起吊销。
+func (h *SessionHandler) RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	exceptSessionID := currentSessionID(r)
+	if includeCurrent, _ := strconv.ParseBool(r.URL.Query().Get("includeCurrent")); includeCurrent {
+		exceptSessionID = 0
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(r.Context(), userID, exceptSessionID)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("吊销会话失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, map[string]int{"revoked": revoked})
+}
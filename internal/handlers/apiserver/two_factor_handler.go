@@ -0,0 +1,193 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"im-go/internal/middleware"
+	"im-go/internal/services"
+)
+
+// TwoFactorHandler 封装了两步验证相关的 HTTP 处理器方法。
+type TwoFactorHandler struct {
+	twoFactorService services.TwoFactorService
+}
+
+// NewTwoFactorHandler 创建一个新的 TwoFactorHandler 实例。
+func NewTwoFactorHandler(twoFactorService services.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactorService: twoFactorService}
+}
+
+// TwoFactorCodeRequest 是提交验证码 (或恢复码) 的请求结构体。
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorLoginRequest 是完成两步验证登录的请求结构体。
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	DeviceName     string `json:"deviceName,omitempty"`
+}
+
+// TwoFactorStatusResponse 是两步验证状态的响应结构体。
+type TwoFactorStatusResponse struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabledAt,omitempty"`
+	RecoveryCodesRemaining int        `json:"recoveryCodesRemaining"`
+}
+
+// TOTPEnrollmentResponse 是开始绑定验证器应用的响应结构体。
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+// RecoveryCodesResponse 返回新生成的恢复码，恢复码只在此时展示一次。
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// VerifyLoginHandler 提交登录挑战的验证码，通过后返回与普通登录相同的令牌。
+func (h *TwoFactorHandler) VerifyLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.ChallengeToken == "" || req.Code == "" {
+		writeJSONError(w, "登录挑战和验证码不能为空", http.StatusBadRequest)
+		return
+	}
+
+	tokens, user, err := h.twoFactorService.CompleteChallenge(r.Context(), req.ChallengeToken, req.Code, sessionClientInfo(r, req.DeviceName))
+	if err != nil {
+		writeTwoFactorError(w, err, "两步验证登录失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newLoginResponse(tokens, user))
+}
+
+// GetStatusHandler 获取当前用户的两步验证状态。
+func (h *TwoFactorHandler) GetStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.twoFactorService.Status(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, "获取两步验证状态失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, TwoFactorStatusResponse{
+		Enabled:                status.Enabled,
+		EnabledAt:              status.EnabledAt,
+		RecoveryCodesRemaining: status.RecoveryCodesRemaining,
+	})
+}
+
+// BeginEnrollmentHandler 生成 TOTP 密钥，客户端据此展示二维码。
+func (h *TwoFactorHandler) BeginEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(r.Context(), userID)
+	if err != nil {
+		writeTwoFactorError(w, err, "生成两步验证密钥失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, TOTPEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+// ConfirmEnrollmentHandler 提交验证器应用生成的验证码以开启两步验证。
+func (h *TwoFactorHandler) ConfirmEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleCode(w, r, func(userID uint, code string) (interface{}, error) {
+		codes, err := h.twoFactorService.ConfirmEnrollment(r.Context(), userID, code)
+		if err != nil {
+			return nil, err
+		}
+		return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+	}, "开启两步验证失败")
+}
+
+// RegenerateRecoveryCodesHandler 重新生成恢复码。
+func (h *TwoFactorHandler) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleCode(w, r, func(userID uint, code string) (interface{}, error) {
+		codes, err := h.twoFactorService.RegenerateRecoveryCodes(r.Context(), userID, code)
+		if err != nil {
+			return nil, err
+		}
+		return RecoveryCodesResponse{RecoveryCodes: codes}, nil
+	}, "生成恢复码失败")
+}
+
+// DisableHandler 关闭两步验证。
+func (h *TwoFactorHandler) DisableHandler(w http.ResponseWriter, r *http.Request) {
+	h.handleCode(w, r, func(userID uint, code string) (interface{}, error) {
+		if err := h.twoFactorService.Disable(r.Context(), userID, code); err != nil {
+			return nil, err
+		}
+		return map[string]string{"message": "两步验证已关闭"}, nil
+	}, "关闭两步验证失败")
+}
+
+// handleCode 解析需要验证码的请求并调用 fn。
+func (h *TwoFactorHandler) handleCode(w http.ResponseWriter, r *http.Request, fn func(userID uint, code string) (interface{}, error), failure string) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "请求体无效", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Code == "" {
+		writeJSONError(w, "验证码不能为空", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := fn(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err, failure)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// writeTwoFactorError 将两步验证相关的错误映射为 HTTP 状态码。
+func writeTwoFactorError(w http.ResponseWriter, err error, failure string) {
+	var limitErr *services.AttemptLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+		writeJSONError(w, limitErr.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrInvalidTwoFactorChallenge):
+		writeJSONError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, services.ErrTwoFactorNotEnabled), errors.Is(err, services.ErrTwoFactorNotEnrolling):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrUserNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	default:
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
@@ -2,33 +2,65 @@
 package apiserver
 
 import (
+	"errors"
 	"fmt"
 	"im-go/internal/config"
 	"im-go/internal/imtypes" // Use imtypes.StorageService
+	"im-go/internal/middleware"
+	"im-go/internal/models"
+	"im-go/internal/services"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
 )
 
 const (
 	defaultMaxMemory = 32 << 20 // 32 MB default max memory for multipart forms
 )
 
-// UploadHandler 封装了文件上传相关的 HTTP 处理器方法。
+// inlineMimeTypes 是允许在浏览器中直接显示的附件类型，只包含不能执行脚本的位图格式。
+var inlineMimeTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UploadHandler 封装了附件上传和下载相关的 HTTP 处理器方法。
 type UploadHandler struct {
-	storageService imtypes.StorageService // Use the interface from imtypes
-	cfg            config.StorageConfig   // Storage config for max size check
+	storageService    imtypes.StorageService // Use the interface from imtypes
+	attachmentService services.AttachmentService
+	cfg               config.StorageConfig // Storage config for max size check
 }
 
 // NewUploadHandler 创建一个新的 UploadHandler 实例。
-func NewUploadHandler(storageService imtypes.StorageService, cfg config.StorageConfig) *UploadHandler {
+func NewUploadHandler(storageService imtypes.StorageService, attachmentService services.AttachmentService, cfg config.StorageConfig) *UploadHandler {
 	return &UploadHandler{
-		storageService: storageService,
-		cfg:            cfg,
+		storageService:    storageService,
+		attachmentService: attachmentService,
+		cfg:               cfg,
 	}
 }
 
-// UploadFileHandler 处理文件上传请求。
+// AttachmentResponse 是上传和查询附件的响应，URL 是需要认证的下载地址。
+type AttachmentResponse struct {
+	*models.Attachment
+	URL string `json:"url"`
+}
+
+func newAttachmentResponse(attachment *models.Attachment) *AttachmentResponse {
+	return &AttachmentResponse{Attachment: attachment, URL: services.AttachmentDownloadPath(attachment.ID)}
+}
+
+// UploadFileHandler 处理 POST /api/v1/upload。表单中可选的 conversationId 指定附件所属的会话。
 func (h *UploadHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+
 	// 1. 限制请求体大小 (可选，但推荐)
 	maxUploadSize := h.cfg.MaxFileSizeMB << 20 // Convert MB to bytes
 	if maxUploadSize <= 0 {
@@ -74,14 +106,171 @@ func (h *UploadHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// 6. 调用存储服务上传文件
-	fileInfo, err := h.storageService.UploadFile(r.Context(), file, handler.Size, handler.Filename, mimeType)
+	var conversationID uint
+	if idStr := r.FormValue("conversationId"); idStr != "" {
+		parsed, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			writeJSONError(w, "无效的会话ID格式", http.StatusBadRequest)
+			return
+		}
+		conversationID = uint(parsed)
+	}
+
+	// 6. 保存文件并记录附件
+	attachment, err := h.attachmentService.Upload(r.Context(), userID, conversationID, file, handler.Size, handler.Filename, mimeType)
+	if err != nil {
+		writeAttachmentError(w, err, "存储文件失败")
+		return
+	}
+
+	// 7. 返回成功响应，包含附件信息和下载地址
+	writeJSONResponse(w, http.StatusCreated, newAttachmentResponse(attachment))
+}
+
+// GetAttachmentHandler 处理 GET /api/v1/attachments/{attachmentID}，返回附件信息。
+func (h *UploadHandler) GetAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := h.attachmentForUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, newAttachmentResponse(attachment))
+}
+
+// DownloadAttachmentHandler 处理 GET /api/v1/attachments/{attachmentID}/download?download=1，需要认证。
+func (h *UploadHandler) DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := h.attachmentForUser(w, r)
+	if !ok {
+		return
+	}
+	h.serveAttachment(w, r, attachment)
+}
+
+// SignAttachmentURLHandler 处理 POST /api/v1/attachments/{attachmentID}/signed-url，返回短期有效的下载链接。
+func (h *UploadHandler) SignAttachmentURLHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return
+	}
+	attachmentID, ok := parseUintVar(w, r, "attachmentID", "无效的附件ID格式")
+	if !ok {
+		return
+	}
+	signed, err := h.attachmentService.SignURL(r.Context(), userID, attachmentID)
 	if err != nil {
-		log.Printf("存储文件失败: %v", err) // Log the detailed error
-		writeJSONError(w, "存储文件失败", http.StatusInternalServerError)
+		writeAttachmentError(w, err, "生成下载链接失败")
 		return
 	}
+	writeJSONResponse(w, http.StatusOK, signed)
+}
 
-	// 7. 返回成功响应，包含文件信息
-	writeJSONResponse(w, http.StatusOK, fileInfo) // FileInfo struct is already JSON-ready
+// SignedDownloadHandler 处理 GET /files/{attachmentID}?expires=&signature=，由签名授权，不需要认证。
+func (h *UploadHandler) SignedDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	attachmentID, ok := parseUintVar(w, r, "attachmentID", "无效的附件ID格式")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		writeJSONError(w, services.ErrInvalidSignedURL.Error(), http.StatusForbidden)
+		return
+	}
+	attachment, err := h.attachmentService.GetBySignature(r.Context(), attachmentID, expires, query.Get("signature"))
+	if err != nil {
+		writeAttachmentError(w, err, "获取文件失败")
+		return
+	}
+	h.serveAttachment(w, r, attachment)
+}
+
+// attachmentForUser 读取路径中的附件ID并返回当前用户有权访问的附件，失败时已写入错误响应。
+func (h *UploadHandler) attachmentForUser(w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "无法从上下文中获取用户ID", http.StatusUnauthorized)
+		return nil, false
+	}
+	attachmentID, ok := parseUintVar(w, r, "attachmentID", "无效的附件ID格式")
+	if !ok {
+		return nil, false
+	}
+	attachment, err := h.attachmentService.GetForUser(r.Context(), userID, attachmentID)
+	if err != nil {
+		writeAttachmentError(w, err, "获取附件失败")
+		return nil, false
+	}
+	return attachment, true
+}
+
+// serveAttachment 发送附件内容。支持预签名 URL 的存储后端 (如 S3) 把请求重定向到预签名 URL，
+// 客户端直接从存储下载文件，不经过 API 服务器；其他后端由 http.ServeContent 发送，支持 Range 和条件请求。
+func (h *UploadHandler) serveAttachment(w http.ResponseWriter, r *http.Request, attachment *models.Attachment) {
+	disposition := contentDisposition(attachment, r.URL.Query().Get("download") == "1")
+
+	if provider, ok := h.storageService.(imtypes.PresignedURLProvider); ok {
+		// 有效期为 0 时使用存储后端配置的有效期
+		presignedURL, err := provider.PresignedGetURL(r.Context(), attachment.StoragePath, 0, disposition)
+		if err != nil {
+			writeStorageError(w, err, attachment.StoragePath)
+			return
+		}
+		// 预签名 URL 会过期，不能被缓存
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, presignedURL, http.StatusFound)
+		return
+	}
+
+	file, info, err := h.storageService.Open(r.Context(), attachment.StoragePath)
+	if err != nil {
+		writeStorageError(w, err, attachment.StoragePath)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// 即使浏览器直接渲染了文件，沙箱也会阻止其中的脚本在本站的源下执行
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, attachment.FileName, info.ModTime, file)
+}
+
+// contentDisposition 返回附件的 Content-Disposition：inlineMimeTypes 中的位图默认在浏览器中直接显示，
+// 其他类型 (包括 SVG、HTML 等可能执行脚本的类型) 总是作为下载。文件名中的非 ASCII 字符按 RFC 2231 编码。
+func contentDisposition(attachment *models.Attachment, forceDownload bool) string {
+	dispositionType := "attachment"
+	if !forceDownload && inlineMimeTypes[attachment.MimeType] {
+		dispositionType = "inline"
+	}
+	if value := mime.FormatMediaType(dispositionType, map[string]string{"filename": attachment.FileName}); value != "" {
+		return value
+	}
+	return dispositionType
+}
+
+// writeAttachmentError 把 AttachmentService 的错误转换为 HTTP 响应。
+func writeAttachmentError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, services.ErrAttachmentNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrAttachmentConversation), errors.Is(err, services.ErrInvalidSignedURL),
+		errors.Is(err, services.ErrSignedURLExpired):
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("%s: %v", failure, err)
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
+
+// writeStorageError 把存储服务的错误转换为 HTTP 响应。
+func writeStorageError(w http.ResponseWriter, err error, path string) {
+	switch {
+	case errors.Is(err, imtypes.ErrFileNotFound), errors.Is(err, imtypes.ErrInvalidFilePath):
+		writeJSONError(w, imtypes.ErrFileNotFound.Error(), http.StatusNotFound)
+	default:
+		log.Printf("读取文件 %s 失败: %v", path, err)
+		writeJSONError(w, "获取文件失败", http.StatusInternalServerError)
+	}
 }
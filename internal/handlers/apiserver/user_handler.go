@@ -72,6 +72,7 @@ func (h *UserHandler) UpdateMyProfileHandler(w http.ResponseWriter, r *http.Requ
 }
 
 // GetUserProfileHandler 处理获取指定用户公开信息的请求。
+// 该处理器同时挂在公开路由和需要认证的路由上，只有认证且未被对方拉黑的用户才能看到在线状态。
 func (h *UserHandler) GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userIDStr, ok := vars["userID"]
@@ -85,7 +86,8 @@ func (h *UserHandler) GetUserProfileHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	user, err := h.userService.GetUserProfile(r.Context(), uint(userID))
+	viewerID, _ := middleware.GetUserIDFromContext(r.Context()) // 公开路由上为 0
+	user, err := h.userService.GetPublicProfile(r.Context(), viewerID, uint(userID))
 	if err != nil {
 		writeJSONError(w, fmt.Sprintf("获取用户信息失败: %v", err), http.StatusNotFound)
 		return
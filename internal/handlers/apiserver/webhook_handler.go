@@ -0,0 +1,247 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"im-go/internal/middleware"
+	"im-go/internal/models"
+	"im-go/internal/services"
+)
+
+// WebhookHandler 封装了群组和机器人 Webhook 管理相关的 HTTP 处理器方法。
+type WebhookHandler struct {
+	webhookService services.WebhookService
+}
+
+// NewWebhookHandler 创建一个新的 WebhookHandler 实例。
+func NewWebhookHandler(webhookService services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// CreateWebhookRequest 是登记 Webhook 的请求结构体。
+type CreateWebhookRequest struct {
+	URL    string                    `json:"url"`
+	Events []models.WebhookEventType `json:"events,omitempty"` // 为空表示订阅全部事件
+}
+
+// UpdateWebhookRequest 是修改 Webhook 的请求结构体，省略的字段保持不变。
+type UpdateWebhookRequest struct {
+	URL     *string                    `json:"url,omitempty"`
+	Events  *[]models.WebhookEventType `json:"events,omitempty"`
+	Enabled *bool                      `json:"enabled,omitempty"`
+}
+
+// WebhookResponse 是 Webhook 的展示结构，不包含签名密钥。
+type WebhookResponse struct {
+	*models.Webhook
+	Events []models.WebhookEventType `json:"events"`
+}
+
+// CreateWebhookResponse 是登记 Webhook 的响应，签名密钥只在这里返回一次。
+type CreateWebhookResponse struct {
+	WebhookResponse
+	Secret string `json:"secret"`
+}
+
+// CreateGroupWebhookHandler 为群组登记 Webhook。
+func (h *WebhookHandler) CreateGroupWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, ok := parseUintVar(w, r, "groupID", "无效的群组ID格式")
+	if !ok {
+		return
+	}
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := h.webhookService.CreateGroupWebhook(r.Context(), userID, groupID, req.URL, req.Events)
+	if err != nil {
+		writeWebhookError(w, err, "登记 Webhook 失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, toCreateWebhookResponse(created))
+}
+
+// ListGroupWebhooksHandler 列出群组的 Webhook。
+func (h *WebhookHandler) ListGroupWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	groupID, ok := parseUintVar(w, r, "groupID", "无效的群组ID格式")
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.webhookService.ListGroupWebhooks(r.Context(), userID, groupID)
+	if err != nil {
+		writeWebhookError(w, err, "获取 Webhook 列表失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, toWebhookResponses(webhooks))
+}
+
+// CreateBotWebhookHandler 为当前用户的机器人登记 Webhook。
+func (h *WebhookHandler) CreateBotWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := h.webhookService.CreateBotWebhook(r.Context(), userID, botID, req.URL, req.Events)
+	if err != nil {
+		writeWebhookError(w, err, "登记 Webhook 失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, toCreateWebhookResponse(created))
+}
+
+// ListBotWebhooksHandler 列出机器人的 Webhook。
+func (h *WebhookHandler) ListBotWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	botID, ok := parseUintVar(w, r, "botID", "无效的机器人ID格式")
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.webhookService.ListBotWebhooks(r.Context(), userID, botID)
+	if err != nil {
+		writeWebhookError(w, err, "获取 Webhook 列表失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, toWebhookResponses(webhooks))
+}
+
+// UpdateWebhookHandler 修改 Webhook 的地址、订阅的事件或启用状态。
+func (h *WebhookHandler) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	webhookID, ok := parseUintVar(w, r, "webhookID", "无效的 Webhook ID 格式")
+	if !ok {
+		return
+	}
+	var req UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "无效的请求体", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	webhook, err := h.webhookService.UpdateWebhook(r.Context(), userID, webhookID, services.WebhookUpdate{
+		URL:     req.URL,
+		Events:  req.Events,
+		Enabled: req.Enabled,
+	})
+	if err != nil {
+		writeWebhookError(w, err, "更新 Webhook 失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, toWebhookResponse(webhook))
+}
+
+// DeleteWebhookHandler 删除 Webhook。
+func (h *WebhookHandler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	webhookID, ok := parseUintVar(w, r, "webhookID", "无效的 Webhook ID 格式")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(r.Context(), userID, webhookID); err != nil {
+		writeWebhookError(w, err, "删除 Webhook 失败")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveriesHandler 列出 Webhook 最近的投递记录。
+func (h *WebhookHandler) ListDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		writeJSONError(w, "用户未认证", http.StatusUnauthorized)
+		return
+	}
+	webhookID, ok := parseUintVar(w, r, "webhookID", "无效的 Webhook ID 格式")
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(r.Context(), userID, webhookID)
+	if err != nil {
+		writeWebhookError(w, err, "获取投递记录失败")
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, deliveries)
+}
+
+// toWebhookResponse 将 Webhook 记录转换为展示结构。
+func toWebhookResponse(webhook *models.Webhook) WebhookResponse {
+	events := webhook.EventList()
+	if events == nil {
+		events = models.ValidWebhookEvents
+	}
+	return WebhookResponse{Webhook: webhook, Events: events}
+}
+
+// toWebhookResponses 批量转换 Webhook 记录。
+func toWebhookResponses(webhooks []*models.Webhook) []WebhookResponse {
+	resp := make([]WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		resp = append(resp, toWebhookResponse(webhook))
+	}
+	return resp
+}
+
+// toCreateWebhookResponse 构建登记 Webhook 的响应。
+func toCreateWebhookResponse(created *services.CreatedWebhook) CreateWebhookResponse {
+	return CreateWebhookResponse{WebhookResponse: toWebhookResponse(created.Webhook), Secret: created.Secret}
+}
+
+// writeWebhookError 将 WebhookService 的错误映射为 HTTP 响应。
+func writeWebhookError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrBotNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidWebhookEvent):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrNotGroupMember), errors.Is(err, services.ErrGroupPermissionDenied),
+		errors.Is(err, services.ErrWebhookLimitReached):
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("%s: %v", failure, err)
+		writeJSONError(w, failure, http.StatusInternalServerError)
+	}
+}
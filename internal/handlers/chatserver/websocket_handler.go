@@ -2,12 +2,11 @@ package chatserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
-	// 如果需要在连接时验证 token
-	"im-go/internal/auth"
 	"im-go/internal/config"
 	"im-go/internal/imtypes"
 	"im-go/internal/services"
@@ -20,46 +19,56 @@ type WebSocketHandler struct {
 	messageService services.MessageService
 	userService    services.UserService // 可选，例如根据 token 获取用户信息
 	cfg            config.Config        // 用于获取 WebSocket 和 Auth 配置
-	tokenBlacklist auth.TokenBlacklist  // 新增：Token 黑名单服务
+	wsAuth         services.WSAuthService
+	checkOrigin    func(r *http.Request) bool // 来源白名单沿用 API 服务器的 CORS 配置
+	channelService services.ChannelService
 }
 
 // NewWebSocketHandler 创建一个新的 WebSocketHandler 实例。
-func NewWebSocketHandler(hub *ws.Hub, msgService services.MessageService, userService services.UserService, cfg config.Config, blacklist auth.TokenBlacklist) *WebSocketHandler {
+func NewWebSocketHandler(hub *ws.Hub, msgService services.MessageService, userService services.UserService, channelService services.ChannelService, wsAuth services.WSAuthService, cfg config.Config) *WebSocketHandler {
 	return &WebSocketHandler{
 		hub:            hub,
 		messageService: msgService,
 		userService:    userService,
+		channelService: channelService,
 		cfg:            cfg,
-		tokenBlacklist: blacklist, // 存储注入的黑名单服务
+		wsAuth:         wsAuth,
+		checkOrigin:    ws.NewOriginChecker(cfg.APIServer.CORS.AllowedOrigins),
 	}
 }
 
 // ServeWS 处理传入的 WebSocket 请求。
-// 它将 HTTP 连接升级为 WebSocket 连接，并为该连接创建一个新的客户端。
+// 它校验请求来源和连接凭证，然后将 HTTP 连接升级为 WebSocket 连接，并为该连接创建一个新的客户端。
+// 凭证通过 Sec-WebSocket-Protocol 携带访问令牌或一次性票据，或者通过 ?ticket= 携带票据，不接受匿名连接。
 func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
-	// 1. 用户认证 (示例：通过 token 查询参数)
-	token := r.URL.Query().Get("token")
-	var userID uint = 0 // 默认为0，代表匿名或未认证
-	var username string = "anonymous"
+	if !h.checkOrigin(r) {
+		log.Printf("拒绝来自 %q 的 WebSocket 连接：来源不在白名单中", r.Header.Get("Origin"))
+		http.Error(w, "不允许的来源", http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Has("token") {
+		// 令牌出现在 URL 中会被代理和访问日志记录，不再接受
+		http.Error(w, "不支持通过查询参数传递令牌，请使用 Sec-WebSocket-Protocol 或连接票据", http.StatusUnauthorized)
+		return
+	}
 
-	if token != "" {
-		// 使用 r.Context() 和注入的 h.tokenBlacklist
-		claims, err := auth.ValidateToken(r.Context(), token, h.cfg.Auth.JWTSecretKey, h.tokenBlacklist)
-		if err != nil {
-			log.Printf("WebSocket 连接尝试失败：令牌无效: %v (令牌: %s)", err, token)
-			http.Error(w, fmt.Sprintf("令牌无效: %v", err), http.StatusUnauthorized)
-			return
+	token, ticket := ws.RequestCredentials(r)
+	identity, err := h.wsAuth.Authenticate(r.Context(), services.WSCredentials{Token: token, Ticket: ticket})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWSCredentialsMissing):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, services.ErrWSCredentialsInvalid):
+			log.Printf("WebSocket 连接尝试失败 (来自 %s): %v", r.RemoteAddr, err)
+			http.Error(w, services.ErrWSCredentialsInvalid.Error(), http.StatusUnauthorized)
+		default:
+			log.Printf("WebSocket 连接认证出错 (来自 %s): %v", r.RemoteAddr, err)
+			http.Error(w, "认证失败", http.StatusInternalServerError)
 		}
-		userID = claims.UserID
-		username = claims.Username
-		log.Printf("用户 %s (ID: %d) 尝试连接 WebSocket", username, userID)
-	} else {
-		// 允许匿名连接的场景，或者如果你的应用设计为在 WebSocket 内部进行认证消息交换
-		log.Println("匿名用户尝试连接 WebSocket (无令牌)")
-		// 如果不允许匿名，则应在此处返回错误:
-		// http.Error(w, "缺少认证令牌", http.StatusUnauthorized)
-		// return
+		return
 	}
+	userID := identity.UserID
+	log.Printf("用户 %s (ID: %d) 尝试连接 WebSocket", identity.Username, userID)
 
 	// 创建一个回调函数，该函数将捕获 messageService 实例
 	rawInputHandler := func(ctx context.Context, input imtypes.RawMessageInput) error {
@@ -67,10 +76,36 @@ func (h *WebSocketHandler) ServeWS(w http.ResponseWriter, r *http.Request) {
 			log.Println("错误: WebSocketHandler 中的 messageService 未初始化")
 			return fmt.Errorf("messageService not available")
 		}
-		return h.messageService.SendMessage(ctx, input)
+		err := h.messageService.SendMessage(ctx, input)
+		var rateErr *services.RateLimitError
+		if errors.As(err, &rateErr) {
+			// 限流错误需要原样告知客户端，附带重试时间
+			return &imtypes.ClientError{Code: imtypes.ErrorCodeRateLimited, Message: rateErr.Error(), RetryAfter: rateErr.RetryAfter}
+		}
+		return err
 	}
 
 	// 将 HTTP 连接升级到 WebSocket
 	// 注意：userID 现在会传递给 ServeWsPerConnection，以便 Client 对象可以关联用户
-	ws.ServeWsPerConnection(h.hub, rawInputHandler, userID, w, r, h.cfg.WebSocket)
+	connIdentity := ws.Identity{UserID: userID, SessionID: identity.SessionID, ExpiresAt: identity.ExpiresAt}
+	ws.ServeWsPerConnection(h.hub, rawInputHandler, connIdentity, h.reauthenticate, w, r, h.cfg.WebSocket, h.checkOrigin)
+
+	// 连接注册后订阅用户所在频道的主题，频道消息由广播消费者按主题投递
+	if h.channelService != nil {
+		topics, err := h.channelService.GetSubscribedTopics(r.Context(), userID)
+		if err != nil {
+			log.Printf("加载用户 %d 的频道订阅失败: %v", userID, err)
+			return
+		}
+		h.hub.SubscribeTopics(userID, topics...)
+	}
+}
+
+// reauthenticate 校验客户端在连接期间提交的新访问令牌，连接据此延长到新令牌的过期时间。
+func (h *WebSocketHandler) reauthenticate(ctx context.Context, token string) (ws.Identity, error) {
+	identity, err := h.wsAuth.Authenticate(ctx, services.WSCredentials{Token: token})
+	if err != nil {
+		return ws.Identity{}, err
+	}
+	return ws.Identity{UserID: identity.UserID, SessionID: identity.SessionID, ExpiresAt: identity.ExpiresAt}, nil
 }
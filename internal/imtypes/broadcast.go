@@ -0,0 +1,56 @@
+package imtypes
+
+import "fmt"
+
+// BroadcastKind identifies what a BroadcastEnvelope carries.
+type BroadcastKind string
+
+const (
+	// BroadcastMessage delivers Message to every local connection subscribed to Topic.
+	BroadcastMessage BroadcastKind = "message"
+	// BroadcastSubscription adds (Subscribed=true) or removes UserID's live connection from Topic.
+	BroadcastSubscription BroadcastKind = "subscription"
+	// BroadcastConversation delivers Message to the locally connected participants of ConversationID.
+	// Each chat server expands the participant list from its own membership cache.
+	BroadcastConversation BroadcastKind = "conversation"
+	// BroadcastMembership tells chat servers that ConversationID's participants changed,
+	// so cached membership for it must be dropped. UserID is the member who joined
+	// (Subscribed=true) or left; the webhook dispatcher turns these into member events.
+	BroadcastMembership BroadcastKind = "membership"
+	// BroadcastSessionRevoked tells chat servers to disconnect UserID's live connection
+	// if it was authenticated by SessionID (0 means any session of the user).
+	BroadcastSessionRevoked BroadcastKind = "session_revoked"
+)
+
+// BroadcastEnvelope is published once per event to the broadcast Kafka topic.
+// Every chat server instance consumes all envelopes and fans them out to its own
+// connected clients, so the sender never has to enumerate recipients.
+type BroadcastEnvelope struct {
+	Kind           BroadcastKind `json:"kind"`
+	Topic          string        `json:"topic,omitempty"`
+	ConversationID uint          `json:"conversationId"`
+	// ExcludeUserID skips one local recipient (usually the sender, who already has the message).
+	ExcludeUserID uint     `json:"excludeUserId,omitempty"`
+	Message       *Message `json:"message,omitempty"`
+	// UserID and Subscribed are set for BroadcastSubscription and BroadcastMembership envelopes.
+	UserID     uint `json:"userId,omitempty"`
+	Subscribed bool `json:"subscribed,omitempty"`
+	// SessionID is set for BroadcastSessionRevoked envelopes.
+	SessionID uint `json:"sessionId,omitempty"`
+}
+
+// ConversationKey returns the partition key used for conversation-scoped envelopes,
+// keeping messages and membership changes of one conversation in order.
+func ConversationKey(conversationID uint) string {
+	return fmt.Sprintf("conversation:%d", conversationID)
+}
+
+// UserKey returns the partition key used for user-scoped envelopes that have no conversation.
+func UserKey(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// ChannelTopic returns the hub topic name for a channel conversation.
+func ChannelTopic(conversationID uint) string {
+	return fmt.Sprintf("channel:%d", conversationID)
+}
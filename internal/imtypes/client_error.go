@@ -0,0 +1,36 @@
+package imtypes
+
+import "time"
+
+// Error codes carried in the metadata of ErrorMessageType frames.
+const (
+	ErrorCodeRateLimited = "rate_limited" // the send was rejected by rate limiting or slow mode; retry after RetryAfterMs
+	ErrorCodeSendFailed  = "send_failed"  // the send could not be accepted for another reason
+	ErrorCodeAuthFailed  = "auth_failed"  // an AuthMessageType frame carried an invalid token or one for another user or session
+	// ErrorCodeBlocked and ErrorCodePrivacyRestricted reject a private message after it was accepted for delivery:
+	// one of the two users has blocked the other, or the receiver only accepts private messages from friends.
+	ErrorCodeBlocked           = "blocked"
+	ErrorCodePrivacyRestricted = "privacy_restricted"
+	// ErrorCodeInvalidAttachment rejects a file or image message whose attachmentId was not uploaded by the sender,
+	// belongs to another conversation or is already referenced by another message. Like ErrorCodeBlocked it arrives asynchronously.
+	ErrorCodeInvalidAttachment = "invalid_attachment"
+)
+
+// ErrorPayload is the Metadata of an ErrorMessageType frame sent back to the client.
+type ErrorPayload struct {
+	Code         string `json:"code"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"`
+}
+
+// ClientError is an error that should be reported back to the sending client as-is.
+// Errors of any other type are reported with ErrorCodeSendFailed and a generic message.
+type ClientError struct {
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (e *ClientError) Error() string {
+	return e.Message
+}
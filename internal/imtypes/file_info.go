@@ -1,11 +1,21 @@
 // internal/imtypes/file_info.go
 package imtypes
 
+import "time"
+
 // FileInfo 包含上传文件的基本信息和访问路径。
 type FileInfo struct {
-	URL      string `json:"url"`      // 可公开访问的文件 URL
+	URL      string `json:"url"`      // 文件的访问 URL
 	Path     string `json:"path"`     // 文件在存储系统中的路径或标识符
 	Size     int64  `json:"size"`     // 文件大小 (字节)
 	MimeType string `json:"mimeType"` // 文件的 MIME 类型
 	FileName string `json:"fileName"` // 原始文件名
 }
+
+// ObjectInfo 是存储系统中一个已保存文件的元数据，由 StorageService 的 Stat、Open 和 List 返回。
+type ObjectInfo struct {
+	Path     string    `json:"path"`     // 与 FileInfo.Path 相同的标识符
+	Size     int64     `json:"size"`     // 文件大小 (字节)
+	MimeType string    `json:"mimeType"` // 文件的 MIME 类型，未知时为 application/octet-stream
+	ModTime  time.Time `json:"modTime"`  // 最后修改时间
+}
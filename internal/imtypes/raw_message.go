@@ -1,6 +1,9 @@
 package imtypes
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // RawMessageInput 定义了一个通用的消息传输结构。
 // 这可以是一个独立的 DTO (Data Transfer Object)
@@ -13,5 +16,8 @@ type RawMessageInput struct {
 	Timestamp      time.Time `json:"timestamp"`                // 时间戳
 	FileName       string    `json:"fileName,omitempty"`       // 文件名 (如果适用)
 	FileSize       int64     `json:"fileSize,omitempty"`       // 文件大小 (如果适用)
+	AttachmentID   uint      `json:"attachmentId,omitempty"`   // 图片或文件消息引用的附件ID (如果适用)
 	ConversationID string    `json:"conversationId,omitempty"` // 会话ID，用于群聊消息
+	// Metadata 目前只用于 callback 消息 (见 CallbackPayload)，其他类型的消息忽略客户端提供的元数据。
+	Metadata json.RawMessage `json:"metadata,omitempty"`
 }
@@ -3,11 +3,21 @@ package imtypes
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
+)
+
+var (
+	// ErrFileNotFound 表示存储系统中没有指定路径的文件。
+	ErrFileNotFound = errors.New("文件不存在")
+	// ErrInvalidFilePath 表示路径不是 UploadFile 可能返回的路径，例如包含 ".." 或目录分隔符。
+	ErrInvalidFilePath = errors.New("无效的文件路径")
 )
 
 // StorageService 定义了文件存储操作的接口。
 // 将接口定义放在 imtypes 中以打破 storage 和 services 之间的循环依赖。
+// 除 UploadFile 外，各方法的 path 参数都是 UploadFile 返回的 FileInfo.Path。
 type StorageService interface {
 	// UploadFile 将读取器中的内容上传到存储系统。
 	// fileName 是原始文件名，用于可能的存储路径或元数据。
@@ -15,7 +25,24 @@ type StorageService interface {
 	// 返回文件的信息 (FileInfo)，包括访问 URL。
 	UploadFile(ctx context.Context, reader io.Reader, fileSize int64, fileName string, mimeType string) (*FileInfo, error) // Note: FileInfo is also defined in imtypes
 
-	// DeleteFile 从存储系统中删除文件 (可选实现)。
-	// pathOrIdentifier 是 UploadFile 返回的 Path 或其他唯一标识。
-	// DeleteFile(ctx context.Context, pathOrIdentifier string) error
+	// Open 打开文件用于读取。返回的读取器支持 Seek，可以用于 Range 请求；调用方负责关闭。
+	// 文件不存在时返回 ErrFileNotFound。
+	Open(ctx context.Context, path string) (io.ReadSeekCloser, *ObjectInfo, error)
+
+	// Stat 返回文件的元数据，文件不存在时返回 ErrFileNotFound。
+	Stat(ctx context.Context, path string) (*ObjectInfo, error)
+
+	// Delete 从存储系统中删除文件，文件不存在时返回 ErrFileNotFound。
+	Delete(ctx context.Context, path string) error
+
+	// List 按路径顺序列出以 prefix 开头的文件，最多 limit 个 (limit <= 0 表示不限制)。
+	List(ctx context.Context, prefix string, limit int) ([]*ObjectInfo, error)
+}
+
+// PresignedURLProvider 由支持预签名 URL 的存储后端 (如 S3) 实现。
+// 客户端通过预签名 URL 直接从存储下载文件，文件内容不经过 API 服务器。
+type PresignedURLProvider interface {
+	// PresignedGetURL 为 UploadFile 返回的 Path 生成一个在 expiry 后失效的下载 URL。
+	// contentDisposition 不为空时，下载响应使用该 Content-Disposition 头。
+	PresignedGetURL(ctx context.Context, path string, expiry time.Duration, contentDisposition string) (string, error)
 }
@@ -1,6 +1,9 @@
 package imtypes
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // MessageType defines the type of a message.
 type MessageType string
@@ -11,6 +14,21 @@ const (
 	FileMessageType   MessageType = "file"
 	EmojiMessageType  MessageType = "emoji"
 	SystemMessageType MessageType = "system" // For system notifications, e.g., user joined/left
+	RecallMessageType MessageType = "recall" // A previously delivered message (ID) has been recalled
+	ErrorMessageType  MessageType = "error"  // A message sent by this client was rejected (see ErrorPayload in Metadata)
+	// CallbackMessageType is sent by clients when a button on an interactive message is clicked
+	// (see CallbackPayload in Metadata). It is routed to the command or bot that produced the message and never stored.
+	CallbackMessageType MessageType = "callback"
+	// AuthMessageType is sent by clients with a fresh access token in Content to keep the connection open
+	// past the expiry of the token it was opened with. The server answers with an AuthMessageType frame
+	// carrying ReauthPayload, or an ErrorMessageType frame with ErrorCodeAuthFailed. It is never forwarded.
+	AuthMessageType MessageType = "auth"
+	// ReauthRequiredMessageType is sent by the server shortly before the connection's token expires
+	// (see ReauthPayload in Metadata). Unless the client sends AuthMessageType in time, the connection is closed.
+	ReauthRequiredMessageType MessageType = "reauth_required"
+	// FriendRequestMessageType is pushed by the server when a friend request involving the user is created,
+	// accepted, rejected or cancelled (see models.FriendRequestNotification in Metadata). It belongs to no conversation.
+	FriendRequestMessageType MessageType = "friend_request"
 )
 
 // Message defines the structure for messages exchanged over WebSocket or to be sent to clients.
@@ -23,5 +41,20 @@ type Message struct {
 	Timestamp      time.Time   `json:"timestamp"`
 	FileName       string      `json:"fileName,omitempty"`
 	FileSize       int64       `json:"fileSize,omitempty"`
+	AttachmentID   uint        `json:"attachmentId,omitempty"` // the uploaded file of an image or file message
 	ConversationID string      `json:"conversationId,omitempty"`
+	// Metadata carries structured data for system messages (see models.SystemEventMetadata),
+	// interactive messages (see models.InteractiveMetadata) and callbacks (see CallbackPayload).
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// CallbackPayload is the Metadata of a CallbackMessageType frame sent by the client.
+type CallbackPayload struct {
+	MessageID string `json:"messageId"` // the interactive message whose button was clicked
+	ButtonID  string `json:"buttonId"`
+}
+
+// ReauthPayload is the Metadata of ReauthRequiredMessageType and AuthMessageType frames sent by the server.
+type ReauthPayload struct {
+	ExpiresAt time.Time `json:"expiresAt"` // when the connection will be closed unless it re-authenticates
 }
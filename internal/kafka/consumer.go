@@ -25,6 +25,8 @@ type confluentKafkaConsumer struct {
 	consumer *kafka.Consumer
 	cfg      config.KafkaConfig
 	groupID  string // Store groupID for logging and potential re-use
+	// fanout consumers start at the end of the topic and never commit offsets (see NewConfluentKafkaFanoutConsumer).
+	fanout bool
 }
 
 // NewConfluentKafkaConsumer creates a new Kafka consumer instance using confluent-kafka-go.
@@ -36,6 +38,15 @@ func NewConfluentKafkaConsumer(cfg config.KafkaConfig) (MessageConsumer, error)
 	return &confluentKafkaConsumer{cfg: cfg}, nil
 }
 
+// NewConfluentKafkaFanoutConsumer creates a consumer for per-instance fan-out groups, where every instance
+// must see every message but only messages published while it is running matter (e.g. broadcasts to local
+// WebSocket connections). It starts at the latest offset and never commits, so a new or restarted instance
+// does not replay the retained topic, and its group holds no offsets and is removed by the broker once the
+// instance stops.
+func NewConfluentKafkaFanoutConsumer(cfg config.KafkaConfig) (MessageConsumer, error) {
+	return &confluentKafkaConsumer{cfg: cfg, fanout: true}, nil
+}
+
 // Consume starts consuming messages from the specified topics and group.
 // This method will block until the context is canceled or a fatal error occurs.
 func (c *confluentKafkaConsumer) Consume(ctx context.Context, topics []string, groupID string, handler MessageHandler) error {
@@ -44,11 +55,15 @@ func (c *confluentKafkaConsumer) Consume(ctx context.Context, topics []string, g
 	}
 	c.groupID = groupID
 
+	offsetReset := "earliest" // Process messages from the beginning if no offset is stored
+	if c.fanout {
+		offsetReset = "latest" // Only messages published after the consumer joins
+	}
 	configMap := &kafka.ConfigMap{
 		"bootstrap.servers":  strings.Join(c.cfg.Brokers, ","),
 		"group.id":           c.groupID,
-		"auto.offset.reset":  "earliest", // Process messages from the beginning if no offset is stored
-		"enable.auto.commit": "false",    // We will commit manually after processing
+		"auto.offset.reset":  offsetReset,
+		"enable.auto.commit": "false", // We will commit manually after processing
 		"security.protocol":  c.cfg.Protocol,
 		// Add other necessary configurations from c.cfg if needed
 		// e.g., security.protocol, sasl.mechanisms, sasl.username, sasl.password
@@ -89,9 +104,12 @@ func (c *confluentKafkaConsumer) Consume(ctx context.Context, topics []string, g
 			switch e := ev.(type) {
 			case *kafka.Message:
 				if err := handler(ctx, e); err != nil {
-					log.Printf("Error processing Kafka message for group %s (Topic: %s, Offset: %v): %v",
+					// The offset is not committed, but the message is not redelivered either: the next
+					// successful commit on this partition moves past it. Wrap handlers with RetryHandler
+					// when their failures are transient.
+					log.Printf("Skipping Kafka message that failed processing for group %s (Topic: %s, Offset: %v): %v",
 						groupID, *e.TopicPartition.Topic, e.TopicPartition.Offset, err)
-				} else {
+				} else if !c.fanout {
 					if _, err := c.consumer.CommitMessage(e); err != nil {
 						log.Printf("Failed to commit offset for group %s (Topic: %s, Offset: %v): %v",
 							groupID, *e.TopicPartition.Topic, e.TopicPartition.Offset, err)
@@ -0,0 +1,38 @@
+package kafkahandlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"im-go/internal/services"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// FriendRequestEventHandler consumes the FriendRequestEvent messages that the outbox relay publishes to
+// FriendRequestTopic and delivers the corresponding WebSocket notifications.
+type FriendRequestEventHandler struct {
+	friendService services.FriendRequestService
+}
+
+// NewFriendRequestEventHandler creates a new FriendRequestEventHandler.
+func NewFriendRequestEventHandler(fs services.FriendRequestService) *FriendRequestEventHandler {
+	return &FriendRequestEventHandler{friendService: fs}
+}
+
+// Handle is the MessageHandler passed to the Kafka consumer. Malformed messages are skipped; delivery errors
+// are returned so that a wrapping kafka.RetryHandler can retry the message, which is safe because DeliverEvent
+// is idempotent. The consumer itself does not redeliver a failed message.
+func (h *FriendRequestEventHandler) Handle(ctx context.Context, msg *kafka.Message) error {
+	var event services.FriendRequestEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.RequestID == 0 {
+		log.Printf("Skipping malformed friend request event at offset %d (value: %s): %v", msg.TopicPartition.Offset, string(msg.Value), err)
+		return nil
+	}
+	if err := h.friendService.DeliverEvent(ctx, &event); err != nil {
+		log.Printf("Error delivering %s notification for friend request %d: %v", event.Event, event.RequestID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// RetryHandler wraps handler so that a failed message is retried in place, up to attempts times in total,
+// waiting initialBackoff before the first retry and doubling the wait after each one. Consume does not
+// redeliver a message whose handler failed: the next successful commit on the partition moves past it.
+// Handlers whose errors are transient (a database or Kafka hiccup) should therefore be wrapped; once the
+// attempts are used up the message is logged as dropped and the last error is returned.
+// The partition is blocked while a message is being retried, so keep attempts * backoff short.
+func RetryHandler(handler MessageHandler, attempts int, initialBackoff time.Duration) MessageHandler {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return func(ctx context.Context, msg *kafka.Message) error {
+		backoff := initialBackoff
+		var err error
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if err = handler(ctx, msg); err == nil {
+				return nil
+			}
+			if attempt == attempts {
+				break
+			}
+			log.Printf("Kafka message %s failed (attempt %d/%d), retrying in %v: %v", describeMessage(msg), attempt, attempts, backoff, err)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		log.Printf("Dropping Kafka message %s after %d attempts: %v", describeMessage(msg), attempts, err)
+		return err
+	}
+}
+
+// describeMessage identifies a message in log lines as topic[partition]@offset.
+func describeMessage(msg *kafka.Message) string {
+	return msg.TopicPartition.String()
+}
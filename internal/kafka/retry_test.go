@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+func TestRetryHandler(t *testing.T) {
+	topic := "events"
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}}
+	errTransient := errors.New("transient")
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		calls := 0
+		handler := RetryHandler(func(ctx context.Context, m *kafka.Message) error {
+			calls++
+			if calls < 3 {
+				return errTransient
+			}
+			return nil
+		}, 5, time.Millisecond)
+		if err := handler(context.Background(), msg); err != nil || calls != 3 {
+			t.Fatalf("err = %v, calls = %d, want nil after 3 calls", err, calls)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		calls := 0
+		handler := RetryHandler(func(ctx context.Context, m *kafka.Message) error {
+			calls++
+			return errTransient
+		}, 3, time.Millisecond)
+		if err := handler(context.Background(), msg); !errors.Is(err, errTransient) || calls != 3 {
+			t.Fatalf("err = %v, calls = %d, want errTransient after 3 calls", err, calls)
+		}
+	})
+
+	t.Run("stops on cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		handler := RetryHandler(func(ctx context.Context, m *kafka.Message) error {
+			cancel()
+			return errTransient
+		}, 3, time.Hour)
+		if err := handler(ctx, msg); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fileMailer 不真正发送邮件，而是把邮件写入目录 (dir 为空时写入日志)，用于本地开发和测试。
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer 创建一个把邮件写入 dir 的 Mailer；dir 为空时只输出到日志。
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建邮件输出目录 %s 失败: %w", dir, err)
+		}
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+// Send 将邮件写入文件或日志。
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	if m.dir == "" {
+		log.Printf("[Mailer] To: %s | Subject: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.NewString())
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, buildMessage(m.from, msg), 0o600); err != nil {
+		return fmt.Errorf("写入邮件文件 %s 失败: %w", path, err)
+	}
+	log.Printf("[Mailer] 邮件已写入 %s (To: %s, Subject: %s)", path, msg.To, msg.Subject)
+	return nil
+}
@@ -0,0 +1,39 @@
+// Package mailer 提供发送邮件的抽象，以及 SMTP 和本地文件/日志两种实现。
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"im-go/internal/config"
+)
+
+// Message 是一封待发送的纯文本邮件。
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 定义了发送邮件的接口。
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New 根据配置创建 Mailer：TYPE 为 "smtp" 时通过 SMTP 服务器发送，
+// 为 "file" 或 "log" 时只把邮件写入 FILE_DIR 或日志，便于本地开发。
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Type {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("SMTP 邮件配置缺少 HOST")
+		}
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.FileDir, cfg.From)
+	case "log", "":
+		return NewFileMailer("", cfg.From)
+	default:
+		return nil, fmt.Errorf("不支持的邮件发送类型: %s", cfg.Type)
+	}
+}
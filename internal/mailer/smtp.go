@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"im-go/internal/config"
+)
+
+// defaultSMTPTimeout 是未配置 MAIL.SMTP.TIMEOUT 时一次发送的最长时间。
+const defaultSMTPTimeout = 30 * time.Second
+
+// smtpMailer 通过 SMTP 服务器发送邮件。
+type smtpMailer struct {
+	host    string
+	addr    string
+	auth    smtp.Auth
+	from    string
+	timeout time.Duration
+}
+
+// NewSMTPMailer 创建一个通过 SMTP 发送邮件的 Mailer。配置了用户名时使用 PLAIN 认证。
+func NewSMTPMailer(cfg config.MailConfig) Mailer {
+	m := &smtpMailer{
+		host:    cfg.SMTP.Host,
+		addr:    net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		from:    cfg.From,
+		timeout: cfg.SMTP.Timeout,
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultSMTPTimeout
+	}
+	if cfg.SMTP.Username != "" {
+		m.auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return m
+}
+
+// Send 发送邮件，与 smtp.SendMail 的流程相同 (支持时使用 STARTTLS)。整个会话受 ctx 和 MAIL.SMTP.TIMEOUT 中
+// 较早的截止时间限制，ctx 被取消时立即断开连接，缓慢或无响应的 SMTP 服务器不会让调用方一直等待。
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := m.send(ctx, msg); err != nil {
+		return fmt.Errorf("通过 SMTP 发送邮件到 %s 失败: %w", msg.To, err)
+	}
+	return nil
+}
+
+func (m *smtpMailer) send(ctx context.Context, msg Message) error {
+	deadline := time.Now().Add(m.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("SMTP 服务器不支持认证")
+		}
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(envelopeAddress(m.from)); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(m.from, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// envelopeAddress 返回 MAIL FROM 使用的地址，去掉 "IM-Go <noreply@example.com>" 中的显示名称。
+func envelopeAddress(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return addr.Address
+	}
+	return from
+}
+
+// buildMessage 构造 RFC 5322 格式的 UTF-8 纯文本邮件。
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"im-go/internal/config"
+)
+
+// fakeSMTPServer 接受一个连接并运行 handle，返回用于创建 Mailer 的配置。
+func fakeSMTPServer(t *testing.T, handle func(conn net.Conn)) config.MailConfig {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return config.MailConfig{
+		From: "IM-Go <noreply@example.com>",
+		SMTP: config.SMTPConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, Timeout: 5 * time.Second},
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	received := make(chan []string, 1)
+	cfg := fakeSMTPServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		var commands []string
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			commands = append(commands, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 fake")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					body, err := r.ReadString('\n')
+					if err != nil || body == ".\r\n" {
+						break
+					}
+				}
+				reply("250 queued")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- commands
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	})
+
+	m := NewSMTPMailer(cfg)
+	if err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "hi", Body: "hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	commands := <-received
+	want := []string{"MAIL FROM:<noreply@example.com>", "RCPT TO:<alice@example.com>", "DATA", "QUIT"}
+	if len(commands) < len(want) || strings.Join(commands[len(commands)-len(want):], "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want to end with %q", commands, want)
+	}
+}
+
+func TestSMTPMailerSendGivesUpOnUnresponsiveServer(t *testing.T) {
+	// 服务器接受连接后不发送问候语
+	hang := func(conn net.Conn) { time.Sleep(5 * time.Second) }
+
+	t.Run("timeout", func(t *testing.T) {
+		cfg := fakeSMTPServer(t, hang)
+		cfg.SMTP.Timeout = 100 * time.Millisecond
+		start := time.Now()
+		if err := NewSMTPMailer(cfg).Send(context.Background(), Message{To: "alice@example.com"}); err == nil {
+			t.Fatal("Send 应返回错误")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Send took %v", elapsed)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		cfg := fakeSMTPServer(t, hang)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := NewSMTPMailer(cfg).Send(ctx, Message{To: "alice@example.com"}); err == nil {
+			t.Fatal("Send 应返回错误")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Send took %v", elapsed)
+		}
+	})
+}
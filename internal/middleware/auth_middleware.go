@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"im-go/internal/auth"
-	// "im-go/internal/config" // 假设 jwtSecret 会直接传入
+	"im-go/internal/models"
+
+	"github.com/gorilla/mux"
 	// "encoding/json" // 如果需要 writeJSONError
 	// "fmt"           // 如果需要 writeJSONError
 )
@@ -26,10 +28,37 @@ const JTIKey contextKey = "jti"
 // ClaimsKey 是用于在上下文中存储完整 Claims 对象的键。
 const ClaimsKey contextKey = "claims"
 
+// APIKeyKey 是用于在上下文中存储 API Key 记录的键，只在使用 API Key 认证的请求中存在。
+const APIKeyKey contextKey = "apiKey"
+
+// APIKeyAuthenticator 校验机器人的 API Key，由 services.BotService 实现。
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error)
+}
+
+// apiKeyRoute 是允许使用 API Key 访问的路由处理器，见 AllowAPIKey。
+type apiKeyRoute struct {
+	scope   models.APIKeyScope
+	handler http.Handler
+}
+
+// ServeHTTP 实现 http.Handler 接口。
+func (h *apiKeyRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+// AllowAPIKey 声明一个路由允许持有 scope 权限范围的 API Key 访问。
+// 未经 AllowAPIKey 包装的路由只接受 JWT，API Key 请求一律返回 403。
+func AllowAPIKey(scope models.APIKeyScope, handler http.HandlerFunc) http.Handler {
+	return &apiKeyRoute{scope: scope, handler: handler}
+}
+
 // AuthMiddleware 创建一个用于 gorilla/mux 的 HTTP 中间件，用于 JWT 认证。
-// jwtSecret 是用于验证 Token 的密钥。
+// keys 按 kid 提供验证 Token 签名的密钥。
 // blacklist 是 TokenBlacklist 接口的实例。
-func AuthMiddleware(jwtSecret string, blacklist auth.TokenBlacklist) func(http.Handler) http.Handler {
+// apiKeys 不为 nil 时，以 models.APIKeyTokenPrefix 开头的 Bearer Token 按机器人的 API Key 校验，
+// 且只能访问通过 AllowAPIKey 声明的路由。
+func AuthMiddleware(keys auth.KeySet, blacklist auth.TokenBlacklist, apiKeys APIKeyAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -45,7 +74,12 @@ func AuthMiddleware(jwtSecret string, blacklist auth.TokenBlacklist) func(http.H
 			}
 			tokenString := parts[1]
 
-			claims, err := auth.ValidateToken(r.Context(), tokenString, jwtSecret, blacklist)
+			if apiKeys != nil && strings.HasPrefix(tokenString, models.APIKeyTokenPrefix) {
+				serveWithAPIKey(w, r, next, apiKeys, tokenString)
+				return
+			}
+
+			claims, err := auth.ValidateToken(r.Context(), tokenString, keys, blacklist)
 			if err != nil {
 				writeJSONError(w, "Token 无效、已过期或已被吊销: "+err.Error(), http.StatusUnauthorized)
 				return
@@ -63,6 +97,33 @@ func AuthMiddleware(jwtSecret string, blacklist auth.TokenBlacklist) func(http.H
 	}
 }
 
+// serveWithAPIKey 校验 API Key 及其对当前路由的权限范围，通过后以机器人身份调用下一个处理器。
+func serveWithAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, apiKeys APIKeyAuthenticator, key string) {
+	apiKey, bot, err := apiKeys.AuthenticateAPIKey(r.Context(), key)
+	if err != nil {
+		writeJSONError(w, "API Key 无效、已过期或已被吊销", http.StatusUnauthorized)
+		return
+	}
+
+	var route *apiKeyRoute
+	if current := mux.CurrentRoute(r); current != nil {
+		route, _ = current.GetHandler().(*apiKeyRoute)
+	}
+	if route == nil {
+		writeJSONError(w, "该接口不支持使用 API Key 访问", http.StatusForbidden)
+		return
+	}
+	if !apiKey.HasScope(route.scope) {
+		writeJSONError(w, "API Key 缺少权限范围 "+string(route.scope), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, bot.ID)
+	ctx = context.WithValue(ctx, UsernameKey, bot.Username)
+	ctx = context.WithValue(ctx, APIKeyKey, apiKey)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 // GetUserIDFromContext 从上下文中获取用户ID。
 // 如果用户ID不存在或类型不正确，返回0和false。
 func GetUserIDFromContext(ctx context.Context) (uint, bool) {
@@ -91,6 +152,13 @@ func GetClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
 	return claims, ok
 }
 
+// GetAPIKeyFromContext 从上下文中获取认证使用的 API Key。
+// 如果请求不是通过 API Key 认证的，返回 nil 和 false。
+func GetAPIKeyFromContext(ctx context.Context) (*models.APIKey, bool) {
+	apiKey, ok := ctx.Value(APIKeyKey).(*models.APIKey)
+	return apiKey, ok
+}
+
 // writeJSONError 是一个辅助函数，用于发送 JSON 格式的错误响应。
 // 注意：为了简单起见，这里没有导入 "encoding/json"。如果需要，请取消注释并导入。
 func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPKey 是用于在上下文中存储客户端 IP 地址的键，见 ClientIPMiddleware。
+const ClientIPKey contextKey = "clientIP"
+
+// ClientIPMiddleware 创建一个解析客户端 IP 地址并写入上下文的中间件。
+// trustedProxies 是受信任的反向代理地址，可以是单个 IP 或 CIDR。只有直接连接的对端 (RemoteAddr)
+// 是受信任的代理时才使用 X-Forwarded-For / X-Real-IP，否则这些请求头由客户端任意填写，一律忽略。
+func ClientIPMiddleware(trustedProxies []string) (func(http.Handler) http.Handler, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("无效的受信任代理 %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("无效的受信任代理 %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	resolver := &clientIPResolver{trusted: prefixes}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ClientIPKey, resolver.resolve(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// GetClientIPFromContext 从上下文中获取 ClientIPMiddleware 解析出的客户端 IP 地址。
+func GetClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ClientIPKey).(string)
+	return ip, ok && ip != ""
+}
+
+type clientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// resolve 返回请求的客户端 IP 地址。对端是受信任的代理时，从右向左遍历 X-Forwarded-For，
+// 跳过受信任的代理，取第一个不受信任的地址；左侧更早的条目可能是客户端伪造的，不予采用。
+func (c *clientIPResolver) resolve(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !c.isTrusted(remote) {
+		return remote
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			addr, err := netip.ParseAddr(hop)
+			if err != nil {
+				// 无法解析的条目之后的内容都不可信，停在最后一个可信的地址上
+				return remote
+			}
+			if !c.isTrusted(hop) {
+				return addr.Unmap().String()
+			}
+			remote = addr.Unmap().String()
+		}
+		return remote
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return remote
+}
+
+func (c *clientIPResolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
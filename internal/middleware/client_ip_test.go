@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores forwarded headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "5.6.7.8"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "peer outside trusted list",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			trusted:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.9"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "spoofed leftmost entry is skipped",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 10.0.0.2"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "unparsable entry stops the walk",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.9, garbage, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "trusted proxy with X-Real-IP",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.9"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "trusted proxy without headers",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "ipv6 peer",
+			trusted:    []string{"::1"},
+			remoteAddr: "[::1]:5000",
+			headers:    map[string]string{"X-Forwarded-For": "2001:db8::1"},
+			want:       "2001:db8::1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := ClientIPMiddleware(tt.trusted)
+			if err != nil {
+				t.Fatalf("ClientIPMiddleware: %v", err)
+			}
+			var got string
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = GetClientIPFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddlewareRejectsInvalidProxy(t *testing.T) {
+	for _, entry := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := ClientIPMiddleware([]string{entry}); err == nil {
+			t.Errorf("ClientIPMiddleware(%q) 应返回错误", entry)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// GroupAnnouncement 是群组公告。每次发布都会新增一条记录，最新的一条即为当前公告。
+type GroupAnnouncement struct {
+	BaseModel
+	GroupID  uint   `gorm:"not null;index" json:"groupId"`
+	AuthorID uint   `gorm:"not null" json:"authorId"`
+	Content  string `gorm:"type:text;not null" json:"content"`
+
+	// 关联关系
+	Author User `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+}
+
+// TableName 指定 GroupAnnouncement 模型的表名。
+func (GroupAnnouncement) TableName() string {
+	return "group_announcements"
+}
+
+// GroupAnnouncementAck 记录成员对某条公告的确认 (已读)。
+type GroupAnnouncementAck struct {
+	BaseModel
+	AnnouncementID uint      `gorm:"not null;uniqueIndex:idx_announcement_ack" json:"announcementId"`
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_announcement_ack" json:"userId"`
+	AckedAt        time.Time `gorm:"not null" json:"ackedAt"`
+
+	// 关联关系
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName 指定 GroupAnnouncementAck 模型的表名。
+func (GroupAnnouncementAck) TableName() string {
+	return "group_announcement_acks"
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKeyTokenPrefix 是 API Key 明文的前缀，认证中间件据此区分 API Key 和 JWT。
+const APIKeyTokenPrefix = "imk_"
+
+// APIKeyScope 是 API Key 的权限范围，只能访问声明了对应范围的接口。
+type APIKeyScope string
+
+const (
+	ScopeMessagesSend      APIKeyScope = "messages:send"      // 通过 REST 接口发送消息
+	ScopeMessagesRead      APIKeyScope = "messages:read"      // 读取所在会话的消息
+	ScopeConversationsRead APIKeyScope = "conversations:read" // 读取会话列表
+)
+
+// ValidAPIKeyScopes 列出所有可以授予 API Key 的权限范围。
+var ValidAPIKeyScopes = []APIKeyScope{ScopeMessagesSend, ScopeMessagesRead, ScopeConversationsRead}
+
+// IsValid 检查权限范围是否已定义。
+func (s APIKeyScope) IsValid() bool {
+	for _, scope := range ValidAPIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey 是机器人账号用于调用 API 的长期凭证。只保存 Key 的 SHA-256 哈希，
+// 明文只在创建时返回一次；吊销后设置 RevokedAt，记录保留用于审计。
+type APIKey struct {
+	BaseModel
+	UserID      uint       `gorm:"not null;index" json:"userId"` // Key 所属的机器人
+	CreatedByID uint       `gorm:"not null" json:"createdById"`  // 创建 Key 的用户 (机器人的所有者)
+	Name        string     `gorm:"type:varchar(100);not null" json:"name"`
+	KeyPrefix   string     `gorm:"type:varchar(16);not null" json:"keyPrefix"` // 明文的开头几位，用于在列表中辨认
+	KeyHash     string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	Scopes      string     `gorm:"type:varchar(255);not null" json:"-"` // 以逗号分隔的 APIKeyScope
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`                 // 为空表示不过期
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+}
+
+// TableName 指定 APIKey 模型的表名。
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// ScopeList 返回 Key 被授予的权限范围。
+func (k *APIKey) ScopeList() []APIKeyScope {
+	if k.Scopes == "" {
+		return nil
+	}
+	parts := strings.Split(k.Scopes, ",")
+	scopes := make([]APIKeyScope, 0, len(parts))
+	for _, part := range parts {
+		scopes = append(scopes, APIKeyScope(part))
+	}
+	return scopes
+}
+
+// SetScopes 设置 Key 的权限范围。
+func (k *APIKey) SetScopes(scopes []APIKeyScope) {
+	parts := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		parts = append(parts, string(scope))
+	}
+	k.Scopes = strings.Join(parts, ",")
+}
+
+// HasScope 检查 Key 是否被授予了指定的权限范围。
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive 检查 Key 在 now 时是否可用。
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
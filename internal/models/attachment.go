@@ -0,0 +1,19 @@
+package models
+
+// Attachment 记录一个上传到存储系统的文件及其归属。上传时可以指定会话，
+// 作为文件或图片消息发送后关联到该消息；下载时按会话成员身份或签名 URL 授权。
+type Attachment struct {
+	BaseModel
+	UploaderID     uint   `gorm:"not null;index" json:"uploaderId"`
+	StoragePath    string `gorm:"type:varchar(255);not null;uniqueIndex" json:"-"` // imtypes.FileInfo.Path，不返回给客户端
+	FileName       string `gorm:"type:varchar(255);not null" json:"fileName"`      // 原始文件名，下载时用于 Content-Disposition
+	MimeType       string `gorm:"type:varchar(127);not null" json:"mimeType"`
+	Size           int64  `gorm:"not null" json:"size"`
+	ConversationID *uint  `gorm:"index" json:"conversationId,omitempty"` // 附件所属的会话，为空时只有上传者可以访问
+	MessageID      *uint  `gorm:"index" json:"messageId,omitempty"`      // 引用该附件的消息
+}
+
+// TableName 指定 Attachment 模型的表名。
+func (Attachment) TableName() string {
+	return "attachments"
+}
@@ -0,0 +1,17 @@
+package models
+
+// BotCommand 是机器人登记的斜杠命令。机器人所在会话中以 "/名称" 开头的消息会路由给该机器人，
+// 通过机器人订阅了 command.invoked 事件的 Webhook 同步投递，响应体作为命令的回复。
+type BotCommand struct {
+	BaseModel
+	BotID       uint   `gorm:"not null;uniqueIndex:idx_bot_command_name" json:"botId"`
+	Name        string `gorm:"type:varchar(32);not null;uniqueIndex:idx_bot_command_name" json:"name"` // 小写，不含 "/"
+	Description string `gorm:"type:varchar(255)" json:"description"`
+
+	Bot User `gorm:"foreignKey:BotID" json:"-"`
+}
+
+// TableName 指定 BotCommand 模型的表名。
+func (BotCommand) TableName() string {
+	return "bot_commands"
+}
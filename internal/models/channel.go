@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Channel 代表一个广播频道：只有管理员可以发言，订阅者只读。
+// 每个频道对应一个 Type 为 "channel" 的 Conversation (TargetID 为 Channel.ID)。
+// 管理员作为该会话的参与者 (IsAdmin=true)，订阅者只记录在 ChannelSubscription 中，
+// 不会写入 conversation_participants。
+type Channel struct {
+	BaseModel
+	Name            string `gorm:"type:varchar(100);not null;index" json:"name"`
+	Description     string `gorm:"type:text" json:"description,omitempty"`
+	AvatarURL       string `gorm:"type:varchar(255)" json:"avatarUrl,omitempty"`
+	OwnerID         uint   `gorm:"not null;index" json:"ownerId"`
+	ConversationID  uint   `gorm:"not null;uniqueIndex" json:"conversationId"`
+	SubscriberCount int    `gorm:"default:0" json:"subscriberCount"`
+	IsPublic        bool   `gorm:"default:true" json:"isPublic"` // 公开频道可以被搜索和自由订阅
+
+	// 关联关系
+	Owner User `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
+}
+
+// TableName 指定 Channel 模型的表名。
+func (Channel) TableName() string {
+	return "channels"
+}
+
+// ChannelSubscription 记录用户对频道的订阅。
+type ChannelSubscription struct {
+	BaseModel
+	ChannelID    uint      `gorm:"not null;uniqueIndex:idx_channel_subscriber" json:"channelId"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_channel_subscriber;index" json:"userId"`
+	SubscribedAt time.Time `gorm:"not null" json:"subscribedAt"`
+
+	// 关联关系
+	Channel Channel `gorm:"foreignKey:ChannelID" json:"channel,omitempty"`
+}
+
+// TableName 指定 ChannelSubscription 模型的表名。
+func (ChannelSubscription) TableName() string {
+	return "channel_subscriptions"
+}
@@ -8,6 +8,7 @@ type ConversationType string
 const (
 	PrivateConversation ConversationType = "private" // 一对一聊天
 	GroupConversation   ConversationType = "group"   // 群组聊天
+	ChannelConversation ConversationType = "channel" // 广播频道：仅管理员发言，订阅者只读
 )
 
 // Conversation 代表一个聊天会话（一对一或群组）。
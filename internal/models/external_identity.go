@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExternalIdentity 将外部身份提供方 (OIDC) 的账号关联到本地用户。
+// 同一提供方的同一 Subject 只能关联一个用户，一个用户可以关联多个外部身份。
+type ExternalIdentity struct {
+	BaseModel
+	UserID      uint       `gorm:"not null;index" json:"userId"`
+	Provider    string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity_subject" json:"provider"` // 提供方的 issuer
+	Subject     string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_external_identity_subject" json:"subject"`
+	Email       string     `gorm:"type:varchar(100)" json:"email,omitempty"` // 最近一次登录时提供方声明的邮箱
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// TableName 指定 ExternalIdentity 模型的表名。
+func (ExternalIdentity) TableName() string {
+	return "external_identities"
+}
@@ -8,6 +8,17 @@ const (
 	FriendRequestStatusAccepted  FriendRequestStatus = "accepted"
 	FriendRequestStatusRejected  FriendRequestStatus = "rejected"
 	FriendRequestStatusCancelled FriendRequestStatus = "cancelled" // If sender cancels
+	FriendRequestStatusExpired   FriendRequestStatus = "expired"   // Pending for longer than the configured TTL
+)
+
+// FriendRequestSource 记录请求者是从哪里找到接收者的，会展示给接收者。
+type FriendRequestSource string
+
+const (
+	FriendRequestSourceSearch     FriendRequestSource = "search"     // 用户搜索
+	FriendRequestSourceGroup      FriendRequestSource = "group"      // 同一个群组，SourceGroupID 为该群组
+	FriendRequestSourceSuggestion FriendRequestSource = "suggestion" // 好友推荐
+	FriendRequestSourceProfile    FriendRequestSource = "profile"    // 用户资料页
 )
 
 // FriendRequest 代表一个好友请求记录
@@ -17,6 +28,9 @@ type FriendRequest struct {
 	RecipientUserID uint                `gorm:"not null;index:idx_friend_request_users"`     // 请求接收者
 	Status          FriendRequestStatus `gorm:"type:varchar(20);not null;default:'pending'"` // 请求状态
 	RequestMessage  string              `gorm:"type:text"`                                   // 可选的请求消息
+	Source          FriendRequestSource `gorm:"type:varchar(20)"`                            // 可选的来源
+	SourceGroupID   *uint               // Source 为 group 时的群组ID
+	SourceGroupName string              `gorm:"-"` // 列表和通知中展示的群组名称，不落库
 
 	// Optional: Define relationships if needed for easier loading
 	// Requester User `gorm:"foreignKey:RequesterUserID"`
@@ -30,3 +44,34 @@ type FriendRequestWithRequester struct {
 	FriendRequest                // Embed the core FriendRequest data
 	Requester     *UserBasicInfo `json:"requester"` // Embed basic requester info
 }
+
+// FriendRequestWithRecipient is a DTO for listing the requests a user has sent,
+// with basic information about the user each request was sent to.
+type FriendRequestWithRecipient struct {
+	FriendRequest
+	Recipient *UserBasicInfo `json:"recipient"`
+}
+
+// Friend request notification events carried in FriendRequestNotification.Event.
+const (
+	FriendRequestEventCreated   = "created"   // sent to the recipient
+	FriendRequestEventAccepted  = "accepted"  // sent to the requester
+	FriendRequestEventRejected  = "rejected"  // sent to the requester
+	FriendRequestEventCancelled = "cancelled" // sent to the recipient
+	FriendRequestEventExpired   = "expired"   // sent to the requester
+)
+
+// FriendRequestNotification is the Metadata of the friend_request WebSocket frames pushed to
+// the other party when a friend request is created, accepted, rejected or cancelled.
+type FriendRequestNotification struct {
+	Event           string         `json:"event"`
+	RequestID       uint           `json:"requestId"`
+	RequesterUserID uint           `json:"requesterUserId"`
+	RecipientUserID uint           `json:"recipientUserId"`
+	Actor           *UserBasicInfo `json:"actor,omitempty"` // the user whose action triggered the notification
+	// Message, Source, SourceGroupID and SourceGroupName are only set on created events.
+	Message         string              `json:"message,omitempty"`
+	Source          FriendRequestSource `json:"source,omitempty"`
+	SourceGroupID   *uint               `json:"sourceGroupId,omitempty"`
+	SourceGroupName string              `json:"sourceGroupName,omitempty"`
+}
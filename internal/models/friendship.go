@@ -21,3 +21,57 @@ func (f *Friendship) EnsureCanonicalOrder() {
 		f.UserID1, f.UserID2 = f.UserID2, f.UserID1
 	}
 }
+
+// FriendProfile holds the private data a user keeps about one of their friends: a remark (alias), tags and
+// the contact group the friend is filed under. Unlike Friendship it is directional and only visible to OwnerID.
+// Rows are hard-deleted together with the friendship.
+type FriendProfile struct {
+	BaseModel
+	OwnerID        uint     `gorm:"not null;uniqueIndex:idx_friend_profile" json:"-"`
+	FriendID       uint     `gorm:"not null;uniqueIndex:idx_friend_profile" json:"-"`
+	Remark         string   `gorm:"type:varchar(64)" json:"remark"`
+	Tags           []string `gorm:"type:jsonb;serializer:json" json:"tags"`
+	ContactGroupID *uint    `gorm:"index" json:"contactGroupId"` // nil means the friend is not in any contact group
+}
+
+// TableName specifies the table name for FriendProfile.
+func (FriendProfile) TableName() string {
+	return "friend_profiles"
+}
+
+// ContactGroup is a user-defined group of friends such as "Work" or "Family". A friend belongs to at most one group.
+type ContactGroup struct {
+	BaseModel
+	OwnerID uint   `gorm:"not null;uniqueIndex:idx_contact_group_name" json:"-"`
+	Name    string `gorm:"type:varchar(50);not null;uniqueIndex:idx_contact_group_name" json:"name"`
+
+	MemberCount int `gorm:"-" json:"memberCount"` // filled in by the service
+}
+
+// TableName specifies the table name for ContactGroup.
+func (ContactGroup) TableName() string {
+	return "contact_groups"
+}
+
+// FriendInfo is an entry of the friends list: the friend's basic info plus the owner's private data about them.
+type FriendInfo struct {
+	UserBasicInfo
+	Remark         string   `json:"remark,omitempty"`
+	Tags           []string `json:"tags"`
+	ContactGroupID *uint    `json:"contactGroupId"`
+}
+
+// SuggestionCandidate is a non-friend ranked for friend suggestions, before their user info is loaded.
+type SuggestionCandidate struct {
+	UserID        uint `json:"userId"`
+	MutualFriends int  `json:"mutualFriends"`
+	SharedGroups  int  `json:"sharedGroups"`
+}
+
+// FriendSuggestion is an entry of the friend suggestions list.
+type FriendSuggestion struct {
+	UserBasicInfo
+	MutualFriendCount int    `json:"mutualFriendCount"`
+	SharedGroupCount  int    `json:"sharedGroupCount"`
+	Reason            string `json:"reason"` // human-readable, e.g. "5 个共同好友"
+}
@@ -14,6 +14,8 @@ type Group struct {
 	// 群组设置，例如：公开/私有，加入权限
 	IsPublic      bool   `gorm:"default:true" json:"isPublic"`                                          // 如果为 true，则任何人都可以查找并加入（或请求加入）
 	JoinCondition string `gorm:"type:varchar(50);default:'direct_join'" json:"joinCondition,omitempty"` // 例如：direct_join, approval_required, invite_only
+	// SlowModeSeconds 是慢速模式下普通成员两次发言的最小间隔，0 表示关闭。版主及以上角色不受限制。
+	SlowModeSeconds int `gorm:"default:0" json:"slowModeSeconds"`
 
 	// 关联关系
 	Owner   User          `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
@@ -31,11 +33,81 @@ func (Group) TableName() string {
 type GroupMemberRole string
 
 const (
-	AdminRole  GroupMemberRole = "admin"
-	MemberRole GroupMemberRole = "member"
-	// 可以添加其他角色，如 Moderator
+	OwnerRole     GroupMemberRole = "owner"
+	AdminRole     GroupMemberRole = "admin"
+	ModeratorRole GroupMemberRole = "moderator"
+	MemberRole    GroupMemberRole = "member"
 )
 
+// Rank 返回角色在层级中的等级，数值越大权限越高。未知角色返回 0。
+func (r GroupMemberRole) Rank() int {
+	switch r {
+	case OwnerRole:
+		return 4
+	case AdminRole:
+		return 3
+	case ModeratorRole:
+		return 2
+	case MemberRole:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsValid 检查角色是否为已定义的角色之一。
+func (r GroupMemberRole) IsValid() bool {
+	return r.Rank() > 0
+}
+
+// AtLeast 判断当前角色是否不低于给定角色。
+func (r GroupMemberRole) AtLeast(other GroupMemberRole) bool {
+	return r.Rank() >= other.Rank()
+}
+
+// GroupPermission 定义了群组内可按群配置的操作。
+type GroupPermission string
+
+const (
+	PermSendMessage    GroupPermission = "send_message"    // 在群聊中发言
+	PermInviteMembers  GroupPermission = "invite_members"  // 邀请他人入群
+	PermPinMessages    GroupPermission = "pin_messages"    // 置顶消息
+	PermEditInfo       GroupPermission = "edit_info"       // 修改群名称、简介、头像等资料
+	PermRecallMessages GroupPermission = "recall_messages" // 撤回他人发送的消息
+	PermAnnounce       GroupPermission = "announce"        // 发布群公告并查看确认情况
+	PermManageWebhooks GroupPermission = "manage_webhooks" // 管理群组的 Webhook 并查看投递记录
+)
+
+// DefaultGroupPermissions 是群组未单独配置时使用的权限矩阵（权限 -> 所需的最低角色）。
+var DefaultGroupPermissions = map[GroupPermission]GroupMemberRole{
+	PermSendMessage:    MemberRole,
+	PermInviteMembers:  MemberRole,
+	PermPinMessages:    ModeratorRole,
+	PermEditInfo:       AdminRole,
+	PermRecallMessages: ModeratorRole,
+	PermAnnounce:       AdminRole,
+	PermManageWebhooks: AdminRole,
+}
+
+// IsValid 检查权限是否为已定义的权限之一。
+func (p GroupPermission) IsValid() bool {
+	_, ok := DefaultGroupPermissions[p]
+	return ok
+}
+
+// GroupPermissionSetting 记录某个群组对某项权限所要求的最低角色，覆盖 DefaultGroupPermissions 中的默认值。
+type GroupPermissionSetting struct {
+	BaseModel
+	GroupID    uint            `gorm:"not null;uniqueIndex:idx_group_permission" json:"groupId"`
+	Permission GroupPermission `gorm:"type:varchar(50);not null;uniqueIndex:idx_group_permission" json:"permission"`
+	MinRole    GroupMemberRole `gorm:"type:varchar(20);not null" json:"minRole"`
+}
+
+// TableName 指定 GroupPermissionSetting 模型的表名。
+func (GroupPermissionSetting) TableName() string {
+	return "group_permission_settings"
+}
+
 // GroupMember 将用户链接到群组并定义其角色。
 type GroupMember struct {
 	BaseModel                 // 或者如果对于连接表更喜欢，可以仅用 ID, CreatedAt, UpdatedAt
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// LoginLockout 记录一次因连续登录失败导致的临时锁定，同时作为审计记录保留。
+// 锁定按登录时提交的用户名或邮箱 (Identifier) 生效，不存在的账号同样会被锁定，UserID 为 0。
+// 锁定在 LockedUntil 之后自动解除，用户通过邮件重置密码时会提前解除 (设置 ClearedAt)。
+type LoginLockout struct {
+	BaseModel
+	Identifier     string     `gorm:"type:varchar(255);not null;default:'';index" json:"identifier"` // 规范化后的用户名或邮箱
+	UserID         uint       `gorm:"not null;index" json:"userId"`
+	IPAddress      string     `gorm:"type:varchar(64)" json:"ipAddress,omitempty"` // 触发锁定的最后一次尝试的来源
+	UserAgent      string     `gorm:"type:varchar(512)" json:"userAgent,omitempty"`
+	FailedAttempts int        `gorm:"not null" json:"failedAttempts"`
+	LockedUntil    time.Time  `gorm:"not null;index" json:"lockedUntil"`
+	ClearedAt      *time.Time `json:"clearedAt,omitempty"`
+}
+
+// TableName 指定 LoginLockout 模型的表名。
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
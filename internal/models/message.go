@@ -19,6 +19,12 @@ const (
 	VideoMessageTypeDB  MessageTypeDB = "video"
 )
 
+// 消息状态
+const (
+	MessageStatusSent     = "sent"
+	MessageStatusRecalled = "recalled" // 已被撤回，内容已清空
+)
+
 // Message 代表存储在数据库中的聊天消息。
 type Message struct {
 	BaseModel
@@ -49,10 +55,11 @@ func (Message) TableName() string {
 // FileMetadata stores metadata for file messages.
 // This can be marshaled into Message.MetadataRaw.
 type FileMetadata struct {
-	FileName string `json:"fileName"`
-	FileSize int64  `json:"fileSize"`
-	MimeType string `json:"mimeType"`
-	URL      string `json:"url"` // URL to access the file
+	FileName     string `json:"fileName"`
+	FileSize     int64  `json:"fileSize"`
+	MimeType     string `json:"mimeType"`
+	URL          string `json:"url"`                    // URL to access the file
+	AttachmentID uint   `json:"attachmentId,omitempty"` // the Attachment holding the file
 }
 
 // ImageMetadata stores metadata for image messages.
@@ -64,6 +71,40 @@ type ImageMetadata struct {
 	Width        int    `json:"width"`
 	Height       int    `json:"height"`
 	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	AttachmentID uint   `json:"attachmentId,omitempty"` // the Attachment holding the image
+}
+
+// System event names carried in SystemEventMetadata.Event.
+const (
+	SystemEventMessagePinned       = "message_pinned"
+	SystemEventMessageUnpinned     = "message_unpinned"
+	SystemEventAnnouncementUpdated = "announcement_updated"
+)
+
+// SystemEventMetadata stores metadata for system messages generated by server-side events
+// (pins, announcements, ...), so clients can render them without parsing Content.
+type SystemEventMetadata struct {
+	Event          string `json:"event"`
+	ActorID        uint   `json:"actorId"`
+	MessageID      uint   `json:"messageId,omitempty"`
+	AnnouncementID uint   `json:"announcementId,omitempty"`
+}
+
+// MessageButton is a button attached to an interactive message. Clicking it sends a callback
+// event back to the slash command or bot that produced the message.
+type MessageButton struct {
+	ID    string `json:"id"` // returned in the callback, unique within the message
+	Label string `json:"label"`
+	Style string `json:"style,omitempty"` // default | primary | danger
+}
+
+// InteractiveMetadata stores metadata for text messages produced by slash commands and bots:
+// the buttons shown under the message, the command that callbacks are routed to, and whether
+// the message is ephemeral (pushed to the invoker only and never stored).
+type InteractiveMetadata struct {
+	Command   string          `json:"command,omitempty"`
+	Buttons   []MessageButton `json:"buttons,omitempty"`
+	Ephemeral bool            `json:"ephemeral,omitempty"`
 }
 
 // SetMetadata helper to set metadata
@@ -101,3 +142,16 @@ func (m *Message) GetImageMetadata() (*ImageMetadata, error) {
 	}
 	return &metadata, nil
 }
+
+// GetInteractiveMetadata helper to get the buttons of an interactive text message
+func (m *Message) GetInteractiveMetadata() (*InteractiveMetadata, error) {
+	if m.Type != TextMessageTypeDB || m.MetadataRaw == nil {
+		return nil, nil
+	}
+	var metadata InteractiveMetadata
+	err := json.Unmarshal(m.MetadataRaw, &metadata)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
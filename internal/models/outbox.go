@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// OutboxEventStatus 是发件箱事件的发布状态。
+type OutboxEventStatus string
+
+const (
+	OutboxPending   OutboxEventStatus = "pending"   // 等待发布或等待重试
+	OutboxPublished OutboxEventStatus = "published" // 已发布到 Kafka
+	OutboxFailed    OutboxEventStatus = "failed"    // 重试耗尽
+)
+
+// OutboxEvent 是事务性发件箱中的一条待发布的 Kafka 消息。它与产生它的业务数据在同一个数据库事务中写入，
+// 因此业务数据保存成功时事件一定不会丢失，由转发器发布后标记为 published。
+// 转发器至少发布一次，消费方需要按 Payload 中的业务ID保证幂等。
+type OutboxEvent struct {
+	BaseModel
+	Topic         string            `gorm:"type:varchar(255);not null" json:"topic"`
+	Key           string            `gorm:"type:varchar(255)" json:"key"`
+	Payload       string            `gorm:"type:text;not null" json:"payload"`
+	Status        OutboxEventStatus `gorm:"type:varchar(16);not null;index:idx_outbox_due,priority:1" json:"status"`
+	Attempts      int               `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time         `gorm:"not null;index:idx_outbox_due,priority:2" json:"nextAttemptAt"`
+	LastError     string            `gorm:"type:varchar(1024)" json:"lastError,omitempty"`
+	PublishedAt   *time.Time        `json:"publishedAt,omitempty"`
+}
+
+// TableName 指定 OutboxEvent 模型的表名。
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// PinnedMessage 记录会话中被置顶的消息。
+type PinnedMessage struct {
+	BaseModel
+	ConversationID uint      `gorm:"not null;uniqueIndex:idx_conversation_pinned_message" json:"conversationId"`
+	MessageID      uint      `gorm:"not null;uniqueIndex:idx_conversation_pinned_message" json:"messageId"`
+	PinnedByID     uint      `gorm:"not null" json:"pinnedById"`
+	PinnedAt       time.Time `gorm:"not null;index" json:"pinnedAt"`
+
+	// 关联关系
+	Message  Message `gorm:"foreignKey:MessageID" json:"message,omitempty"`
+	PinnedBy User    `gorm:"foreignKey:PinnedByID" json:"pinnedBy,omitempty"`
+}
+
+// TableName 指定 PinnedMessage 模型的表名。
+func (PinnedMessage) TableName() string {
+	return "pinned_messages"
+}
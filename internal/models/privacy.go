@@ -0,0 +1,52 @@
+package models
+
+// UserBlock 记录用户拉黑的其他用户。被拉黑的用户不能向拉黑者发送好友请求、不能与其开始或继续私聊，
+// 也看不到拉黑者的在线状态。取消拉黑时硬删除记录，以便之后可以再次拉黑。
+type UserBlock struct {
+	BaseModel
+	BlockerID uint `gorm:"not null;uniqueIndex:idx_user_block" json:"blockerId"`
+	BlockedID uint `gorm:"not null;uniqueIndex:idx_user_block;index" json:"blockedId"`
+
+	Blocked User `gorm:"foreignKey:BlockedID" json:"-"`
+}
+
+// TableName 指定 UserBlock 模型的表名。
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
+
+// PrivacyAudience 是隐私设置允许的对象范围。
+type PrivacyAudience string
+
+const (
+	PrivacyEveryone PrivacyAudience = "everyone" // 所有用户
+	PrivacyFriends  PrivacyAudience = "friends"  // 仅好友
+	PrivacyNobody   PrivacyAudience = "nobody"   // 任何人都不允许
+)
+
+// PrivacySettings 是用户的隐私设置。没有记录的用户按所有项均为 everyone 处理。
+type PrivacySettings struct {
+	BaseModel
+	UserID uint `gorm:"not null;uniqueIndex" json:"-"`
+	// SearchVisibility 决定谁能在用户搜索中找到该用户。
+	SearchVisibility PrivacyAudience `gorm:"type:varchar(20);not null;default:'everyone'" json:"searchVisibility"`
+	// MessagePermission 决定非好友能否向该用户发起私聊 (只能是 everyone 或 friends)。
+	MessagePermission PrivacyAudience `gorm:"type:varchar(20);not null;default:'everyone'" json:"messagePermission"`
+	// GroupInvitePermission 决定谁能把该用户拉进群组。
+	GroupInvitePermission PrivacyAudience `gorm:"type:varchar(20);not null;default:'everyone'" json:"groupInvitePermission"`
+}
+
+// TableName 指定 PrivacySettings 模型的表名。
+func (PrivacySettings) TableName() string {
+	return "user_privacy_settings"
+}
+
+// DefaultPrivacySettings 返回未设置过隐私选项的用户所使用的默认设置。
+func DefaultPrivacySettings(userID uint) *PrivacySettings {
+	return &PrivacySettings{
+		UserID:                userID,
+		SearchVisibility:      PrivacyEveryone,
+		MessagePermission:     PrivacyEveryone,
+		GroupInvitePermission: PrivacyEveryone,
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Session 代表一次登录产生的会话 (一台设备上的一次登录)。
+// 会话持有一串轮换的刷新令牌 (RefreshToken)，同一会话下的刷新令牌构成一个令牌族：
+// 任何一个已经使用过的刷新令牌被再次提交时，视为令牌泄露，整个会话会被吊销。
+type Session struct {
+	BaseModel
+	UserID     uint       `gorm:"not null;index" json:"userId"`
+	DeviceName string     `gorm:"type:varchar(100)" json:"deviceName,omitempty"`
+	IPAddress  string     `gorm:"type:varchar(64)" json:"ipAddress,omitempty"`
+	UserAgent  string     `gorm:"type:varchar(512)" json:"userAgent,omitempty"`
+	LastUsedAt time.Time  `gorm:"not null" json:"lastUsedAt"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"` // 最近一次签发的刷新令牌的过期时间
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+
+	// 当前访问令牌的 JTI 及过期时间，吊销会话时用于将其加入黑名单
+	AccessTokenID        string    `gorm:"type:varchar(64)" json:"-"`
+	AccessTokenExpiresAt time.Time `json:"-"`
+}
+
+// TableName 指定 Session 模型的表名。
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive 判断会话是否仍然有效 (未吊销且刷新令牌未过期)。
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken 是会话下的一个刷新令牌，只保存令牌的 SHA-256 哈希。
+// 每个刷新令牌只能使用一次，使用后 UsedAt 被设置并签发新的刷新令牌。
+type RefreshToken struct {
+	BaseModel
+	SessionID uint       `gorm:"not null;index" json:"sessionId"`
+	TokenHash string     `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+
+	// 关联关系
+	Session Session `gorm:"foreignKey:SessionID" json:"-"`
+}
+
+// TableName 指定 RefreshToken 模型的表名。
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
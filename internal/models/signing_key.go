@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// SigningKey 是用于签发 JWT 的非对称密钥，由 API 服务器定期轮换。
+// 轮换后旧密钥不再用于签名 (RetiredAt)，但在其签发的令牌全部过期之前 (ExpiresAt) 仍会发布在 JWKS 中用于验证。
+type SigningKey struct {
+	BaseModel
+	KeyID         string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"kid"`
+	Algorithm     string     `gorm:"type:varchar(16);not null" json:"alg"`
+	PrivateKeyPEM string     `gorm:"type:text;not null" json:"-"` // PKCS#8 PEM，只有 API 服务器读取
+	RetiredAt     *time.Time `json:"retiredAt,omitempty"`
+	ExpiresAt     *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+}
+
+// TableName 指定 SigningKey 模型的表名。
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
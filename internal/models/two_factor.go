@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// TOTPCredential 是用户的 TOTP 两步验证密钥。
+// 用户开始绑定时创建 (EnabledAt 为空)，提交正确的验证码后才算开启。
+type TOTPCredential struct {
+	BaseModel
+	UserID    uint       `gorm:"not null;uniqueIndex" json:"userId"`
+	Secret    string     `gorm:"type:varchar(64);not null" json:"-"` // Base32 编码的共享密钥
+	EnabledAt *time.Time `json:"enabledAt,omitempty"`
+	// LastUsedStep 是最近一次通过校验的验证码所属的时间步长，同一步长的验证码不能重复使用。
+	LastUsedStep int64 `gorm:"not null;default:0" json:"-"`
+}
+
+// TableName 指定 TOTPCredential 模型的表名。
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// IsEnabled 判断两步验证是否已开启。
+func (c *TOTPCredential) IsEnabled() bool {
+	return c != nil && c.EnabledAt != nil
+}
+
+// RecoveryCode 是无法使用验证器应用时代替 TOTP 验证码的一次性恢复码，只保存哈希。
+type RecoveryCode struct {
+	BaseModel
+	UserID   uint       `gorm:"not null;index" json:"userId"`
+	CodeHash string     `gorm:"type:char(64);not null" json:"-"`
+	UsedAt   *time.Time `json:"usedAt,omitempty"`
+}
+
+// TableName 指定 RecoveryCode 模型的表名。
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
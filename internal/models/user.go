@@ -14,6 +14,15 @@ type User struct {
 	LastSeenAt   *time.Time `json:"lastSeenAt,omitempty"`
 	Bio          string     `gorm:"type:text" json:"bio,omitempty"`
 
+	// EmailVerified 表示用户已通过邮件中的链接确认了 Email 的所有权。
+	EmailVerified   bool       `gorm:"default:false" json:"emailVerified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+
+	// IsBot 标识机器人账号。机器人不能通过密码登录，只能使用 API Key 调用开放给 API Key 的接口，
+	// BotOwnerID 是创建并管理该机器人的用户。
+	IsBot      bool  `gorm:"default:false;index" json:"isBot"`
+	BotOwnerID *uint `gorm:"index" json:"botOwnerId,omitempty"`
+
 	// 关联关系
 	Messages      []Message       `gorm:"foreignKey:SenderID" json:"messages,omitempty"`                       // 用户发送的消息
 	Conversations []*Conversation `gorm:"many2many:conversation_participants;" json:"conversations,omitempty"` // 用户参与的会话
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// UserTokenPurpose 标识一次性用户令牌的用途。
+type UserTokenPurpose string
+
+const (
+	EmailVerificationToken UserTokenPurpose = "email_verification"
+	PasswordResetToken     UserTokenPurpose = "password_reset"
+	// TwoFactorChallengeToken 是密码校验通过、等待提交两步验证码的登录挑战。
+	TwoFactorChallengeToken UserTokenPurpose = "two_factor_challenge"
+)
+
+// UserToken 是发给用户的一次性、限时令牌 (邮箱验证、密码重置、两步验证登录挑战)。
+// 只保存令牌的 SHA-256 哈希，令牌使用后设置 UsedAt，不能再次使用。
+type UserToken struct {
+	BaseModel
+	UserID    uint             `gorm:"not null;index" json:"userId"`
+	Purpose   UserTokenPurpose `gorm:"type:varchar(32);not null;index" json:"purpose"`
+	TokenHash string           `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+	Email     string           `gorm:"type:varchar(100)" json:"email,omitempty"` // 令牌发送到的邮箱，验证时需与用户当前邮箱一致
+	ExpiresAt time.Time        `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time       `json:"usedAt,omitempty"`
+}
+
+// TableName 指定 UserToken 模型的表名。
+func (UserToken) TableName() string {
+	return "user_tokens"
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// WebhookEventType 是投递给 Webhook 的事件类型。
+type WebhookEventType string
+
+const (
+	WebhookEventMessageCreated WebhookEventType = "message.created" // 会话中有新消息 (包括系统消息)
+	WebhookEventMemberJoined   WebhookEventType = "member.joined"   // 用户加入群组
+	WebhookEventMemberLeft     WebhookEventType = "member.left"     // 用户离开群组
+
+	// 以下交互事件只投递给机器人 Webhook，在命令处理过程中同步投递，响应体作为回复，不重试。
+	WebhookEventCommandInvoked WebhookEventType = "command.invoked" // 用户调用了机器人登记的斜杠命令
+	WebhookEventButtonClicked  WebhookEventType = "button.clicked"  // 用户点击了机器人消息上的按钮
+)
+
+// ValidWebhookEvents 列出所有可以订阅的事件类型。
+var ValidWebhookEvents = []WebhookEventType{
+	WebhookEventMessageCreated, WebhookEventMemberJoined, WebhookEventMemberLeft,
+	WebhookEventCommandInvoked, WebhookEventButtonClicked,
+}
+
+// IsValid 检查事件类型是否已定义。
+func (e WebhookEventType) IsValid() bool {
+	for _, event := range ValidWebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook 是登记在群组或机器人上的外部 HTTP 端点。GroupID 和 BotID 恰好有一个不为空：
+// 群组 Webhook 接收该群组的事件，机器人 Webhook 接收机器人所在会话 (群聊和私聊) 的事件。
+// 每次投递用 Secret 对请求体做 HMAC-SHA256 签名，Secret 只在创建时返回。
+type Webhook struct {
+	BaseModel
+	GroupID     *uint  `gorm:"index" json:"groupId,omitempty"`
+	BotID       *uint  `gorm:"index" json:"botId,omitempty"`
+	CreatedByID uint   `gorm:"not null" json:"createdById"`
+	URL         string `gorm:"type:varchar(2048);not null" json:"url"`
+	Secret      string `gorm:"type:varchar(128);not null" json:"-"`
+	Events      string `gorm:"type:varchar(255)" json:"-"` // 以逗号分隔的 WebhookEventType，为空表示订阅全部事件
+
+	// Enabled 为 false 时不再投递。连续 ConsecutiveFailures 个事件投递失败达到上限时自动停用，
+	// DisabledReason 记录原因；重新启用时清零。
+	Enabled             bool       `gorm:"not null;default:true" json:"enabled"`
+	ConsecutiveFailures int        `gorm:"not null;default:0" json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty"`
+	DisabledReason      string     `gorm:"type:varchar(255)" json:"disabledReason,omitempty"`
+	LastDeliveryAt      *time.Time `json:"lastDeliveryAt,omitempty"`
+}
+
+// TableName 指定 Webhook 模型的表名。
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// EventList 返回订阅的事件类型，为空表示全部。
+func (w *Webhook) EventList() []WebhookEventType {
+	if w.Events == "" {
+		return nil
+	}
+	parts := strings.Split(w.Events, ",")
+	events := make([]WebhookEventType, 0, len(parts))
+	for _, part := range parts {
+		events = append(events, WebhookEventType(part))
+	}
+	return events
+}
+
+// SetEvents 设置订阅的事件类型。
+func (w *Webhook) SetEvents(events []WebhookEventType) {
+	parts := make([]string, 0, len(events))
+	for _, event := range events {
+		parts = append(parts, string(event))
+	}
+	w.Events = strings.Join(parts, ",")
+}
+
+// Subscribes 检查 Webhook 是否订阅了指定事件。
+func (w *Webhook) Subscribes(event WebhookEventType) bool {
+	events := w.EventList()
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus 是一次事件投递的状态。
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"   // 等待投递或重试
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded" // 端点返回了 2xx
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"    // 重试耗尽或端点已停用
+)
+
+// WebhookDelivery 是投递日志：每个事件对每个 Webhook 一条记录，记录投递次数和最后一次尝试的结果。
+// 待重试的记录按 NextAttemptAt 由投递任务取出，多个实例通过条件更新认领，避免重复投递。
+type WebhookDelivery struct {
+	BaseModel
+	WebhookID      uint                  `gorm:"not null;index" json:"webhookId"`
+	EventID        string                `gorm:"type:varchar(64);not null;index" json:"eventId"` // 同一事件投递到多个 Webhook 时相同，接收方可据此去重
+	EventType      WebhookEventType      `gorm:"type:varchar(32);not null" json:"eventType"`
+	Payload        string                `gorm:"type:text;not null" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(16);not null;index:idx_webhook_delivery_due,priority:1" json:"status"`
+	Attempts       int                   `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time             `gorm:"not null;index:idx_webhook_delivery_due,priority:2" json:"nextAttemptAt"`
+	LastStatusCode int                   `json:"lastStatusCode,omitempty"`
+	LastError      string                `gorm:"type:varchar(1024)" json:"lastError,omitempty"`
+	LastDurationMs int64                 `json:"lastDurationMs,omitempty"`
+	DeliveredAt    *time.Time            `json:"deliveredAt,omitempty"`
+}
+
+// TableName 指定 WebhookDelivery 模型的表名。
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
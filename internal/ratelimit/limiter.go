@@ -0,0 +1,23 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result 是一次限流检查的结果。
+type Result struct {
+	Allowed bool
+	// RetryAfter 是被拒绝时距离窗口内最早一次请求过期的时间，即最早可以重试的时间。
+	RetryAfter time.Duration
+	// Count 是检查之后窗口内已记录的请求数 (允许时包含本次请求)。
+	Count int
+}
+
+// Limiter 定义了滑动窗口限流器的接口。
+type Limiter interface {
+	// Allow 检查 key 在 window 内的请求次数是否少于 limit，允许时记录本次请求。
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+	// Reset 清除 key 的所有记录。
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"im-go/internal/auth"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisOIDCStateStore 是 auth.OIDCStateStore 接口的 Redis 实现，多个 API 服务器实例共享登录状态。
+type redisOIDCStateStore struct {
+	client *redis.Client
+}
+
+// NewRedisOIDCStateStore 创建一个新的 redisOIDCStateStore 实例。
+func NewRedisOIDCStateStore(client *redis.Client) auth.OIDCStateStore {
+	return &redisOIDCStateStore{client: client}
+}
+
+const oidcStateKeyPrefix = "oidc:state:"
+
+// Save 保存登录状态，ttl 后自动过期。
+func (r *redisOIDCStateStore) Save(ctx context.Context, state string, data *auth.OIDCLoginState, ttl time.Duration) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化 OIDC 登录状态失败: %w", err)
+	}
+	if err := r.client.Set(ctx, oidcStateKeyPrefix+state, payload, ttl).Err(); err != nil {
+		return fmt.Errorf("保存 OIDC 登录状态到 Redis 失败: %w", err)
+	}
+	return nil
+}
+
+// Consume 使用 GETDEL 原子地取出并删除登录状态，保证同一个 state 只能完成一次回调。
+func (r *redisOIDCStateStore) Consume(ctx context.Context, state string) (*auth.OIDCLoginState, error) {
+	payload, err := r.client.GetDel(ctx, oidcStateKeyPrefix+state).Bytes()
+	if err == redis.Nil {
+		return nil, auth.ErrOIDCStateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从 Redis 读取 OIDC 登录状态失败: %w", err)
+	}
+	var data auth.OIDCLoginState
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("解析 OIDC 登录状态失败: %w", err)
+	}
+	return &data, nil
+}
@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"im-go/internal/models"
+	"im-go/internal/services"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSuggestionCache 是 services.SuggestionCache 接口的 Redis 实现，所有 API 服务器实例共享同一份好友推荐缓存。
+type redisSuggestionCache struct {
+	client *redis.Client
+}
+
+// NewRedisSuggestionCache 创建一个新的 redisSuggestionCache 实例。
+func NewRedisSuggestionCache(client *redis.Client) services.SuggestionCache {
+	return &redisSuggestionCache{client: client}
+}
+
+const suggestionKeyPrefix = "friend:suggestions:"
+
+// Get 读取用户的推荐候选，键不存在时 ok 为 false。
+func (r *redisSuggestionCache) Get(ctx context.Context, userID uint) ([]models.SuggestionCandidate, bool, error) {
+	payload, err := r.client.Get(ctx, suggestionKeyPrefix+strconv.FormatUint(uint64(userID), 10)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("从 Redis 读取好友推荐失败: %w", err)
+	}
+	var candidates []models.SuggestionCandidate
+	if err := json.Unmarshal(payload, &candidates); err != nil {
+		return nil, false, fmt.Errorf("解析好友推荐缓存失败: %w", err)
+	}
+	return candidates, true, nil
+}
+
+// Set 保存用户的推荐候选，ttl 后自动过期。空列表同样会被缓存，避免没有候选的用户每次都重新计算。
+func (r *redisSuggestionCache) Set(ctx context.Context, userID uint, candidates []models.SuggestionCandidate, ttl time.Duration) error {
+	if candidates == nil {
+		candidates = []models.SuggestionCandidate{}
+	}
+	payload, err := json.Marshal(candidates)
+	if err != nil {
+		return fmt.Errorf("序列化好友推荐失败: %w", err)
+	}
+	if err := r.client.Set(ctx, suggestionKeyPrefix+strconv.FormatUint(uint64(userID), 10), payload, ttl).Err(); err != nil {
+		return fmt.Errorf("保存好友推荐到 Redis 失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"im-go/internal/auth"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisWSTicketStore 是 auth.WSTicketStore 接口的 Redis 实现，API 服务器和 ChatServer 通过它共享连接票据。
+type redisWSTicketStore struct {
+	client *redis.Client
+}
+
+// NewRedisWSTicketStore 创建一个新的 redisWSTicketStore 实例。
+func NewRedisWSTicketStore(client *redis.Client) auth.WSTicketStore {
+	return &redisWSTicketStore{client: client}
+}
+
+const wsTicketKeyPrefix = "ws:ticket:"
+
+// Save 保存连接票据，ttl 后自动过期。
+func (r *redisWSTicketStore) Save(ctx context.Context, ticket string, data *auth.WSTicket, ttl time.Duration) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化连接票据失败: %w", err)
+	}
+	if err := r.client.Set(ctx, wsTicketKeyPrefix+ticket, payload, ttl).Err(); err != nil {
+		return fmt.Errorf("保存连接票据到 Redis 失败: %w", err)
+	}
+	return nil
+}
+
+// Consume 使用 GETDEL 原子地取出并删除票据，保证同一张票据只能建立一个连接。
+func (r *redisWSTicketStore) Consume(ctx context.Context, ticket string) (*auth.WSTicket, error) {
+	payload, err := r.client.GetDel(ctx, wsTicketKeyPrefix+ticket).Bytes()
+	if err == redis.Nil {
+		return nil, auth.ErrWSTicketNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("从 Redis 读取连接票据失败: %w", err)
+	}
+	var data auth.WSTicket
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, fmt.Errorf("解析连接票据失败: %w", err)
+	}
+	return &data, nil
+}
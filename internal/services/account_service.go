@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+	"im-go/internal/mailer"
+	"im-go/internal/models"
+	"im-go/internal/ratelimit"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidUserToken     = errors.New("链接无效或已过期")
+	ErrEmailNotSet          = errors.New("用户未设置邮箱")
+	ErrEmailAlreadyVerified = errors.New("邮箱已验证")
+	ErrPasswordTooShort     = errors.New("密码长度至少为 8 位")
+	ErrMailQueueFull        = errors.New("邮件发送繁忙，请稍后重试")
+)
+
+const (
+	// minPasswordLength 是重置密码时新密码的最小长度。
+	minPasswordLength = 8
+	// mailSendTimeout 是后台发送邮件的超时时间。
+	mailSendTimeout = 30 * time.Second
+)
+
+// AccountService 定义了邮箱验证和找回密码相关服务的接口。
+// 两个流程都通过邮件发送一次性、限时的令牌，数据库中只保存令牌哈希。
+type AccountService interface {
+	// SendEmailVerification 向用户当前邮箱发送验证链接，之前未使用的验证链接随即失效。
+	// 邮件在后台发送，发送队列已满时返回 ErrMailQueueFull。
+	SendEmailVerification(ctx context.Context, userID uint) error
+	// VerifyEmail 使用邮件中的令牌确认邮箱。
+	VerifyEmail(ctx context.Context, token string) (*models.User, error)
+	// RequestPasswordReset 向该邮箱对应的用户发送密码重置链接，ipAddress 是申请者的地址。
+	// 邮箱不存在时同样返回 nil，调用方无法据此判断账号是否存在。
+	// 同一邮箱或同一 IP 申请过于频繁时返回 *AttemptLimitError，发送队列已满时返回 ErrMailQueueFull。
+	RequestPasswordReset(ctx context.Context, email, ipAddress string) error
+	// ResetPassword 使用重置令牌设置新密码，吊销该用户的所有登录会话，并解除因登录失败导致的锁定。
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	// Run 启动发送邮件的工作 goroutine，直到 ctx 被取消并且正在发送的邮件结束。
+	Run(ctx context.Context)
+}
+
+// accountService 是 AccountService 的实现。
+type accountService struct {
+	userRepo  storage.UserRepository
+	tokenRepo storage.UserTokenRepository
+	lockouts  storage.LoginLockoutRepository
+	sessions  SessionService
+	mailer    mailer.Mailer
+	limiter   ratelimit.Limiter
+	cfg       config.Config
+
+	// mailJobs 是等待后台发送的邮件，由 Run 启动的 MAIL.WORKERS 个 goroutine 处理
+	mailJobs chan func(ctx context.Context) error
+}
+
+// NewAccountService 创建一个新的 AccountService 实例。limiter 用于限制申请重置密码的频率。
+// 需要调用 Run 启动发送邮件的工作 goroutine。
+func NewAccountService(userRepo storage.UserRepository, tokenRepo storage.UserTokenRepository, lockouts storage.LoginLockoutRepository, sessions SessionService, mailer mailer.Mailer, limiter ratelimit.Limiter, cfg config.Config) AccountService {
+	return &accountService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		lockouts:  lockouts,
+		sessions:  sessions,
+		mailer:    mailer,
+		limiter:   limiter,
+		cfg:       cfg,
+		mailJobs:  make(chan func(ctx context.Context) error, max(cfg.Mail.QueueSize, 0)),
+	}
+}
+
+// Run 并发处理后台邮件，每封邮件最多用时 mailSendTimeout。
+func (s *accountService) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(s.cfg.Mail.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.mailJobs:
+					sendCtx, cancel := context.WithTimeout(ctx, mailSendTimeout)
+					if err := job(sendCtx); err != nil {
+						log.Printf("后台发送邮件失败: %v", err)
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// enqueueMail 把邮件放入发送队列，队列已满时立即返回 ErrMailQueueFull。
+func (s *accountService) enqueueMail(job func(ctx context.Context) error) error {
+	select {
+	case s.mailJobs <- job:
+		return nil
+	default:
+		return ErrMailQueueFull
+	}
+}
+
+// SendEmailVerification 发送邮箱验证邮件。
+func (s *accountService) SendEmailVerification(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("获取用户 %d 失败: %w", userID, err)
+	}
+	if user.Email == "" {
+		return ErrEmailNotSet
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issueToken(ctx, user, models.EmailVerificationToken, s.cfg.Auth.EmailVerificationExpiry)
+	if err != nil {
+		return err
+	}
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "验证你的邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %s 内打开以下链接验证你的邮箱：\n%s\n\n如果这不是你本人的操作，请忽略本邮件。\n",
+			displayName(user), formatValidity(s.cfg.Auth.EmailVerificationExpiry), s.link("/verify-email", token)),
+	}
+	return s.enqueueMail(func(ctx context.Context) error {
+		return s.mailer.Send(ctx, msg)
+	})
+}
+
+// VerifyEmail 确认邮箱。令牌签发后用户邮箱发生变化时令牌失效。
+func (s *accountService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	stored, user, err := s.consumeToken(ctx, token, models.EmailVerificationToken)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(stored.Email, user.Email) {
+		return nil, ErrInvalidUserToken
+	}
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("更新用户 %d 的邮箱验证状态失败: %w", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// RequestPasswordReset 检查申请频率后在后台查找用户并发送重置邮件，使邮箱存在与否的响应时间一致。
+// 频率限制只取决于邮箱和 IP，与账号是否存在无关。限流存储不可用时放行，只记录日志。
+func (s *accountService) RequestPasswordReset(ctx context.Context, email, ipAddress string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+	if ipAddress != "" {
+		if err := s.checkResetLimit(ctx, "password-reset:ip:"+ipAddress, s.cfg.Auth.PasswordResetMaxPerIP); err != nil {
+			return err
+		}
+	}
+	if err := s.checkResetLimit(ctx, "password-reset:email:"+strings.ToLower(email), s.cfg.Auth.PasswordResetMaxPerEmail); err != nil {
+		return err
+	}
+	return s.enqueueMail(func(ctx context.Context) error {
+		return s.sendPasswordReset(ctx, email)
+	})
+}
+
+// checkResetLimit 检查 key 在 PasswordResetWindow 内的申请次数，超出 limit 时返回 *AttemptLimitError。
+func (s *accountService) checkResetLimit(ctx context.Context, key string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	result, err := s.limiter.Allow(ctx, key, limit, s.cfg.Auth.PasswordResetWindow)
+	if err != nil {
+		log.Printf("重置密码限流检查失败，放行本次申请 (key=%s): %v", key, err)
+		return nil
+	}
+	if !result.Allowed {
+		return &AttemptLimitError{RetryAfter: result.RetryAfter}
+	}
+	return nil
+}
+
+// sendPasswordReset 查找用户并发送密码重置邮件，用户不存在时静默返回。
+func (s *accountService) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("通过邮箱查找用户失败: %w", err)
+	}
+
+	token, err := s.issueToken(ctx, user, models.PasswordResetToken, s.cfg.Auth.PasswordResetExpiry)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "重置你的密码",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置你账号密码的请求。请在 %s 内打开以下链接设置新密码：\n%s\n\n重置成功后，你在所有设备上的登录都会失效。如果这不是你本人的操作，请忽略本邮件，你的密码不会改变。\n",
+			displayName(user), formatValidity(s.cfg.Auth.PasswordResetExpiry), s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword 重置密码并吊销所有会话。
+func (s *accountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	stored, user, err := s.consumeToken(ctx, token, models.PasswordResetToken)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("密码哈希失败: %w", err)
+	}
+	user.PasswordHash = hashedPassword
+	// 能收到重置邮件即证明拥有该邮箱
+	if !user.EmailVerified && strings.EqualFold(stored.Email, user.Email) {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("更新用户 %d 的密码失败: %w", user.ID, err)
+	}
+
+	// 其他未使用的重置链接一并失效
+	if err := s.tokenRepo.InvalidateTokens(ctx, user.ID, models.PasswordResetToken, time.Now()); err != nil {
+		log.Printf("使用户 %d 的其他重置链接失效失败: %v", user.ID, err)
+	}
+	// 能收到重置邮件说明是账号本人，不必等待锁定到期
+	if err := s.lockouts.ClearActiveLockouts(ctx, user.ID, time.Now()); err != nil {
+		log.Printf("解除用户 %d 的登录锁定失败: %v", user.ID, err)
+	}
+	revoked, err := s.sessions.RevokeAllSessions(ctx, user.ID, 0)
+	if err != nil {
+		return fmt.Errorf("密码已重置，但吊销用户 %d 的登录会话失败: %w", user.ID, err)
+	}
+	log.Printf("用户 %d 重置了密码，已吊销 %d 个登录会话", user.ID, revoked)
+	return nil
+}
+
+// issueToken 使旧令牌失效并签发新的一次性令牌，返回明文令牌。
+func (s *accountService) issueToken(ctx context.Context, user *models.User, purpose models.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.tokenRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := storage.NewGormUserTokenRepository(tx)
+		if err := txRepo.InvalidateTokens(ctx, user.ID, purpose, time.Now()); err != nil {
+			return fmt.Errorf("使旧令牌失效失败: %w", err)
+		}
+		return txRepo.CreateToken(ctx, &models.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			Email:     user.Email,
+			ExpiresAt: time.Now().Add(ttl),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("保存用户 %d 的 %s 令牌失败: %w", user.ID, purpose, err)
+	}
+	return token, nil
+}
+
+// consumeToken 校验并使用一次性令牌，返回令牌记录及其用户。
+func (s *accountService) consumeToken(ctx context.Context, token string, purpose models.UserTokenPurpose) (*models.UserToken, *models.User, error) {
+	if token == "" {
+		return nil, nil, ErrInvalidUserToken
+	}
+	stored, err := s.tokenRepo.GetTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidUserToken
+		}
+		return nil, nil, fmt.Errorf("查找令牌失败: %w", err)
+	}
+	now := time.Now()
+	if stored.Purpose != purpose || stored.UsedAt != nil || !now.Before(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidUserToken
+	}
+
+	marked, err := s.tokenRepo.MarkTokenUsed(ctx, stored.ID, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("标记令牌失败: %w", err)
+	}
+	if !marked {
+		return nil, nil, ErrInvalidUserToken // 并发请求已使用该令牌
+	}
+
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidUserToken
+		}
+		return nil, nil, fmt.Errorf("获取用户 %d 失败: %w", stored.UserID, err)
+	}
+	return stored, user, nil
+}
+
+// link 构造邮件中指向前端页面的链接。
+func (s *accountService) link(path, token string) string {
+	return strings.TrimSuffix(s.cfg.Mail.LinkBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// displayName 返回邮件称呼中使用的用户名称。
+func displayName(user *models.User) string {
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+	return user.Username
+}
+
+// formatValidity 将令牌有效期格式化为邮件中展示的文字。
+func formatValidity(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d 小时", int(d/time.Hour))
+	}
+	return fmt.Sprintf("%d 分钟", int(d/time.Minute))
+}
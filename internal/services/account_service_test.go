@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/ratelimit"
+)
+
+// countingLimiter 是只按次数计数的内存限流器。
+type countingLimiter struct {
+	counts map[string]int
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (ratelimit.Result, error) {
+	if l.counts[key] >= limit {
+		return ratelimit.Result{Allowed: false, RetryAfter: window, Count: l.counts[key]}, nil
+	}
+	l.counts[key]++
+	return ratelimit.Result{Allowed: true, Count: l.counts[key]}, nil
+}
+
+func (l *countingLimiter) Reset(ctx context.Context, key string) error {
+	delete(l.counts, key)
+	return nil
+}
+
+func newResetTestService(queueSize int) AccountService {
+	cfg := config.Config{}
+	cfg.Auth.PasswordResetMaxPerEmail = 2
+	cfg.Auth.PasswordResetMaxPerIP = 3
+	cfg.Auth.PasswordResetWindow = time.Hour
+	cfg.Mail.QueueSize = queueSize
+	return NewAccountService(nil, nil, nil, nil, nil, &countingLimiter{counts: map[string]int{}}, cfg)
+}
+
+func TestRequestPasswordResetLimits(t *testing.T) {
+	ctx := context.Background()
+	var limitErr *AttemptLimitError
+
+	t.Run("per email", func(t *testing.T) {
+		svc := newResetTestService(10)
+		for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+			if err := svc.RequestPasswordReset(ctx, "Alice@example.com", ip); err != nil {
+				t.Fatalf("request %d: %v", i+1, err)
+			}
+		}
+		// 邮箱大小写不同也计入同一限额
+		err := svc.RequestPasswordReset(ctx, "alice@example.com", "10.0.0.3")
+		if !errors.As(err, &limitErr) || limitErr.RetryAfter != time.Hour {
+			t.Fatalf("err = %v, want *AttemptLimitError", err)
+		}
+	})
+
+	t.Run("per ip", func(t *testing.T) {
+		svc := newResetTestService(10)
+		for i, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+			if err := svc.RequestPasswordReset(ctx, email, "10.0.0.1"); err != nil {
+				t.Fatalf("request %d: %v", i+1, err)
+			}
+		}
+		if err := svc.RequestPasswordReset(ctx, "d@example.com", "10.0.0.1"); !errors.As(err, &limitErr) {
+			t.Fatalf("err = %v, want *AttemptLimitError", err)
+		}
+	})
+
+	t.Run("queue full", func(t *testing.T) {
+		svc := newResetTestService(1)
+		if err := svc.RequestPasswordReset(ctx, "a@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.RequestPasswordReset(ctx, "b@example.com", "10.0.0.1"); !errors.Is(err, ErrMailQueueFull) {
+			t.Fatalf("err = %v, want ErrMailQueueFull", err)
+		}
+	})
+}
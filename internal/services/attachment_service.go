@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/imtypes"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+)
+
+var (
+	// ErrAttachmentNotFound 也用于无权访问的附件，避免泄露附件是否存在。
+	ErrAttachmentNotFound     = errors.New("附件不存在")
+	ErrAttachmentConversation = errors.New("您不是该会话的参与者，不能上传附件")
+	ErrInvalidSignedURL       = errors.New("下载链接无效")
+	ErrSignedURLExpired       = errors.New("下载链接已过期")
+)
+
+// maxAttachmentNameLength 是附件文件名的最大字符数，与 attachments.file_name 字段长度一致。
+const maxAttachmentNameLength = 255
+
+// SignedURL 是附件的短期下载链接，持有链接的人不需要登录即可下载，适合 <img> 等无法携带令牌的场景。
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AttachmentService 定义了附件上传和下载授权的接口。
+type AttachmentService interface {
+	// Upload 把文件保存到存储服务并记录附件。conversationID 不为 0 时上传者必须是该会话的参与者，
+	// 附件只能在该会话中发送。
+	Upload(ctx context.Context, uploaderID, conversationID uint, reader io.Reader, size int64, fileName, mimeType string) (*models.Attachment, error)
+	// GetForUser 返回用户有权访问的附件：上传者本人，或附件所属会话的参与者 (频道为订阅者)。
+	GetForUser(ctx context.Context, userID, attachmentID uint) (*models.Attachment, error)
+	// SignURL 为用户有权访问的附件生成签名下载链接。
+	SignURL(ctx context.Context, userID, attachmentID uint) (*SignedURL, error)
+	// GetBySignature 校验签名下载链接的参数并返回对应的附件。
+	GetBySignature(ctx context.Context, attachmentID uint, expires int64, signature string) (*models.Attachment, error)
+}
+
+// attachmentService 是 AttachmentService 的实现。
+type attachmentService struct {
+	attachmentRepo storage.AttachmentRepository
+	convoRepo      storage.ConversationRepository
+	channelRepo    storage.ChannelRepository
+	storage        imtypes.StorageService
+	signingKey     []byte
+	signedURLTTL   time.Duration
+}
+
+// NewAttachmentService 创建一个新的 AttachmentService 实例。signingKey 用于签名下载链接，
+// 多个 API 服务器实例必须使用相同的密钥。
+func NewAttachmentService(
+	attachmentRepo storage.AttachmentRepository,
+	convoRepo storage.ConversationRepository,
+	channelRepo storage.ChannelRepository,
+	storageService imtypes.StorageService,
+	signingKey string,
+	signedURLTTL time.Duration,
+) AttachmentService {
+	if signedURLTTL <= 0 {
+		signedURLTTL = 10 * time.Minute
+	}
+	return &attachmentService{
+		attachmentRepo: attachmentRepo,
+		convoRepo:      convoRepo,
+		channelRepo:    channelRepo,
+		storage:        storageService,
+		signingKey:     []byte(signingKey),
+		signedURLTTL:   signedURLTTL,
+	}
+}
+
+// AttachmentDownloadPath 返回附件的下载路径，需要认证。
+func AttachmentDownloadPath(attachmentID uint) string {
+	return fmt.Sprintf("/api/v1/attachments/%d/download", attachmentID)
+}
+
+// Upload 先保存文件再写入记录，写入失败时删除已保存的文件。
+func (s *attachmentService) Upload(ctx context.Context, uploaderID, conversationID uint, reader io.Reader, size int64, fileName, mimeType string) (*models.Attachment, error) {
+	attachment := &models.Attachment{UploaderID: uploaderID}
+	if conversationID != 0 {
+		if _, err := s.convoRepo.GetParticipant(ctx, conversationID, uploaderID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrAttachmentConversation
+			}
+			return nil, fmt.Errorf("检查会话参与者失败: %w", err)
+		}
+		attachment.ConversationID = &conversationID
+	}
+
+	mimeType = normalizeMimeType(mimeType)
+	fileInfo, err := s.storage.UploadFile(ctx, reader, size, fileName, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("存储文件失败: %w", err)
+	}
+	// 文件名来自客户端，只保留最后一段并限制在数据库字段长度以内
+	fileName = filepath.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if runes := []rune(fileName); len(runes) > maxAttachmentNameLength {
+		fileName = string(runes[:maxAttachmentNameLength])
+	}
+	attachment.StoragePath = fileInfo.Path
+	attachment.FileName = fileName
+	attachment.MimeType = mimeType
+	attachment.Size = fileInfo.Size
+
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		if delErr := s.storage.Delete(ctx, fileInfo.Path); delErr != nil {
+			log.Printf("删除未记录的文件 %s 失败: %v", fileInfo.Path, delErr)
+		}
+		return nil, fmt.Errorf("保存附件记录失败: %w", err)
+	}
+	return attachment, nil
+}
+
+// normalizeMimeType 把客户端提供的 MIME 类型规范化为不带参数的小写媒体类型，
+// 例如 "Image/SVG+XML; charset=utf-8" 变为 "image/svg+xml"。无法解析时使用 application/octet-stream。
+func normalizeMimeType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "application/octet-stream"
+	}
+	return strings.ToLower(mediaType)
+}
+
+// GetForUser 返回用户有权访问的附件。
+func (s *attachmentService) GetForUser(ctx context.Context, userID, attachmentID uint) (*models.Attachment, error) {
+	attachment, err := s.getByID(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := s.canAccess(ctx, userID, attachment)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+// SignURL 生成 /files/{id}?expires=&signature= 形式的下载链接。
+func (s *attachmentService) SignURL(ctx context.Context, userID, attachmentID uint) (*SignedURL, error) {
+	if _, err := s.GetForUser(ctx, userID, attachmentID); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.signedURLTTL).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	return &SignedURL{
+		URL:       fmt.Sprintf("/files/%d?expires=%d&signature=%s", attachmentID, expires, s.sign(attachmentID, expires)),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// GetBySignature 在签名有效且未过期时返回附件。签名链接签发后不再检查会话成员身份。
+func (s *attachmentService) GetBySignature(ctx context.Context, attachmentID uint, expires int64, signature string) (*models.Attachment, error) {
+	expected := s.sign(attachmentID, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidSignedURL
+	}
+	if time.Now().Unix() > expires {
+		return nil, ErrSignedURLExpired
+	}
+	return s.getByID(ctx, attachmentID)
+}
+
+// sign 计算附件ID和过期时间的 HMAC-SHA256 签名。
+func (s *attachmentService) sign(attachmentID uint, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(strconv.FormatUint(uint64(attachmentID), 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getByID 获取附件，不存在时返回 ErrAttachmentNotFound。
+func (s *attachmentService) getByID(ctx context.Context, attachmentID uint) (*models.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("获取附件失败: %w", err)
+	}
+	return attachment, nil
+}
+
+// canAccess 判断用户能否访问附件。频道订阅者不在参与者表中，需要单独检查订阅关系。
+func (s *attachmentService) canAccess(ctx context.Context, userID uint, attachment *models.Attachment) (bool, error) {
+	if attachment.UploaderID == userID {
+		return true, nil
+	}
+	if attachment.ConversationID == nil {
+		return false, nil
+	}
+	conversationID := *attachment.ConversationID
+	_, err := s.convoRepo.GetParticipant(ctx, conversationID, userID)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Errorf("检查会话参与者失败: %w", err)
+	}
+
+	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("获取会话失败: %w", err)
+	}
+	if conversation.Type != models.ChannelConversation {
+		return false, nil
+	}
+	subscribed, err := s.channelRepo.IsSubscribed(ctx, conversation.TargetID, userID)
+	if err != nil {
+		return false, fmt.Errorf("检查频道订阅失败: %w", err)
+	}
+	return subscribed, nil
+}
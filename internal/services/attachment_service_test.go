@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestNormalizeMimeType(t *testing.T) {
+	tests := map[string]string{
+		"image/png":                     "image/png",
+		"Image/SVG+XML":                 "image/svg+xml",
+		"image/svg+xml; charset=utf-8":  "image/svg+xml",
+		" IMAGE/JPEG ;q=1":              "image/jpeg",
+		"text/html;charset=UTF-8":       "text/html",
+		"":                              "application/octet-stream",
+		"png":                           "application/octet-stream",
+		"image/png; charset=\"unclosed": "application/octet-stream",
+	}
+	for input, want := range tests {
+		if got := normalizeMimeType(input); got != want {
+			t.Errorf("normalizeMimeType(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"im-go/internal/auth"
 	"im-go/internal/config"
@@ -19,23 +20,46 @@ var (
 	ErrUserNotFound       = errors.New("用户未找到")
 )
 
+// dummyPasswordHash 用于账号不存在时仍执行一次 bcrypt 比较，使响应时间与密码错误时一致。
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword("im-go-dummy-password")
+	return hash
+})
+
+// LoginResult 是登录的结果。用户开启了两步验证时只返回 Challenge，
+// 客户端需通过 TwoFactorService.CompleteChallenge 提交验证码后才能得到 Tokens。
+type LoginResult struct {
+	Tokens    *AuthTokens
+	Challenge *TwoFactorChallenge
+	User      *models.User
+}
+
 // AuthService 定义了用户认证服务的接口。
 type AuthService interface {
 	Register(ctx context.Context, username, nickname, email, password string) (*models.User, error)
-	Login(ctx context.Context, usernameOrEmail, password string) (token string, user *models.User, err error)
+	// Login 校验用户凭据，成功后为客户端创建一个新的登录会话并签发访问令牌和刷新令牌；
+	// 用户开启了两步验证时改为返回登录挑战。账号不存在和密码错误都返回 ErrInvalidCredentials，
+	// 尝试过于频繁时返回 *AttemptLimitError 或 *AccountLockedError。
+	Login(ctx context.Context, usernameOrEmail, password string, client SessionClientInfo) (*LoginResult, error)
 }
 
 // authService 是 AuthService 的实现。
 type authService struct {
-	userRepo storage.UserRepository
-	cfg      config.Config // 包含 AuthConfig
+	userRepo  storage.UserRepository
+	sessions  SessionService
+	twoFactor TwoFactorService
+	guard     LoginGuard
+	cfg       config.Config // 包含 AuthConfig
 }
 
 // NewAuthService 创建一个新的 AuthService 实例。
-func NewAuthService(userRepo storage.UserRepository, cfg config.Config) AuthService {
+func NewAuthService(userRepo storage.UserRepository, sessions SessionService, twoFactor TwoFactorService, guard LoginGuard, cfg config.Config) AuthService {
 	return &authService{
-		userRepo: userRepo,
-		cfg:      cfg,
+		userRepo:  userRepo,
+		sessions:  sessions,
+		twoFactor: twoFactor,
+		guard:     guard,
+		cfg:       cfg,
 	}
 }
 
@@ -80,32 +104,66 @@ func (s *authService) Register(ctx context.Context, username, nickname, email, p
 }
 
 // Login 处理用户登录逻辑。
-func (s *authService) Login(ctx context.Context, usernameOrEmail, password string) (string, *models.User, error) {
-	var user *models.User
-	var err error
+func (s *authService) Login(ctx context.Context, usernameOrEmail, password string, client SessionClientInfo) (*LoginResult, error) {
+	user, err := s.findLoginUser(ctx, usernameOrEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.guard.CheckAttempt(ctx, usernameOrEmail, client); err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		auth.CheckPasswordHash(password, dummyPasswordHash())
+	}
+	if user == nil || !auth.CheckPasswordHash(password, user.PasswordHash) {
+		if err := s.guard.RecordFailure(ctx, usernameOrEmail, user, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	s.guard.RecordSuccess(ctx, usernameOrEmail)
+
+	twoFactorEnabled, err := s.twoFactor.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactorEnabled {
+		challenge, err := s.twoFactor.CreateChallenge(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: challenge, User: user}, nil
+	}
+
+	tokens, err := s.sessions.StartSession(ctx, user, client)
+	if err != nil {
+		return nil, fmt.Errorf("创建登录会话失败: %w", err)
+	}
 
+	return &LoginResult{Tokens: tokens, User: user}, nil
+}
+
+// findLoginUser 通过用户名或邮箱查找用户，不存在时返回 nil。
+// 机器人只能使用 API Key，不能通过密码登录，按不存在的账号处理。
+func (s *authService) findLoginUser(ctx context.Context, usernameOrEmail string) (*models.User, error) {
 	// 尝试通过用户名查找用户
-	user, err = s.userRepo.GetByUsername(ctx, usernameOrEmail)
+	user, err := s.userRepo.GetByUsername(ctx, usernameOrEmail)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		// 如果用户名未找到，尝试通过邮箱查找 (如果 email 字段被用于登录)
 		user, err = s.userRepo.GetByEmail(ctx, usernameOrEmail)
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", nil, ErrUserNotFound
+			return nil, nil
 		} else if err != nil {
-			return "", nil, fmt.Errorf("通过邮箱查找用户失败: %w", err)
+			return nil, fmt.Errorf("通过邮箱查找用户失败: %w", err)
 		}
 	} else if err != nil {
-		return "", nil, fmt.Errorf("通过用户名查找用户失败: %w", err)
-	}
-
-	if !auth.CheckPasswordHash(password, user.PasswordHash) {
-		return "", nil, ErrInvalidCredentials
+		return nil, fmt.Errorf("通过用户名查找用户失败: %w", err)
 	}
 
-	token, err := auth.GenerateToken(user.ID, user.Username, s.cfg.Auth)
-	if err != nil {
-		return "", nil, fmt.Errorf("生成令牌失败: %w", err)
+	if user.IsBot {
+		return nil, nil
 	}
-
-	return token, user, nil
+	return user, nil
 }
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// loginUserRepo 只按用户名或邮箱返回固定用户。
+type loginUserRepo struct {
+	storage.UserRepository
+	byUsername map[string]*models.User
+	byEmail    map[string]*models.User
+}
+
+func (r *loginUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	if user, ok := r.byUsername[username]; ok {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *loginUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if user, ok := r.byEmail[email]; ok {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestFindLoginUserRejectsBots(t *testing.T) {
+	ctx := context.Background()
+	bot := &models.User{Username: "helper-bot", IsBot: true}
+	alice := &models.User{Username: "alice"}
+	repo := &loginUserRepo{
+		byUsername: map[string]*models.User{"helper-bot": bot, "alice": alice},
+		byEmail:    map[string]*models.User{"bot@example.com": bot, "alice@example.com": alice},
+	}
+	svc := NewAuthService(repo, nil, nil, nil, config.Config{}).(*authService)
+
+	tests := map[string]*models.User{
+		"helper-bot":        nil,
+		"bot@example.com":   nil,
+		"alice":             alice,
+		"alice@example.com": alice,
+		"nobody":            nil,
+	}
+	for identifier, want := range tests {
+		got, err := svc.findLoginUser(ctx, identifier)
+		if err != nil || got != want {
+			t.Errorf("findLoginUser(%q) = %v, %v; want %v", identifier, got, err, want)
+		}
+	}
+}
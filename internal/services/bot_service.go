@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"im-go/internal/auth"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBotNotFound         = errors.New("机器人不存在")
+	ErrBotLimitReached     = errors.New("机器人数量已达上限")
+	ErrInvalidBotUsername  = errors.New("机器人用户名只能包含字母、数字和下划线，长度为 3 到 32 位")
+	ErrAPIKeyNotFound      = errors.New("API Key 不存在")
+	ErrAPIKeyLimitReached  = errors.New("可用的 API Key 数量已达上限，请先吊销不再使用的 Key")
+	ErrInvalidAPIKeyScope  = errors.New("无效的 API Key 权限范围")
+	ErrInvalidAPIKey       = errors.New("API Key 无效、已过期或已被吊销")
+	ErrBotMustBeInvited    = errors.New("机器人只能通过邀请加入群组")
+	ErrBotCannotOwnBots    = errors.New("机器人不能创建机器人")
+	ErrAPIKeyNameRequired  = errors.New("API Key 名称不能为空")
+	ErrAPIKeyScopeRequired = errors.New("至少需要授予一个权限范围")
+	ErrInvalidBotCommand   = errors.New("命令名只能包含小写字母、数字和下划线，以字母开头，长度不超过 32 位")
+	ErrBotCommandLimit     = errors.New("机器人登记的命令数量超过上限")
+)
+
+const (
+	// maxBotsPerOwner 是每个用户可以创建的机器人数量上限。
+	maxBotsPerOwner = 10
+	// maxActiveAPIKeysPerBot 是每个机器人同时可用的 API Key 数量上限。
+	maxActiveAPIKeysPerBot = 10
+	// apiKeyPrefixLength 是列表中展示的 Key 明文开头的长度 (含 APIKeyTokenPrefix)。
+	apiKeyPrefixLength = 12
+	// apiKeyTouchInterval 是记录 Key 最后使用时间的最小间隔。
+	apiKeyTouchInterval = time.Minute
+	// maxCommandsPerBot 是每个机器人可以登记的斜杠命令数量上限。
+	maxCommandsPerBot = 50
+	// maxBotCommandDescriptionLength 是命令说明的最大字符数。
+	maxBotCommandDescriptionLength = 100
+)
+
+// botUsernamePattern 限制机器人用户名的字符和长度。
+var botUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,32}$`)
+
+// botCommandPattern 限制机器人命令名的字符和长度。
+var botCommandPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CreatedAPIKey 是新创建的 API Key，Key 为明文，只在创建时返回一次。
+type CreatedAPIKey struct {
+	Key    string
+	APIKey *models.APIKey
+}
+
+// BotService 定义了机器人账号和 API Key 相关服务的接口。
+// 机器人是 IsBot 为 true 的普通用户，由创建者管理；机器人不能通过密码登录，
+// 只能使用 API Key 调用声明了对应权限范围的接口，只能通过邀请加入群组。
+type BotService interface {
+	// CreateBot 为 ownerID 创建一个机器人账号。
+	CreateBot(ctx context.Context, ownerID uint, username, nickname, avatarURL, bio string) (*models.User, error)
+	// ListBots 返回 ownerID 创建的机器人。
+	ListBots(ctx context.Context, ownerID uint) ([]*models.User, error)
+
+	// CreateAPIKey 为机器人签发新的 API Key，ttl 为 0 表示不过期。
+	CreateAPIKey(ctx context.Context, ownerID, botID uint, name string, scopes []models.APIKeyScope, ttl time.Duration) (*CreatedAPIKey, error)
+	// ListAPIKeys 返回机器人的所有 API Key，包括已吊销的。
+	ListAPIKeys(ctx context.Context, ownerID, botID uint) ([]*models.APIKey, error)
+	// RevokeAPIKey 吊销机器人的一个 API Key，立即生效。
+	RevokeAPIKey(ctx context.Context, ownerID, botID, keyID uint) error
+
+	// SetCommands 用 commands 替换机器人登记的斜杠命令，命令名会转换为小写。
+	SetCommands(ctx context.Context, ownerID, botID uint, commands []*models.BotCommand) ([]*models.BotCommand, error)
+	// ListCommands 返回机器人登记的斜杠命令。
+	ListCommands(ctx context.Context, ownerID, botID uint) ([]*models.BotCommand, error)
+
+	// AuthenticateAPIKey 校验请求携带的 API Key，返回 Key 记录及其所属的机器人。
+	// Key 不存在、已过期、已吊销或机器人已被删除时返回 ErrInvalidAPIKey。
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error)
+}
+
+// botService 是 BotService 的实现。
+type botService struct {
+	userRepo    storage.UserRepository
+	apiKeyRepo  storage.APIKeyRepository
+	commandRepo storage.BotCommandRepository
+}
+
+// NewBotService 创建一个新的 BotService 实例。
+func NewBotService(userRepo storage.UserRepository, apiKeyRepo storage.APIKeyRepository, commandRepo storage.BotCommandRepository) BotService {
+	return &botService{userRepo: userRepo, apiKeyRepo: apiKeyRepo, commandRepo: commandRepo}
+}
+
+// CreateBot 创建机器人账号。机器人没有可用的密码，也没有邮箱。
+func (s *botService) CreateBot(ctx context.Context, ownerID uint, username, nickname, avatarURL, bio string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if !botUsernamePattern.MatchString(username) {
+		return nil, ErrInvalidBotUsername
+	}
+
+	owner, err := s.userRepo.GetByID(ctx, ownerID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("获取用户 %d 失败: %w", ownerID, err)
+	}
+	if owner.IsBot {
+		return nil, ErrBotCannotOwnBots
+	}
+
+	bots, err := s.userRepo.GetBotsByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的机器人失败: %w", ownerID, err)
+	}
+	if len(bots) >= maxBotsPerOwner {
+		return nil, ErrBotLimitReached
+	}
+
+	if _, err := s.userRepo.GetByUsername(ctx, username); err == nil {
+		return nil, ErrUserAlreadyExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("检查用户名时出错: %w", err)
+	}
+
+	unusablePassword, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := auth.HashPassword(unusablePassword)
+	if err != nil {
+		return nil, fmt.Errorf("密码哈希失败: %w", err)
+	}
+
+	bot := &models.User{
+		Username:     username,
+		Nickname:     strings.TrimSpace(nickname),
+		AvatarURL:    avatarURL,
+		Bio:          bio,
+		PasswordHash: passwordHash,
+		IsBot:        true,
+		BotOwnerID:   &ownerID,
+	}
+	if bot.Nickname == "" {
+		bot.Nickname = username
+	}
+	// 机器人没有邮箱，不写入该列，使其保持 NULL 而不占用邮箱唯一索引中的空字符串
+	if err := s.userRepo.GetDB().WithContext(ctx).Omit("Email").Create(bot).Error; err != nil {
+		return nil, fmt.Errorf("创建机器人失败: %w", err)
+	}
+	log.Printf("用户 %d 创建了机器人 %d (%s)", ownerID, bot.ID, bot.Username)
+	return bot, nil
+}
+
+// ListBots 返回用户创建的机器人。
+func (s *botService) ListBots(ctx context.Context, ownerID uint) ([]*models.User, error) {
+	bots, err := s.userRepo.GetBotsByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的机器人失败: %w", ownerID, err)
+	}
+	return bots, nil
+}
+
+// CreateAPIKey 签发 API Key，数据库中只保存其哈希。
+func (s *botService) CreateAPIKey(ctx context.Context, ownerID, botID uint, name string, scopes []models.APIKeyScope, ttl time.Duration) (*CreatedAPIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrAPIKeyNameRequired
+	}
+	if len(scopes) == 0 {
+		return nil, ErrAPIKeyScopeRequired
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAPIKeyScope, scope)
+		}
+	}
+	if _, err := s.ownedBot(ctx, ownerID, botID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.apiKeyRepo.GetAPIKeysByUser(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的 API Key 失败: %w", botID, err)
+	}
+	now := time.Now()
+	active := 0
+	for _, key := range existing {
+		if key.IsActive(now) {
+			active++
+		}
+	}
+	if active >= maxActiveAPIKeysPerBot {
+		return nil, ErrAPIKeyLimitReached
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	plaintext := models.APIKeyTokenPrefix + secret
+	apiKey := &models.APIKey{
+		UserID:      botID,
+		CreatedByID: ownerID,
+		Name:        name,
+		KeyPrefix:   plaintext[:apiKeyPrefixLength],
+		KeyHash:     hashToken(plaintext),
+	}
+	apiKey.SetScopes(scopes)
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := s.apiKeyRepo.CreateAPIKey(ctx, apiKey); err != nil {
+		return nil, fmt.Errorf("保存机器人 %d 的 API Key 失败: %w", botID, err)
+	}
+	log.Printf("用户 %d 为机器人 %d 创建了 API Key %d (%s)，权限范围: %s", ownerID, botID, apiKey.ID, apiKey.KeyPrefix, apiKey.Scopes)
+	return &CreatedAPIKey{Key: plaintext, APIKey: apiKey}, nil
+}
+
+// ListAPIKeys 返回机器人的 API Key。
+func (s *botService) ListAPIKeys(ctx context.Context, ownerID, botID uint) ([]*models.APIKey, error) {
+	if _, err := s.ownedBot(ctx, ownerID, botID); err != nil {
+		return nil, err
+	}
+	keys, err := s.apiKeyRepo.GetAPIKeysByUser(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的 API Key 失败: %w", botID, err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 吊销 API Key。重复吊销视为成功。
+func (s *botService) RevokeAPIKey(ctx context.Context, ownerID, botID, keyID uint) error {
+	if _, err := s.ownedBot(ctx, ownerID, botID); err != nil {
+		return err
+	}
+	key, err := s.apiKeyRepo.GetAPIKeyByID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return fmt.Errorf("获取 API Key %d 失败: %w", keyID, err)
+	}
+	if key.UserID != botID {
+		return ErrAPIKeyNotFound
+	}
+	if _, err := s.apiKeyRepo.RevokeAPIKey(ctx, keyID, time.Now()); err != nil {
+		return fmt.Errorf("吊销 API Key %d 失败: %w", keyID, err)
+	}
+	log.Printf("用户 %d 吊销了机器人 %d 的 API Key %d (%s)", ownerID, botID, keyID, key.KeyPrefix)
+	return nil
+}
+
+// AuthenticateAPIKey 校验 API Key 并记录最后使用时间。
+func (s *botService) AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(key, models.APIKeyTokenPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	apiKey, err := s.apiKeyRepo.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("查找 API Key 失败: %w", err)
+	}
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	bot, err := s.userRepo.GetByID(ctx, apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("获取机器人 %d 失败: %w", apiKey.UserID, err)
+	}
+	if !bot.IsBot {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if err := s.apiKeyRepo.TouchAPIKey(ctx, apiKey.ID, now, apiKeyTouchInterval); err != nil {
+		log.Printf("更新 API Key %d 的最后使用时间失败: %v", apiKey.ID, err)
+	}
+	return apiKey, bot, nil
+}
+
+// SetCommands 校验命令名和说明后替换机器人的命令。
+func (s *botService) SetCommands(ctx context.Context, ownerID, botID uint, commands []*models.BotCommand) ([]*models.BotCommand, error) {
+	if _, err := s.ownedBot(ctx, ownerID, botID); err != nil {
+		return nil, err
+	}
+	if len(commands) > maxCommandsPerBot {
+		return nil, ErrBotCommandLimit
+	}
+
+	seen := make(map[string]bool, len(commands))
+	replacement := make([]*models.BotCommand, 0, len(commands))
+	for _, command := range commands {
+		name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(command.Name), "/"))
+		if !botCommandPattern.MatchString(name) || seen[name] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidBotCommand, command.Name)
+		}
+		seen[name] = true
+		description := strings.TrimSpace(command.Description)
+		if utf8.RuneCountInString(description) > maxBotCommandDescriptionLength {
+			description = string([]rune(description)[:maxBotCommandDescriptionLength])
+		}
+		replacement = append(replacement, &models.BotCommand{BotID: botID, Name: name, Description: description})
+	}
+
+	if err := s.commandRepo.ReplaceBotCommands(ctx, botID, replacement); err != nil {
+		return nil, fmt.Errorf("保存机器人 %d 的命令失败: %w", botID, err)
+	}
+	return replacement, nil
+}
+
+// ListCommands 返回机器人的命令。
+func (s *botService) ListCommands(ctx context.Context, ownerID, botID uint) ([]*models.BotCommand, error) {
+	if _, err := s.ownedBot(ctx, ownerID, botID); err != nil {
+		return nil, err
+	}
+	commands, err := s.commandRepo.GetBotCommands(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的命令失败: %w", botID, err)
+	}
+	return commands, nil
+}
+
+// ownedBot 获取 ownerID 创建的机器人，机器人不存在或不属于该用户时返回 ErrBotNotFound。
+func (s *botService) ownedBot(ctx context.Context, ownerID, botID uint) (*models.User, error) {
+	return findOwnedBot(ctx, s.userRepo, ownerID, botID)
+}
+
+// findOwnedBot 是 ownedBot 的实现，也供管理机器人 Webhook 时校验归属。
+func findOwnedBot(ctx context.Context, userRepo storage.UserRepository, ownerID, botID uint) (*models.User, error) {
+	bot, err := userRepo.GetByID(ctx, botID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBotNotFound
+		}
+		return nil, fmt.Errorf("获取机器人 %d 失败: %w", botID, err)
+	}
+	if !bot.IsBot || bot.BotOwnerID == nil || *bot.BotOwnerID != ownerID {
+		return nil, ErrBotNotFound
+	}
+	return bot, nil
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/imtypes"
+	appKafka "im-go/internal/kafka"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// ChannelService 定义了广播频道相关服务的接口。
+// 频道是一对多的只读会话：管理员作为会话参与者发言，订阅者只记录订阅关系，
+// 消息通过广播主题投递，不会为每个订阅者单独写入参与者记录或 Kafka 消息。
+type ChannelService interface {
+	CreateChannel(ctx context.Context, ownerID uint, name, description, avatarURL string, isPublic bool) (*models.Channel, error)
+	// GetChannel 获取频道详情，私有频道仅订阅者可见。
+	GetChannel(ctx context.Context, userID, channelID uint) (*models.Channel, error)
+	SearchPublicChannels(ctx context.Context, query string, limit, offset int) ([]*models.Channel, error)
+
+	Subscribe(ctx context.Context, userID, channelID uint) error
+	Unsubscribe(ctx context.Context, userID, channelID uint) error
+	GetUserChannels(ctx context.Context, userID uint, limit, offset int) ([]*models.Channel, error)
+
+	// SetAdmin 由频道所有者授予或撤销订阅者的发言 (管理员) 权限。
+	SetAdmin(ctx context.Context, ownerID, channelID, userID uint, isAdmin bool) error
+
+	// GetSubscribedTopics 返回用户订阅的所有频道的 Hub 主题，用于 WebSocket 连接建立时订阅。
+	GetSubscribedTopics(ctx context.Context, userID uint) ([]string, error)
+}
+
+var (
+	ErrChannelNotFound         = errors.New("频道未找到")
+	ErrChannelPermissionDenied = errors.New("没有执行该操作的频道权限")
+	ErrChannelOwnerCannotLeave = errors.New("频道所有者不能取消订阅")
+	ErrNotChannelSubscriber    = errors.New("用户未订阅该频道")
+)
+
+// channelService 是 ChannelService 的实现。
+type channelService struct {
+	channelRepo storage.ChannelRepository
+	convoRepo   storage.ConversationRepository
+	producer    appKafka.MessageProducer // 用于发布订阅变更，让在线连接即时加入或离开频道主题
+	cfg         config.Config
+}
+
+// NewChannelService 创建一个新的 ChannelService 实例。
+func NewChannelService(channelRepo storage.ChannelRepository, convoRepo storage.ConversationRepository, producer appKafka.MessageProducer, cfg config.Config) ChannelService {
+	return &channelService{channelRepo: channelRepo, convoRepo: convoRepo, producer: producer, cfg: cfg}
+}
+
+// CreateChannel 创建频道及其关联会话，创建者成为管理员并自动订阅。
+func (s *channelService) CreateChannel(ctx context.Context, ownerID uint, name, description, avatarURL string, isPublic bool) (*models.Channel, error) {
+	if name == "" {
+		return nil, fmt.Errorf("频道名称不能为空")
+	}
+
+	var channel *models.Channel
+	err := s.channelRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txConvoRepo := storage.NewGormConversationRepository(tx)
+		txChannelRepo := storage.NewGormChannelRepository(tx)
+
+		conversation := &models.Conversation{Type: models.ChannelConversation}
+		if err := txConvoRepo.CreateConversation(ctx, conversation); err != nil {
+			return fmt.Errorf("创建频道会话失败: %w", err)
+		}
+
+		channel = &models.Channel{
+			Name:           name,
+			Description:    description,
+			AvatarURL:      avatarURL,
+			OwnerID:        ownerID,
+			ConversationID: conversation.ID,
+			IsPublic:       isPublic,
+		}
+		if err := txChannelRepo.CreateChannel(ctx, channel); err != nil {
+			return fmt.Errorf("创建频道失败: %w", err)
+		}
+
+		if err := tx.Model(conversation).Update("target_id", channel.ID).Error; err != nil {
+			return fmt.Errorf("关联频道会话失败: %w", err)
+		}
+
+		owner := &models.ConversationParticipant{
+			ConversationID: conversation.ID,
+			UserID:         ownerID,
+			JoinedAt:       time.Now(),
+			IsAdmin:        true,
+		}
+		if err := txConvoRepo.AddParticipant(ctx, owner); err != nil {
+			return fmt.Errorf("将所有者 %d 设为频道管理员失败: %w", ownerID, err)
+		}
+
+		if _, err := txChannelRepo.AddSubscription(ctx, &models.ChannelSubscription{
+			ChannelID:    channel.ID,
+			UserID:       ownerID,
+			SubscribedAt: time.Now(),
+		}); err != nil {
+			return fmt.Errorf("为所有者 %d 订阅频道失败: %w", ownerID, err)
+		}
+		channel.SubscriberCount = 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishSubscription(ctx, channel, ownerID, true)
+	return channel, nil
+}
+
+// GetChannel 获取频道详情。
+func (s *channelService) GetChannel(ctx context.Context, userID, channelID uint) (*models.Channel, error) {
+	channel, err := s.getChannel(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.IsPublic {
+		subscribed, err := s.channelRepo.IsSubscribed(ctx, channelID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("检查频道 %d 订阅状态失败: %w", channelID, err)
+		}
+		if !subscribed {
+			return nil, ErrChannelNotFound
+		}
+	}
+	return channel, nil
+}
+
+// SearchPublicChannels 搜索公开频道。
+func (s *channelService) SearchPublicChannels(ctx context.Context, query string, limit, offset int) ([]*models.Channel, error) {
+	return s.channelRepo.SearchPublicChannels(ctx, query, limit, offset)
+}
+
+// Subscribe 订阅频道。私有频道不能自行订阅。重复订阅视为成功。
+func (s *channelService) Subscribe(ctx context.Context, userID, channelID uint) error {
+	channel, err := s.getChannel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if !channel.IsPublic {
+		return fmt.Errorf("%w: 私有频道不能自行订阅", ErrChannelPermissionDenied)
+	}
+
+	created, err := s.channelRepo.AddSubscription(ctx, &models.ChannelSubscription{
+		ChannelID:    channelID,
+		UserID:       userID,
+		SubscribedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("订阅频道 %d 失败: %w", channelID, err)
+	}
+	if created {
+		s.publishSubscription(ctx, channel, userID, true)
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅频道。管理员取消订阅时同时失去发言权限。
+func (s *channelService) Unsubscribe(ctx context.Context, userID, channelID uint) error {
+	channel, err := s.getChannel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if channel.OwnerID == userID {
+		return ErrChannelOwnerCannotLeave
+	}
+
+	removed, err := s.channelRepo.RemoveSubscription(ctx, channelID, userID)
+	if err != nil {
+		return fmt.Errorf("取消订阅频道 %d 失败: %w", channelID, err)
+	}
+	if !removed {
+		return ErrNotChannelSubscriber
+	}
+	if err := s.convoRepo.RemoveParticipant(ctx, channel.ConversationID, userID); err != nil {
+		log.Printf("移除频道 %d 管理员 %d 失败: %v", channelID, userID, err)
+	}
+	s.publishSubscription(ctx, channel, userID, false)
+	return nil
+}
+
+// GetUserChannels 获取用户订阅的频道列表。
+func (s *channelService) GetUserChannels(ctx context.Context, userID uint, limit, offset int) ([]*models.Channel, error) {
+	return s.channelRepo.GetUserChannels(ctx, userID, limit, offset)
+}
+
+// SetAdmin 授予或撤销频道管理员。只有所有者可以操作，且目标必须是订阅者。
+func (s *channelService) SetAdmin(ctx context.Context, ownerID, channelID, userID uint, isAdmin bool) error {
+	channel, err := s.getChannel(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	if channel.OwnerID != ownerID {
+		return fmt.Errorf("%w: 只有频道所有者可以管理管理员", ErrChannelPermissionDenied)
+	}
+	if userID == channel.OwnerID {
+		return fmt.Errorf("%w: 不能修改所有者的管理员身份", ErrChannelPermissionDenied)
+	}
+
+	if !isAdmin {
+		if err := s.convoRepo.RemoveParticipant(ctx, channel.ConversationID, userID); err != nil {
+			return fmt.Errorf("撤销频道 %d 管理员 %d 失败: %w", channelID, userID, err)
+		}
+		return nil
+	}
+
+	subscribed, err := s.channelRepo.IsSubscribed(ctx, channelID, userID)
+	if err != nil {
+		return fmt.Errorf("检查频道 %d 订阅状态失败: %w", channelID, err)
+	}
+	if !subscribed {
+		return ErrNotChannelSubscriber
+	}
+	admin := &models.ConversationParticipant{
+		ConversationID: channel.ConversationID,
+		UserID:         userID,
+		JoinedAt:       time.Now(),
+		IsAdmin:        true,
+	}
+	if err := s.convoRepo.AddParticipant(ctx, admin); err != nil {
+		return fmt.Errorf("设置频道 %d 管理员 %d 失败: %w", channelID, userID, err)
+	}
+	return nil
+}
+
+// GetSubscribedTopics 返回用户订阅的所有频道主题。
+func (s *channelService) GetSubscribedTopics(ctx context.Context, userID uint) ([]string, error) {
+	conversationIDs, err := s.channelRepo.GetSubscribedConversationIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 订阅的频道失败: %w", userID, err)
+	}
+	topics := make([]string, 0, len(conversationIDs))
+	for _, id := range conversationIDs {
+		topics = append(topics, imtypes.ChannelTopic(id))
+	}
+	return topics, nil
+}
+
+// getChannel 获取频道，不存在时返回 ErrChannelNotFound。
+func (s *channelService) getChannel(ctx context.Context, channelID uint) (*models.Channel, error) {
+	channel, err := s.channelRepo.GetChannelByID(ctx, channelID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChannelNotFound
+		}
+		return nil, fmt.Errorf("获取频道 %d 失败: %w", channelID, err)
+	}
+	return channel, nil
+}
+
+// publishSubscription 广播订阅变更，让持有该用户连接的 ChatServer 实例即时加入或离开频道主题。
+// 发布失败只影响当前连接，用户重新连接时会按订阅记录重新订阅。
+func (s *channelService) publishSubscription(ctx context.Context, channel *models.Channel, userID uint, subscribed bool) {
+	envelope := imtypes.BroadcastEnvelope{
+		Kind:           imtypes.BroadcastSubscription,
+		Topic:          imtypes.ChannelTopic(channel.ConversationID),
+		ConversationID: channel.ConversationID,
+		UserID:         userID,
+		Subscribed:     subscribed,
+	}
+	if err := publishBroadcast(ctx, s.producer, s.cfg.Kafka.BroadcastTopic, &envelope); err != nil {
+		log.Printf("发布频道 %d 用户 %d 的订阅变更失败: %v", channel.ID, userID, err)
+	}
+}
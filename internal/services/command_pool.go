@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// CommandWorkerPool 在固定数量的 goroutine 中执行斜杠命令和按钮回调，
+// 使调用机器人 Webhook 的等待不阻塞入站消息的消费。队列满时拒绝新任务而不是等待。
+type CommandWorkerPool struct {
+	workers int
+	jobs    chan func(ctx context.Context)
+}
+
+// NewCommandWorkerPool 创建一个最多 workers 个任务并发、最多 queueSize 个任务排队的工作池。
+// 需要调用 Run 启动工作 goroutine。
+func NewCommandWorkerPool(workers, queueSize int) *CommandWorkerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &CommandWorkerPool{workers: workers, jobs: make(chan func(ctx context.Context), queueSize)}
+}
+
+// Submit 把任务放入队列，队列已满时立即返回 false。
+func (p *CommandWorkerPool) Submit(job func(ctx context.Context)) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run 启动工作 goroutine 执行队列中的任务，直到 ctx 被取消并且正在执行的任务结束。
+func (p *CommandWorkerPool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					p.execute(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// execute 执行单个任务，任务中的 panic 只记录日志，不影响其他任务。
+func (p *CommandWorkerPool) execute(ctx context.Context, job func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("命令任务异常: %v", r)
+		}
+	}()
+	job(ctx)
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCommandSenderIsBot     = errors.New("机器人发送的消息不作为命令处理")
+	ErrInvalidCommandResponse = errors.New("命令回复无效")
+	ErrBotCommandUnavailable  = errors.New("机器人没有可以接收命令的 Webhook")
+)
+
+const (
+	// maxCommandResponseLength 是命令回复文本的最大字符数，与 REST 发送消息的限制一致。
+	maxCommandResponseLength = 4000
+	// maxMessageButtons 是一条消息上按钮的最大数量。
+	maxMessageButtons = 5
+	// maxButtonIDLength 和 maxButtonLabelLength 限制按钮 ID 的字节数和文字的字符数。
+	maxButtonIDLength    = 64
+	maxButtonLabelLength = 40
+	// commandResponseMaxBytes 是读取机器人命令响应体的上限。
+	commandResponseMaxBytes = 64 * 1024
+)
+
+// commandPattern 匹配 "/命令"、"/命令 参数" 和指定机器人的 "/命令@机器人用户名 参数"。
+var commandPattern = regexp.MustCompile(`^/([A-Za-z][A-Za-z0-9_]{0,31})(?:@([A-Za-z0-9_]{3,32}))?(?:\s+([\s\S]*))?$`)
+
+// CommandInvocation 是一次斜杠命令调用。
+type CommandInvocation struct {
+	Command        string // 小写的命令名，不含 "/"
+	BotUsername    string // "/命令@机器人用户名" 中指定的机器人，可为空
+	Args           string // 命令名之后的文本
+	ConversationID uint
+	GroupID        uint // 群聊中为群组 ID
+	UserID         uint // 调用者
+}
+
+// CommandCallback 是用户点击交互消息上按钮产生的回调。
+type CommandCallback struct {
+	Command        string // 产生该消息的命令
+	MessageID      uint
+	ButtonID       string
+	ConversationID uint
+	GroupID        uint
+	UserID         uint // 点击按钮的用户
+}
+
+// CommandResponse 是命令处理器的回复。Ephemeral 为 true 时只推送给调用者且不保存，不能带按钮；
+// 否则作为普通文本消息发到会话中，按钮被点击时回调发回给同一个处理器。
+type CommandResponse struct {
+	Text      string                 `json:"text"`
+	Ephemeral bool                   `json:"ephemeral,omitempty"`
+	Buttons   []models.MessageButton `json:"buttons,omitempty"`
+}
+
+// CommandReply 是路由后的回复以及发送者：进程内命令以调用者的身份发送，机器人命令以机器人的身份发送。
+type CommandReply struct {
+	Command  string
+	SenderID uint
+	Response *CommandResponse
+}
+
+// CommandHandler 是进程内的斜杠命令处理器。返回 nil 表示不回复。
+type CommandHandler interface {
+	HandleCommand(ctx context.Context, inv *CommandInvocation) (*CommandResponse, error)
+	HandleCallback(ctx context.Context, cb *CommandCallback) (*CommandResponse, error)
+}
+
+// CommandHandlerFunc 把函数适配为不带按钮回调的 CommandHandler。
+type CommandHandlerFunc func(ctx context.Context, inv *CommandInvocation) (*CommandResponse, error)
+
+// HandleCommand 调用 f。
+func (f CommandHandlerFunc) HandleCommand(ctx context.Context, inv *CommandInvocation) (*CommandResponse, error) {
+	return f(ctx, inv)
+}
+
+// HandleCallback 忽略按钮回调。
+func (f CommandHandlerFunc) HandleCallback(ctx context.Context, cb *CommandCallback) (*CommandResponse, error) {
+	return nil, nil
+}
+
+// CommandRouter 把斜杠命令和按钮回调路由给进程内处理器或机器人。
+// 进程内命令优先；其余命令在会话中的机器人登记的命令里查找，通过机器人的 Webhook 同步投递。
+type CommandRouter interface {
+	// Register 登记一个进程内命令，只应在启动时调用。
+	Register(name, description string, handler CommandHandler)
+	// Route 处理一次命令调用。调用者是机器人时返回 ErrCommandSenderIsBot，消息应按普通消息处理；
+	// 未知命令和处理失败以临时回复告知调用者。
+	Route(ctx context.Context, inv *CommandInvocation) (*CommandReply, error)
+	// RouteCallback 处理一次按钮回调，senderID 是被点击消息的发送者。
+	RouteCallback(ctx context.Context, cb *CommandCallback, senderID uint) (*CommandReply, error)
+}
+
+// registeredCommand 是登记的进程内命令。
+type registeredCommand struct {
+	description string
+	handler     CommandHandler
+}
+
+// commandRouter 是 CommandRouter 的实现。
+type commandRouter struct {
+	builtins    map[string]registeredCommand
+	commandRepo storage.BotCommandRepository
+	webhookRepo storage.WebhookRepository
+	userRepo    storage.UserRepository
+	client      *http.Client
+}
+
+// NewCommandRouter 创建一个新的 CommandRouter 实例，并登记内置的 /help 命令。
+func NewCommandRouter(commandRepo storage.BotCommandRepository, webhookRepo storage.WebhookRepository, userRepo storage.UserRepository, cfg config.WebhookConfig) CommandRouter {
+	r := &commandRouter{
+		builtins:    make(map[string]registeredCommand),
+		commandRepo: commandRepo,
+		webhookRepo: webhookRepo,
+		userRepo:    userRepo,
+		client:      newWebhookHTTPClient(cfg, cfg.CommandTimeout),
+	}
+	r.Register("help", "列出当前会话中可用的命令", CommandHandlerFunc(r.help))
+	return r
+}
+
+// ParseCommand 解析以 "/" 开头的消息文本，不是命令格式时返回 false。
+func ParseCommand(text string) (*CommandInvocation, bool) {
+	matches := commandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if matches == nil {
+		return nil, false
+	}
+	return &CommandInvocation{
+		Command:     strings.ToLower(matches[1]),
+		BotUsername: matches[2],
+		Args:        strings.TrimSpace(matches[3]),
+	}, true
+}
+
+// Register 登记进程内命令，同名命令会被覆盖。
+func (r *commandRouter) Register(name, description string, handler CommandHandler) {
+	r.builtins[strings.ToLower(name)] = registeredCommand{description: description, handler: handler}
+}
+
+// Route 依次查找进程内命令和会话中机器人登记的命令。
+func (r *commandRouter) Route(ctx context.Context, inv *CommandInvocation) (*CommandReply, error) {
+	invoker, err := r.userRepo.GetByID(ctx, inv.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 失败: %w", inv.UserID, err)
+	}
+	if invoker.IsBot {
+		return nil, ErrCommandSenderIsBot
+	}
+
+	if builtin, ok := r.builtins[inv.Command]; ok && inv.BotUsername == "" {
+		resp, err := builtin.handler.HandleCommand(ctx, inv)
+		if err != nil {
+			log.Printf("命令 /%s 处理失败 (会话 %d, 用户 %d): %v", inv.Command, inv.ConversationID, inv.UserID, err)
+			return commandFailure(inv.Command, inv.UserID), nil
+		}
+		return &CommandReply{Command: inv.Command, SenderID: inv.UserID, Response: resp}, nil
+	}
+
+	commands, err := r.commandRepo.GetConversationBotCommands(ctx, inv.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话 %d 中机器人的命令失败: %w", inv.ConversationID, err)
+	}
+	var matched []*models.BotCommand
+	for _, command := range commands {
+		if command.Name != inv.Command {
+			continue
+		}
+		if inv.BotUsername != "" && !strings.EqualFold(command.Bot.Username, inv.BotUsername) {
+			continue
+		}
+		matched = append(matched, command)
+	}
+
+	switch len(matched) {
+	case 0:
+		return ephemeralReply(inv.Command, inv.UserID, fmt.Sprintf("未知命令 /%s，发送 /help 查看可用的命令", inv.Command)), nil
+	case 1:
+	default:
+		return ephemeralReply(inv.Command, inv.UserID, fmt.Sprintf("多个机器人提供了 /%s 命令，请使用 /%s@机器人用户名 指定", inv.Command, inv.Command)), nil
+	}
+
+	botID := matched[0].BotID
+	resp, err := r.invokeBot(ctx, botID, &WebhookEvent{
+		Type:           models.WebhookEventCommandInvoked,
+		ConversationID: inv.ConversationID,
+		GroupID:        inv.GroupID,
+		UserID:         inv.UserID,
+		Command:        inv.Command,
+		Args:           inv.Args,
+	})
+	if err != nil {
+		log.Printf("机器人 %d 处理命令 /%s 失败 (会话 %d): %v", botID, inv.Command, inv.ConversationID, err)
+		return commandFailure(inv.Command, inv.UserID), nil
+	}
+	return &CommandReply{Command: inv.Command, SenderID: botID, Response: resp}, nil
+}
+
+// RouteCallback 把机器人消息上的按钮回调投递给机器人，其他消息的回调交给产生该消息的进程内命令。
+func (r *commandRouter) RouteCallback(ctx context.Context, cb *CommandCallback, senderID uint) (*CommandReply, error) {
+	sender, err := r.userRepo.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 失败: %w", senderID, err)
+	}
+
+	if sender.IsBot {
+		resp, err := r.invokeBot(ctx, sender.ID, &WebhookEvent{
+			Type:           models.WebhookEventButtonClicked,
+			ConversationID: cb.ConversationID,
+			GroupID:        cb.GroupID,
+			UserID:         cb.UserID,
+			Command:        cb.Command,
+			MessageID:      cb.MessageID,
+			ButtonID:       cb.ButtonID,
+		})
+		if err != nil {
+			log.Printf("机器人 %d 处理按钮回调失败 (消息 %d): %v", sender.ID, cb.MessageID, err)
+			return commandFailure(cb.Command, cb.UserID), nil
+		}
+		return &CommandReply{Command: cb.Command, SenderID: sender.ID, Response: resp}, nil
+	}
+
+	builtin, ok := r.builtins[cb.Command]
+	if !ok {
+		return ephemeralReply(cb.Command, cb.UserID, "该按钮已失效"), nil
+	}
+	resp, err := builtin.handler.HandleCallback(ctx, cb)
+	if err != nil {
+		log.Printf("命令 /%s 处理按钮回调失败 (消息 %d): %v", cb.Command, cb.MessageID, err)
+		return commandFailure(cb.Command, cb.UserID), nil
+	}
+	return &CommandReply{Command: cb.Command, SenderID: cb.UserID, Response: resp}, nil
+}
+
+// invokeBot 把交互事件同步投递给机器人第一个订阅了该事件的 Webhook，响应体解析为回复，空响应表示不回复。
+// 投递结果记入投递日志，但不影响 Webhook 的连续失败计数。
+func (r *commandRouter) invokeBot(ctx context.Context, botID uint, event *WebhookEvent) (*CommandResponse, error) {
+	hooks, err := r.webhookRepo.GetEnabledWebhooksForBot(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的 Webhook 失败: %w", botID, err)
+	}
+	var hook *models.Webhook
+	for _, candidate := range hooks {
+		if candidate.Subscribes(event.Type) {
+			hook = candidate
+			break
+		}
+	}
+	if hook == nil {
+		return nil, ErrBotCommandUnavailable
+	}
+
+	event.ID = uuid.NewString()
+	event.CreatedAt = time.Now()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("序列化 Webhook 事件失败: %w", err)
+	}
+
+	start := time.Now()
+	statusCode, body, postErr := postWebhook(ctx, r.client, hook, event.Type, event.ID, payload, commandResponseMaxBytes)
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		WebhookID:      hook.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Status:         models.WebhookDeliverySucceeded,
+		Attempts:       1,
+		NextAttemptAt:  now,
+		LastStatusCode: statusCode,
+		LastDurationMs: now.Sub(start).Milliseconds(),
+		DeliveredAt:    &now,
+	}
+	if postErr != nil {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.LastError = truncateWebhookError(postErr.Error(), webhookMaxErrorLength)
+		delivery.DeliveredAt = nil
+	}
+	if err := r.webhookRepo.CreateDeliveries(ctx, []*models.WebhookDelivery{delivery}); err != nil {
+		log.Printf("保存 Webhook %d 的投递记录失败: %v", hook.ID, err)
+	}
+	if postErr != nil {
+		return nil, postErr
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
+	}
+	var resp CommandResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCommandResponse, err)
+	}
+	return &resp, nil
+}
+
+// help 列出内置命令和会话中机器人登记的命令。
+func (r *commandRouter) help(ctx context.Context, inv *CommandInvocation) (*CommandResponse, error) {
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("可用的命令:")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n/%s - %s", name, r.builtins[name].description)
+	}
+	commands, err := r.commandRepo.GetConversationBotCommands(ctx, inv.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话 %d 中机器人的命令失败: %w", inv.ConversationID, err)
+	}
+	for _, command := range commands {
+		fmt.Fprintf(&b, "\n/%s@%s - %s", command.Name, command.Bot.Username, command.Description)
+	}
+	return &CommandResponse{Text: b.String(), Ephemeral: true}, nil
+}
+
+// ValidateCommandResponse 检查回复的文本和按钮，临时回复不能带按钮。
+func ValidateCommandResponse(resp *CommandResponse) error {
+	if strings.TrimSpace(resp.Text) == "" {
+		return fmt.Errorf("%w: 回复内容不能为空", ErrInvalidCommandResponse)
+	}
+	if utf8.RuneCountInString(resp.Text) > maxCommandResponseLength {
+		return fmt.Errorf("%w: 回复内容不能超过 %d 个字符", ErrInvalidCommandResponse, maxCommandResponseLength)
+	}
+	if resp.Ephemeral && len(resp.Buttons) > 0 {
+		return fmt.Errorf("%w: 临时回复不能带按钮", ErrInvalidCommandResponse)
+	}
+	if len(resp.Buttons) > maxMessageButtons {
+		return fmt.Errorf("%w: 按钮不能超过 %d 个", ErrInvalidCommandResponse, maxMessageButtons)
+	}
+	seen := make(map[string]bool, len(resp.Buttons))
+	for _, button := range resp.Buttons {
+		if button.ID == "" || len(button.ID) > maxButtonIDLength || seen[button.ID] {
+			return fmt.Errorf("%w: 按钮 ID 不能为空、重复或超过 %d 个字节", ErrInvalidCommandResponse, maxButtonIDLength)
+		}
+		seen[button.ID] = true
+		if strings.TrimSpace(button.Label) == "" || utf8.RuneCountInString(button.Label) > maxButtonLabelLength {
+			return fmt.Errorf("%w: 按钮文字不能为空或超过 %d 个字符", ErrInvalidCommandResponse, maxButtonLabelLength)
+		}
+		switch button.Style {
+		case "", "default", "primary", "danger":
+		default:
+			return fmt.Errorf("%w: 未知的按钮样式 %s", ErrInvalidCommandResponse, button.Style)
+		}
+	}
+	return nil
+}
+
+// ephemeralReply 构建只推送给 userID 的提示。
+func ephemeralReply(command string, userID uint, text string) *CommandReply {
+	return &CommandReply{Command: command, SenderID: userID, Response: &CommandResponse{Text: text, Ephemeral: true}}
+}
+
+// commandFailure 构建命令处理失败的提示。
+func commandFailure(command string, userID uint) *CommandReply {
+	return ephemeralReply(command, userID, fmt.Sprintf("命令 /%s 执行失败，请稍后重试", command))
+}
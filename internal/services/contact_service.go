@@ -0,0 +1,534 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxRemarkLength           = 64
+	maxFriendTags             = 20
+	maxTagLength              = 20
+	maxContactGroupNameLength = 50
+
+	defaultSuggestionLimit = 20
+	maxSuggestionLimit     = 50
+	// suggestionPoolSize candidates are computed and cached per user, so that limit and read-time
+	// exclusions can be applied without recomputing.
+	suggestionPoolSize = 100
+	// maxSuggestionGroupSize is the largest group whose members count as people the user may know.
+	maxSuggestionGroupSize = 500
+	suggestionCacheTTL     = 10 * time.Minute
+)
+
+var (
+	ErrInvalidRemark           = errors.New("备注不能超过 64 个字符")
+	ErrInvalidFriendTags       = errors.New("每个好友最多 20 个标签，每个标签不能超过 20 个字符")
+	ErrContactGroupNotFound    = errors.New("联系人分组不存在")
+	ErrContactGroupExists      = errors.New("已存在同名的联系人分组")
+	ErrInvalidContactGroupName = errors.New("分组名称不能为空且不能超过 50 个字符")
+)
+
+// FriendFilter narrows down the friends list. Empty fields do not filter.
+type FriendFilter struct {
+	Query          string // case-insensitive match on remark, nickname or username
+	Tag            string // friends carrying this tag
+	ContactGroupID uint   // friends in this contact group
+}
+
+// FriendSelector picks friends for bulk operations such as adding them to a group chat.
+// A friend is selected if they are in any of the contact groups or carry any of the tags.
+type FriendSelector struct {
+	ContactGroupIDs []uint   `json:"contactGroupIds,omitempty"`
+	Tags            []string `json:"contactTags,omitempty"`
+}
+
+// FriendProfileChanges is an update to the user's private data about a friend. Nil fields are left unchanged.
+type FriendProfileChanges struct {
+	Remark *string   `json:"remark,omitempty"`
+	Tags   *[]string `json:"tags,omitempty"`
+	// ContactGroupID moves the friend into a contact group; 0 moves them out of their current group.
+	ContactGroupID *uint `json:"contactGroupId,omitempty"`
+}
+
+// SuggestionCache caches the ranked suggestion candidates of each user. Implementations must be safe for
+// concurrent use; a cache miss is reported with ok == false.
+type SuggestionCache interface {
+	Get(ctx context.Context, userID uint) (candidates []models.SuggestionCandidate, ok bool, err error)
+	Set(ctx context.Context, userID uint, candidates []models.SuggestionCandidate, ttl time.Duration) error
+}
+
+// ContactService manages the friends list together with per-friend remarks, tags and contact groups.
+type ContactService interface {
+	// ListFriends returns the user's friends with their remarks, tags and contact group, sorted by display name.
+	ListFriends(ctx context.Context, userID uint, filter FriendFilter) ([]*models.FriendInfo, error)
+	// UpdateFriend changes the user's remark, tags or contact group of a friend. Returns ErrNotFriends if they are not friends.
+	UpdateFriend(ctx context.Context, userID, friendID uint, changes FriendProfileChanges) (*models.FriendInfo, error)
+	// ListTags returns every tag the user has put on friends, sorted.
+	ListTags(ctx context.Context, userID uint) ([]string, error)
+	// SelectFriendIDs returns the IDs of the friends matched by the selector.
+	SelectFriendIDs(ctx context.Context, userID uint, selector FriendSelector) ([]uint, error)
+
+	// ListContactGroups returns the user's contact groups with their member counts.
+	ListContactGroups(ctx context.Context, userID uint) ([]*models.ContactGroup, error)
+	// CreateContactGroup creates a contact group. Names must be unique per user.
+	CreateContactGroup(ctx context.Context, userID uint, name string) (*models.ContactGroup, error)
+	// RenameContactGroup renames one of the user's contact groups.
+	RenameContactGroup(ctx context.Context, userID, groupID uint, name string) (*models.ContactGroup, error)
+	// DeleteContactGroup deletes a contact group. Its friends stay friends but are no longer in any group.
+	DeleteContactGroup(ctx context.Context, userID, groupID uint) error
+
+	// SuggestFriends returns up to limit non-friends the user may know, ranked by mutual friends, then shared groups.
+	SuggestFriends(ctx context.Context, userID uint, limit int) ([]*models.FriendSuggestion, error)
+}
+
+type contactService struct {
+	friendshipRepo storage.FriendshipRepository
+	userRepo       storage.UserRepository
+	suggestionRepo storage.SuggestionRepository
+	cache          SuggestionCache // may be nil, in which case suggestions are computed on every request
+}
+
+// NewContactService creates a new ContactService instance.
+func NewContactService(friendshipRepo storage.FriendshipRepository, userRepo storage.UserRepository, suggestionRepo storage.SuggestionRepository, cache SuggestionCache) ContactService {
+	return &contactService{
+		friendshipRepo: friendshipRepo,
+		userRepo:       userRepo,
+		suggestionRepo: suggestionRepo,
+		cache:          cache,
+	}
+}
+
+// ListFriends loads all friends and their profiles, then filters in memory: friends lists are small,
+// and tags are stored as JSON so filtering them in SQL would not use an index anyway.
+func (s *contactService) ListFriends(ctx context.Context, userID uint, filter FriendFilter) ([]*models.FriendInfo, error) {
+	friends, err := s.loadFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+	tag := strings.TrimSpace(filter.Tag)
+
+	result := make([]*models.FriendInfo, 0, len(friends))
+	for _, friend := range friends {
+		if filter.ContactGroupID != 0 && (friend.ContactGroupID == nil || *friend.ContactGroupID != filter.ContactGroupID) {
+			continue
+		}
+		if tag != "" && !containsString(friend.Tags, tag) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(friend.Remark), query) &&
+			!strings.Contains(strings.ToLower(friend.Nickname), query) &&
+			!strings.Contains(strings.ToLower(friend.Username), query) {
+			continue
+		}
+		result = append(result, friend)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return strings.ToLower(friendDisplayName(result[i])) < strings.ToLower(friendDisplayName(result[j]))
+	})
+	return result, nil
+}
+
+// UpdateFriend validates the changes and upserts the profile.
+func (s *contactService) UpdateFriend(ctx context.Context, userID, friendID uint, changes FriendProfileChanges) (*models.FriendInfo, error) {
+	friends, err := s.loadFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var friend *models.FriendInfo
+	for _, f := range friends {
+		if f.ID == friendID {
+			friend = f
+			break
+		}
+	}
+	if friend == nil {
+		return nil, ErrNotFriends
+	}
+
+	if changes.Remark != nil {
+		remark := strings.TrimSpace(*changes.Remark)
+		if utf8.RuneCountInString(remark) > maxRemarkLength {
+			return nil, ErrInvalidRemark
+		}
+		friend.Remark = remark
+	}
+	if changes.Tags != nil {
+		tags, err := normalizeTags(*changes.Tags)
+		if err != nil {
+			return nil, err
+		}
+		friend.Tags = tags
+	}
+	if changes.ContactGroupID != nil {
+		if *changes.ContactGroupID == 0 {
+			friend.ContactGroupID = nil
+		} else {
+			if _, err := s.getContactGroup(ctx, userID, *changes.ContactGroupID); err != nil {
+				return nil, err
+			}
+			groupID := *changes.ContactGroupID
+			friend.ContactGroupID = &groupID
+		}
+	}
+
+	profile := &models.FriendProfile{
+		OwnerID:        userID,
+		FriendID:       friendID,
+		Remark:         friend.Remark,
+		Tags:           friend.Tags,
+		ContactGroupID: friend.ContactGroupID,
+	}
+	if err := s.friendshipRepo.SaveProfile(ctx, profile); err != nil {
+		log.Printf("Error saving friend profile of user %d for friend %d: %v", userID, friendID, err)
+		return nil, fmt.Errorf("保存好友备注失败: %w", err)
+	}
+	return friend, nil
+}
+
+// ListTags collects the distinct tags across all of the user's friend profiles.
+func (s *contactService) ListTags(ctx context.Context, userID uint) ([]string, error) {
+	profiles, err := s.friendshipRepo.GetProfiles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取好友标签失败: %w", err)
+	}
+	seen := make(map[string]bool)
+	tags := []string{}
+	for _, profile := range profiles {
+		for _, tag := range profile.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// SelectFriendIDs returns the union of the friends in the selected contact groups and the friends carrying
+// the selected tags. Contact groups that do not belong to the user match nobody.
+func (s *contactService) SelectFriendIDs(ctx context.Context, userID uint, selector FriendSelector) ([]uint, error) {
+	if len(selector.ContactGroupIDs) == 0 && len(selector.Tags) == 0 {
+		return nil, nil
+	}
+	friends, err := s.loadFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[uint]bool, len(selector.ContactGroupIDs))
+	for _, id := range selector.ContactGroupIDs {
+		groups[id] = true
+	}
+	var ids []uint
+	for _, friend := range friends {
+		inGroup := friend.ContactGroupID != nil && groups[*friend.ContactGroupID]
+		tagged := false
+		for _, tag := range selector.Tags {
+			if containsString(friend.Tags, strings.TrimSpace(tag)) {
+				tagged = true
+				break
+			}
+		}
+		if inGroup || tagged {
+			ids = append(ids, friend.ID)
+		}
+	}
+	return ids, nil
+}
+
+// ListContactGroups returns the groups with the number of current friends in each.
+func (s *contactService) ListContactGroups(ctx context.Context, userID uint) ([]*models.ContactGroup, error) {
+	groups, err := s.friendshipRepo.ListContactGroups(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取联系人分组失败: %w", err)
+	}
+	if len(groups) == 0 {
+		return []*models.ContactGroup{}, nil
+	}
+	profiles, err := s.friendshipRepo.GetProfiles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取联系人分组失败: %w", err)
+	}
+	counts := make(map[uint]int)
+	for _, profile := range profiles {
+		if profile.ContactGroupID != nil {
+			counts[*profile.ContactGroupID]++
+		}
+	}
+	for _, group := range groups {
+		group.MemberCount = counts[group.ID]
+	}
+	return groups, nil
+}
+
+// CreateContactGroup validates the name and creates the group.
+func (s *contactService) CreateContactGroup(ctx context.Context, userID uint, name string) (*models.ContactGroup, error) {
+	name, err := s.checkContactGroupName(ctx, userID, 0, name)
+	if err != nil {
+		return nil, err
+	}
+	group := &models.ContactGroup{OwnerID: userID, Name: name}
+	if err := s.friendshipRepo.CreateContactGroup(ctx, group); err != nil {
+		log.Printf("Error creating contact group %q for user %d: %v", name, userID, err)
+		return nil, fmt.Errorf("创建联系人分组失败: %w", err)
+	}
+	return group, nil
+}
+
+// RenameContactGroup validates the new name and renames the group.
+func (s *contactService) RenameContactGroup(ctx context.Context, userID, groupID uint, name string) (*models.ContactGroup, error) {
+	group, err := s.getContactGroup(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	name, err = s.checkContactGroupName(ctx, userID, groupID, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.friendshipRepo.RenameContactGroup(ctx, groupID, name); err != nil {
+		log.Printf("Error renaming contact group %d of user %d: %v", groupID, userID, err)
+		return nil, fmt.Errorf("重命名联系人分组失败: %w", err)
+	}
+	group.Name = name
+	return group, nil
+}
+
+// DeleteContactGroup deletes the group and moves its friends out of it.
+func (s *contactService) DeleteContactGroup(ctx context.Context, userID, groupID uint) error {
+	removed, err := s.friendshipRepo.DeleteContactGroup(ctx, userID, groupID)
+	if err != nil {
+		log.Printf("Error deleting contact group %d of user %d: %v", groupID, userID, err)
+		return fmt.Errorf("删除联系人分组失败: %w", err)
+	}
+	if !removed {
+		return ErrContactGroupNotFound
+	}
+	return nil
+}
+
+// SuggestFriends reads the candidate pool from the cache, computing it on a miss. The pool may be up to
+// suggestionCacheTTL old, so friends, blocked users and pending requests are filtered out again on every
+// call; new candidates only show up once the pool expires.
+func (s *contactService) SuggestFriends(ctx context.Context, userID uint, limit int) ([]*models.FriendSuggestion, error) {
+	if limit <= 0 {
+		limit = defaultSuggestionLimit
+	}
+	if limit > maxSuggestionLimit {
+		limit = maxSuggestionLimit
+	}
+
+	candidates, err := s.suggestionCandidates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return []*models.FriendSuggestion{}, nil
+	}
+	excludedIDs, err := s.suggestionRepo.GetExcludedUserIDs(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取好友推荐失败: %w", err)
+	}
+	excluded := make(map[uint]bool, len(excludedIDs))
+	for _, id := range excludedIDs {
+		excluded[id] = true
+	}
+
+	var picked []models.SuggestionCandidate
+	var ids []uint
+	for _, c := range candidates {
+		if excluded[c.UserID] {
+			continue
+		}
+		picked = append(picked, c)
+		ids = append(ids, c.UserID)
+		if len(picked) == limit {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return []*models.FriendSuggestion{}, nil
+	}
+
+	infos, err := s.userRepo.GetMultipleBasicInfoByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("获取推荐用户信息失败: %w", err)
+	}
+	byID := make(map[uint]*models.UserBasicInfo, len(infos))
+	for _, info := range infos {
+		byID[info.ID] = info
+	}
+	result := make([]*models.FriendSuggestion, 0, len(picked))
+	for _, c := range picked {
+		info, ok := byID[c.UserID]
+		if !ok {
+			continue // deleted since the pool was cached
+		}
+		result = append(result, &models.FriendSuggestion{
+			UserBasicInfo:     *info,
+			MutualFriendCount: c.MutualFriends,
+			SharedGroupCount:  c.SharedGroups,
+			Reason:            suggestionReason(c),
+		})
+	}
+	return result, nil
+}
+
+// suggestionCandidates returns the cached candidate pool, or computes and caches it.
+// Cache failures are logged and treated as a miss.
+func (s *contactService) suggestionCandidates(ctx context.Context, userID uint) ([]models.SuggestionCandidate, error) {
+	if s.cache != nil {
+		candidates, ok, err := s.cache.Get(ctx, userID)
+		if err != nil {
+			log.Printf("Error reading friend suggestions of user %d from cache: %v", userID, err)
+		} else if ok {
+			return candidates, nil
+		}
+	}
+
+	candidates, err := s.suggestionRepo.FindCandidates(ctx, userID, maxSuggestionGroupSize, suggestionPoolSize)
+	if err != nil {
+		log.Printf("Error computing friend suggestions for user %d: %v", userID, err)
+		return nil, fmt.Errorf("获取好友推荐失败: %w", err)
+	}
+	if s.cache != nil {
+		if err := s.cache.Set(ctx, userID, candidates, suggestionCacheTTL); err != nil {
+			log.Printf("Error caching friend suggestions of user %d: %v", userID, err)
+		}
+	}
+	return candidates, nil
+}
+
+// suggestionReason explains why a user is suggested, e.g. "5 个共同好友" or "2 个共同好友，1 个共同群组".
+func suggestionReason(c models.SuggestionCandidate) string {
+	switch {
+	case c.MutualFriends > 0 && c.SharedGroups > 0:
+		return fmt.Sprintf("%d 个共同好友，%d 个共同群组", c.MutualFriends, c.SharedGroups)
+	case c.MutualFriends > 0:
+		return fmt.Sprintf("%d 个共同好友", c.MutualFriends)
+	default:
+		return fmt.Sprintf("%d 个共同群组", c.SharedGroups)
+	}
+}
+
+// loadFriends merges the friends' basic info with the user's profiles of them.
+// Profiles of users who are no longer friends are ignored.
+func (s *contactService) loadFriends(ctx context.Context, userID uint) ([]*models.FriendInfo, error) {
+	friendIDs, err := s.friendshipRepo.GetFriendIDs(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting friend IDs for user %d: %v", userID, err)
+		return nil, fmt.Errorf("获取好友列表失败: %w", err)
+	}
+	if len(friendIDs) == 0 {
+		return []*models.FriendInfo{}, nil
+	}
+	infos, err := s.userRepo.GetMultipleBasicInfoByIDs(ctx, friendIDs)
+	if err != nil {
+		log.Printf("Error getting basic info for friend IDs of user %d: %v", userID, err)
+		return nil, fmt.Errorf("获取好友信息失败: %w", err)
+	}
+	profiles, err := s.friendshipRepo.GetProfiles(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting friend profiles of user %d: %v", userID, err)
+		return nil, fmt.Errorf("获取好友备注失败: %w", err)
+	}
+	byFriend := make(map[uint]*models.FriendProfile, len(profiles))
+	for _, profile := range profiles {
+		byFriend[profile.FriendID] = profile
+	}
+
+	friends := make([]*models.FriendInfo, 0, len(infos))
+	for _, info := range infos {
+		friend := &models.FriendInfo{UserBasicInfo: *info, Tags: []string{}}
+		if profile, ok := byFriend[info.ID]; ok {
+			friend.Remark = profile.Remark
+			if profile.Tags != nil {
+				friend.Tags = profile.Tags
+			}
+			friend.ContactGroupID = profile.ContactGroupID
+		}
+		friends = append(friends, friend)
+	}
+	return friends, nil
+}
+
+// getContactGroup maps a missing group to ErrContactGroupNotFound.
+func (s *contactService) getContactGroup(ctx context.Context, userID, groupID uint) (*models.ContactGroup, error) {
+	group, err := s.friendshipRepo.GetContactGroup(ctx, userID, groupID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrContactGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取联系人分组失败: %w", err)
+	}
+	return group, nil
+}
+
+// checkContactGroupName trims the name, checks its length and that no other group of the user has it.
+func (s *contactService) checkContactGroupName(ctx context.Context, userID, groupID uint, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxContactGroupNameLength {
+		return "", ErrInvalidContactGroupName
+	}
+	groups, err := s.friendshipRepo.ListContactGroups(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("获取联系人分组失败: %w", err)
+	}
+	for _, group := range groups {
+		if group.Name == name && group.ID != groupID {
+			return "", ErrContactGroupExists
+		}
+	}
+	return name, nil
+}
+
+// normalizeTags trims the tags, drops empty ones and duplicates, and enforces the limits.
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || containsString(result, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, ErrInvalidFriendTags
+		}
+		result = append(result, tag)
+	}
+	if len(result) > maxFriendTags {
+		return nil, ErrInvalidFriendTags
+	}
+	return result, nil
+}
+
+// friendDisplayName is the name a friend is shown under: the remark if set, then the nickname, then the username.
+func friendDisplayName(friend *models.FriendInfo) string {
+	if friend.Remark != "" {
+		return friend.Remark
+	}
+	if friend.Nickname != "" {
+		return friend.Nickname
+	}
+	return friend.Username
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
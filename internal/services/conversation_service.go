@@ -14,8 +14,9 @@ import (
 
 // ConversationService 定义了会话相关服务的接口。
 type ConversationService interface {
-	// GetOrCreatePrivateConversation 获取或创建两个用户之间的私聊会话。
+	// GetOrCreatePrivateConversation 获取或创建两个用户之间的私聊会话，userID1 为发起者。
 	// 返回会话对象以及一个布尔值，指示会话是否是新创建的。
+	// 会话不存在且 userID1 不能向 userID2 发送私聊消息 (拉黑或隐私设置) 时返回 ErrUserBlocked 或 ErrPrivacyRestricted。
 	GetOrCreatePrivateConversation(ctx context.Context, userID1, userID2 uint) (*models.Conversation, bool, error)
 	GetUserConversations(ctx context.Context, userID uint, limit, offset int) ([]*models.Conversation, error)
 	GetConversationDetails(ctx context.Context, conversationID uint, userID uint) (*models.Conversation, error) // userID 用于权限检查或个性化信息
@@ -31,13 +32,16 @@ type ConversationService interface {
 
 // conversationService 是 ConversationService 的实现。
 type conversationService struct {
-	convoRepo storage.ConversationRepository
-	userRepo  storage.UserRepository // 可能需要用于获取参与者信息
+	convoRepo   storage.ConversationRepository
+	userRepo    storage.UserRepository    // 可能需要用于获取参与者信息
+	channelRepo storage.ChannelRepository // 频道订阅者不是会话参与者，查看频道会话时需检查订阅关系
+	privacy     PrivacyChecker            // 创建私聊会话前检查拉黑关系和隐私设置
+	notifier    MembershipChangeNotifier  // 补充参与者后使 ChatServer 的成员缓存失效
 }
 
 // NewConversationService 创建一个新的 ConversationService 实例。
-func NewConversationService(convoRepo storage.ConversationRepository, userRepo storage.UserRepository) ConversationService {
-	return &conversationService{convoRepo: convoRepo, userRepo: userRepo}
+func NewConversationService(convoRepo storage.ConversationRepository, userRepo storage.UserRepository, channelRepo storage.ChannelRepository, privacy PrivacyChecker, notifier MembershipChangeNotifier) ConversationService {
+	return &conversationService{convoRepo: convoRepo, userRepo: userRepo, channelRepo: channelRepo, privacy: privacy, notifier: notifier}
 }
 
 // GetOrCreatePrivateConversation 获取或创建两个用户之间的私聊会话。
@@ -45,6 +49,7 @@ func (s *conversationService) GetOrCreatePrivateConversation(ctx context.Context
 	if userID1 == userID2 {
 		return nil, false, fmt.Errorf("不能与自己创建私聊会话")
 	}
+	initiatorID, targetID := userID1, userID2
 
 	// 确保 userID1 < userID2，以使查找具有确定性，避免重复会话
 	if userID1 > userID2 {
@@ -61,6 +66,9 @@ func (s *conversationService) GetOrCreatePrivateConversation(ctx context.Context
 	}
 
 	// 会话不存在，创建新的私聊会话
+	if err := s.privacy.CheckPrivateMessage(ctx, initiatorID, targetID); err != nil {
+		return nil, false, err
+	}
 	newConversation := &models.Conversation{
 		Type: models.PrivateConversation,
 		// TargetID 对于私聊可以不设置，或根据需要定义其含义
@@ -144,6 +152,7 @@ func (s *conversationService) FixGroupConversationParticipants(ctx context.Conte
 			fmt.Printf("添加参与者失败: UserID=%d, 错误: %v\n", member.UserID, err)
 		} else {
 			fmt.Printf("成功添加参与者: UserID=%d\n", member.UserID)
+			s.notifier.NotifyMembershipChanged(ctx, conversation.ID, member.UserID, true)
 			memberCount++
 		}
 	}
@@ -448,18 +457,24 @@ func (s *conversationService) GetUserConversations(ctx context.Context, userID u
 
 // GetConversationDetails 获取会话的详细信息，包括参与者等。
 func (s *conversationService) GetConversationDetails(ctx context.Context, conversationID uint, userID uint) (*models.Conversation, error) {
-	// 1. 检查用户是否有权限查看此会话
-	_, err := s.convoRepo.GetParticipant(ctx, conversationID, userID)
+	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("用户 %d 不是会话 %d 的成员，无权查看", userID, conversationID)
-		}
-		return nil, fmt.Errorf("检查用户 %d 在会话 %d 中的参与情况失败: %w", userID, conversationID, err)
+		return nil, fmt.Errorf("获取会话 %d 详情失败: %w", conversationID, err)
 	}
 
-	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
+	// 1. 检查用户是否有权限查看此会话 (频道会话对订阅者开放)
+	_, err = s.convoRepo.GetParticipant(ctx, conversationID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("获取会话 %d 详情失败: %w", conversationID, err)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("检查用户 %d 在会话 %d 中的参与情况失败: %w", userID, conversationID, err)
+		}
+		subscribed, subErr := s.isChannelSubscriber(ctx, conversation, userID)
+		if subErr != nil {
+			return nil, subErr
+		}
+		if !subscribed {
+			return nil, fmt.Errorf("用户 %d 不是会话 %d 的成员，无权查看", userID, conversationID)
+		}
 	}
 
 	// TODO: 预加载或手动加载会话的参与者信息 (User) 和最后一条消息 (Message)
@@ -469,6 +484,18 @@ func (s *conversationService) GetConversationDetails(ctx context.Context, conver
 	return conversation, nil
 }
 
+// isChannelSubscriber 检查用户是否订阅了频道会话，非频道会话总是返回 false。
+func (s *conversationService) isChannelSubscriber(ctx context.Context, conversation *models.Conversation, userID uint) (bool, error) {
+	if conversation.Type != models.ChannelConversation || s.channelRepo == nil {
+		return false, nil
+	}
+	subscribed, err := s.channelRepo.IsSubscribed(ctx, conversation.TargetID, userID)
+	if err != nil {
+		return false, fmt.Errorf("检查用户 %d 对频道 %d 的订阅状态失败: %w", userID, conversation.TargetID, err)
+	}
+	return subscribed, nil
+}
+
 func (s *conversationService) GetConversationParticipants(ctx context.Context, conversationID uint) ([]*models.ConversationParticipant, error) {
 	return s.convoRepo.GetConversationParticipants(ctx, conversationID)
 }
@@ -6,13 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"im-go/internal/config"
+	"im-go/internal/imtypes"
 	"im-go/internal/kafka"
 	"im-go/internal/models"
 	"im-go/internal/storage"
 	"log"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	confluentKafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"gorm.io/gorm" // Import gorm for error checking
 )
 
@@ -26,25 +29,61 @@ var (
 	ErrNotRecipientOfRequest = errors.New("您不是此好友请求的接收者")
 	ErrRequestNotPending     = errors.New("该好友请求不是待处理状态")
 	ErrFriendshipExists      = errors.New("好友关系已存在")
+	ErrNotRequesterOfRequest = errors.New("您不是此好友请求的发送者")
+	ErrNotFriends            = errors.New("你们还不是好友")
+	ErrFriendRequestExpired  = errors.New("该好友请求已过期")
+	ErrFriendRequestLimit    = errors.New("今天发送的好友请求太多了，请明天再试")
+	ErrFriendRequestMessage  = errors.New("好友请求附言过长")
+	ErrFriendRequestSource   = errors.New("无效的好友请求来源")
+	ErrNotInSourceGroup      = errors.New("你们不在同一个群组中")
 )
 
-// FriendRequestEvent defines the structure for Kafka messages related to friend requests.
+// expirySweepBatchSize caps how many stale requests one sweep round loads at a time.
+const expirySweepBatchSize = 100
+
+// FriendRequestOptions carries the optional details the requester attaches to a friend request.
+type FriendRequestOptions struct {
+	Message       string                     `json:"message"`
+	Source        models.FriendRequestSource `json:"source"`
+	SourceGroupID *uint                      `json:"sourceGroupId"` // required when Source is "group"
+}
+
+// FriendRequestEvent is published to FriendRequestTopic through the outbox whenever a friend request is
+// created, accepted, rejected or cancelled. It is written in the same transaction as the change, so an event
+// is never lost and never describes a change that was rolled back; consumers may see it more than once.
 type FriendRequestEvent struct {
+	RequestID       uint      `json:"requestId"`
+	Event           string    `json:"event"` // one of models.FriendRequestEvent*
+	ActorID         uint      `json:"actorId"`
 	RequesterUserID uint      `json:"requesterUserId"`
 	RecipientUserID uint      `json:"recipientUserId"`
 	Timestamp       time.Time `json:"timestamp"`
-	// 可以添加 RequestMessage 等其他字段
+	// The request details are carried on every event so consumers do not need to load the request.
+	Message       string                     `json:"message,omitempty"`
+	Source        models.FriendRequestSource `json:"source,omitempty"`
+	SourceGroupID *uint                      `json:"sourceGroupId,omitempty"`
 }
 
 // FriendRequestService defines the interface for friend request operations.
 type FriendRequestService interface {
-	SendFriendRequest(ctx context.Context, requesterID, recipientID uint) error
-	ProcessFriendRequest(ctx context.Context, kafkaMsg *confluentKafka.Message) error
+	// SendFriendRequest saves a pending request and returns it, so the client gets the request ID right away.
+	// At most FriendRequestConfig.MaxPerDay requests can be sent in any 24 hours.
+	SendFriendRequest(ctx context.Context, requesterID, recipientID uint, opts FriendRequestOptions) (*models.FriendRequest, error)
+	// DeliverEvent pushes the notification described by a FriendRequestEvent to the affected user.
+	// It is called by the FriendRequestTopic consumer and is idempotent.
+	DeliverEvent(ctx context.Context, event *FriendRequestEvent) error
 	AcceptFriendRequest(ctx context.Context, recipientUserID uint, requestID uint) error
 	RejectFriendRequest(ctx context.Context, recipientUserID uint, requestID uint) error
 	ListPendingRequests(ctx context.Context, userID uint) ([]*models.FriendRequestWithRequester, error)
-	GetFriendsList(ctx context.Context, userID uint) ([]*models.UserBasicInfo, error)
-	// TODO: Add RejectFriendRequest, ListPendingRequests etc.
+	// CancelFriendRequest lets the requester withdraw a pending request they sent.
+	CancelFriendRequest(ctx context.Context, requesterUserID uint, requestID uint) error
+	// ListOutgoingRequests lists the pending requests the user has sent, newest first.
+	ListOutgoingRequests(ctx context.Context, userID uint) ([]*models.FriendRequestWithRecipient, error)
+	// RemoveFriend ends the friendship between userID and friendID.
+	RemoveFriend(ctx context.Context, userID, friendID uint) error
+	// ExpireStaleRequests marks requests pending for longer than FriendRequestConfig.PendingTTL as expired,
+	// notifies their requesters and returns how many were expired.
+	ExpireStaleRequests(ctx context.Context) (int, error)
 }
 
 // FriendRequestWithRequester is a DTO that includes friend request details along with requester info.
@@ -59,8 +98,11 @@ type friendRequestService struct {
 	userRepo       storage.UserRepository
 	friendRepo     storage.FriendRequestRepository
 	friendshipRepo storage.FriendshipRepository // Added
+	groupRepo      storage.GroupRepository
+	privacy        PrivacyChecker
 	producer       kafka.MessageProducer
 	kafkaConfig    config.KafkaConfig
+	requestConfig  config.FriendRequestConfig
 }
 
 // NewFriendRequestService creates a new FriendRequestService instance.
@@ -69,130 +111,149 @@ func NewFriendRequestService(
 	userRepo storage.UserRepository,
 	friendRepo storage.FriendRequestRepository,
 	friendshipRepo storage.FriendshipRepository, // Added
+	groupRepo storage.GroupRepository,
+	privacy PrivacyChecker,
 	producer kafka.MessageProducer,
 	cfg config.KafkaConfig,
+	requestCfg config.FriendRequestConfig,
 ) FriendRequestService {
 	return &friendRequestService{
 		db:             db,
 		userRepo:       userRepo,
 		friendRepo:     friendRepo,
 		friendshipRepo: friendshipRepo,
+		groupRepo:      groupRepo,
+		privacy:        privacy,
 		producer:       producer,
 		kafkaConfig:    cfg,
+		requestConfig:  requestCfg,
 	}
 }
 
-// SendFriendRequest validates the request and publishes an event to Kafka.
-func (s *friendRequestService) SendFriendRequest(ctx context.Context, requesterID, recipientID uint) error {
+// SendFriendRequest validates the request, then saves it together with its "created" event in one transaction.
+func (s *friendRequestService) SendFriendRequest(ctx context.Context, requesterID, recipientID uint, opts FriendRequestOptions) (*models.FriendRequest, error) {
 	if requesterID == recipientID {
-		return ErrFriendRequestSelf
+		return nil, ErrFriendRequestSelf
+	}
+	message := strings.TrimSpace(opts.Message)
+	if s.requestConfig.MaxMessageLength > 0 && utf8.RuneCountInString(message) > s.requestConfig.MaxMessageLength {
+		return nil, ErrFriendRequestMessage
 	}
 
 	// 1. Check if recipient exists
 	_, err := s.userRepo.GetByID(ctx, recipientID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrRecipientNotFound
+			return nil, ErrRecipientNotFound
 		}
 		log.Printf("Error checking recipient user %d: %v", recipientID, err)
-		return fmt.Errorf("检查接收用户时出错: %w", err)
+		return nil, fmt.Errorf("检查接收用户时出错: %w", err)
+	}
+
+	// 1.1 Blocked users (in either direction) cannot send friend requests
+	if err := s.privacy.CheckFriendRequest(ctx, requesterID, recipientID); err != nil {
+		return nil, err
 	}
 
 	// 2. Check if users are already friends
 	areFriends, err := s.friendshipRepo.AreUsersFriends(ctx, requesterID, recipientID)
 	if err != nil {
 		log.Printf("Error checking if users %d and %d are already friends: %v", requesterID, recipientID, err)
-		return fmt.Errorf("检查好友关系时出错: %w", err)
+		return nil, fmt.Errorf("检查好友关系时出错: %w", err)
 	}
 	if areFriends {
-		return ErrAlreadyFriends
+		return nil, ErrAlreadyFriends
 	}
 
-	// 3. Check if a pending request already exists (in either direction)
-	existingRequest, err := s.friendRepo.FindPendingRequest(ctx, requesterID, recipientID)
+	// 2.1 The source is shown to the recipient, so a group source must be a group both users are in
+	sourceGroupID, err := s.validateSource(ctx, requesterID, recipientID, opts)
 	if err != nil {
-		log.Printf("Error checking existing friend request between %d and %d: %v", requesterID, recipientID, err)
-		return fmt.Errorf("检查现有请求时出错: %w", err)
+		return nil, err
 	}
-	if existingRequest != nil {
-		return ErrFriendRequestExists
+
+	// 2.2 Anti-spam: cancelled and handled requests still count towards the daily limit
+	if s.requestConfig.MaxPerDay > 0 {
+		sent, err := s.friendRepo.CountSentSince(ctx, requesterID, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			log.Printf("Error counting friend requests sent by %d: %v", requesterID, err)
+			return nil, fmt.Errorf("检查好友请求发送次数时出错: %w", err)
+		}
+		if sent >= int64(s.requestConfig.MaxPerDay) {
+			return nil, ErrFriendRequestLimit
+		}
 	}
 
-	// 4. Prepare Kafka message event and payload
-	event := FriendRequestEvent{
+	// 3. Save the request and its event atomically. The pending check runs inside the transaction
+	// so that two concurrent requests are less likely to both pass it.
+	request := &models.FriendRequest{
 		RequesterUserID: requesterID,
 		RecipientUserID: recipientID,
-		Timestamp:       time.Now(),
-	}
-	payload, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Error marshalling friend request event for Kafka: %v", err)
-		return fmt.Errorf("序列化好友请求事件失败: %w", err)
+		Status:          models.FriendRequestStatusPending,
+		RequestMessage:  message,
+		Source:          opts.Source,
+		SourceGroupID:   sourceGroupID,
 	}
+	txErr := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txFriendRepo := storage.NewGormFriendRequestRepository(tx)
 
-	// 5. Publish to Kafka
-	topic := s.kafkaConfig.FriendRequestTopic
-	key := []byte(fmt.Sprintf("%d-%d", requesterID, recipientID))
+		existingRequest, err := txFriendRepo.FindPendingRequest(ctx, requesterID, recipientID)
+		if err != nil {
+			log.Printf("Error checking existing friend request between %d and %d: %v", requesterID, recipientID, err)
+			return fmt.Errorf("检查现有请求时出错: %w", err)
+		}
+		if existingRequest != nil {
+			return ErrFriendRequestExists
+		}
 
-	err = s.producer.SendMessage(ctx, topic, key, payload)
-	if err != nil {
-		log.Printf("Error producing friend request event to Kafka topic %s: %v", topic, err)
-		return fmt.Errorf("发送好友请求到处理队列失败: %w", err)
+		if err := txFriendRepo.Create(ctx, request); err != nil {
+			log.Printf("Error saving friend request (%d -> %d) to database: %v", requesterID, recipientID, err)
+			return fmt.Errorf("保存好友请求失败: %w", err)
+		}
+		return s.enqueueEvent(ctx, tx, request, models.FriendRequestEventCreated, requesterID)
+	})
+	if txErr != nil {
+		return nil, txErr
 	}
 
-	log.Printf("Friend request event published to topic %s for %d -> %d", topic, requesterID, recipientID)
-	return nil
+	log.Printf("Friend request from %d to %d saved with ID %d", requesterID, recipientID, request.ID)
+	return request, nil
 }
 
-// ProcessFriendRequest handles incoming friend request events from Kafka.
-func (s *friendRequestService) ProcessFriendRequest(ctx context.Context, kafkaMsg *confluentKafka.Message) error {
-	log.Printf("Processing friend request event from Kafka, offset %d", kafkaMsg.TopicPartition.Offset)
-	var event FriendRequestEvent
-	if err := json.Unmarshal(kafkaMsg.Value, &event); err != nil {
-		log.Printf("Error unmarshalling friend request event from Kafka: %v, value: %s", err, string(kafkaMsg.Value))
-		return nil // Commit offset for bad message
-	}
-
-	// Check if users are already friends before creating request (idempotency for retries)
-	areFriends, err := s.friendshipRepo.AreUsersFriends(ctx, event.RequesterUserID, event.RecipientUserID)
-	if err != nil {
-		log.Printf("Error checking friendship status for %d and %d in ProcessFriendRequest: %v", event.RequesterUserID, event.RecipientUserID, err)
-		return err // Retryable
-	}
-	if areFriends {
-		log.Printf("Users %d and %d are already friends, skipping friend request creation.", event.RequesterUserID, event.RecipientUserID)
-		return nil // Commit offset
-	}
-
-	// Double-check if request already exists
-	existing, err := s.friendRepo.FindPendingRequest(ctx, event.RequesterUserID, event.RecipientUserID)
+// DeliverEvent notifies the recipient of created and cancelled requests and the requester of accepted and
+// rejected ones. A "created" event for a request that is no longer pending is skipped, since the later
+// event for the same request supersedes it.
+func (s *friendRequestService) DeliverEvent(ctx context.Context, event *FriendRequestEvent) error {
+	request, err := s.friendRepo.GetRequestByID(ctx, event.RequestID)
 	if err != nil {
-		log.Printf("Error re-checking friend request before creation (%d -> %d): %v", event.RequesterUserID, event.RecipientUserID, err)
-		return err // Retryable
-	}
-	if existing != nil {
-		log.Printf("Friend request already processed or exists (%d -> %d), skipping creation.", event.RequesterUserID, event.RecipientUserID)
-		return nil // Commit offset
-	}
-
-	request := models.FriendRequest{
-		RequesterUserID: event.RequesterUserID,
-		RecipientUserID: event.RecipientUserID,
-		Status:          models.FriendRequestStatusPending,
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Friend request %d no longer exists, skipping %s notification.", event.RequestID, event.Event)
+			return nil
+		}
+		return fmt.Errorf("检索好友请求失败: %w", err)
 	}
 
-	if err := s.friendRepo.Create(ctx, &request); err != nil {
-		log.Printf("Error saving friend request (%d -> %d) to database: %v", event.RequesterUserID, event.RecipientUserID, err)
-		return err // Retryable
+	var receiverID uint
+	switch event.Event {
+	case models.FriendRequestEventCreated:
+		if request.Status != models.FriendRequestStatusPending {
+			log.Printf("Friend request %d is %s, skipping created notification.", request.ID, request.Status)
+			return nil
+		}
+		receiverID = request.RecipientUserID
+	case models.FriendRequestEventCancelled:
+		receiverID = request.RecipientUserID
+	case models.FriendRequestEventAccepted, models.FriendRequestEventRejected, models.FriendRequestEventExpired:
+		receiverID = request.RequesterUserID
+	default:
+		log.Printf("Unknown friend request event %q for request %d, skipping.", event.Event, request.ID)
+		return nil
 	}
-
-	log.Printf("Friend request from %d to %d saved successfully with ID %d", event.RequesterUserID, event.RecipientUserID, request.ID)
-	// TODO: Trigger real-time notification to recipientUserID about the new request
-	return nil
+	return s.notify(ctx, receiverID, event.Event, request, event.ActorID)
 }
 
 // AcceptFriendRequest processes the acceptance of a friend request.
 func (s *friendRequestService) AcceptFriendRequest(ctx context.Context, recipientUserID uint, requestID uint) error {
+	var accepted *models.FriendRequest
 	// Use a transaction to ensure atomicity
 	txErr := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Get the specific friend request repository instance for this transaction
@@ -213,11 +274,23 @@ func (s *friendRequestService) AcceptFriendRequest(ctx context.Context, recipien
 		if request.RecipientUserID != recipientUserID {
 			return ErrNotRecipientOfRequest
 		}
-		if request.Status != models.FriendRequestStatusPending {
+		if err := s.checkPending(request); err != nil {
+			return err
+		}
+
+		// 3. Update friend request status to accepted. The conditional update makes a concurrent
+		// accept, reject, cancel or expiry of the same request lose cleanly instead of overwriting it.
+		updated, err := txFriendRepo.UpdateStatusIfPending(ctx, requestID, models.FriendRequestStatusAccepted)
+		if err != nil {
+			log.Printf("Error updating friend request %d status to accepted: %v", requestID, err)
+			return fmt.Errorf("更新好友请求状态失败: %w", err)
+		}
+		if !updated {
 			return ErrRequestNotPending
 		}
+		request.Status = models.FriendRequestStatusAccepted
 
-		// 3. Check if they are already friends (should not happen if logic is correct, but good check)
+		// 4. Check if they are already friends (should not happen if logic is correct, but good check)
 		areFriends, err := txFriendshipRepo.AreUsersFriends(ctx, request.RequesterUserID, request.RecipientUserID)
 		if err != nil {
 			log.Printf("Error checking friendship in AcceptFriendRequest for users %d, %d: %v", request.RequesterUserID, request.RecipientUserID, err)
@@ -230,12 +303,6 @@ func (s *friendRequestService) AcceptFriendRequest(ctx context.Context, recipien
 			// return ErrFriendshipExists // Or just continue to update status
 		}
 
-		// 4. Update friend request status to accepted
-		if err := txFriendRepo.UpdateRequestStatus(ctx, requestID, models.FriendRequestStatusAccepted); err != nil {
-			log.Printf("Error updating friend request %d status to accepted: %v", requestID, err)
-			return fmt.Errorf("更新好友请求状态失败: %w", err)
-		}
-
 		// 5. Create friendship record (only if not already friends)
 		if !areFriends {
 			friendship := &models.Friendship{
@@ -253,16 +320,16 @@ func (s *friendRequestService) AcceptFriendRequest(ctx context.Context, recipien
 		}
 
 		// TODO: Create a new private conversation for these users if one doesn't exist.
-		// TODO: Send real-time notification to the requesterUserID that their request was accepted.
 
-		return nil // Commit transaction
+		accepted = request
+		return s.enqueueEvent(ctx, tx, request, models.FriendRequestEventAccepted, recipientUserID)
 	})
 
 	if txErr != nil {
 		return txErr // Return the error from the transaction
 	}
 
-	log.Printf("Friend request %d accepted successfully by user %d for requester %d.", requestID, recipientUserID, 0) // RequesterID not directly available here without re-fetch
+	log.Printf("Friend request %d accepted successfully by user %d for requester %d.", requestID, recipientUserID, accepted.RequesterUserID)
 	return nil
 }
 
@@ -281,6 +348,7 @@ func (s *friendRequestService) ListPendingRequests(ctx context.Context, userID u
 	// Enrich with requester info
 	var resultDTOs []*models.FriendRequestWithRequester
 	for _, req := range pendingRequests {
+		s.fillSourceGroupName(ctx, &req)
 		requester, err := s.userRepo.GetBasicInfoByID(ctx, req.RequesterUserID)
 		if err != nil {
 			log.Printf("Error fetching requester info for user %d (request %d): %v", req.RequesterUserID, req.ID, err)
@@ -310,41 +378,281 @@ func (s *friendRequestService) RejectFriendRequest(ctx context.Context, recipien
 	if request.RecipientUserID != recipientUserID {
 		return ErrNotRecipientOfRequest
 	}
-	if request.Status != models.FriendRequestStatusPending {
-		// Allow rejecting already accepted/rejected requests? For now, only pending.
-		return ErrRequestNotPending
+	if err := s.checkPending(request); err != nil {
+		return err
 	}
 
-	// 3. Update friend request status to rejected
-	if err := s.friendRepo.UpdateRequestStatus(ctx, requestID, models.FriendRequestStatusRejected); err != nil {
+	// 3. Update friend request status to rejected, together with the event
+	if err := s.updateStatusWithEvent(ctx, request, models.FriendRequestStatusRejected, models.FriendRequestEventRejected, recipientUserID); err != nil {
+		if errors.Is(err, ErrRequestNotPending) {
+			return err
+		}
 		log.Printf("Error updating friend request %d status to rejected: %v", requestID, err)
 		return fmt.Errorf("更新好友请求状态为已拒绝失败: %w", err)
 	}
 
 	log.Printf("Friend request %d rejected by user %d.", requestID, recipientUserID)
-	// TODO: Send real-time notification to the requesterUserID that their request was rejected.
 	return nil
 }
 
-// GetFriendsList retrieves the basic info for all friends of the given user.
-func (s *friendRequestService) GetFriendsList(ctx context.Context, userID uint) ([]*models.UserBasicInfo, error) {
-	// 1. Get the IDs of all friends
-	friendIDs, err := s.friendshipRepo.GetFriendIDs(ctx, userID)
+// CancelFriendRequest marks a pending request as cancelled and notifies the recipient.
+func (s *friendRequestService) CancelFriendRequest(ctx context.Context, requesterUserID uint, requestID uint) error {
+	request, err := s.friendRepo.GetRequestByID(ctx, requestID)
 	if err != nil {
-		log.Printf("Error getting friend IDs for user %d: %v", userID, err)
-		return nil, fmt.Errorf("获取好友列表失败: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFriendRequestNotFound
+		}
+		log.Printf("Error retrieving friend request %d for cancellation: %v", requestID, err)
+		return fmt.Errorf("检索好友请求失败: %w", err)
+	}
+	if request.RequesterUserID != requesterUserID {
+		return ErrNotRequesterOfRequest
+	}
+	if request.Status != models.FriendRequestStatusPending {
+		return ErrRequestNotPending
 	}
 
-	if len(friendIDs) == 0 {
-		return []*models.UserBasicInfo{}, nil // Return empty list if no friends
+	if err := s.updateStatusWithEvent(ctx, request, models.FriendRequestStatusCancelled, models.FriendRequestEventCancelled, requesterUserID); err != nil {
+		if errors.Is(err, ErrRequestNotPending) {
+			return err
+		}
+		log.Printf("Error updating friend request %d status to cancelled: %v", requestID, err)
+		return fmt.Errorf("更新好友请求状态为已撤回失败: %w", err)
 	}
 
-	// 2. Get the basic info for those friend IDs
-	friendsInfo, err := s.userRepo.GetMultipleBasicInfoByIDs(ctx, friendIDs)
+	log.Printf("Friend request %d cancelled by requester %d.", requestID, requesterUserID)
+	return nil
+}
+
+// ListOutgoingRequests retrieves the pending requests sent by the user, enriched with recipient info.
+func (s *friendRequestService) ListOutgoingRequests(ctx context.Context, userID uint) ([]*models.FriendRequestWithRecipient, error) {
+	requests, err := s.friendRepo.GetOutgoingPendingRequests(ctx, userID)
 	if err != nil {
-		log.Printf("Error getting basic info for friend IDs of user %d: %v", userID, err)
-		return nil, fmt.Errorf("获取好友信息失败: %w", err)
+		log.Printf("Error fetching outgoing friend requests for user %d: %v", userID, err)
+		return nil, fmt.Errorf("获取已发送的好友请求失败: %w", err)
 	}
 
-	return friendsInfo, nil
+	result := make([]*models.FriendRequestWithRecipient, 0, len(requests))
+	for _, req := range requests {
+		recipient, err := s.userRepo.GetBasicInfoByID(ctx, req.RecipientUserID)
+		if err != nil {
+			log.Printf("Error fetching recipient info for user %d (request %d): %v", req.RecipientUserID, req.ID, err)
+			continue
+		}
+		result = append(result, &models.FriendRequestWithRecipient{
+			FriendRequest: req,
+			Recipient:     recipient,
+		})
+	}
+	return result, nil
+}
+
+// RemoveFriend deletes the friendship. The private conversation and its history are kept.
+func (s *friendRequestService) RemoveFriend(ctx context.Context, userID, friendID uint) error {
+	removed, err := s.friendshipRepo.Delete(ctx, userID, friendID)
+	if err != nil {
+		log.Printf("Error removing friendship between %d and %d: %v", userID, friendID, err)
+		return fmt.Errorf("删除好友失败: %w", err)
+	}
+	if !removed {
+		return ErrNotFriends
+	}
+	log.Printf("User %d removed friend %d.", userID, friendID)
+	return nil
+}
+
+// ExpireStaleRequests expires stale requests in batches. Each request is expired with a conditional update,
+// so a request accepted or cancelled concurrently (or expired by another instance) is left alone.
+func (s *friendRequestService) ExpireStaleRequests(ctx context.Context) (int, error) {
+	if s.requestConfig.PendingTTL <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.requestConfig.PendingTTL)
+	expired := 0
+	for ctx.Err() == nil {
+		stale, err := s.friendRepo.GetPendingCreatedBefore(ctx, cutoff, expirySweepBatchSize)
+		if err != nil {
+			return expired, fmt.Errorf("获取过期的好友请求失败: %w", err)
+		}
+		for i := range stale {
+			request := &stale[i]
+			txErr := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				updated, err := storage.NewGormFriendRequestRepository(tx).UpdateStatusIfPending(ctx, request.ID, models.FriendRequestStatusExpired)
+				if err != nil || !updated {
+					return err
+				}
+				request.Status = models.FriendRequestStatusExpired
+				expired++
+				// The recipient never acted, so they are named as the actor in the requester's notification
+				return s.enqueueEvent(ctx, tx, request, models.FriendRequestEventExpired, request.RecipientUserID)
+			})
+			if txErr != nil {
+				return expired, fmt.Errorf("将好友请求 %d 标记为已过期失败: %w", request.ID, txErr)
+			}
+		}
+		if len(stale) < expirySweepBatchSize {
+			break
+		}
+	}
+	return expired, nil
+}
+
+// validateSource checks the source the requester gave and returns the group ID to store with the request.
+func (s *friendRequestService) validateSource(ctx context.Context, requesterID, recipientID uint, opts FriendRequestOptions) (*uint, error) {
+	switch opts.Source {
+	case "", models.FriendRequestSourceSearch, models.FriendRequestSourceSuggestion, models.FriendRequestSourceProfile:
+		return nil, nil
+	case models.FriendRequestSourceGroup:
+	default:
+		return nil, ErrFriendRequestSource
+	}
+	if opts.SourceGroupID == nil || *opts.SourceGroupID == 0 {
+		return nil, ErrFriendRequestSource
+	}
+	groupID := *opts.SourceGroupID
+	for _, userID := range []uint{requesterID, recipientID} {
+		if _, err := s.groupRepo.GetMember(ctx, groupID, userID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrNotInSourceGroup
+			}
+			log.Printf("Error checking membership of user %d in group %d: %v", userID, groupID, err)
+			return nil, fmt.Errorf("检查群组成员时出错: %w", err)
+		}
+	}
+	return &groupID, nil
+}
+
+// checkPending returns an error unless the request can still be accepted or rejected. A request past its TTL
+// counts as expired even if the sweep has not marked it yet.
+func (s *friendRequestService) checkPending(request *models.FriendRequest) error {
+	if request.Status == models.FriendRequestStatusExpired {
+		return ErrFriendRequestExpired
+	}
+	if request.Status != models.FriendRequestStatusPending {
+		return ErrRequestNotPending
+	}
+	if s.requestConfig.PendingTTL > 0 && time.Since(request.CreatedAt) > s.requestConfig.PendingTTL {
+		return ErrFriendRequestExpired
+	}
+	return nil
+}
+
+// fillSourceGroupName sets SourceGroupName for group-sourced requests. A deleted group just leaves it empty.
+func (s *friendRequestService) fillSourceGroupName(ctx context.Context, request *models.FriendRequest) {
+	if request.Source != models.FriendRequestSourceGroup || request.SourceGroupID == nil {
+		return
+	}
+	group, err := s.groupRepo.GetGroupByID(ctx, *request.SourceGroupID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error fetching source group %d of friend request %d: %v", *request.SourceGroupID, request.ID, err)
+		}
+		return
+	}
+	request.SourceGroupName = group.Name
+}
+
+// updateStatusWithEvent changes the status of a still-pending request and writes the matching event in one
+// transaction. It returns ErrRequestNotPending if the request left the pending state after the caller checked it.
+func (s *friendRequestService) updateStatusWithEvent(ctx context.Context, request *models.FriendRequest, status models.FriendRequestStatus, event string, actorID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updated, err := storage.NewGormFriendRequestRepository(tx).UpdateStatusIfPending(ctx, request.ID, status)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrRequestNotPending
+		}
+		request.Status = status
+		return s.enqueueEvent(ctx, tx, request, event, actorID)
+	})
+}
+
+// enqueueEvent writes a FriendRequestEvent to the outbox within tx. The request ID is used as the Kafka key
+// so that all events of a request land on the same partition in order.
+func (s *friendRequestService) enqueueEvent(ctx context.Context, tx *gorm.DB, request *models.FriendRequest, event string, actorID uint) error {
+	payload := FriendRequestEvent{
+		RequestID:       request.ID,
+		Event:           event,
+		ActorID:         actorID,
+		RequesterUserID: request.RequesterUserID,
+		RecipientUserID: request.RecipientUserID,
+		Timestamp:       time.Now(),
+		Message:         request.RequestMessage,
+		Source:          request.Source,
+		SourceGroupID:   request.SourceGroupID,
+	}
+	key := strconv.FormatUint(uint64(request.ID), 10)
+	if err := enqueueOutbox(ctx, storage.NewGormOutboxRepository(tx), s.kafkaConfig.FriendRequestTopic, key, payload); err != nil {
+		log.Printf("Error writing %s event for friend request %d to the outbox: %v", event, request.ID, err)
+		return fmt.Errorf("保存好友请求事件失败: %w", err)
+	}
+	return nil
+}
+
+// notify pushes a friend_request frame to receiverID through WebSocketOutgoingTopic.
+// The frame ID is derived from the request and event, so clients can drop duplicates from redelivered events.
+func (s *friendRequestService) notify(ctx context.Context, receiverID uint, event string, request *models.FriendRequest, actorID uint) error {
+	actor, err := s.userRepo.GetBasicInfoByID(ctx, actorID)
+	if err != nil {
+		return fmt.Errorf("获取用户 %d 的信息失败: %w", actorID, err)
+	}
+	name := actor.Nickname
+	if name == "" {
+		name = actor.Username
+	}
+	notification := models.FriendRequestNotification{
+		Event:           event,
+		RequestID:       request.ID,
+		RequesterUserID: request.RequesterUserID,
+		RecipientUserID: request.RecipientUserID,
+		Actor:           actor,
+	}
+	var content string
+	switch event {
+	case models.FriendRequestEventCreated:
+		s.fillSourceGroupName(ctx, request)
+		notification.Message = request.RequestMessage
+		notification.Source = request.Source
+		notification.SourceGroupID = request.SourceGroupID
+		notification.SourceGroupName = request.SourceGroupName
+		if request.SourceGroupName != "" {
+			content = fmt.Sprintf("%s 通过群组「%s」请求添加你为好友", name, request.SourceGroupName)
+		} else {
+			content = fmt.Sprintf("%s 请求添加你为好友", name)
+		}
+		if request.RequestMessage != "" {
+			content += ": " + request.RequestMessage
+		}
+	case models.FriendRequestEventAccepted:
+		content = fmt.Sprintf("%s 接受了你的好友请求", name)
+	case models.FriendRequestEventRejected:
+		content = fmt.Sprintf("%s 拒绝了你的好友请求", name)
+	case models.FriendRequestEventCancelled:
+		content = fmt.Sprintf("%s 撤回了好友请求", name)
+	case models.FriendRequestEventExpired:
+		content = fmt.Sprintf("你发给 %s 的好友请求已过期", name)
+	}
+
+	metadata, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("序列化好友请求通知失败: %w", err)
+	}
+	receiver := strconv.FormatUint(uint64(receiverID), 10)
+	payload, err := json.Marshal(&imtypes.Message{
+		ID:         fmt.Sprintf("friend-request-%d-%s", request.ID, event),
+		Type:       imtypes.FriendRequestMessageType,
+		Content:    content,
+		SenderID:   strconv.FormatUint(uint64(actorID), 10),
+		ReceiverID: receiver,
+		Timestamp:  time.Now(),
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化好友请求推送失败: %w", err)
+	}
+	if err := s.producer.SendMessage(ctx, s.kafkaConfig.WebSocketOutgoingTopic, []byte(receiver), payload); err != nil {
+		return fmt.Errorf("发布好友请求通知失败: %w", err)
+	}
+	return nil
 }
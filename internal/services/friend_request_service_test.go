@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newFriendRequestTestService(t *testing.T) (*friendRequestService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.FriendRequest{}, &models.Friendship{}, &models.OutboxEvent{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	svc := NewFriendRequestService(db, nil, storage.NewGormFriendRequestRepository(db), storage.NewGormFriendshipRepository(db), nil, nil, nil, config.KafkaConfig{FriendRequestTopic: "friend-requests"}, config.FriendRequestConfig{})
+	return svc.(*friendRequestService), db
+}
+
+// TestFriendRequestStatusChangeLosesToConcurrentChange 模拟调用方检查请求仍待处理之后、写入之前，
+// 请求已被并发地撤回：状态不能被覆盖，也不能写入事件或建立好友关系。
+func TestFriendRequestStatusChangeLosesToConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	svc, db := newFriendRequestTestService(t)
+
+	request := &models.FriendRequest{RequesterUserID: 1, RecipientUserID: 2, Status: models.FriendRequestStatusPending}
+	if err := db.Create(request).Error; err != nil {
+		t.Fatal(err)
+	}
+	stale := *request
+	if err := db.Model(request).Update("status", models.FriendRequestStatusCancelled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := svc.updateStatusWithEvent(ctx, &stale, models.FriendRequestStatusRejected, models.FriendRequestEventRejected, 2)
+	if !errors.Is(err, ErrRequestNotPending) {
+		t.Fatalf("updateStatusWithEvent err = %v, want ErrRequestNotPending", err)
+	}
+	if err := svc.AcceptFriendRequest(ctx, 2, request.ID); !errors.Is(err, ErrRequestNotPending) {
+		t.Fatalf("AcceptFriendRequest err = %v, want ErrRequestNotPending", err)
+	}
+
+	var current models.FriendRequest
+	if err := db.First(&current, request.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Status != models.FriendRequestStatusCancelled {
+		t.Errorf("status = %s, want cancelled", current.Status)
+	}
+	var events, friendships int64
+	db.Model(&models.OutboxEvent{}).Count(&events)
+	db.Model(&models.Friendship{}).Count(&friendships)
+	if events != 0 || friendships != 0 {
+		t.Errorf("events = %d, friendships = %d, want none", events, friendships)
+	}
+}
+
+func TestAcceptFriendRequestOnce(t *testing.T) {
+	ctx := context.Background()
+	svc, db := newFriendRequestTestService(t)
+
+	request := &models.FriendRequest{RequesterUserID: 1, RecipientUserID: 2, Status: models.FriendRequestStatusPending}
+	if err := db.Create(request).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.AcceptFriendRequest(ctx, 2, request.ID); err != nil {
+		t.Fatalf("AcceptFriendRequest: %v", err)
+	}
+	if err := svc.AcceptFriendRequest(ctx, 2, request.ID); !errors.Is(err, ErrRequestNotPending) {
+		t.Fatalf("second AcceptFriendRequest err = %v, want ErrRequestNotPending", err)
+	}
+	if err := svc.CancelFriendRequest(ctx, 1, request.ID); !errors.Is(err, ErrRequestNotPending) {
+		t.Fatalf("CancelFriendRequest err = %v, want ErrRequestNotPending", err)
+	}
+
+	var events, friendships int64
+	db.Model(&models.OutboxEvent{}).Count(&events)
+	db.Model(&models.Friendship{}).Count(&friendships)
+	if events != 1 || friendships != 1 {
+		t.Errorf("events = %d, friendships = %d, want 1 each", events, friendships)
+	}
+}
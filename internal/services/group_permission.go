@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotGroupMember        = errors.New("用户不是该群组成员")
+	ErrGroupPermissionDenied = errors.New("没有执行该操作的群组权限")
+)
+
+// GroupPermissionChecker 集中处理群组内的权限判断，供群组服务和消息服务共用。
+type GroupPermissionChecker interface {
+	// Check 校验用户在群组中是否拥有指定权限，通过时返回其成员记录。
+	Check(ctx context.Context, groupID, userID uint, perm models.GroupPermission) (*models.GroupMember, error)
+	// Matrix 返回群组当前生效的权限矩阵，未单独配置的权限使用默认值。
+	Matrix(ctx context.Context, groupID uint) (map[models.GroupPermission]models.GroupMemberRole, error)
+	// Member 获取用户在群组中的成员记录，不是成员时返回 ErrNotGroupMember。
+	Member(ctx context.Context, groupID, userID uint) (*models.GroupMember, error)
+}
+
+// groupPermissionChecker 是基于 GroupRepository 的 GroupPermissionChecker 实现。
+type groupPermissionChecker struct {
+	groupRepo storage.GroupRepository
+}
+
+// NewGroupPermissionChecker 创建一个新的 GroupPermissionChecker 实例。
+func NewGroupPermissionChecker(groupRepo storage.GroupRepository) GroupPermissionChecker {
+	return &groupPermissionChecker{groupRepo: groupRepo}
+}
+
+// Member 获取用户在群组中的成员记录。
+func (c *groupPermissionChecker) Member(ctx context.Context, groupID, userID uint) (*models.GroupMember, error) {
+	member, err := c.groupRepo.GetMember(ctx, groupID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotGroupMember
+		}
+		return nil, fmt.Errorf("查询群组 %d 成员 %d 失败: %w", groupID, userID, err)
+	}
+	return member, nil
+}
+
+// Matrix 返回群组当前生效的权限矩阵。
+func (c *groupPermissionChecker) Matrix(ctx context.Context, groupID uint) (map[models.GroupPermission]models.GroupMemberRole, error) {
+	matrix := make(map[models.GroupPermission]models.GroupMemberRole, len(models.DefaultGroupPermissions))
+	for perm, role := range models.DefaultGroupPermissions {
+		matrix[perm] = role
+	}
+
+	settings, err := c.groupRepo.GetPermissionSettings(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("获取群组 %d 权限配置失败: %w", groupID, err)
+	}
+	for _, setting := range settings {
+		if setting.Permission.IsValid() && setting.MinRole.IsValid() {
+			matrix[setting.Permission] = setting.MinRole
+		}
+	}
+	return matrix, nil
+}
+
+// Check 校验用户在群组中是否拥有指定权限。
+func (c *groupPermissionChecker) Check(ctx context.Context, groupID, userID uint, perm models.GroupPermission) (*models.GroupMember, error) {
+	member, err := c.Member(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix, err := c.Matrix(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	minRole, ok := matrix[perm]
+	if !ok {
+		return nil, fmt.Errorf("未知的群组权限: %s", perm)
+	}
+	if !member.Role.AtLeast(minRole) {
+		return nil, fmt.Errorf("%w: %s 需要 %s 及以上角色", ErrGroupPermissionDenied, perm, minRole)
+	}
+	return member, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"im-go/internal/models"
@@ -22,15 +23,41 @@ type GroupService interface {
 	// DeleteGroup(ctx context.Context, userID, groupID uint) error // 需要权限检查
 	SearchPublicGroups(ctx context.Context, query string, limit, offset int) ([]*models.Group, error)
 
+	// JoinGroup 主动加入群组。机器人只能通过 InviteUserToGroup 加入，主动加入时返回 ErrBotMustBeInvited。
 	JoinGroup(ctx context.Context, userID, groupID uint) (*models.GroupMember, error)
 	LeaveGroup(ctx context.Context, userID, groupID uint) error
-	// InviteUserToGroup(ctx context.Context, inviterID, groupID, inviteeID uint) error
+	InviteUserToGroup(ctx context.Context, inviterID, groupID, inviteeID uint) (*models.GroupMember, error)
 	// ApproveJoinRequest(ctx context.Context, adminID, groupID, userID uint) error
 	// KickMember(ctx context.Context, adminID, groupID, memberID uint) error
-	GetGroupMembers(ctx context.Context, groupID uint, limit, offset int) ([]*models.GroupMember, error)
+	// GetGroupMembers 获取群组成员列表，按拉黑关系隐藏成员对 viewerID 的在线状态。
+	GetGroupMembers(ctx context.Context, viewerID, groupID uint, limit, offset int) ([]*models.GroupMember, error)
 	UpdateMemberRole(ctx context.Context, adminID, groupID, memberID uint, newRole models.GroupMemberRole) (*models.GroupMember, error)
+	TransferOwnership(ctx context.Context, ownerID, groupID, newOwnerID uint) error
 	GetUserGroups(ctx context.Context, userID uint, limit, offset int) ([]*models.Group, error)
 	GetGroupDetailsByID(ctx context.Context, groupID uint) (*models.Group, error)
+
+	// CheckPermission 校验用户在群组中是否拥有指定权限，所有群组内的权限判断都应经过这里。
+	CheckPermission(ctx context.Context, groupID, userID uint, perm models.GroupPermission) (*models.GroupMember, error)
+	GetPermissions(ctx context.Context, userID, groupID uint) (map[models.GroupPermission]models.GroupMemberRole, error)
+	UpdatePermissions(ctx context.Context, userID, groupID uint, changes map[models.GroupPermission]models.GroupMemberRole) (map[models.GroupPermission]models.GroupMemberRole, error)
+	// SetSlowMode 设置群组慢速模式的发言间隔 (秒)，0 表示关闭，需要 edit_info 权限。
+	SetSlowMode(ctx context.Context, userID, groupID uint, seconds int) (*models.Group, error)
+
+	// 群公告
+	SetAnnouncement(ctx context.Context, userID, groupID uint, content string) (*models.GroupAnnouncement, error)
+	GetAnnouncement(ctx context.Context, userID, groupID uint) (*GroupAnnouncementView, error)
+	AcknowledgeAnnouncement(ctx context.Context, userID, groupID, announcementID uint) error
+	ListAnnouncementAcks(ctx context.Context, userID, groupID uint) ([]*models.GroupAnnouncementAck, error)
+}
+
+// ErrAnnouncementNotFound 表示群组当前没有公告，或确认的不是当前公告。
+var ErrAnnouncementNotFound = errors.New("群公告未找到")
+
+// GroupAnnouncementView 是成员查看群公告时的结果，包含当前用户的确认状态。
+type GroupAnnouncementView struct {
+	Announcement *models.GroupAnnouncement `json:"announcement"`
+	Acknowledged bool                      `json:"acknowledged"`
+	AckCount     int64                     `json:"ackCount"`
 }
 
 // groupService 是 GroupService 的实现。
@@ -38,11 +65,15 @@ type groupService struct {
 	groupRepo storage.GroupRepository
 	userRepo  storage.UserRepository
 	convoRepo storage.ConversationRepository // 用于在创建群组时，可能需要创建关联的群聊会话
+	annRepo   storage.AnnouncementRepository
+	perms     GroupPermissionChecker
+	notifier  ConversationNotifier // 用于在群聊中发布系统消息 (例如新公告)，以及广播成员变更
+	privacy   PrivacyChecker       // 邀请用户入群前检查拉黑关系和被邀请者的隐私设置
 }
 
 // NewGroupService 创建一个新的 GroupService 实例。
-func NewGroupService(groupRepo storage.GroupRepository, userRepo storage.UserRepository, convoRepo storage.ConversationRepository) GroupService {
-	return &groupService{groupRepo: groupRepo, userRepo: userRepo, convoRepo: convoRepo}
+func NewGroupService(groupRepo storage.GroupRepository, userRepo storage.UserRepository, convoRepo storage.ConversationRepository, annRepo storage.AnnouncementRepository, perms GroupPermissionChecker, notifier ConversationNotifier, privacy PrivacyChecker) GroupService {
+	return &groupService{groupRepo: groupRepo, userRepo: userRepo, convoRepo: convoRepo, annRepo: annRepo, perms: perms, notifier: notifier, privacy: privacy}
 }
 
 // CreateGroup 创建一个新的群组。
@@ -72,11 +103,11 @@ func (s *groupService) CreateGroup(ctx context.Context, ownerID uint, name, desc
 		return nil, fmt.Errorf("创建群组失败: %w", err)
 	}
 
-	// 3. 将创建者添加为群管理员
+	// 3. 将创建者添加为群主
 	ownerMember := &models.GroupMember{
 		GroupID:  newGroup.ID,
 		UserID:   ownerID,
-		Role:     models.AdminRole,
+		Role:     models.OwnerRole,
 		JoinedAt: time.Now(),
 	}
 	if err := s.groupRepo.AddMember(ctx, ownerMember); err != nil {
@@ -115,21 +146,15 @@ func (s *groupService) GetGroupDetails(ctx context.Context, groupID uint, userID
 	return group, nil
 }
 
-// UpdateGroupInfo 更新群组信息 (需要权限检查，例如只有群主或管理员可以更新)。
+// UpdateGroupInfo 更新群组信息 (需要 edit_info 权限)。
 func (s *groupService) UpdateGroupInfo(ctx context.Context, userID, groupID uint, name, description, avatarURL string, isPublic bool, joinCondition string) (*models.Group, error) {
 	group, err := s.groupRepo.GetGroupByID(ctx, groupID)
 	if err != nil {
 		return nil, fmt.Errorf("更新群组信息失败，群组 %d 未找到: %w", groupID, err)
 	}
 
-	// 权限检查：例如，只有群主可以修改
-	if group.OwnerID != userID {
-		// 或者检查是否为管理员
-		// member, _ := s.groupRepo.GetMember(ctx, groupID, userID)
-		// if member == nil || member.Role != models.AdminRole {
-		// 	 return nil, fmt.Errorf("用户 %d 无权修改群组 %d 的信息", userID, groupID)
-		// }
-		return nil, fmt.Errorf("用户 %d 不是群主，无权修改群组 %d 的信息", userID, groupID) // 简化权限
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermEditInfo); err != nil {
+		return nil, err
 	}
 
 	updated := false
@@ -141,7 +166,14 @@ func (s *groupService) UpdateGroupInfo(ctx context.Context, userID, groupID uint
 		group.Description = description
 		updated = true
 	}
-	// ... 其他字段更新逻辑 ...
+	if avatarURL != "" && group.AvatarURL != avatarURL {
+		group.AvatarURL = avatarURL
+		updated = true
+	}
+	if joinCondition != "" && group.JoinCondition != joinCondition {
+		group.JoinCondition = joinCondition
+		updated = true
+	}
 	group.IsPublic = isPublic // isPublic 通常可以直接赋值
 	updated = true
 
@@ -168,10 +200,20 @@ func (s *groupService) JoinGroup(ctx context.Context, userID, groupID uint) (*mo
 		return nil, fmt.Errorf("加入群组失败，群组 %d 未找到: %w", groupID, err)
 	}
 
+	// 机器人只能由群成员邀请加入
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("加入群组失败，用户 %d 未找到: %w", userID, err)
+	}
+	if user.IsBot {
+		return nil, ErrBotMustBeInvited
+	}
+
 	// 检查是否已是成员
-	existingMember, _ := s.groupRepo.GetMember(ctx, groupID, userID)
-	if existingMember != nil {
+	if existingMember, err := s.perms.Member(ctx, groupID, userID); err == nil {
 		return existingMember, fmt.Errorf("用户 %d 已经是群组 %d 的成员", userID, groupID)
+	} else if !errors.Is(err, ErrNotGroupMember) {
+		return nil, err
 	}
 
 	// TODO: 根据 group.JoinCondition 处理加入逻辑 (直接加入、需要审批、仅邀请)
@@ -197,6 +239,7 @@ func (s *groupService) JoinGroup(ctx context.Context, userID, groupID uint) (*mo
 		// log.Printf("更新群组 %d 成员数失败: %v", groupID, err)
 	}
 
+	s.addConversationParticipant(ctx, groupID, userID)
 	return newMember, nil
 }
 
@@ -235,37 +278,356 @@ func (s *groupService) LeaveGroup(ctx context.Context, userID, groupID uint) err
 			// log.Printf("更新群组 %d 成员数失败: %v", groupID, err) // 记录日志，但不应阻塞用户离开操作
 		}
 	}
+
+	s.removeConversationParticipant(ctx, groupID, userID)
 	return nil
 }
 
-// GetGroupMembers 获取群组成员列表。
-func (s *groupService) GetGroupMembers(ctx context.Context, groupID uint, limit, offset int) ([]*models.GroupMember, error) {
-	return s.groupRepo.GetGroupMembers(ctx, groupID, limit, offset)
+// GetGroupMembers 获取群组成员列表，拉黑了 viewerID 的成员不向其展示在线状态。
+func (s *groupService) GetGroupMembers(ctx context.Context, viewerID, groupID uint, limit, offset int) ([]*models.GroupMember, error) {
+	members, err := s.groupRepo.GetGroupMembers(ctx, groupID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member.User.ID == 0 {
+			continue
+		}
+		if err := hidePresence(ctx, s.privacy, viewerID, &member.User); err != nil {
+			return nil, fmt.Errorf("检查成员 %d 的在线状态可见性失败: %w", member.UserID, err)
+		}
+	}
+	return members, nil
 }
 
-// UpdateMemberRole 更新群组成员的角色 (通常由管理员或群主操作)。
+// UpdateMemberRole 更新群组成员的角色。
+// 操作者必须至少是管理员，且只能管理比自己角色低的成员、授予比自己低的角色；群主身份只能通过 TransferOwnership 变更。
 func (s *groupService) UpdateMemberRole(ctx context.Context, adminID, groupID, memberID uint, newRole models.GroupMemberRole) (*models.GroupMember, error) {
+	if !newRole.IsValid() {
+		return nil, fmt.Errorf("无效的群组角色: %s", newRole)
+	}
+	if newRole == models.OwnerRole {
+		return nil, fmt.Errorf("%w: 请通过转让群主设置新的群主", ErrGroupPermissionDenied)
+	}
+
 	// 1. 验证操作者 (adminID) 是否有权限
-	adminMember, err := s.groupRepo.GetMember(ctx, groupID, adminID)
-	if err != nil || adminMember.Role != models.AdminRole {
-		return nil, fmt.Errorf("用户 %d 无权在群组 %d 中修改成员角色", adminID, groupID)
+	actor, err := s.perms.Member(ctx, groupID, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.Role.AtLeast(models.AdminRole) {
+		return nil, fmt.Errorf("%w: 只有管理员或群主可以修改成员角色", ErrGroupPermissionDenied)
 	}
 
 	// 2. 获取目标成员
-	targetMember, err := s.groupRepo.GetMember(ctx, groupID, memberID)
+	targetMember, err := s.perms.Member(ctx, groupID, memberID)
 	if err != nil {
 		return nil, fmt.Errorf("修改角色失败，成员 %d 未在群组 %d 中找到: %w", memberID, groupID, err)
 	}
+	if targetMember.Role == models.OwnerRole {
+		return nil, fmt.Errorf("%w: 不能修改群主的角色", ErrGroupPermissionDenied)
+	}
+	if actor.Role.Rank() <= targetMember.Role.Rank() || actor.Role.Rank() <= newRole.Rank() {
+		return nil, fmt.Errorf("%w: 只能管理角色低于自己的成员", ErrGroupPermissionDenied)
+	}
 
 	// 3. 更新角色
-	// TODO: 检查是否允许将自己降级，或将最后一个管理员降级等逻辑
 	targetMember.Role = newRole
 	if err := s.groupRepo.UpdateMember(ctx, targetMember); err != nil {
 		return nil, fmt.Errorf("更新成员 %d 在群组 %d 中的角色失败: %w", memberID, groupID, err)
 	}
+	s.syncParticipantAdmin(ctx, groupID, targetMember)
 	return targetMember, nil
 }
 
+// TransferOwnership 将群主身份转让给另一位成员，原群主降为管理员。
+func (s *groupService) TransferOwnership(ctx context.Context, ownerID, groupID, newOwnerID uint) error {
+	if ownerID == newOwnerID {
+		return fmt.Errorf("不能将群主转让给自己")
+	}
+	group, err := s.groupRepo.GetGroupByID(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("转让群主失败，群组 %d 未找到: %w", groupID, err)
+	}
+	owner, err := s.perms.Member(ctx, groupID, ownerID)
+	if err != nil {
+		return err
+	}
+	if group.OwnerID != ownerID || owner.Role != models.OwnerRole {
+		return fmt.Errorf("%w: 只有群主可以转让群主身份", ErrGroupPermissionDenied)
+	}
+	newOwner, err := s.perms.Member(ctx, groupID, newOwnerID)
+	if err != nil {
+		return fmt.Errorf("转让群主失败，用户 %d 不是群组成员: %w", newOwnerID, err)
+	}
+
+	err = s.convoRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txGroupRepo := storage.NewGormGroupRepository(tx)
+		newOwner.Role = models.OwnerRole
+		if err := txGroupRepo.UpdateMember(ctx, newOwner); err != nil {
+			return fmt.Errorf("设置新群主角色失败: %w", err)
+		}
+		owner.Role = models.AdminRole
+		if err := txGroupRepo.UpdateMember(ctx, owner); err != nil {
+			return fmt.Errorf("调整原群主角色失败: %w", err)
+		}
+		if err := tx.Model(&models.Group{}).Where("id = ?", groupID).Update("owner_id", newOwnerID).Error; err != nil {
+			return fmt.Errorf("更新群组 %d 的群主失败: %w", groupID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.syncParticipantAdmin(ctx, groupID, newOwner)
+	s.syncParticipantAdmin(ctx, groupID, owner)
+	return nil
+}
+
+// InviteUserToGroup 邀请用户加入群组 (需要 invite_members 权限)，被邀请者同时加入群聊会话。
+// 双方存在拉黑关系或被邀请者的隐私设置不允许时返回 ErrUserBlocked 或 ErrPrivacyRestricted。
+func (s *groupService) InviteUserToGroup(ctx context.Context, inviterID, groupID, inviteeID uint) (*models.GroupMember, error) {
+	if _, err := s.perms.Check(ctx, groupID, inviterID, models.PermInviteMembers); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByID(ctx, inviteeID); err != nil {
+		return nil, fmt.Errorf("邀请失败，用户 %d 不存在: %w", inviteeID, err)
+	}
+	if err := s.privacy.CheckGroupAdd(ctx, inviterID, inviteeID); err != nil {
+		return nil, err
+	}
+	if existing, err := s.perms.Member(ctx, groupID, inviteeID); err == nil {
+		return existing, fmt.Errorf("用户 %d 已经是群组 %d 的成员", inviteeID, groupID)
+	} else if !errors.Is(err, ErrNotGroupMember) {
+		return nil, err
+	}
+
+	newMember := &models.GroupMember{
+		GroupID:  groupID,
+		UserID:   inviteeID,
+		Role:     models.MemberRole,
+		JoinedAt: time.Now(),
+	}
+	if err := s.groupRepo.AddMember(ctx, newMember); err != nil {
+		return nil, fmt.Errorf("邀请用户 %d 加入群组 %d 失败: %w", inviteeID, groupID, err)
+	}
+	if err := s.convoRepo.GetDB().WithContext(ctx).Model(&models.Group{}).Where("id = ?", groupID).
+		UpdateColumn("member_count", gorm.Expr("member_count + 1")).Error; err != nil {
+		log.Printf("更新群组 %d 成员数失败: %v", groupID, err)
+	}
+
+	s.addConversationParticipant(ctx, groupID, inviteeID)
+	return newMember, nil
+}
+
+// addConversationParticipant 将新成员加入群聊会话，并通知 ChatServer 刷新成员缓存。
+func (s *groupService) addConversationParticipant(ctx context.Context, groupID, userID uint) {
+	convo, err := s.convoRepo.FindGroupConversation(ctx, groupID)
+	if err != nil {
+		log.Printf("未找到群组 %d 的会话，跳过添加会话参与者: %v", groupID, err)
+		return
+	}
+	participant := &models.ConversationParticipant{ConversationID: convo.ID, UserID: userID, JoinedAt: time.Now()}
+	if err := s.convoRepo.AddParticipant(ctx, participant); err != nil {
+		log.Printf("将用户 %d 添加到群组 %d 的会话失败: %v", userID, groupID, err)
+		return
+	}
+	s.notifier.NotifyMembershipChanged(ctx, convo.ID, userID, true)
+}
+
+// removeConversationParticipant 将离开的成员移出群聊会话，并通知 ChatServer 刷新成员缓存。
+func (s *groupService) removeConversationParticipant(ctx context.Context, groupID, userID uint) {
+	convo, err := s.convoRepo.FindGroupConversation(ctx, groupID)
+	if err != nil {
+		log.Printf("未找到群组 %d 的会话，跳过移除会话参与者: %v", groupID, err)
+		return
+	}
+	if err := s.convoRepo.RemoveParticipant(ctx, convo.ID, userID); err != nil {
+		log.Printf("将用户 %d 移出群组 %d 的会话失败: %v", userID, groupID, err)
+		return
+	}
+	s.notifier.NotifyMembershipChanged(ctx, convo.ID, userID, false)
+}
+
+// CheckPermission 校验用户在群组中是否拥有指定权限。
+func (s *groupService) CheckPermission(ctx context.Context, groupID, userID uint, perm models.GroupPermission) (*models.GroupMember, error) {
+	return s.perms.Check(ctx, groupID, userID, perm)
+}
+
+// GetPermissions 返回群组当前生效的权限矩阵，仅群成员可以查看。
+func (s *groupService) GetPermissions(ctx context.Context, userID, groupID uint) (map[models.GroupPermission]models.GroupMemberRole, error) {
+	if _, err := s.perms.Member(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+	return s.perms.Matrix(ctx, groupID)
+}
+
+// UpdatePermissions 修改群组的权限矩阵，仅群主可以操作。
+func (s *groupService) UpdatePermissions(ctx context.Context, userID, groupID uint, changes map[models.GroupPermission]models.GroupMemberRole) (map[models.GroupPermission]models.GroupMemberRole, error) {
+	member, err := s.perms.Member(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != models.OwnerRole {
+		return nil, fmt.Errorf("%w: 只有群主可以修改群组权限", ErrGroupPermissionDenied)
+	}
+
+	for perm, role := range changes {
+		if !perm.IsValid() {
+			return nil, fmt.Errorf("未知的群组权限: %s", perm)
+		}
+		if !role.IsValid() {
+			return nil, fmt.Errorf("无效的群组角色: %s", role)
+		}
+	}
+	for perm, role := range changes {
+		setting := &models.GroupPermissionSetting{GroupID: groupID, Permission: perm, MinRole: role}
+		if err := s.groupRepo.SavePermissionSetting(ctx, setting); err != nil {
+			return nil, fmt.Errorf("保存群组 %d 权限 %s 失败: %w", groupID, perm, err)
+		}
+	}
+	return s.perms.Matrix(ctx, groupID)
+}
+
+// maxSlowModeSeconds 是慢速模式允许设置的最大间隔。
+const maxSlowModeSeconds = 3600
+
+// SetSlowMode 设置群组慢速模式。
+func (s *groupService) SetSlowMode(ctx context.Context, userID, groupID uint, seconds int) (*models.Group, error) {
+	if seconds < 0 || seconds > maxSlowModeSeconds {
+		return nil, fmt.Errorf("慢速模式间隔必须在 0 到 %d 秒之间", maxSlowModeSeconds)
+	}
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermEditInfo); err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.GetGroupByID(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("获取群组 %d 失败: %w", groupID, err)
+	}
+	if err := s.convoRepo.GetDB().WithContext(ctx).Model(&models.Group{}).Where("id = ?", groupID).
+		UpdateColumn("slow_mode_seconds", seconds).Error; err != nil {
+		return nil, fmt.Errorf("设置群组 %d 慢速模式失败: %w", groupID, err)
+	}
+	group.SlowModeSeconds = seconds
+	return group, nil
+}
+
+// SetAnnouncement 发布新的群公告 (需要 announce 权限)，并在群聊中发送系统消息提醒成员。
+func (s *groupService) SetAnnouncement(ctx context.Context, userID, groupID uint, content string) (*models.GroupAnnouncement, error) {
+	if content == "" {
+		return nil, fmt.Errorf("公告内容不能为空")
+	}
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermAnnounce); err != nil {
+		return nil, err
+	}
+
+	announcement := &models.GroupAnnouncement{GroupID: groupID, AuthorID: userID, Content: content}
+	if err := s.annRepo.Create(ctx, announcement); err != nil {
+		return nil, fmt.Errorf("发布群组 %d 公告失败: %w", groupID, err)
+	}
+
+	if convo, err := s.convoRepo.FindGroupConversation(ctx, groupID); err == nil {
+		metadata := &models.SystemEventMetadata{
+			Event:          models.SystemEventAnnouncementUpdated,
+			ActorID:        userID,
+			AnnouncementID: announcement.ID,
+		}
+		if _, err := s.notifier.SendSystemMessage(ctx, convo.ID, userID, "群公告: "+content, metadata); err != nil {
+			log.Printf("发送群组 %d 公告系统消息失败: %v", groupID, err)
+		}
+	} else {
+		log.Printf("未找到群组 %d 的会话，跳过公告系统消息: %v", groupID, err)
+	}
+	return announcement, nil
+}
+
+// GetAnnouncement 获取群组当前公告及当前用户的确认状态，仅群成员可查看。
+func (s *groupService) GetAnnouncement(ctx context.Context, userID, groupID uint) (*GroupAnnouncementView, error) {
+	if _, err := s.perms.Member(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+	announcement, err := s.latestAnnouncement(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	acked, err := s.annRepo.HasAcked(ctx, announcement.ID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询公告确认状态失败: %w", err)
+	}
+	count, err := s.annRepo.CountAcks(ctx, announcement.ID)
+	if err != nil {
+		return nil, fmt.Errorf("统计公告确认人数失败: %w", err)
+	}
+	return &GroupAnnouncementView{Announcement: announcement, Acknowledged: acked, AckCount: count}, nil
+}
+
+// AcknowledgeAnnouncement 记录成员已确认当前公告。只能确认当前公告，避免确认过期内容。
+func (s *groupService) AcknowledgeAnnouncement(ctx context.Context, userID, groupID, announcementID uint) error {
+	if _, err := s.perms.Member(ctx, groupID, userID); err != nil {
+		return err
+	}
+	announcement, err := s.latestAnnouncement(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if announcementID != 0 && announcementID != announcement.ID {
+		return ErrAnnouncementNotFound
+	}
+
+	ack := &models.GroupAnnouncementAck{AnnouncementID: announcement.ID, UserID: userID, AckedAt: time.Now()}
+	if err := s.annRepo.Ack(ctx, ack); err != nil {
+		return fmt.Errorf("确认公告 %d 失败: %w", announcement.ID, err)
+	}
+	return nil
+}
+
+// ListAnnouncementAcks 获取当前公告的确认记录 (需要 announce 权限)。
+func (s *groupService) ListAnnouncementAcks(ctx context.Context, userID, groupID uint) ([]*models.GroupAnnouncementAck, error) {
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermAnnounce); err != nil {
+		return nil, err
+	}
+	announcement, err := s.latestAnnouncement(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.annRepo.GetAcks(ctx, announcement.ID)
+}
+
+// latestAnnouncement 获取群组当前公告，没有公告时返回 ErrAnnouncementNotFound。
+func (s *groupService) latestAnnouncement(ctx context.Context, groupID uint) (*models.GroupAnnouncement, error) {
+	announcement, err := s.annRepo.GetLatest(ctx, groupID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAnnouncementNotFound
+		}
+		return nil, fmt.Errorf("获取群组 %d 公告失败: %w", groupID, err)
+	}
+	return announcement, nil
+}
+
+// syncParticipantAdmin 将成员角色同步到群聊会话参与者的 IsAdmin 标记上。
+func (s *groupService) syncParticipantAdmin(ctx context.Context, groupID uint, member *models.GroupMember) {
+	convo, err := s.convoRepo.FindGroupConversation(ctx, groupID)
+	if err != nil {
+		return
+	}
+	participant, err := s.convoRepo.GetParticipant(ctx, convo.ID, member.UserID)
+	if err != nil {
+		return
+	}
+	isAdmin := member.Role.AtLeast(models.AdminRole)
+	if participant.IsAdmin == isAdmin {
+		return
+	}
+	participant.IsAdmin = isAdmin
+	if err := s.convoRepo.UpdateParticipant(ctx, participant); err != nil {
+		log.Printf("同步群组 %d 成员 %d 的会话管理员标记失败: %v", groupID, member.UserID, err)
+	}
+}
+
 // GetUserGroups 获取用户加入的所有群组列表。
 func (s *groupService) GetUserGroups(ctx context.Context, userID uint, limit, offset int) ([]*models.Group, error) {
 	return s.groupRepo.GetUserGroups(ctx, userID, limit, offset)
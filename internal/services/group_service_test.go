@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"im-go/internal/models"
+	"im-go/internal/storage"
+)
+
+// stubMemberRepo 返回预设的群组成员。
+type stubMemberRepo struct {
+	storage.GroupRepository
+	members []*models.GroupMember
+}
+
+func (r *stubMemberRepo) GetGroupMembers(ctx context.Context, groupID uint, limit, offset int) ([]*models.GroupMember, error) {
+	return r.members, nil
+}
+
+// stubBlocks 按 blocker -> blocked 记录拉黑关系，只实现 CanSeePresence。
+type stubBlocks struct {
+	PrivacyChecker
+	blocked map[[2]uint]bool
+}
+
+func (p *stubBlocks) CanSeePresence(ctx context.Context, viewerID, targetID uint) (bool, error) {
+	return viewerID == targetID || !p.blocked[[2]uint{targetID, viewerID}], nil
+}
+
+func TestGetGroupMembersHidesPresenceFromBlockedViewer(t *testing.T) {
+	seen := time.Now()
+	member := func(id uint) *models.GroupMember {
+		m := &models.GroupMember{UserID: id, User: models.User{Status: "online", LastSeenAt: &seen}}
+		m.User.ID = id
+		return m
+	}
+	repo := &stubMemberRepo{members: []*models.GroupMember{member(1), member(2), member(3)}}
+	// 用户 2 拉黑了用户 1
+	privacy := &stubBlocks{blocked: map[[2]uint]bool{{2, 1}: true}}
+	svc := NewGroupService(repo, nil, nil, nil, nil, nil, privacy)
+
+	members, err := svc.GetGroupMembers(context.Background(), 1, 10, 100, 0)
+	if err != nil {
+		t.Fatalf("GetGroupMembers: %v", err)
+	}
+	for _, m := range members {
+		hidden := m.User.Status == "" && m.User.LastSeenAt == nil
+		if want := m.UserID == 2; hidden != want {
+			t.Errorf("member %d: presence hidden = %v, want %v", m.UserID, hidden, want)
+		}
+	}
+}
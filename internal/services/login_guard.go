@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/ratelimit"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// ErrAccountLocked 表示账号因连续登录失败被临时锁定，具体信息见 AccountLockedError。
+var ErrAccountLocked = errors.New("登录失败次数过多，账号已被临时锁定")
+
+const (
+	// loginDelayBase 是超过 LoginDelayAfterFailures 之后第一次失败的延迟，之后每次翻倍。
+	loginDelayBase = 500 * time.Millisecond
+	// loginMaxDelay 是单次失败延迟的上限。
+	loginMaxDelay = 8 * time.Second
+)
+
+// AccountLockedError 表示登录被账号锁定拒绝。
+type AccountLockedError struct {
+	LockedUntil time.Time
+}
+
+// Error 实现 error 接口。
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("%v，请在 %d 秒后重试", ErrAccountLocked, e.RetryAfterSeconds())
+}
+
+// Unwrap 使 errors.Is(err, ErrAccountLocked) 成立。
+func (e *AccountLockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// RetryAfterSeconds 返回距离解除锁定的秒数，至少为 1。
+func (e *AccountLockedError) RetryAfterSeconds() int {
+	return (&AttemptLimitError{RetryAfter: time.Until(e.LockedUntil)}).RetryAfterSeconds()
+}
+
+// LoginGuard 在校验密码前后限制登录尝试：按来源 IP 限制尝试次数，按提交的登录标识 (用户名或邮箱) 统计连续失败，
+// 失败次数增加时逐次延迟响应，达到上限后临时锁定该标识并保存锁定记录。
+// 已存在和不存在的账号走完全相同的流程，得到相同的错误、延迟和 Retry-After，调用方无法据此判断账号是否存在。
+type LoginGuard interface {
+	// CheckAttempt 在校验密码之前调用。
+	// IP 超出限制时返回 *AttemptLimitError，登录标识处于锁定状态时返回 *AccountLockedError。
+	CheckAttempt(ctx context.Context, identifier string, client SessionClientInfo) error
+	// RecordFailure 记录一次失败并按失败次数延迟返回；本次失败导致锁定时返回 *AccountLockedError。
+	// user 为 nil 表示 identifier 不对应任何账号，只影响锁定记录中的 UserID。
+	RecordFailure(ctx context.Context, identifier string, user *models.User, client SessionClientInfo) error
+	// RecordSuccess 清除登录标识的连续失败计数。
+	RecordSuccess(ctx context.Context, identifier string)
+}
+
+// loginGuard 是基于 ratelimit.Limiter 的 LoginGuard 实现。
+type loginGuard struct {
+	limiter  ratelimit.Limiter
+	lockouts storage.LoginLockoutRepository
+	cfg      config.AuthConfig
+}
+
+// NewLoginGuard 创建一个新的 LoginGuard 实例。
+func NewLoginGuard(limiter ratelimit.Limiter, lockouts storage.LoginLockoutRepository, cfg config.AuthConfig) LoginGuard {
+	return &loginGuard{limiter: limiter, lockouts: lockouts, cfg: cfg}
+}
+
+// CheckAttempt 检查来源 IP 的尝试次数和登录标识的锁定状态。限流存储不可用时放行，只记录日志。
+func (g *loginGuard) CheckAttempt(ctx context.Context, identifier string, client SessionClientInfo) error {
+	if client.IPAddress != "" {
+		key := "login:ip:" + client.IPAddress
+		result, err := g.limiter.Allow(ctx, key, g.cfg.LoginMaxAttemptsPerIP, g.cfg.LoginAttemptWindow)
+		if err != nil {
+			log.Printf("登录限流检查失败，放行本次登录 (key=%s): %v", key, err)
+		} else if !result.Allowed {
+			return &AttemptLimitError{RetryAfter: result.RetryAfter}
+		}
+	}
+
+	lockout, err := g.lockouts.GetActiveLockout(ctx, normalizeLoginIdentifier(identifier), time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("获取登录锁定状态失败: %w", err)
+	}
+	return &AccountLockedError{LockedUntil: lockout.LockedUntil}
+}
+
+// RecordFailure 记录失败，达到上限时写入锁定记录并重新计数。
+func (g *loginGuard) RecordFailure(ctx context.Context, identifier string, user *models.User, client SessionClientInfo) error {
+	identifier = normalizeLoginIdentifier(identifier)
+	key := "login:fail:" + identifier
+	result, err := g.limiter.Allow(ctx, key, g.cfg.LoginMaxFailures, g.cfg.LoginAttemptWindow)
+	if err != nil {
+		log.Printf("记录登录失败次数失败 (key=%s): %v", key, err)
+		return nil
+	}
+
+	g.delay(ctx, result.Count)
+
+	if g.cfg.LoginMaxFailures <= 0 || result.Count < g.cfg.LoginMaxFailures {
+		return nil
+	}
+
+	lockout := &models.LoginLockout{
+		Identifier:     identifier,
+		IPAddress:      client.IPAddress,
+		UserAgent:      client.UserAgent,
+		FailedAttempts: result.Count,
+		LockedUntil:    time.Now().Add(g.cfg.LoginLockoutDuration),
+	}
+	if user != nil {
+		lockout.UserID = user.ID
+	}
+	if err := g.lockouts.CreateLockout(ctx, lockout); err != nil {
+		return fmt.Errorf("保存登录锁定记录失败: %w", err)
+	}
+	if err := g.limiter.Reset(ctx, key); err != nil {
+		log.Printf("重置登录失败次数失败 (key=%s): %v", key, err)
+	}
+	log.Printf("登录标识 %q (用户 %d) 连续登录失败 %d 次 (最后来源 %s)，锁定至 %s",
+		identifier, lockout.UserID, result.Count, client.IPAddress, lockout.LockedUntil.Format(time.RFC3339))
+	return &AccountLockedError{LockedUntil: lockout.LockedUntil}
+}
+
+// RecordSuccess 清除失败计数。
+func (g *loginGuard) RecordSuccess(ctx context.Context, identifier string) {
+	key := "login:fail:" + normalizeLoginIdentifier(identifier)
+	if err := g.limiter.Reset(ctx, key); err != nil {
+		log.Printf("重置登录失败次数失败 (key=%s): %v", key, err)
+	}
+}
+
+// delay 在失败次数超过 LoginDelayAfterFailures 后按指数递增延迟返回，减缓在线猜测密码的速度。
+func (g *loginGuard) delay(ctx context.Context, failures int) {
+	if g.cfg.LoginDelayAfterFailures <= 0 || failures <= g.cfg.LoginDelayAfterFailures {
+		return
+	}
+	d := loginMaxDelay
+	if shift := failures - g.cfg.LoginDelayAfterFailures - 1; shift < 5 {
+		d = min(loginDelayBase<<shift, loginMaxDelay)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// normalizeLoginIdentifier 规范化登录时提交的用户名或邮箱，用作失败计数和锁定的 key。
+func normalizeLoginIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
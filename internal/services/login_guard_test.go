@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newLoginGuardTest(t *testing.T) LoginGuard {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.LoginLockout{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	cfg := config.AuthConfig{
+		LoginMaxAttemptsPerIP: 100,
+		LoginMaxFailures:      3,
+		LoginAttemptWindow:    time.Hour,
+		LoginLockoutDuration:  15 * time.Minute,
+	}
+	return NewLoginGuard(&countingLimiter{counts: map[string]int{}}, storage.NewGormLoginLockoutRepository(db), cfg)
+}
+
+// TestLoginGuardSameForUnknownAccounts 检查已存在和不存在的账号被锁定时得到相同的错误和剩余时间。
+func TestLoginGuardSameForUnknownAccounts(t *testing.T) {
+	ctx := context.Background()
+	guard := newLoginGuardTest(t)
+	client := SessionClientInfo{IPAddress: "10.0.0.1"}
+	existing := &models.User{Username: "alice"}
+	existing.ID = 7
+
+	lock := func(identifier string, user *models.User) *AccountLockedError {
+		t.Helper()
+		var err error
+		for i := 0; i < 3; i++ {
+			if err = guard.CheckAttempt(ctx, identifier, client); err != nil {
+				t.Fatalf("%s: CheckAttempt %d: %v", identifier, i+1, err)
+			}
+			err = guard.RecordFailure(ctx, identifier, user, client)
+		}
+		var locked *AccountLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("%s: RecordFailure err = %v, want *AccountLockedError", identifier, err)
+		}
+		if err := guard.CheckAttempt(ctx, " "+identifier+" ", client); !errors.As(err, &locked) {
+			t.Fatalf("%s: CheckAttempt err = %v, want *AccountLockedError", identifier, err)
+		}
+		return locked
+	}
+
+	known := lock("Alice", existing)
+	unknown := lock("nobody", nil)
+	if d := known.LockedUntil.Sub(unknown.LockedUntil).Abs(); d > time.Second {
+		t.Errorf("LockedUntil differs by %v between existing and unknown accounts", d)
+	}
+	if known.RetryAfterSeconds() != unknown.RetryAfterSeconds() {
+		t.Errorf("RetryAfterSeconds = %d vs %d", known.RetryAfterSeconds(), unknown.RetryAfterSeconds())
+	}
+	if err := guard.CheckAttempt(ctx, "bob", client); err != nil {
+		t.Errorf("other identifier: CheckAttempt err = %v", err)
+	}
+}
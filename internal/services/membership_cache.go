@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"im-go/internal/storage"
+)
+
+// ConversationMembershipCache 在 ChatServer 本地缓存会话的参与者列表，
+// 用于把一条会话级广播展开为本实例上的在线连接，避免为每个成员写一条 Kafka 记录。
+type ConversationMembershipCache interface {
+	// Members 返回会话参与者的用户ID，缓存未命中或过期时从数据库加载。
+	Members(ctx context.Context, conversationID uint) ([]uint, error)
+	// Invalidate 丢弃会话的缓存，下一次 Members 调用会重新加载。
+	Invalidate(conversationID uint)
+}
+
+// membershipEntry 是一个会话的缓存条目。
+type membershipEntry struct {
+	userIDs  []uint
+	loadedAt time.Time
+}
+
+// conversationMembershipCache 是基于内存和 TTL 的 ConversationMembershipCache 实现。
+type conversationMembershipCache struct {
+	convoRepo storage.ConversationRepository
+	ttl       time.Duration
+
+	mu      sync.RWMutex
+	entries map[uint]membershipEntry
+	// generations 记录每个会话被失效的次数，用于识别加载期间发生的失效
+	generations map[uint]uint64
+}
+
+// NewConversationMembershipCache 创建一个新的 ConversationMembershipCache 实例。
+// ttl 是条目的最长存活时间，作为错过成员变更通知时的兜底。
+func NewConversationMembershipCache(convoRepo storage.ConversationRepository, ttl time.Duration) ConversationMembershipCache {
+	return &conversationMembershipCache{
+		convoRepo: convoRepo,
+		ttl:       ttl,
+		entries:   make(map[uint]membershipEntry),
+
+		generations: make(map[uint]uint64),
+	}
+}
+
+// Members 返回会话参与者的用户ID。返回的切片由缓存共享，调用方不应修改。
+func (c *conversationMembershipCache) Members(ctx context.Context, conversationID uint) ([]uint, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[conversationID]
+	generation := c.generations[conversationID]
+	c.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < c.ttl {
+		return entry.userIDs, nil
+	}
+
+	loadedAt := time.Now()
+	userIDs, err := c.convoRepo.GetParticipantUserIDs(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("加载会话 %d 的成员失败: %w", conversationID, err)
+	}
+
+	c.mu.Lock()
+	// 加载期间如果条目被失效，加载到的可能是变更前的成员，只返回给本次调用而不写入缓存；
+	// 如果已被更新的数据替换，也不要用旧数据覆盖
+	if c.generations[conversationID] == generation {
+		if current, exists := c.entries[conversationID]; !exists || current.loadedAt.Before(loadedAt) {
+			c.entries[conversationID] = membershipEntry{userIDs: userIDs, loadedAt: loadedAt}
+		}
+	}
+	c.mu.Unlock()
+	return userIDs, nil
+}
+
+// Invalidate 丢弃会话的缓存。
+func (c *conversationMembershipCache) Invalidate(conversationID uint) {
+	c.mu.Lock()
+	delete(c.entries, conversationID)
+	c.generations[conversationID]++
+	c.mu.Unlock()
+}
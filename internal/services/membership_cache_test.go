@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"im-go/internal/storage"
+)
+
+// blockingParticipantRepo 返回预设的成员列表，设置 loading 时在返回前等待 release，用于在加载期间插入失效。
+type blockingParticipantRepo struct {
+	storage.ConversationRepository
+
+	members []uint
+	loads   int
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingParticipantRepo) GetParticipantUserIDs(ctx context.Context, conversationID uint) ([]uint, error) {
+	r.loads++
+	members := r.members
+	if r.loading != nil {
+		close(r.loading)
+		<-r.release
+		r.loading = nil
+	}
+	return members, nil
+}
+
+func TestMembershipCacheDiscardsLoadRacingInvalidate(t *testing.T) {
+	repo := &blockingParticipantRepo{
+		members: []uint{1, 2},
+		loading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	cache := NewConversationMembershipCache(repo, time.Hour)
+
+	done := make(chan []uint)
+	go func() {
+		members, err := cache.Members(context.Background(), 10)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- members
+	}()
+
+	// 加载读到旧成员后、写入缓存前，用户 3 加入并触发失效
+	<-repo.loading
+	repo.members = []uint{1, 2, 3}
+	cache.Invalidate(10)
+	close(repo.release)
+	if members := <-done; len(members) != 2 {
+		t.Fatalf("first Members = %v, want the list it loaded", members)
+	}
+
+	members, err := cache.Members(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Errorf("Members after invalidate = %v, want [1 2 3]", members)
+	}
+	if repo.loads != 2 {
+		t.Errorf("loads = %d, want 2", repo.loads)
+	}
+
+	if _, err := cache.Members(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if repo.loads != 2 {
+		t.Errorf("loads = %d, want the fresh list to be cached", repo.loads)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"time"
 
 	"im-go/internal/config"
 	"im-go/internal/models"
@@ -18,6 +19,8 @@ import (
 	appKafka "im-go/internal/kafka" // Renamed alias for clarity
 
 	confluentKafka "github.com/confluentinc/confluent-kafka-go/v2/kafka" // New import
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // RawMessageInput 类型现在从 imtypes 包获取
@@ -35,34 +38,105 @@ type MessageService interface {
 	GetMessagesForConversation(ctx context.Context, conversationID uint, limit int, offset int) ([]*models.Message, error)
 	// MarkMessagesAsRead(ctx context.Context, userID uint, conversationID uint, messageIDs []uint) error
 	GetMessageByID(ctx context.Context, messageID uint) (*models.Message, error)
+
+	// RecallMessage 撤回消息：发送者可在撤回时限内撤回自己的消息，群聊中拥有 recall_messages 权限的成员可撤回他人消息。
+	RecallMessage(ctx context.Context, userID, messageID uint) (*models.Message, error)
+
+	// SendSystemMessage 在会话中保存一条系统消息，并通过 WebSocketOutgoingTopic 推送给所有参与者。
+	SendSystemMessage(ctx context.Context, conversationID, actorID uint, content string, metadata *models.SystemEventMetadata) (*models.Message, error)
+
+	// PinMessage / UnpinMessage 置顶或取消置顶消息，群聊中需要 pin_messages 权限，私聊中任一参与者均可操作。
+	PinMessage(ctx context.Context, userID, conversationID, messageID uint) (*models.PinnedMessage, error)
+	UnpinMessage(ctx context.Context, userID, conversationID, messageID uint) error
+	ListPinnedMessages(ctx context.Context, userID, conversationID uint) ([]*models.PinnedMessage, error)
+
+	// NotifyMembershipChanged 广播会话成员变更 (userID 加入或离开)，使 ChatServer 的成员缓存失效。
+	NotifyMembershipChanged(ctx context.Context, conversationID, userID uint, joined bool)
+}
+
+// SystemMessageSender 是发送系统消息的能力，由 MessageService 实现，供其他服务在不依赖完整 MessageService 的情况下使用。
+type SystemMessageSender interface {
+	SendSystemMessage(ctx context.Context, conversationID, actorID uint, content string, metadata *models.SystemEventMetadata) (*models.Message, error)
+}
+
+// MembershipChangeNotifier 在会话参与者变更后通知 ChatServer 丢弃缓存的成员列表，由 MessageService 实现。
+type MembershipChangeNotifier interface {
+	NotifyMembershipChanged(ctx context.Context, conversationID, userID uint, joined bool)
 }
 
+// ConversationNotifier 组合了群组服务需要的会话通知能力。
+type ConversationNotifier interface {
+	SystemMessageSender
+	MembershipChangeNotifier
+}
+
+// messageRecallWindow 是发送者撤回自己消息的时限。
+const messageRecallWindow = 2 * time.Minute
+
+var (
+	ErrMessageNotFound       = errors.New("消息未找到")
+	ErrMessageRecallDenied   = errors.New("无权撤回该消息")
+	ErrMessageAlreadyPinned  = errors.New("消息已被置顶")
+	ErrMessageNotPinned      = errors.New("消息未被置顶")
+	ErrNotConversationMember = errors.New("用户不是该会话的参与者")
+)
+
 // messageService 是 MessageService 的实现。
 type messageService struct {
 	msgRepo   storage.MessageRepository
 	convoRepo storage.ConversationRepository
+	pinRepo   storage.PinnedMessageRepository
 	producer  appKafka.MessageProducer
-	cfg       config.Config
+	perms     GroupPermissionChecker
+	guard     SendRateGuard  // 消息进入 MessagesTopic 前的频率限制，为 nil 时不限流
+	commands  CommandRouter  // 斜杠命令和按钮回调的路由，为 nil 时以 "/" 开头的消息按普通消息处理
+	privacy   PrivacyChecker // 私聊消息的拉黑和隐私设置检查，为 nil 时不检查
+
+	workers *CommandWorkerPool // 异步执行命令和按钮回调，commands 为 nil 时不使用
+	cfg     config.Config
 	// hub      *ws.Hub // 如果需要直接与 Hub 交互以分发消息
 }
 
-// NewMessageService 创建一个新的 MessageService 实例。
-func NewMessageService(msgRepo storage.MessageRepository, convoRepo storage.ConversationRepository, producer appKafka.MessageProducer, cfg config.Config /*, hub *ws.Hub*/) MessageService {
+// NewMessageService 创建一个新的 MessageService 实例。commands 不为 nil 时 workers 也不能为 nil，并且需要由调用方启动。
+func NewMessageService(msgRepo storage.MessageRepository, convoRepo storage.ConversationRepository, pinRepo storage.PinnedMessageRepository, producer appKafka.MessageProducer, perms GroupPermissionChecker, guard SendRateGuard, commands CommandRouter, workers *CommandWorkerPool, privacy PrivacyChecker, cfg config.Config /*, hub *ws.Hub*/) MessageService {
 	return &messageService{
 		msgRepo:   msgRepo,
 		convoRepo: convoRepo,
+		pinRepo:   pinRepo,
 		producer:  producer,
+		perms:     perms,
+		guard:     guard,
+		commands:  commands,
+		workers:   workers,
+		privacy:   privacy,
 		cfg:       cfg,
 		// hub: hub,
 	}
 }
 
 // SendMessage 处理用户发送的新消息，将其发送到 Kafka。
+// 超过发送频率限制或群组慢速模式时返回 *RateLimitError，消息不会进入 Kafka。
 func (s *messageService) SendMessage(ctx context.Context, input imtypes.RawMessageInput) error {
 	if input.SenderID == "" || input.ReceiverID == "" {
 		return fmt.Errorf("发送者ID或接收者ID不能为空")
 	}
 
+	if s.guard != nil {
+		senderID, err := storage.StrToUint(input.SenderID)
+		if err != nil {
+			return fmt.Errorf("转换发送者ID '%s' 失败: %w", input.SenderID, err)
+		}
+		var conversationID uint
+		if input.ConversationID != "" {
+			if conversationID, err = storage.StrToUint(input.ConversationID); err != nil {
+				return fmt.Errorf("转换会话ID '%s' 失败: %w", input.ConversationID, err)
+			}
+		}
+		if err := s.guard.CheckSend(ctx, senderID, conversationID); err != nil {
+			return err
+		}
+	}
+
 	// RawMessageInput 已经包含了需要发送到 Kafka 的核心信息
 	// 将 RawMessageInput 序列化为 []byte 以便发送到 Kafka
 	msgBytes, err := json.Marshal(input)
@@ -96,6 +170,11 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		return fmt.Errorf("转换发送者ID '%s' 失败: %w", receivedInput.SenderID, err)
 	}
 
+	// 按钮回调针对已有会话中的消息，不能用于创建私聊会话
+	if receivedInput.Type == string(imtypes.CallbackMessageType) && receivedInput.ConversationID == "" {
+		return fmt.Errorf("按钮回调缺少会话ID")
+	}
+
 	// 验证发送者是否存在
 	_, err = s.validateUserExists(ctx, senderIDUint)
 	if err != nil {
@@ -105,6 +184,8 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 	// 处理不同类型的消息
 	var conversation *models.Conversation
 	var conversationID uint
+	// privateReceiverID 是私聊的接收者，由会话参与者确定，不采用客户端填写的 ReceiverID
+	var privateReceiverID uint
 
 	// 判断是否有会话ID，有会话ID时直接使用
 	if receivedInput.ConversationID != "" {
@@ -121,11 +202,38 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		}
 
 		// 验证发送者是否是会话参与者
-		_, err = s.convoRepo.GetParticipant(ctx, conversationIDUint, senderIDUint)
+		participant, err := s.convoRepo.GetParticipant(ctx, conversationIDUint, senderIDUint)
 		if err != nil {
 			return fmt.Errorf("发送者ID=%d不是会话ID=%d的参与者: %w", senderIDUint, conversationIDUint, err)
 		}
 
+		// 频道只有管理员可以发言，订阅者不在参与者表中，上面的校验已将其排除
+		if conversation.Type == models.ChannelConversation && !participant.IsAdmin {
+			return fmt.Errorf("发送者ID=%d不是频道会话ID=%d的管理员，无权发言", senderIDUint, conversationIDUint)
+		}
+
+		// 群聊中发言需要 send_message 权限
+		if conversation.Type == models.GroupConversation {
+			if _, err := s.perms.Check(ctx, conversation.TargetID, senderIDUint, models.PermSendMessage); err != nil {
+				return fmt.Errorf("发送者ID=%d无权在群组ID=%d中发言: %w", senderIDUint, conversation.TargetID, err)
+			}
+		}
+
+		// 私聊中双方存在拉黑关系或对方的隐私设置不允许时，拒绝消息并通知发送者
+		if conversation.Type == models.PrivateConversation {
+			peerID, err := s.privatePeer(ctx, conversationIDUint, senderIDUint)
+			if err != nil {
+				return err
+			}
+			if receivedInput.ReceiverID != "" && receivedInput.ReceiverID != strconv.FormatUint(uint64(peerID), 10) {
+				log.Printf("私聊会话ID=%d的消息指定的接收者 %s 不是会话的另一个参与者 %d，已忽略", conversationIDUint, receivedInput.ReceiverID, peerID)
+			}
+			if s.rejectPrivateMessage(ctx, receivedInput, senderIDUint, peerID) {
+				return nil
+			}
+			privateReceiverID = peerID
+		}
+
 		conversationID = conversationIDUint
 		fmt.Printf("[ProcessKafkaMessage] 使用现有会话ID=%d，会话类型=%s\n", conversationID, conversation.Type)
 
@@ -147,6 +255,12 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 			return fmt.Errorf("接收者用户验证失败: %w", err)
 		}
 
+		// 在创建会话之前检查拉黑关系和接收者的隐私设置
+		if s.rejectPrivateMessage(ctx, receivedInput, senderIDUint, receiverIDUint) {
+			return nil
+		}
+		privateReceiverID = receiverIDUint
+
 		// 获取或创建私聊会话 (发送者和接收者的会话)
 		var privateConversation *models.Conversation
 
@@ -179,6 +293,29 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		}
 	}
 
+	// 按钮回调不作为消息保存，交给工作池异步路由，慢速的机器人 Webhook 不阻塞后续消息的消费
+	if receivedInput.Type == string(imtypes.CallbackMessageType) {
+		if s.commands == nil {
+			return nil
+		}
+		s.dispatchCommand(ctx, conversation, senderIDUint, func(ctx context.Context) {
+			s.handleCallback(ctx, conversation, senderIDUint, receivedInput)
+		})
+		return nil
+	}
+	// 斜杠命令和普通消息一样保存并推送，保存之后再异步路由给命令处理器
+	var inv *CommandInvocation
+	if s.commands != nil && receivedInput.Type == string(models.TextMessageTypeDB) {
+		if parsed, ok := ParseCommand(string(receivedInput.Content)); ok {
+			inv = parsed
+			inv.ConversationID = conversationID
+			inv.UserID = senderIDUint
+			if conversation.Type == models.GroupConversation {
+				inv.GroupID = conversation.TargetID
+			}
+		}
+	}
+
 	// 创建消息
 	dbMessage := &models.Message{
 		ConversationID: conversationID,
@@ -188,11 +325,15 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		SentAt:         receivedInput.Timestamp,
 	}
 
-	if receivedInput.Type == string(models.FileMessageTypeDB) || receivedInput.Type == string(models.ImageMessageTypeDB) {
+	isAttachmentMessage := receivedInput.Type == string(models.FileMessageTypeDB) || receivedInput.Type == string(models.ImageMessageTypeDB)
+	if isAttachmentMessage {
 		metadata := map[string]interface{}{
 			"fileName": receivedInput.FileName,
 			"fileSize": receivedInput.FileSize,
 		}
+		if receivedInput.AttachmentID != 0 {
+			metadata["attachmentId"] = receivedInput.AttachmentID
+		}
 		metadataBytes, _ := json.Marshal(metadata)
 		dbMessage.MetadataRaw = metadataBytes
 	}
@@ -215,6 +356,22 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		return fmt.Errorf("存储消息到数据库失败: %w", err)
 	}
 
+	// 把附件关联到消息，之后会话的参与者都可以下载该附件；只能引用自己上传且未被其他消息引用的附件
+	if isAttachmentMessage && receivedInput.AttachmentID != 0 {
+		linked, err := storage.NewGormAttachmentRepository(tx).LinkMessage(ctx, receivedInput.AttachmentID, senderIDUint, conversationID, dbMessage.ID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("关联附件 %d 失败: %w", receivedInput.AttachmentID, err)
+		}
+		if !linked {
+			// 引用的附件不属于发送者、属于其他会话或已被引用，重试也不会成功：通知发送者并视为已处理
+			tx.Rollback()
+			log.Printf("拒绝发送者ID=%d在会话ID=%d中引用附件 %d", senderIDUint, conversationID, receivedInput.AttachmentID)
+			s.sendErrorFrame(ctx, receivedInput, senderIDUint, imtypes.ErrorCodeInvalidAttachment, "附件不存在或不能在该会话中使用")
+			return nil
+		}
+	}
+
 	// 更新会话的最后一条消息
 	conversation.LastMessageID = &dbMessage.ID
 	if err := tx.Save(conversation).Error; err != nil {
@@ -231,7 +388,95 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 
 	// --- 新增：将消息推送到 WebSocketOutgoingTopic ---
 	// 构建发送给客户端的 websocket.Message
-	outgoingWsMsg := &imtypes.Message{
+	outgoingWsMsg := toOutgoingMessage(dbMessage)
+
+	// 群聊和频道消息发给所有人，私聊只需发给接收者
+	if conversation.Type == models.GroupConversation || conversation.Type == models.ChannelConversation {
+		// 跳过发送者自己，因为他已经在前端看到了乐观更新的消息
+		s.publishToConversation(ctx, conversation, senderIDUint, outgoingWsMsg)
+	} else {
+		// 私聊：只向接收者发送消息
+		outgoingWsMsg.ReceiverID = strconv.FormatUint(uint64(privateReceiverID), 10)
+		outgoingMsgBytes, _ := json.Marshal(outgoingWsMsg)
+		outgoingKey := []byte(outgoingWsMsg.ReceiverID)
+
+		if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, outgoingKey, outgoingMsgBytes); err != nil {
+			log.Printf("发送私聊消息到接收者ID=%d失败: %v", privateReceiverID, err)
+		}
+		fmt.Printf("[ProcessKafkaMessage] 发送私聊消息到接收者ID=%d\n", privateReceiverID)
+	}
+
+	if inv != nil {
+		s.dispatchCommand(ctx, conversation, senderIDUint, func(ctx context.Context) {
+			s.routeCommand(ctx, conversation, inv)
+		})
+	}
+	return nil
+}
+
+// privatePeer 返回私聊会话中除 userID 之外的另一个参与者。
+func (s *messageService) privatePeer(ctx context.Context, conversationID, userID uint) (uint, error) {
+	participantIDs, err := s.convoRepo.GetParticipantUserIDs(ctx, conversationID)
+	if err != nil {
+		return 0, fmt.Errorf("查询私聊会话ID=%d的参与者失败: %w", conversationID, err)
+	}
+	for _, id := range participantIDs {
+		if id != userID {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("私聊会话ID=%d缺少另一个参与者", conversationID)
+}
+
+// rejectPrivateMessage 检查 senderID 能否向 receiverID 发送私聊消息。不允许时向发送者推送一条
+// error 帧 (ErrorCodeBlocked 或 ErrorCodePrivacyRestricted) 并返回 true，消息不会被保存。
+// 检查本身出错时放行，避免数据库抖动导致消息丢失。
+func (s *messageService) rejectPrivateMessage(ctx context.Context, input imtypes.RawMessageInput, senderID, receiverID uint) bool {
+	if s.privacy == nil {
+		return false
+	}
+	err := s.privacy.CheckPrivateMessage(ctx, senderID, receiverID)
+	var code string
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrUserBlocked):
+		code = imtypes.ErrorCodeBlocked
+	case errors.Is(err, ErrPrivacyRestricted):
+		code = imtypes.ErrorCodePrivacyRestricted
+	default:
+		log.Printf("检查用户 %d 向用户 %d 发送私聊消息的权限失败: %v", senderID, receiverID, err)
+		return false
+	}
+
+	log.Printf("拒绝用户 %d 发给用户 %d 的私聊消息: %v", senderID, receiverID, err)
+	s.sendErrorFrame(ctx, input, senderID, code, err.Error())
+	return true
+}
+
+// sendErrorFrame 向发送者推送一条 error 帧，告知其发送的消息 input 未被接受。
+func (s *messageService) sendErrorFrame(ctx context.Context, input imtypes.RawMessageInput, senderID uint, code, content string) {
+	metadata, _ := json.Marshal(imtypes.ErrorPayload{Code: code})
+	sender := strconv.FormatUint(uint64(senderID), 10)
+	frame := &imtypes.Message{
+		ID:             input.ID, // 客户端生成的消息ID，便于客户端定位失败的消息
+		Type:           imtypes.ErrorMessageType,
+		Content:        content,
+		SenderID:       sender,
+		ReceiverID:     sender,
+		Timestamp:      time.Now(),
+		ConversationID: input.ConversationID,
+		Metadata:       metadata,
+	}
+	frameBytes, _ := json.Marshal(frame)
+	if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, []byte(sender), frameBytes); err != nil {
+		log.Printf("向用户 %d 推送发送失败通知失败: %v", senderID, err)
+	}
+}
+
+// toOutgoingMessage 将数据库中的消息转换为推送给客户端的 imtypes.Message。
+func toOutgoingMessage(dbMessage *models.Message) *imtypes.Message {
+	outgoing := &imtypes.Message{
 		ID:             dbMessage.IDString(),
 		Type:           imtypes.MessageType(dbMessage.Type),
 		Content:        dbMessage.Content,
@@ -239,60 +484,111 @@ func (s *messageService) ProcessKafkaMessage(ctx context.Context, kafkaMsg *conf
 		Timestamp:      dbMessage.SentAt,
 		ConversationID: strconv.FormatUint(uint64(dbMessage.ConversationID), 10),
 	}
-	if dbMessage.Type == models.FileMessageTypeDB || dbMessage.Type == models.ImageMessageTypeDB {
+	switch dbMessage.Type {
+	case models.FileMessageTypeDB, models.ImageMessageTypeDB:
 		fileMeta, _ := dbMessage.GetFileMetadata()
 		if fileMeta != nil {
-			outgoingWsMsg.FileName = fileMeta.FileName
-			outgoingWsMsg.FileSize = fileMeta.FileSize
+			outgoing.FileName = fileMeta.FileName
+			outgoing.FileSize = fileMeta.FileSize
+			outgoing.AttachmentID = fileMeta.AttachmentID
+		}
+		if imageMeta, _ := dbMessage.GetImageMetadata(); imageMeta != nil {
+			outgoing.FileName = imageMeta.FileName
+			outgoing.FileSize = imageMeta.FileSize
+			outgoing.AttachmentID = imageMeta.AttachmentID
 		}
+	case models.SystemMessageTypeDB, models.TextMessageTypeDB:
+		// 文本消息只有命令回复和机器人消息带有元数据 (按钮)
+		outgoing.Metadata = dbMessage.MetadataRaw
+	}
+	return outgoing
+}
+
+// publishToConversation 按会话类型选择投递方式：频道和群聊消息只向广播主题发布一次，
+// 由各 ChatServer 实例按本地订阅 (频道) 或缓存的成员列表 (群聊) 扇出；私聊逐个推送给参与者。
+func (s *messageService) publishToConversation(ctx context.Context, conversation *models.Conversation, excludeUserID uint, msg *imtypes.Message) {
+	envelope := imtypes.BroadcastEnvelope{
+		ConversationID: conversation.ID,
+		ExcludeUserID:  excludeUserID,
+		Message:        msg,
+	}
+	switch conversation.Type {
+	case models.ChannelConversation:
+		envelope.Kind = imtypes.BroadcastMessage
+		envelope.Topic = imtypes.ChannelTopic(conversation.ID)
+	case models.GroupConversation:
+		envelope.Kind = imtypes.BroadcastConversation
+	default:
+		s.publishToParticipants(ctx, conversation.ID, excludeUserID, msg)
+		return
 	}
 
-	// 获取会话所有参与者，以便可以向他们发送消息
+	if err := publishBroadcast(ctx, s.producer, s.cfg.Kafka.BroadcastTopic, &envelope); err != nil {
+		log.Printf("发布会话 %d 的广播消息失败: %v", conversation.ID, err)
+	}
+}
+
+// NotifyMembershipChanged 通知所有 ChatServer 实例会话成员已变更，使其丢弃缓存的成员列表。
+// 变更的成员一并写入信封，供 Webhook 投递成员加入、离开事件。
+func (s *messageService) NotifyMembershipChanged(ctx context.Context, conversationID, userID uint, joined bool) {
+	envelope := imtypes.BroadcastEnvelope{
+		Kind:           imtypes.BroadcastMembership,
+		ConversationID: conversationID,
+		UserID:         userID,
+		Subscribed:     joined,
+	}
+	if err := publishBroadcast(ctx, s.producer, s.cfg.Kafka.BroadcastTopic, &envelope); err != nil {
+		log.Printf("发布会话 %d 的成员变更通知失败: %v", conversationID, err)
+	}
+}
+
+// publishBroadcast 将广播信封发布到广播主题。以频道主题、会话或用户为 key，保证同一会话内消息与成员变更的顺序。
+func publishBroadcast(ctx context.Context, producer appKafka.MessageProducer, topic string, envelope *imtypes.BroadcastEnvelope) error {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("序列化广播信封失败: %w", err)
+	}
+	key := envelope.Topic
+	switch {
+	case key != "":
+	case envelope.ConversationID == 0 && envelope.UserID != 0:
+		key = imtypes.UserKey(envelope.UserID) // 与会话无关的用户事件 (如会话吊销)
+	default:
+		key = imtypes.ConversationKey(envelope.ConversationID)
+	}
+	if err := producer.SendMessage(ctx, topic, []byte(key), payload); err != nil {
+		return fmt.Errorf("发送广播信封到 Kafka 失败: %w", err)
+	}
+	return nil
+}
+
+// publishToParticipants 将消息逐个推送给会话参与者 (仅用于私聊等小会话) (跳过 excludeUserID，为 0 时不跳过)。
+func (s *messageService) publishToParticipants(ctx context.Context, conversationID uint, excludeUserID uint, msg *imtypes.Message) {
 	participants, err := s.convoRepo.GetConversationParticipants(ctx, conversationID)
 	if err != nil {
 		log.Printf("获取会话参与者失败: %v", err)
-	} else {
-		fmt.Printf("[ProcessKafkaMessage] 会话ID=%d有%d名参与者\n", conversationID, len(participants))
+		return
 	}
 
-	// 群聊消息发给所有人，私聊只需发给接收者
-	if conversation.Type == models.GroupConversation {
-		// 群聊：向所有参与者发送消息
-		for _, participant := range participants {
-			// 给每个参与者单独发送一条消息
-			if participant.UserID == senderIDUint {
-				// 跳过发送者自己，因为他已经在前端看到了乐观更新的消息
-				continue
-			}
-
-			// 为每个接收者单独设置ReceiverID
-			outgoingWsMsg.ReceiverID = strconv.FormatUint(uint64(participant.UserID), 10)
-			participantMessageBytes, err := json.Marshal(outgoingWsMsg)
-			if err != nil {
-				log.Printf("序列化发送给参与者 %d 的消息失败: %v", participant.UserID, err)
-				continue
-			}
+	for _, participant := range participants {
+		if participant.UserID == excludeUserID {
+			continue
+		}
 
-			// 以接收者ID为key发送消息
-			outgoingKey := []byte(outgoingWsMsg.ReceiverID)
-			if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, outgoingKey, participantMessageBytes); err != nil {
-				log.Printf("发送消息到参与者 %d 失败: %v", participant.UserID, err)
-			}
-			fmt.Printf("[ProcessKafkaMessage] 发送群聊消息给参与者ID=%d\n", participant.UserID)
+		// 为每个接收者单独设置ReceiverID
+		outgoing := *msg
+		outgoing.ReceiverID = strconv.FormatUint(uint64(participant.UserID), 10)
+		participantMessageBytes, err := json.Marshal(&outgoing)
+		if err != nil {
+			log.Printf("序列化发送给参与者 %d 的消息失败: %v", participant.UserID, err)
+			continue
 		}
-	} else {
-		// 私聊：只向接收者发送消息
-		outgoingWsMsg.ReceiverID = receivedInput.ReceiverID
-		outgoingMsgBytes, _ := json.Marshal(outgoingWsMsg)
-		outgoingKey := []byte(receivedInput.ReceiverID)
 
-		if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, outgoingKey, outgoingMsgBytes); err != nil {
-			log.Printf("发送私聊消息到接收者ID=%s失败: %v", receivedInput.ReceiverID, err)
+		// 以接收者ID为key发送消息
+		if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, []byte(outgoing.ReceiverID), participantMessageBytes); err != nil {
+			log.Printf("发送消息到参与者 %d 失败: %v", participant.UserID, err)
 		}
-		fmt.Printf("[ProcessKafkaMessage] 发送私聊消息到接收者ID=%s\n", receivedInput.ReceiverID)
 	}
-
-	return nil
 }
 
 // validateUserExists 检查用户是否存在
@@ -322,3 +618,312 @@ func (s *messageService) GetMessageByID(ctx context.Context, messageID uint) (*m
 	}
 	return s.msgRepo.GetByID(ctx, messageID) // Changed FindMessageByID to FindByID
 }
+
+// RecallMessage 撤回一条消息，并通知会话的其他参与者。
+func (s *messageService) RecallMessage(ctx context.Context, userID, messageID uint) (*models.Message, error) {
+	message, err := s.msgRepo.GetByID(ctx, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, fmt.Errorf("获取消息 %d 失败: %w", messageID, err)
+	}
+	if message.Status == models.MessageStatusRecalled {
+		return message, nil
+	}
+
+	conversation, err := s.convoRepo.GetConversationByID(ctx, message.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话 %d 失败: %w", message.ConversationID, err)
+	}
+
+	if message.SenderID == userID {
+		if time.Since(message.SentAt) > messageRecallWindow {
+			return nil, fmt.Errorf("%w: 已超过撤回时限", ErrMessageRecallDenied)
+		}
+	} else {
+		// 只有群聊中拥有 recall_messages 权限、且角色高于发送者的成员才能撤回他人的消息
+		if conversation.Type != models.GroupConversation {
+			return nil, ErrMessageRecallDenied
+		}
+		actor, err := s.perms.Check(ctx, conversation.TargetID, userID, models.PermRecallMessages)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMessageRecallDenied, err)
+		}
+		if sender, err := s.perms.Member(ctx, conversation.TargetID, message.SenderID); err == nil && sender.Role.Rank() >= actor.Role.Rank() {
+			return nil, fmt.Errorf("%w: 不能撤回同级或更高角色成员的消息", ErrMessageRecallDenied)
+		}
+	}
+
+	message.Status = models.MessageStatusRecalled
+	message.Content = ""
+	message.MetadataRaw = nil
+	if err := s.msgRepo.Update(ctx, message); err != nil {
+		return nil, fmt.Errorf("撤回消息 %d 失败: %w", messageID, err)
+	}
+
+	notice := &imtypes.Message{
+		ID:             message.IDString(),
+		Type:           imtypes.RecallMessageType,
+		SenderID:       strconv.FormatUint(uint64(userID), 10),
+		Timestamp:      time.Now(),
+		ConversationID: strconv.FormatUint(uint64(message.ConversationID), 10),
+	}
+	s.publishToConversation(ctx, conversation, 0, notice)
+	return message, nil
+}
+
+// SendSystemMessage 保存一条系统消息并推送给会话的所有参与者 (包括操作者本人，以便其他终端同步)。
+func (s *messageService) SendSystemMessage(ctx context.Context, conversationID, actorID uint, content string, metadata *models.SystemEventMetadata) (*models.Message, error) {
+	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话 %d 失败: %w", conversationID, err)
+	}
+
+	dbMessage := &models.Message{
+		ConversationID: conversationID,
+		SenderID:       actorID,
+		Type:           models.SystemMessageTypeDB,
+		Content:        content,
+		SentAt:         time.Now(),
+	}
+	if metadata != nil {
+		if err := dbMessage.SetMetadata(metadata); err != nil {
+			return nil, fmt.Errorf("序列化系统消息元数据失败: %w", err)
+		}
+	}
+
+	if err := s.saveAndPublish(ctx, conversation, dbMessage); err != nil {
+		return nil, err
+	}
+	return dbMessage, nil
+}
+
+// saveAndPublish 保存服务端生成的消息、更新会话的最后一条消息，并推送给会话的所有参与者。
+func (s *messageService) saveAndPublish(ctx context.Context, conversation *models.Conversation, dbMessage *models.Message) error {
+	err := s.convoRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dbMessage).Error; err != nil {
+			return fmt.Errorf("存储消息失败: %w", err)
+		}
+		if err := tx.Model(conversation).Update("last_message_id", dbMessage.ID).Error; err != nil {
+			return fmt.Errorf("更新会话 %d 的 LastMessageID 失败: %w", conversation.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publishToConversation(ctx, conversation, 0, toOutgoingMessage(dbMessage))
+	return nil
+}
+
+// dispatchCommand 把命令或按钮回调交给工作池执行，队列已满时以临时回复告知调用者稍后重试。
+func (s *messageService) dispatchCommand(ctx context.Context, conversation *models.Conversation, userID uint, job func(ctx context.Context)) {
+	if s.workers.Submit(job) {
+		return
+	}
+	log.Printf("命令队列已满，丢弃用户 %d 在会话 %d 中的命令", userID, conversation.ID)
+	s.deliverCommandReply(ctx, conversation, userID, ephemeralReply("", userID, "机器人繁忙，请稍后重试"))
+}
+
+// routeCommand 把已保存的斜杠命令交给命令路由并发送回复，机器人发送的命令被忽略。
+func (s *messageService) routeCommand(ctx context.Context, conversation *models.Conversation, inv *CommandInvocation) {
+	reply, err := s.commands.Route(ctx, inv)
+	switch {
+	case err == nil:
+		s.deliverCommandReply(ctx, conversation, inv.UserID, reply)
+	case !errors.Is(err, ErrCommandSenderIsBot):
+		log.Printf("路由命令 /%s 失败 (会话 %d, 用户 %d): %v", inv.Command, conversation.ID, inv.UserID, err)
+		s.deliverCommandReply(ctx, conversation, inv.UserID, commandFailure(inv.Command, inv.UserID))
+	}
+}
+
+// handleCallback 校验被点击的按钮并把回调交给命令路由，处理失败时以临时回复告知点击者。
+func (s *messageService) handleCallback(ctx context.Context, conversation *models.Conversation, userID uint, input imtypes.RawMessageInput) {
+	var payload imtypes.CallbackPayload
+	if err := json.Unmarshal(input.Metadata, &payload); err != nil {
+		log.Printf("无法解析用户 %d 的按钮回调: %v", userID, err)
+		return
+	}
+	messageID, err := storage.StrToUint(payload.MessageID)
+	if err != nil {
+		log.Printf("用户 %d 的按钮回调消息ID '%s' 无效", userID, payload.MessageID)
+		return
+	}
+
+	message, err := s.msgRepo.GetByID(ctx, messageID)
+	if err != nil || message.ConversationID != conversation.ID || message.Status == models.MessageStatusRecalled {
+		s.deliverCommandReply(ctx, conversation, userID, ephemeralReply("", userID, "该按钮已失效"))
+		return
+	}
+	metadata, err := message.GetInteractiveMetadata()
+	if err != nil || metadata == nil || !hasButton(metadata.Buttons, payload.ButtonID) {
+		s.deliverCommandReply(ctx, conversation, userID, ephemeralReply("", userID, "该按钮已失效"))
+		return
+	}
+
+	cb := &CommandCallback{
+		Command:        metadata.Command,
+		MessageID:      message.ID,
+		ButtonID:       payload.ButtonID,
+		ConversationID: conversation.ID,
+		UserID:         userID,
+	}
+	if conversation.Type == models.GroupConversation {
+		cb.GroupID = conversation.TargetID
+	}
+	reply, err := s.commands.RouteCallback(ctx, cb, message.SenderID)
+	if err != nil {
+		log.Printf("路由消息 %d 的按钮回调失败: %v", message.ID, err)
+		reply = commandFailure(metadata.Command, userID)
+	}
+	s.deliverCommandReply(ctx, conversation, userID, reply)
+}
+
+// deliverCommandReply 发送命令或按钮回调的回复：临时回复只推送给 invokerID 且不保存，
+// 其他回复以 reply.SenderID 的身份保存为带按钮的文本消息并推送给会话的所有参与者。
+func (s *messageService) deliverCommandReply(ctx context.Context, conversation *models.Conversation, invokerID uint, reply *CommandReply) {
+	if reply == nil || reply.Response == nil {
+		return
+	}
+	if err := ValidateCommandResponse(reply.Response); err != nil {
+		log.Printf("命令 /%s 的回复无效 (会话 %d): %v", reply.Command, conversation.ID, err)
+		reply = commandFailure(reply.Command, invokerID)
+	}
+	resp := reply.Response
+
+	metadata := &models.InteractiveMetadata{Command: reply.Command, Buttons: resp.Buttons, Ephemeral: resp.Ephemeral}
+	if resp.Ephemeral {
+		metadataBytes, _ := json.Marshal(metadata)
+		invoker := strconv.FormatUint(uint64(invokerID), 10)
+		ephemeral := &imtypes.Message{
+			ID:             "ephemeral-" + uuid.NewString(),
+			Type:           imtypes.TextMessageType,
+			Content:        resp.Text,
+			SenderID:       strconv.FormatUint(uint64(reply.SenderID), 10),
+			ReceiverID:     invoker,
+			Timestamp:      time.Now(),
+			ConversationID: strconv.FormatUint(uint64(conversation.ID), 10),
+			Metadata:       metadataBytes,
+		}
+		msgBytes, _ := json.Marshal(ephemeral)
+		if err := s.producer.SendMessage(ctx, s.cfg.Kafka.WebSocketOutgoingTopic, []byte(invoker), msgBytes); err != nil {
+			log.Printf("发送临时回复给用户 %d 失败: %v", invokerID, err)
+		}
+		return
+	}
+
+	dbMessage := &models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       reply.SenderID,
+		Type:           models.TextMessageTypeDB,
+		Content:        resp.Text,
+		SentAt:         time.Now(),
+	}
+	if err := dbMessage.SetMetadata(metadata); err != nil {
+		log.Printf("序列化命令回复元数据失败: %v", err)
+		return
+	}
+	if err := s.saveAndPublish(ctx, conversation, dbMessage); err != nil {
+		log.Printf("保存命令 /%s 的回复失败 (会话 %d): %v", reply.Command, conversation.ID, err)
+	}
+}
+
+// hasButton 检查按钮列表中是否有指定 ID 的按钮。
+func hasButton(buttons []models.MessageButton, buttonID string) bool {
+	for _, button := range buttons {
+		if button.ID == buttonID {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeConversationAction 校验用户是否为会话参与者；群聊会话还需拥有指定的群组权限。
+func (s *messageService) authorizeConversationAction(ctx context.Context, userID uint, conversation *models.Conversation, perm models.GroupPermission) error {
+	if _, err := s.convoRepo.GetParticipant(ctx, conversation.ID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotConversationMember
+		}
+		return fmt.Errorf("查询会话 %d 参与者失败: %w", conversation.ID, err)
+	}
+	if conversation.Type == models.GroupConversation {
+		if _, err := s.perms.Check(ctx, conversation.TargetID, userID, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PinMessage 置顶会话中的一条消息，并发送系统消息通知参与者。
+func (s *messageService) PinMessage(ctx context.Context, userID, conversationID, messageID uint) (*models.PinnedMessage, error) {
+	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话 %d 失败: %w", conversationID, err)
+	}
+	if err := s.authorizeConversationAction(ctx, userID, conversation, models.PermPinMessages); err != nil {
+		return nil, err
+	}
+
+	message, err := s.msgRepo.GetByID(ctx, messageID)
+	if err != nil || message.ConversationID != conversationID {
+		return nil, ErrMessageNotFound
+	}
+	if message.Status == models.MessageStatusRecalled {
+		return nil, fmt.Errorf("不能置顶已撤回的消息")
+	}
+	if _, err := s.pinRepo.Get(ctx, conversationID, messageID); err == nil {
+		return nil, ErrMessageAlreadyPinned
+	}
+
+	pin := &models.PinnedMessage{
+		ConversationID: conversationID,
+		MessageID:      messageID,
+		PinnedByID:     userID,
+		PinnedAt:       time.Now(),
+	}
+	if err := s.pinRepo.Create(ctx, pin); err != nil {
+		return nil, fmt.Errorf("置顶消息 %d 失败: %w", messageID, err)
+	}
+
+	metadata := &models.SystemEventMetadata{Event: models.SystemEventMessagePinned, ActorID: userID, MessageID: messageID}
+	if _, err := s.SendSystemMessage(ctx, conversationID, userID, "置顶了一条消息", metadata); err != nil {
+		log.Printf("发送置顶系统消息失败 (会话 %d, 消息 %d): %v", conversationID, messageID, err)
+	}
+	return pin, nil
+}
+
+// UnpinMessage 取消置顶，并发送系统消息通知参与者。
+func (s *messageService) UnpinMessage(ctx context.Context, userID, conversationID, messageID uint) error {
+	conversation, err := s.convoRepo.GetConversationByID(ctx, conversationID)
+	if err != nil {
+		return fmt.Errorf("获取会话 %d 失败: %w", conversationID, err)
+	}
+	if err := s.authorizeConversationAction(ctx, userID, conversation, models.PermPinMessages); err != nil {
+		return err
+	}
+	if _, err := s.pinRepo.Get(ctx, conversationID, messageID); err != nil {
+		return ErrMessageNotPinned
+	}
+	if err := s.pinRepo.Delete(ctx, conversationID, messageID); err != nil {
+		return fmt.Errorf("取消置顶消息 %d 失败: %w", messageID, err)
+	}
+
+	metadata := &models.SystemEventMetadata{Event: models.SystemEventMessageUnpinned, ActorID: userID, MessageID: messageID}
+	if _, err := s.SendSystemMessage(ctx, conversationID, userID, "取消置顶了一条消息", metadata); err != nil {
+		log.Printf("发送取消置顶系统消息失败 (会话 %d, 消息 %d): %v", conversationID, messageID, err)
+	}
+	return nil
+}
+
+// ListPinnedMessages 获取会话的置顶消息列表 (最近置顶的在前)，仅会话参与者可查看。
+func (s *messageService) ListPinnedMessages(ctx context.Context, userID, conversationID uint) ([]*models.PinnedMessage, error) {
+	if _, err := s.convoRepo.GetParticipant(ctx, conversationID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotConversationMember
+		}
+		return nil, fmt.Errorf("查询会话 %d 参与者失败: %w", conversationID, err)
+	}
+	return s.pinRepo.ListByConversation(ctx, conversationID)
+}
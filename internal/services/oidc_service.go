@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOIDCDisabled            = errors.New("未启用单点登录")
+	ErrInvalidOIDCLogin        = errors.New("单点登录失败或已过期，请重新登录")
+	ErrOIDCAccountNotLinked    = errors.New("该外部账号未关联任何用户")
+	ErrOIDCIdentityLinked      = errors.New("该外部账号已关联其他用户")
+	ErrOIDCEmailInUse          = errors.New("该邮箱已被其他账号使用，请先登录该账号后再关联")
+	ErrOIDCUsernameUnavailable = errors.New("无法为外部账号分配用户名")
+)
+
+const (
+	// oidcUsernameMaxLength 是自动创建账号时用户名的最大长度 (不含去重后缀)。
+	oidcUsernameMaxLength = 32
+	// oidcUsernameAttempts 是用户名冲突时追加数字后缀的最大尝试次数。
+	oidcUsernameAttempts = 20
+)
+
+// OIDCAuthorization 是跳转到身份提供方所需的信息。
+// 前端应保存 State，回调时核对提供方带回的 state 与之一致后再提交，防止登录 CSRF。
+type OIDCAuthorization struct {
+	AuthorizationURL string
+	State            string
+}
+
+// OIDCService 定义了通过外部 OpenID Connect 身份提供方登录的服务接口。
+// 登录成功后与密码登录一样创建登录会话、签发本系统的访问令牌和刷新令牌，开启了两步验证的用户同样需要先完成挑战；
+// 外部身份首次登录时按配置关联到已有账号或自动创建新账号。
+type OIDCService interface {
+	// Enabled 判断是否配置了身份提供方。
+	Enabled() bool
+	// DisplayName 返回登录按钮上显示的名称。
+	DisplayName() string
+	// BeginLogin 生成 state、nonce 和 PKCE 校验值并返回授权地址。
+	// linkUserID 非零时表示已登录用户关联外部账号，回调成功后外部身份关联到该用户。
+	BeginLogin(ctx context.Context, linkUserID uint) (*OIDCAuthorization, error)
+	// CompleteLogin 处理身份提供方回调的授权码，返回新登录会话的令牌；用户开启了两步验证时只返回 Challenge。
+	CompleteLogin(ctx context.Context, state, code string, client SessionClientInfo) (*LoginResult, error)
+	// ListIdentities 返回用户关联的外部身份。
+	ListIdentities(ctx context.Context, userID uint) ([]*models.ExternalIdentity, error)
+}
+
+// oidcService 是 OIDCService 的实现。
+type oidcService struct {
+	provider     *auth.OIDCProvider // 未启用时为 nil
+	stateStore   auth.OIDCStateStore
+	identityRepo storage.ExternalIdentityRepository
+	userRepo     storage.UserRepository
+	sessions     SessionService
+	twoFactor    TwoFactorService
+	cfg          config.OIDCConfig
+}
+
+// NewOIDCService 创建一个新的 OIDCService 实例。provider 为 nil 表示未启用单点登录。
+func NewOIDCService(provider *auth.OIDCProvider, stateStore auth.OIDCStateStore, identityRepo storage.ExternalIdentityRepository, userRepo storage.UserRepository, sessions SessionService, twoFactor TwoFactorService, cfg config.OIDCConfig) OIDCService {
+	return &oidcService{
+		provider:     provider,
+		stateStore:   stateStore,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		sessions:     sessions,
+		twoFactor:    twoFactor,
+		cfg:          cfg,
+	}
+}
+
+// Enabled 判断是否启用。
+func (s *oidcService) Enabled() bool {
+	return s.provider != nil
+}
+
+// DisplayName 返回提供方名称。
+func (s *oidcService) DisplayName() string {
+	return s.cfg.DisplayName
+}
+
+// BeginLogin 保存登录状态并构造授权地址。
+func (s *oidcService) BeginLogin(ctx context.Context, linkUserID uint) (*OIDCAuthorization, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	state, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := auth.NewPKCEVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("构造 OIDC 授权地址失败: %w", err)
+	}
+	loginState := &auth.OIDCLoginState{Nonce: nonce, CodeVerifier: verifier, LinkUserID: linkUserID}
+	if err := s.stateStore.Save(ctx, state, loginState, s.cfg.StateTTL); err != nil {
+		return nil, err
+	}
+	return &OIDCAuthorization{AuthorizationURL: authURL, State: state}, nil
+}
+
+// CompleteLogin 校验回调并登录。state 只能使用一次，无论成功与否。
+// 外部身份只代替密码，开启了两步验证的用户与密码登录一样需要通过 TwoFactorService.CompleteChallenge 完成登录。
+func (s *oidcService) CompleteLogin(ctx context.Context, state, code string, client SessionClientInfo) (*LoginResult, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidOIDCLogin
+	}
+	loginState, err := s.stateStore.Consume(ctx, state)
+	if err != nil {
+		if errors.Is(err, auth.ErrOIDCStateNotFound) {
+			return nil, ErrInvalidOIDCLogin
+		}
+		return nil, err
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC 授权码换取 ID Token 失败: %v", err)
+		return nil, ErrInvalidOIDCLogin
+	}
+
+	user, err := s.resolveUser(ctx, identity, loginState.LinkUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	twoFactorEnabled, err := s.twoFactor.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactorEnabled {
+		challenge, err := s.twoFactor.CreateChallenge(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: challenge, User: user}, nil
+	}
+
+	tokens, err := s.sessions.StartSession(ctx, user, client)
+	if err != nil {
+		return nil, fmt.Errorf("创建登录会话失败: %w", err)
+	}
+	return &LoginResult{Tokens: tokens, User: user}, nil
+}
+
+// ListIdentities 返回关联的外部身份。
+func (s *oidcService) ListIdentities(ctx context.Context, userID uint) ([]*models.ExternalIdentity, error) {
+	identities, err := s.identityRepo.GetIdentitiesByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的外部身份失败: %w", userID, err)
+	}
+	return identities, nil
+}
+
+// resolveUser 找到外部身份对应的本地用户，必要时关联已有账号或创建新账号。
+func (s *oidcService) resolveUser(ctx context.Context, identity *auth.OIDCIdentity, linkUserID uint) (*models.User, error) {
+	now := time.Now()
+	existing, err := s.identityRepo.GetIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		if linkUserID != 0 && existing.UserID != linkUserID {
+			return nil, ErrOIDCIdentityLinked
+		}
+		if err := s.identityRepo.UpdateLastLogin(ctx, existing.ID, identity.Email, now); err != nil {
+			log.Printf("更新外部身份 %d 的登录时间失败: %v", existing.ID, err)
+		}
+		return s.getUser(ctx, existing.UserID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查找外部身份失败: %w", err)
+	}
+
+	// 1. 已登录用户主动关联
+	if linkUserID != 0 {
+		user, err := s.getUser(ctx, linkUserID)
+		if err != nil {
+			return nil, err
+		}
+		return user, s.link(ctx, s.identityRepo, user.ID, identity, now)
+	}
+
+	// 2. 按双方都已验证的邮箱关联。本地邮箱未验证时不关联，避免他人抢先用该邮箱注册后接管 SSO 账号
+	var emailOwner *models.User
+	if identity.Email != "" {
+		emailOwner, err = s.userRepo.GetByEmail(ctx, identity.Email)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("通过邮箱查找用户失败: %w", err)
+		}
+	}
+	if emailOwner != nil && s.cfg.LinkVerifiedEmail && identity.EmailVerified && emailOwner.EmailVerified {
+		log.Printf("外部身份 %s 通过已验证的邮箱关联到用户 %d", identity.Subject, emailOwner.ID)
+		return emailOwner, s.link(ctx, s.identityRepo, emailOwner.ID, identity, now)
+	}
+
+	// 3. 自动创建账号
+	if !s.cfg.AutoProvision {
+		return nil, ErrOIDCAccountNotLinked
+	}
+	if emailOwner != nil {
+		return nil, ErrOIDCEmailInUse
+	}
+	return s.provision(ctx, identity, now)
+}
+
+// provision 为外部身份创建新用户并关联。新用户没有可用的密码，可以通过找回密码设置。
+func (s *oidcService) provision(ctx context.Context, identity *auth.OIDCIdentity, now time.Time) (*models.User, error) {
+	username, err := s.availableUsername(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	unusablePassword, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := auth.HashPassword(unusablePassword)
+	if err != nil {
+		return nil, fmt.Errorf("密码哈希失败: %w", err)
+	}
+
+	user := &models.User{
+		Username:     username,
+		Nickname:     identity.Name,
+		Email:        identity.Email,
+		AvatarURL:    identity.Picture,
+		PasswordHash: passwordHash,
+	}
+	if user.Nickname == "" {
+		user.Nickname = username
+	}
+	if identity.Email != "" && identity.EmailVerified {
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+
+	err = s.identityRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := storage.NewGormUserRepository(tx).Create(ctx, user); err != nil {
+			return fmt.Errorf("创建用户失败: %w", err)
+		}
+		return s.link(ctx, storage.NewGormExternalIdentityRepository(tx), user.ID, identity, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("为外部身份 %s (%s) 自动创建了用户 %d (%s)", identity.Subject, identity.Issuer, user.ID, user.Username)
+	return user, nil
+}
+
+// link 保存外部身份关联。
+func (s *oidcService) link(ctx context.Context, repo storage.ExternalIdentityRepository, userID uint, identity *auth.OIDCIdentity, now time.Time) error {
+	if err := repo.CreateIdentity(ctx, &models.ExternalIdentity{
+		UserID:      userID,
+		Provider:    identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return fmt.Errorf("关联外部身份到用户 %d 失败: %w", userID, err)
+	}
+	return nil
+}
+
+// availableUsername 根据外部身份生成一个未被占用的用户名，冲突时追加数字后缀。
+func (s *oidcService) availableUsername(ctx context.Context, identity *auth.OIDCIdentity) (string, error) {
+	base := sanitizeUsername(identity.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(identity.Email, "@", 2)[0])
+	}
+	if base == "" {
+		sum := sha256.Sum256([]byte(identity.Issuer + "|" + identity.Subject))
+		base = "sso_" + hex.EncodeToString(sum[:])[:12]
+	}
+
+	candidate := base
+	for i := 1; i <= oidcUsernameAttempts; i++ {
+		_, err := s.userRepo.GetByUsername(ctx, candidate)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, nil
+		} else if err != nil {
+			return "", fmt.Errorf("检查用户名时出错: %w", err)
+		}
+		candidate = fmt.Sprintf("%s%d", base, i+1)
+	}
+	return "", ErrOIDCUsernameUnavailable
+}
+
+// getUser 获取用户。
+func (s *oidcService) getUser(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("获取用户 %d 失败: %w", userID, err)
+	}
+	return user, nil
+}
+
+// sanitizeUsername 只保留字母、数字和 _ . -，并限制长度。
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 128 && (r == '_' || r == '.' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			b.WriteRune(r)
+		}
+		if b.Len() >= oidcUsernameMaxLength {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/auth/oidctest"
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// memoryOIDCStateStore 是 auth.OIDCStateStore 的内存实现，与 Redis 实现一样只能取出一次。
+type memoryOIDCStateStore struct {
+	mu     sync.Mutex
+	states map[string]*auth.OIDCLoginState
+}
+
+func (s *memoryOIDCStateStore) Save(ctx context.Context, state string, data *auth.OIDCLoginState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state] = data
+	return nil
+}
+
+func (s *memoryOIDCStateStore) Consume(ctx context.Context, state string) (*auth.OIDCLoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.states[state]
+	if !ok {
+		return nil, auth.ErrOIDCStateNotFound
+	}
+	delete(s.states, state)
+	return data, nil
+}
+
+// stubSessions 记录 StartSession 的调用，其他方法不会被 OIDCService 使用。
+type stubSessions struct {
+	SessionService
+	started []uint
+}
+
+func (s *stubSessions) StartSession(ctx context.Context, user *models.User, client SessionClientInfo) (*AuthTokens, error) {
+	s.started = append(s.started, user.ID)
+	return &AuthTokens{AccessToken: fmt.Sprintf("access-%d", user.ID), SessionID: uint(len(s.started))}, nil
+}
+
+// stubTwoFactor 对 enabled 中的用户要求两步验证。
+type stubTwoFactor struct {
+	TwoFactorService
+	enabled map[uint]bool
+}
+
+func (s *stubTwoFactor) IsEnabled(ctx context.Context, userID uint) (bool, error) {
+	return s.enabled[userID], nil
+}
+
+func (s *stubTwoFactor) CreateChallenge(ctx context.Context, user *models.User) (*TwoFactorChallenge, error) {
+	return &TwoFactorChallenge{Token: fmt.Sprintf("challenge-%d", user.ID), ExpiresAt: time.Now().Add(5 * time.Minute)}, nil
+}
+
+type oidcTestEnv struct {
+	service   OIDCService
+	issuer    *oidctest.Issuer
+	db        *gorm.DB
+	sessions  *stubSessions
+	twoFactor *stubTwoFactor
+}
+
+// newOIDCTestEnv 使用 oidctest 身份提供方和内存 SQLite 数据库创建 OIDCService。
+func newOIDCTestEnv(t *testing.T, configure func(cfg *config.OIDCConfig)) *oidcTestEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.ExternalIdentity{}); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	issuer := oidctest.NewIssuer(t)
+	cfg := issuer.Config()
+	if configure != nil {
+		configure(&cfg)
+	}
+	env := &oidcTestEnv{
+		issuer:    issuer,
+		db:        db,
+		sessions:  &stubSessions{},
+		twoFactor: &stubTwoFactor{enabled: map[uint]bool{}},
+	}
+	env.service = NewOIDCService(
+		auth.NewOIDCProvider(cfg),
+		&memoryOIDCStateStore{states: map[string]*auth.OIDCLoginState{}},
+		storage.NewGormExternalIdentityRepository(db),
+		storage.NewGormUserRepository(db),
+		env.sessions,
+		env.twoFactor,
+		cfg,
+	)
+	return env
+}
+
+// login 走完整个登录流程：发起授权、在身份提供方以 user 登录、提交回调。
+func (e *oidcTestEnv) login(t *testing.T, user oidctest.User, linkUserID uint, opts ...oidctest.ClaimsOption) (*LoginResult, error) {
+	t.Helper()
+	authorization, err := e.service.BeginLogin(context.Background(), linkUserID)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	code, state := e.issuer.Authorize(t, authorization.AuthorizationURL, user, opts...)
+	if state != authorization.State {
+		t.Fatalf("提供方带回的 state = %q, want %q", state, authorization.State)
+	}
+	return e.service.CompleteLogin(context.Background(), state, code, SessionClientInfo{})
+}
+
+func (e *oidcTestEnv) createUser(t *testing.T, username, email string, emailVerified bool) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Email: email, EmailVerified: emailVerified, PasswordHash: "x"}
+	if err := e.db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+func (e *oidcTestEnv) identities(t *testing.T, userID uint) []*models.ExternalIdentity {
+	t.Helper()
+	identities, err := e.service.ListIdentities(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("ListIdentities: %v", err)
+	}
+	return identities
+}
+
+var oidcAlice = oidctest.User{
+	Subject:           "alice-subject",
+	Email:             "alice@example.com",
+	EmailVerified:     true,
+	Name:              "Alice",
+	PreferredUsername: "alice",
+}
+
+func TestOIDCCompleteLoginProvisionsUser(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.AutoProvision = true })
+	env.createUser(t, "alice", "someone-else@example.com", true) // 用户名已被占用
+
+	result, err := env.login(t, oidcAlice, 0)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	user := result.User
+	if result.Tokens == nil || result.Challenge != nil {
+		t.Fatalf("result = %+v, want tokens", result)
+	}
+	if user.Username != "alice2" || user.Nickname != "Alice" || user.Email != oidcAlice.Email || !user.EmailVerified {
+		t.Errorf("自动创建的用户 = %+v", user)
+	}
+	identities := env.identities(t, user.ID)
+	if len(identities) != 1 || identities[0].Subject != oidcAlice.Subject || identities[0].Provider != env.issuer.URL() {
+		t.Fatalf("外部身份 = %+v", identities)
+	}
+
+	// 再次登录使用已关联的账号，不会重复创建
+	again, err := env.login(t, oidcAlice, 0)
+	if err != nil {
+		t.Fatalf("第二次 CompleteLogin: %v", err)
+	}
+	if again.User.ID != user.ID {
+		t.Errorf("第二次登录的用户 = %d, want %d", again.User.ID, user.ID)
+	}
+	var count int64
+	env.db.Model(&models.User{}).Count(&count)
+	if count != 2 {
+		t.Errorf("用户数 = %d, want 2", count)
+	}
+}
+
+func TestOIDCCompleteLoginStateIsSingleUse(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.AutoProvision = true })
+	ctx := context.Background()
+
+	authorization, err := env.service.BeginLogin(ctx, 0)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	code, state := env.issuer.Authorize(t, authorization.AuthorizationURL, oidcAlice)
+	if _, err := env.service.CompleteLogin(ctx, state, code, SessionClientInfo{}); err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+
+	// 同一个 state 配合新的授权码也不能再次使用，且不会请求令牌端点
+	secondCode, _ := env.issuer.Authorize(t, authorization.AuthorizationURL, oidcAlice)
+	requests := env.issuer.TokenRequests()
+	if _, err := env.service.CompleteLogin(ctx, state, secondCode, SessionClientInfo{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Fatalf("重复使用 state: err = %v, want ErrInvalidOIDCLogin", err)
+	}
+	if _, err := env.service.CompleteLogin(ctx, "unknown-state", secondCode, SessionClientInfo{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Fatalf("未知的 state: err = %v, want ErrInvalidOIDCLogin", err)
+	}
+	if env.issuer.TokenRequests() != requests {
+		t.Error("state 无效时不应请求令牌端点")
+	}
+}
+
+func TestOIDCCompleteLoginConsumesStateOnFailure(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.AutoProvision = true })
+	ctx := context.Background()
+
+	authorization, err := env.service.BeginLogin(ctx, 0)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	// ID Token 的 nonce 与登录状态中的不一致
+	code, state := env.issuer.Authorize(t, authorization.AuthorizationURL, oidcAlice, func(c jwt.MapClaims) { c["nonce"] = "forged" })
+	if _, err := env.service.CompleteLogin(ctx, state, code, SessionClientInfo{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Fatalf("nonce 不匹配: err = %v, want ErrInvalidOIDCLogin", err)
+	}
+
+	retryCode, _ := env.issuer.Authorize(t, authorization.AuthorizationURL, oidcAlice)
+	if _, err := env.service.CompleteLogin(ctx, state, retryCode, SessionClientInfo{}); !errors.Is(err, ErrInvalidOIDCLogin) {
+		t.Fatalf("失败后重试同一个 state: err = %v, want ErrInvalidOIDCLogin", err)
+	}
+	if len(env.sessions.started) != 0 {
+		t.Errorf("创建了 %d 个会话, want 0", len(env.sessions.started))
+	}
+}
+
+func TestOIDCCompleteLoginRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  oidctest.ClaimsOption
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.AutoProvision = true })
+			if _, err := env.login(t, oidcAlice, 0, tt.opt); !errors.Is(err, ErrInvalidOIDCLogin) {
+				t.Fatalf("err = %v, want ErrInvalidOIDCLogin", err)
+			}
+			var count int64
+			env.db.Model(&models.User{}).Count(&count)
+			if count != 0 || len(env.sessions.started) != 0 {
+				t.Errorf("校验失败后创建了 %d 个用户和 %d 个会话", count, len(env.sessions.started))
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteLoginLinksVerifiedEmail(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) {
+		cfg.AutoProvision = true
+		cfg.LinkVerifiedEmail = true
+	})
+	existing := env.createUser(t, "alice_local", oidcAlice.Email, true)
+
+	result, err := env.login(t, oidcAlice, 0)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if result.User.ID != existing.ID {
+		t.Fatalf("登录的用户 = %d, want 已有用户 %d", result.User.ID, existing.ID)
+	}
+	if identities := env.identities(t, existing.ID); len(identities) != 1 {
+		t.Errorf("已有用户关联的外部身份数 = %d, want 1", len(identities))
+	}
+}
+
+func TestOIDCCompleteLoginEmailInUse(t *testing.T) {
+	tests := []struct {
+		name              string
+		localVerified     bool
+		providerVerified  bool
+		linkVerifiedEmail bool
+	}{
+		{"local email unverified", false, true, true},
+		{"provider email unverified", true, false, true},
+		{"linking disabled", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) {
+				cfg.AutoProvision = true
+				cfg.LinkVerifiedEmail = tt.linkVerifiedEmail
+			})
+			existing := env.createUser(t, "alice_local", oidcAlice.Email, tt.localVerified)
+			user := oidcAlice
+			user.EmailVerified = tt.providerVerified
+
+			if _, err := env.login(t, user, 0); !errors.Is(err, ErrOIDCEmailInUse) {
+				t.Fatalf("err = %v, want ErrOIDCEmailInUse", err)
+			}
+			if identities := env.identities(t, existing.ID); len(identities) != 0 {
+				t.Errorf("外部身份不应关联到已有用户: %+v", identities)
+			}
+		})
+	}
+}
+
+func TestOIDCCompleteLoginWithoutAutoProvision(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	if _, err := env.login(t, oidcAlice, 0); !errors.Is(err, ErrOIDCAccountNotLinked) {
+		t.Fatalf("err = %v, want ErrOIDCAccountNotLinked", err)
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	bob := env.createUser(t, "bob", "bob@example.com", true)
+	carol := env.createUser(t, "carol", "carol@example.com", true)
+
+	// 已登录用户主动关联，即使未开启自动创建账号
+	result, err := env.login(t, oidcAlice, bob.ID)
+	if err != nil {
+		t.Fatalf("关联外部身份: %v", err)
+	}
+	if result.User.ID != bob.ID {
+		t.Fatalf("关联后登录的用户 = %d, want %d", result.User.ID, bob.ID)
+	}
+
+	// 同一个外部身份不能再关联到其他用户
+	if _, err := env.login(t, oidcAlice, carol.ID); !errors.Is(err, ErrOIDCIdentityLinked) {
+		t.Fatalf("err = %v, want ErrOIDCIdentityLinked", err)
+	}
+	if identities := env.identities(t, carol.ID); len(identities) != 0 {
+		t.Errorf("carol 不应关联外部身份: %+v", identities)
+	}
+}
+
+func TestOIDCCompleteLoginRequiresTwoFactor(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.LinkVerifiedEmail = true })
+	existing := env.createUser(t, "alice_local", oidcAlice.Email, true)
+	env.twoFactor.enabled[existing.ID] = true
+
+	result, err := env.login(t, oidcAlice, 0)
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if result.Tokens != nil || result.Challenge == nil {
+		t.Fatalf("开启两步验证的用户应只得到挑战: %+v", result)
+	}
+	if result.User.ID != existing.ID {
+		t.Errorf("挑战的用户 = %d, want %d", result.User.ID, existing.ID)
+	}
+	if len(env.sessions.started) != 0 {
+		t.Errorf("通过两步验证前创建了 %d 个会话", len(env.sessions.started))
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/kafka"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+)
+
+// outboxCleanupInterval 是清理过期的已发布事件并输出积压情况的间隔。
+const outboxCleanupInterval = time.Minute
+
+// OutboxRelay 把事务性发件箱中的事件发布到 Kafka。每个 API 服务器实例运行一个，多个实例通过认领避免重复发布，
+// 但实例在发布成功后、标记之前退出时事件会被再次发布，因此消费方需要保证幂等。
+type OutboxRelay interface {
+	// Run 定期发布到期的事件并清理过期的已发布事件，直到 ctx 被取消。
+	Run(ctx context.Context)
+}
+
+// outboxRelay 是 OutboxRelay 的实现。
+type outboxRelay struct {
+	outboxRepo storage.OutboxRepository
+	producer   kafka.MessageProducer
+	cfg        config.OutboxConfig
+}
+
+// NewOutboxRelay 创建一个新的 OutboxRelay 实例。
+func NewOutboxRelay(outboxRepo storage.OutboxRepository, producer kafka.MessageProducer, cfg config.OutboxConfig) OutboxRelay {
+	return &outboxRelay{outboxRepo: outboxRepo, producer: producer, cfg: cfg}
+}
+
+// enqueueOutbox 序列化 payload 并写入发件箱。outboxRepo 应基于业务事务创建，使事件与业务数据一同提交。
+func enqueueOutbox(ctx context.Context, outboxRepo storage.OutboxRepository, topic, key string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化发件箱事件失败: %w", err)
+	}
+	return outboxRepo.Create(ctx, &models.OutboxEvent{
+		Topic:         topic,
+		Key:           key,
+		Payload:       string(body),
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// Run 按 PollInterval 发布到期的事件，按 outboxCleanupInterval 清理过期事件。
+func (r *outboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		r.publishDue(ctx)
+		if time.Since(lastCleanup) >= outboxCleanupInterval {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDue 按写入顺序逐条发布当前到期的事件，一批取满时继续取下一批。
+func (r *outboxRelay) publishDue(ctx context.Context) {
+	batchSize := r.cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	for ctx.Err() == nil {
+		due, err := r.outboxRepo.GetDueEvents(ctx, time.Now(), batchSize)
+		if err != nil {
+			log.Printf("Outbox: 获取待发布事件失败: %v", err)
+			return
+		}
+		for _, event := range due {
+			r.publish(ctx, event)
+		}
+		if len(due) < batchSize {
+			return
+		}
+	}
+}
+
+// publish 认领并发布一条事件，失败时按指数退避安排重试，重试耗尽后标记为 failed。
+func (r *outboxRelay) publish(ctx context.Context, event *models.OutboxEvent) {
+	// 认领期限覆盖一次发布的耗时，实例在发布中途退出时事件会在期限后被重新取出
+	lease := time.Now().Add(30 * time.Second)
+	claimed, err := r.outboxRepo.ClaimEvent(ctx, event.ID, event.Attempts, lease)
+	if err != nil {
+		log.Printf("Outbox: 认领事件 %d 失败: %v", event.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	event.Attempts++
+
+	if err := r.producer.SendMessage(ctx, event.Topic, []byte(event.Key), []byte(event.Payload)); err != nil {
+		status := models.OutboxPending
+		if r.cfg.MaxAttempts > 0 && event.Attempts >= r.cfg.MaxAttempts {
+			status = models.OutboxFailed
+			log.Printf("Outbox: 事件 %d (topic %s) 发布 %d 次均失败，不再重试: %v", event.ID, event.Topic, event.Attempts, err)
+		} else {
+			log.Printf("Outbox: 事件 %d (topic %s) 第 %d 次发布失败，将重试: %v", event.ID, event.Topic, event.Attempts, err)
+		}
+		if err := r.outboxRepo.MarkFailedAttempt(ctx, event.ID, status, time.Now().Add(r.retryDelay(event.Attempts)), truncateWebhookError(err.Error(), 1024)); err != nil {
+			log.Printf("Outbox: 保存事件 %d 的发布结果失败: %v", event.ID, err)
+		}
+		return
+	}
+	if err := r.outboxRepo.MarkPublished(ctx, event.ID, time.Now()); err != nil {
+		// 事件会在认领期限后被再次发布
+		log.Printf("Outbox: 标记事件 %d 为已发布失败: %v", event.ID, err)
+	}
+}
+
+// cleanup 删除保留期之前发布的事件，并在存在积压或失败事件时输出日志。
+func (r *outboxRelay) cleanup(ctx context.Context) {
+	if r.cfg.Retention > 0 {
+		deleted, err := r.outboxRepo.DeletePublishedBefore(ctx, time.Now().Add(-r.cfg.Retention))
+		if err != nil {
+			log.Printf("Outbox: 清理已发布事件失败: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Outbox: 清理了 %d 条已发布事件", deleted)
+		}
+	}
+
+	pending, err := r.outboxRepo.CountByStatus(ctx, models.OutboxPending)
+	if err != nil {
+		log.Printf("Outbox: 统计待发布事件失败: %v", err)
+		return
+	}
+	failed, err := r.outboxRepo.CountByStatus(ctx, models.OutboxFailed)
+	if err != nil {
+		log.Printf("Outbox: 统计发布失败的事件失败: %v", err)
+		return
+	}
+	if pending > int64(r.cfg.BatchSize) || failed > 0 {
+		log.Printf("Outbox: 待发布 %d 条，发布失败 %d 条", pending, failed)
+	}
+}
+
+// retryDelay 返回第 attempts 次发布失败后的重试间隔：RetryBaseDelay 每次翻倍，最长 RetryMaxDelay。
+func (r *outboxRelay) retryDelay(attempts int) time.Duration {
+	delay := r.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < r.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.cfg.RetryMaxDelay {
+		delay = r.cfg.RetryMaxDelay
+	}
+	return delay
+}
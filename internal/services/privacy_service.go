@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBlockSelf             = errors.New("不能拉黑自己")
+	ErrBlockNotFound         = errors.New("该用户不在拉黑名单中")
+	ErrUserBlocked           = errors.New("你们之间存在拉黑关系，无法进行此操作")
+	ErrPrivacyRestricted     = errors.New("对方的隐私设置不允许此操作")
+	ErrInvalidPrivacySetting = errors.New("无效的隐私设置")
+)
+
+// BlockedUser 是拉黑名单中的一项。
+type BlockedUser struct {
+	models.UserBasicInfo
+	BlockedAt time.Time `json:"blockedAt"`
+}
+
+// PrivacySettingsChanges 是对隐私设置的修改，为 nil 的字段保持不变。
+type PrivacySettingsChanges struct {
+	SearchVisibility      *models.PrivacyAudience `json:"searchVisibility,omitempty"`
+	MessagePermission     *models.PrivacyAudience `json:"messagePermission,omitempty"`
+	GroupInvitePermission *models.PrivacyAudience `json:"groupInvitePermission,omitempty"`
+}
+
+// PrivacyChecker 是其他服务在执行操作前检查拉黑关系和隐私设置的能力，由 PrivacyService 实现。
+// 检查不通过时返回 ErrUserBlocked 或 ErrPrivacyRestricted。
+type PrivacyChecker interface {
+	// CheckFriendRequest 检查 requesterID 能否向 recipientID 发送好友请求。
+	CheckFriendRequest(ctx context.Context, requesterID, recipientID uint) error
+	// CheckPrivateMessage 检查 senderID 能否向 receiverID 发送私聊消息。
+	CheckPrivateMessage(ctx context.Context, senderID, receiverID uint) error
+	// CheckGroupAdd 检查 actorID 能否把 targetID 拉进群组。
+	CheckGroupAdd(ctx context.Context, actorID, targetID uint) error
+	// CanSeePresence 检查 viewerID 能否看到 targetID 的在线状态，viewerID 为 0 表示未登录的访问者。
+	CanSeePresence(ctx context.Context, viewerID, targetID uint) (bool, error)
+}
+
+// PrivacyService 定义了拉黑名单和隐私设置相关服务的接口。
+type PrivacyService interface {
+	PrivacyChecker
+
+	// BlockUser 拉黑用户，同时拒绝双方之间待处理的好友请求。重复拉黑不会报错。
+	BlockUser(ctx context.Context, userID, targetID uint) error
+	// UnblockUser 取消拉黑，用户不在拉黑名单中时返回 ErrBlockNotFound。
+	UnblockUser(ctx context.Context, userID, targetID uint) error
+	// ListBlockedUsers 返回用户的拉黑名单，最近拉黑的在前。
+	ListBlockedUsers(ctx context.Context, userID uint) ([]*BlockedUser, error)
+
+	// GetSettings 返回用户的隐私设置，从未修改过时返回默认设置。
+	GetSettings(ctx context.Context, userID uint) (*models.PrivacySettings, error)
+	// UpdateSettings 修改用户的隐私设置，返回修改后的完整设置。
+	UpdateSettings(ctx context.Context, userID uint, changes PrivacySettingsChanges) (*models.PrivacySettings, error)
+}
+
+// privacyService 是 PrivacyService 的实现。
+type privacyService struct {
+	privacyRepo    storage.PrivacyRepository
+	userRepo       storage.UserRepository
+	friendshipRepo storage.FriendshipRepository
+	friendRepo     storage.FriendRequestRepository
+	msgRepo        storage.MessageRepository
+}
+
+// NewPrivacyService 创建一个新的 PrivacyService 实例。
+func NewPrivacyService(privacyRepo storage.PrivacyRepository, userRepo storage.UserRepository, friendshipRepo storage.FriendshipRepository, friendRepo storage.FriendRequestRepository, msgRepo storage.MessageRepository) PrivacyService {
+	return &privacyService{
+		privacyRepo:    privacyRepo,
+		userRepo:       userRepo,
+		friendshipRepo: friendshipRepo,
+		friendRepo:     friendRepo,
+		msgRepo:        msgRepo,
+	}
+}
+
+// BlockUser 保存拉黑记录。双方之间的好友关系保留，但拉黑期间的私聊、好友请求和拉人入群都会被拒绝。
+func (s *privacyService) BlockUser(ctx context.Context, userID, targetID uint) error {
+	if userID == targetID {
+		return ErrBlockSelf
+	}
+	if _, err := s.userRepo.GetByID(ctx, targetID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("查询用户 %d 失败: %w", targetID, err)
+	}
+	if err := s.privacyRepo.AddBlock(ctx, &models.UserBlock{BlockerID: userID, BlockedID: targetID}); err != nil {
+		return fmt.Errorf("拉黑用户 %d 失败: %w", targetID, err)
+	}
+
+	pending, err := s.friendRepo.FindPendingRequest(ctx, userID, targetID)
+	if err != nil {
+		log.Printf("查询用户 %d 和 %d 之间待处理的好友请求失败: %v", userID, targetID, err)
+		return nil
+	}
+	if pending != nil {
+		if err := s.friendRepo.UpdateRequestStatus(ctx, pending.ID, models.FriendRequestStatusRejected); err != nil {
+			log.Printf("拒绝好友请求 %d 失败: %v", pending.ID, err)
+		}
+	}
+	return nil
+}
+
+// UnblockUser 删除拉黑记录。
+func (s *privacyService) UnblockUser(ctx context.Context, userID, targetID uint) error {
+	removed, err := s.privacyRepo.RemoveBlock(ctx, userID, targetID)
+	if err != nil {
+		return fmt.Errorf("取消拉黑用户 %d 失败: %w", targetID, err)
+	}
+	if !removed {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// ListBlockedUsers 返回拉黑名单及被拉黑用户的基本信息。
+func (s *privacyService) ListBlockedUsers(ctx context.Context, userID uint) ([]*BlockedUser, error) {
+	blocks, err := s.privacyRepo.ListBlocks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取拉黑名单失败: %w", err)
+	}
+	result := make([]*BlockedUser, 0, len(blocks))
+	for _, block := range blocks {
+		result = append(result, &BlockedUser{
+			UserBasicInfo: models.UserBasicInfo{
+				ID:        block.BlockedID,
+				Username:  block.Blocked.Username,
+				Nickname:  block.Blocked.Nickname,
+				AvatarURL: block.Blocked.AvatarURL,
+			},
+			BlockedAt: block.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// GetSettings 获取隐私设置，没有记录时返回默认设置。
+func (s *privacyService) GetSettings(ctx context.Context, userID uint) (*models.PrivacySettings, error) {
+	settings, err := s.privacyRepo.GetSettings(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultPrivacySettings(userID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的隐私设置失败: %w", userID, err)
+	}
+	return settings, nil
+}
+
+// UpdateSettings 校验并保存隐私设置。私聊权限只能是 everyone 或 friends，好友之间始终可以私聊。
+func (s *privacyService) UpdateSettings(ctx context.Context, userID uint, changes PrivacySettingsChanges) (*models.PrivacySettings, error) {
+	settings, err := s.GetSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if changes.SearchVisibility != nil {
+		if !validAudience(*changes.SearchVisibility) {
+			return nil, fmt.Errorf("%w: searchVisibility 只能是 everyone、friends 或 nobody", ErrInvalidPrivacySetting)
+		}
+		settings.SearchVisibility = *changes.SearchVisibility
+	}
+	if changes.MessagePermission != nil {
+		if *changes.MessagePermission != models.PrivacyEveryone && *changes.MessagePermission != models.PrivacyFriends {
+			return nil, fmt.Errorf("%w: messagePermission 只能是 everyone 或 friends", ErrInvalidPrivacySetting)
+		}
+		settings.MessagePermission = *changes.MessagePermission
+	}
+	if changes.GroupInvitePermission != nil {
+		if !validAudience(*changes.GroupInvitePermission) {
+			return nil, fmt.Errorf("%w: groupInvitePermission 只能是 everyone、friends 或 nobody", ErrInvalidPrivacySetting)
+		}
+		settings.GroupInvitePermission = *changes.GroupInvitePermission
+	}
+	settings.UserID = userID
+	if err := s.privacyRepo.SaveSettings(ctx, settings); err != nil {
+		return nil, fmt.Errorf("保存用户 %d 的隐私设置失败: %w", userID, err)
+	}
+	return settings, nil
+}
+
+// CheckFriendRequest 任一方拉黑对方时都不能发送好友请求。
+func (s *privacyService) CheckFriendRequest(ctx context.Context, requesterID, recipientID uint) error {
+	return s.checkNotBlocked(ctx, requesterID, recipientID)
+}
+
+// CheckPrivateMessage 检查拉黑关系和接收者的私聊权限。接收者只允许好友私聊时，
+// 非好友只有在接收者先在私聊中给他发过消息之后才能继续回复 (例如用户主动联系的机器人)。
+func (s *privacyService) CheckPrivateMessage(ctx context.Context, senderID, receiverID uint) error {
+	if err := s.checkNotBlocked(ctx, senderID, receiverID); err != nil {
+		return err
+	}
+	settings, err := s.GetSettings(ctx, receiverID)
+	if err != nil {
+		return err
+	}
+	if settings.MessagePermission != models.PrivacyFriends {
+		return nil
+	}
+	friends, err := s.friendshipRepo.AreUsersFriends(ctx, senderID, receiverID)
+	if err != nil {
+		return fmt.Errorf("检查好友关系失败: %w", err)
+	}
+	if friends {
+		return nil
+	}
+	replied, err := s.msgRepo.HasSentPrivateMessage(ctx, receiverID, senderID)
+	if err != nil {
+		return fmt.Errorf("查询私聊记录失败: %w", err)
+	}
+	if !replied {
+		return ErrPrivacyRestricted
+	}
+	return nil
+}
+
+// CheckGroupAdd 检查拉黑关系和被拉入者的入群邀请权限，用户把自己加入群组不受限制。
+func (s *privacyService) CheckGroupAdd(ctx context.Context, actorID, targetID uint) error {
+	if actorID == targetID {
+		return nil
+	}
+	if err := s.checkNotBlocked(ctx, actorID, targetID); err != nil {
+		return err
+	}
+	settings, err := s.GetSettings(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	switch settings.GroupInvitePermission {
+	case models.PrivacyNobody:
+		return ErrPrivacyRestricted
+	case models.PrivacyFriends:
+		friends, err := s.friendshipRepo.AreUsersFriends(ctx, actorID, targetID)
+		if err != nil {
+			return fmt.Errorf("检查好友关系失败: %w", err)
+		}
+		if !friends {
+			return ErrPrivacyRestricted
+		}
+	}
+	return nil
+}
+
+// CanSeePresence 未登录的访问者和被目标用户拉黑的用户看不到在线状态。
+func (s *privacyService) CanSeePresence(ctx context.Context, viewerID, targetID uint) (bool, error) {
+	if viewerID == targetID {
+		return true, nil
+	}
+	if viewerID == 0 {
+		return false, nil
+	}
+	blocked, err := s.privacyRepo.HasBlocked(ctx, targetID, viewerID)
+	if err != nil {
+		return false, fmt.Errorf("检查拉黑关系失败: %w", err)
+	}
+	return !blocked, nil
+}
+
+// hidePresence 在 viewerID 看不到 user 的在线状态时清空 Status 和 LastSeenAt。
+// 所有向其他用户返回用户信息的接口都应经过这里，而不是各自判断拉黑关系。
+func hidePresence(ctx context.Context, privacy PrivacyChecker, viewerID uint, user *models.User) error {
+	visible, err := privacy.CanSeePresence(ctx, viewerID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		user.Status = ""
+		user.LastSeenAt = nil
+	}
+	return nil
+}
+
+// checkNotBlocked 两个用户之间存在任一方向的拉黑时返回 ErrUserBlocked。
+func (s *privacyService) checkNotBlocked(ctx context.Context, userID1, userID2 uint) error {
+	blocked, err := s.privacyRepo.IsBlockedEitherWay(ctx, userID1, userID2)
+	if err != nil {
+		return fmt.Errorf("检查拉黑关系失败: %w", err)
+	}
+	if blocked {
+		return ErrUserBlocked
+	}
+	return nil
+}
+
+// validAudience 检查取值是否为 everyone、friends 或 nobody。
+func validAudience(audience models.PrivacyAudience) bool {
+	switch audience {
+	case models.PrivacyEveryone, models.PrivacyFriends, models.PrivacyNobody:
+		return true
+	}
+	return false
+}
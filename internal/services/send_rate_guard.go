@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/ratelimit"
+	"im-go/internal/storage"
+)
+
+// ErrRateLimited 表示消息因发送过于频繁被拒绝，具体信息见 RateLimitError。
+var ErrRateLimited = errors.New("发送过于频繁")
+
+const (
+	RateLimitScopeUser     = "user"      // 全局的单用户发送频率限制
+	RateLimitScopeSlowMode = "slow_mode" // 群组慢速模式
+)
+
+// RateLimitError 表示发送被限流拒绝。
+type RateLimitError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+// Error 实现 error 接口。
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v (%s)，请在 %d 秒后重试", ErrRateLimited, e.Scope, e.RetryAfterSeconds())
+}
+
+// Unwrap 使 errors.Is(err, ErrRateLimited) 成立。
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryAfterSeconds 返回向上取整的重试等待秒数，至少为 1。
+func (e *RateLimitError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// SendRateGuard 在消息进入 MessagesTopic 之前校验发送频率。
+type SendRateGuard interface {
+	// CheckSend 校验用户的全局发送频率，以及目标群组的慢速模式 (conversationID 为 0 时只校验全局频率)。
+	// 被拒绝时返回 *RateLimitError。
+	CheckSend(ctx context.Context, senderID, conversationID uint) error
+}
+
+// sendRateGuard 是基于 ratelimit.Limiter 的 SendRateGuard 实现。
+type sendRateGuard struct {
+	limiter   ratelimit.Limiter
+	convoRepo storage.ConversationRepository
+	groupRepo storage.GroupRepository
+	perms     GroupPermissionChecker
+	cfg       config.RateLimitConfig
+}
+
+// NewSendRateGuard 创建一个新的 SendRateGuard 实例。
+func NewSendRateGuard(limiter ratelimit.Limiter, convoRepo storage.ConversationRepository, groupRepo storage.GroupRepository, perms GroupPermissionChecker, cfg config.RateLimitConfig) SendRateGuard {
+	return &sendRateGuard{limiter: limiter, convoRepo: convoRepo, groupRepo: groupRepo, perms: perms, cfg: cfg}
+}
+
+// CheckSend 校验发送频率。限流存储不可用时放行，只记录日志，避免 Redis 故障导致无法发消息。
+func (g *sendRateGuard) CheckSend(ctx context.Context, senderID, conversationID uint) error {
+	// 1. 全局单用户限流 (先于慢速模式检查，被全局限流拒绝的消息不会占用慢速模式的发言间隔)
+	window := time.Duration(g.cfg.WindowSeconds) * time.Second
+	if err := g.allow(ctx, fmt.Sprintf("msg:user:%d", senderID), g.cfg.MessagesPerWindow, window, RateLimitScopeUser); err != nil {
+		return err
+	}
+
+	if conversationID == 0 {
+		return nil
+	}
+
+	// 2. 群组慢速模式
+	conversation, err := g.convoRepo.GetConversationByID(ctx, conversationID)
+	if err != nil || conversation.Type != models.GroupConversation {
+		// 会话不存在等错误交给后续的消息处理流程报告
+		return nil
+	}
+	group, err := g.groupRepo.GetGroupByID(ctx, conversation.TargetID)
+	if err != nil || group.SlowModeSeconds <= 0 {
+		return nil
+	}
+	if member, err := g.perms.Member(ctx, group.ID, senderID); err == nil && member.Role.AtLeast(models.ModeratorRole) {
+		return nil
+	}
+	slowKey := fmt.Sprintf("msg:slow:%d:%d", conversationID, senderID)
+	return g.allow(ctx, slowKey, 1, time.Duration(group.SlowModeSeconds)*time.Second, RateLimitScopeSlowMode)
+}
+
+// allow 执行一次限流检查，拒绝时返回 *RateLimitError。
+func (g *sendRateGuard) allow(ctx context.Context, key string, limit int, window time.Duration, scope string) error {
+	result, err := g.limiter.Allow(ctx, key, limit, window)
+	if err != nil {
+		log.Printf("限流检查失败，放行本次发送 (key=%s): %v", key, err)
+		return nil
+	}
+	if !result.Allowed {
+		return &RateLimitError{Scope: scope, RetryAfter: result.RetryAfter}
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+	"im-go/internal/imtypes"
+	appKafka "im-go/internal/kafka"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，会话已被吊销")
+	ErrSessionNotFound     = errors.New("会话未找到")
+)
+
+// secureTokenBytes 是刷新令牌等不透明令牌的随机字节数。
+const secureTokenBytes = 32
+
+// SessionClientInfo 是发起登录或刷新的客户端信息，记录在会话中用于展示。
+type SessionClientInfo struct {
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+}
+
+// AuthTokens 是一次登录或刷新签发的令牌。
+type AuthTokens struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+	SessionID             uint
+}
+
+// SessionService 定义了登录会话及刷新令牌相关服务的接口。
+// 每次登录创建一个会话，访问令牌 (JWT) 短期有效，刷新令牌只保存哈希并在每次使用后轮换；
+// 已使用过的刷新令牌被再次提交时视为泄露，整个会话被吊销。
+type SessionService interface {
+	// StartSession 为已通过认证的用户创建会话并签发首对令牌。
+	StartSession(ctx context.Context, user *models.User, client SessionClientInfo) (*AuthTokens, error)
+	// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌。
+	Refresh(ctx context.Context, refreshToken string, client SessionClientInfo) (*AuthTokens, *models.User, error)
+
+	ListSessions(ctx context.Context, userID uint) ([]*models.Session, error)
+	// RevokeSession 吊销用户的一个会话：使其刷新令牌和已签发的访问令牌失效，并断开该会话的 WebSocket 连接。
+	RevokeSession(ctx context.Context, userID, sessionID uint) error
+	// RevokeAllSessions 吊销用户除 exceptSessionID 外的所有会话 (exceptSessionID 为 0 时吊销全部)，返回吊销的数量。
+	RevokeAllSessions(ctx context.Context, userID, exceptSessionID uint) (int, error)
+}
+
+// sessionService 是 SessionService 的实现。
+type sessionService struct {
+	sessionRepo storage.SessionRepository
+	userRepo    storage.UserRepository
+	keys        auth.KeyManager
+	blacklist   auth.TokenBlacklist
+	producer    appKafka.MessageProducer // 用于通知 ChatServer 断开被吊销会话的连接
+	cfg         config.Config
+}
+
+// NewSessionService 创建一个新的 SessionService 实例。
+func NewSessionService(sessionRepo storage.SessionRepository, userRepo storage.UserRepository, keys auth.KeyManager, blacklist auth.TokenBlacklist, producer appKafka.MessageProducer, cfg config.Config) SessionService {
+	return &sessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		keys:        keys,
+		blacklist:   blacklist,
+		producer:    producer,
+		cfg:         cfg,
+	}
+}
+
+// StartSession 创建会话并签发令牌。
+func (s *sessionService) StartSession(ctx context.Context, user *models.User, client SessionClientInfo) (*AuthTokens, error) {
+	var tokens *AuthTokens
+	err := s.sessionRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := storage.NewGormSessionRepository(tx)
+
+		now := time.Now()
+		session := &models.Session{
+			UserID:     user.ID,
+			DeviceName: client.DeviceName,
+			IPAddress:  client.IPAddress,
+			UserAgent:  client.UserAgent,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(s.cfg.Auth.RefreshTokenExpiry),
+		}
+		if err := txRepo.CreateSession(ctx, session); err != nil {
+			return fmt.Errorf("创建会话失败: %w", err)
+		}
+
+		var err error
+		tokens, err = s.issueTokens(ctx, txRepo, session, user, client)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Refresh 轮换刷新令牌。
+func (s *sessionService) Refresh(ctx context.Context, refreshToken string, client SessionClientInfo) (*AuthTokens, *models.User, error) {
+	if refreshToken == "" {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	stored, err := s.sessionRepo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("查找刷新令牌失败: %w", err)
+	}
+	session, err := s.sessionRepo.GetSessionByID(ctx, stored.SessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("查找会话 %d 失败: %w", stored.SessionID, err)
+	}
+	if session.RevokedAt != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if stored.UsedAt != nil {
+		// 旧令牌被重放：令牌族可能已泄露，吊销整个会话，合法持有者需要重新登录
+		log.Printf("检测到会话 %d (用户 %d) 的刷新令牌被重复使用，吊销该会话", session.ID, session.UserID)
+		s.revoke(ctx, session)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取会话用户 %d 失败: %w", session.UserID, err)
+	}
+
+	var tokens *AuthTokens
+	reused := false
+	err = s.sessionRepo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := storage.NewGormSessionRepository(tx)
+		marked, err := txRepo.MarkRefreshTokenUsed(ctx, stored.ID, now)
+		if err != nil {
+			return fmt.Errorf("标记刷新令牌失败: %w", err)
+		}
+		if !marked {
+			// 并发请求已经使用了该令牌
+			reused = true
+			return nil
+		}
+		tokens, err = s.issueTokens(ctx, txRepo, session, user, client)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if reused {
+		log.Printf("检测到会话 %d (用户 %d) 的刷新令牌被并发重复使用，吊销该会话", session.ID, session.UserID)
+		s.revoke(ctx, session)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	return tokens, user, nil
+}
+
+// ListSessions 获取用户的有效会话。
+func (s *sessionService) ListSessions(ctx context.Context, userID uint) ([]*models.Session, error) {
+	sessions, err := s.sessionRepo.GetActiveSessions(ctx, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的会话失败: %w", userID, err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的一个会话。会话不属于该用户时与不存在一样返回 ErrSessionNotFound。
+func (s *sessionService) RevokeSession(ctx context.Context, userID, sessionID uint) error {
+	session, err := s.sessionRepo.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("获取会话 %d 失败: %w", sessionID, err)
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	return s.revoke(ctx, session)
+}
+
+// RevokeAllSessions 吊销用户的所有有效会话。
+func (s *sessionService) RevokeAllSessions(ctx context.Context, userID, exceptSessionID uint) (int, error) {
+	sessions, err := s.sessionRepo.GetActiveSessions(ctx, userID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("获取用户 %d 的会话失败: %w", userID, err)
+	}
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == exceptSessionID {
+			continue
+		}
+		if err := s.revoke(ctx, session); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// issueTokens 为会话签发新的访问令牌和刷新令牌，并记录到会话中。
+func (s *sessionService) issueTokens(ctx context.Context, repo storage.SessionRepository, session *models.Session, user *models.User, client SessionClientInfo) (*AuthTokens, error) {
+	accessToken, claims, err := auth.GenerateToken(ctx, user.ID, user.Username, session.ID, s.cfg.Auth, s.keys)
+	if err != nil {
+		return nil, fmt.Errorf("生成令牌失败: %w", err)
+	}
+	refreshToken, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refreshExpiresAt := now.Add(s.cfg.Auth.RefreshTokenExpiry)
+	if err := repo.CreateRefreshToken(ctx, &models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: refreshExpiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("保存刷新令牌失败: %w", err)
+	}
+
+	session.LastUsedAt = now
+	session.ExpiresAt = refreshExpiresAt
+	session.AccessTokenID = claims.ID
+	session.AccessTokenExpiresAt = claims.ExpiresAt.Time
+	if client.IPAddress != "" {
+		session.IPAddress = client.IPAddress
+	}
+	if client.UserAgent != "" {
+		session.UserAgent = client.UserAgent
+	}
+	if err := repo.UpdateSessionTokens(ctx, session); err != nil {
+		return nil, fmt.Errorf("更新会话 %d 失败: %w", session.ID, err)
+	}
+
+	return &AuthTokens{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  session.AccessTokenExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+		SessionID:             session.ID,
+	}, nil
+}
+
+// revoke 吊销会话：标记数据库记录，将当前访问令牌和会话加入黑名单，并通知 ChatServer 断开连接。
+func (s *sessionService) revoke(ctx context.Context, session *models.Session) error {
+	now := time.Now()
+	revoked, err := s.sessionRepo.RevokeSession(ctx, session.ID, now)
+	if err != nil {
+		return fmt.Errorf("吊销会话 %d 失败: %w", session.ID, err)
+	}
+	if !revoked {
+		return nil // 已被其他请求吊销
+	}
+	session.RevokedAt = &now
+
+	if session.AccessTokenID != "" {
+		if err := s.blacklist.Add(ctx, session.AccessTokenID, session.AccessTokenExpiresAt); err != nil {
+			log.Printf("将会话 %d 的访问令牌加入黑名单失败: %v", session.ID, err)
+		}
+	}
+	// 会话轮换过的旧访问令牌最长在 JWTExpiry 内仍然有效，用会话标记覆盖它们
+	if err := s.blacklist.Add(ctx, auth.SessionRevocationID(session.ID), now.Add(s.cfg.Auth.JWTExpiry)); err != nil {
+		log.Printf("将会话 %d 加入黑名单失败: %v", session.ID, err)
+	}
+
+	envelope := imtypes.BroadcastEnvelope{
+		Kind:      imtypes.BroadcastSessionRevoked,
+		UserID:    session.UserID,
+		SessionID: session.ID,
+	}
+	if err := publishBroadcast(ctx, s.producer, s.cfg.Kafka.BroadcastTopic, &envelope); err != nil {
+		log.Printf("发布会话 %d 的吊销通知失败: %v", session.ID, err)
+	}
+	return nil
+}
+
+// generateSecureToken 生成一个随机的不透明令牌 (刷新令牌、邮件中的一次性令牌)。
+func generateSecureToken() (string, error) {
+	buf := make([]byte, secureTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机令牌失败: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 返回不透明令牌的 SHA-256 哈希，数据库中只保存哈希。
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+)
+
+const (
+	// signingKeyReloadInterval 是从数据库重新加载密钥的周期，使多个 API 服务器实例看到彼此的轮换。
+	signingKeyReloadInterval = time.Minute
+	// signingKeyMissReload 是遇到未知 kid 时重新加载的最小间隔。
+	signingKeyMissReload = 10 * time.Second
+	// signingKeyExpiryLeeway 是退役密钥在最后一个令牌过期后额外保留的时间，覆盖各节点间的时钟偏差。
+	signingKeyExpiryLeeway = 5 * time.Minute
+	// signingKeyCleanupDelay 是过期密钥在物理删除前保留的时间。
+	signingKeyCleanupDelay = 24 * time.Hour
+)
+
+// SigningKeyManager 是保存在数据库中的、定期轮换的 JWT 签名密钥集合。
+type SigningKeyManager interface {
+	auth.KeyManager
+	// Run 定期重新加载并按 JWTKeyRotationInterval 轮换签名密钥，直到 ctx 结束。
+	Run(ctx context.Context)
+}
+
+// signingKeyManager 是 SigningKeyManager 的实现，密钥缓存在内存中。
+type signingKeyManager struct {
+	repo storage.SigningKeyRepository
+	cfg  config.AuthConfig
+
+	mu               sync.RWMutex
+	keys             map[string]*auth.SigningKey // 可用于验证的密钥，按 kid 索引
+	current          *auth.SigningKey            // 当前签名密钥
+	currentCreatedAt time.Time
+	jwks             *auth.JWKS
+	loadedAt         time.Time
+}
+
+// NewSigningKeyManager 加载签名密钥，没有可用的签名密钥 (或算法配置已变更) 时立即生成一把。
+func NewSigningKeyManager(ctx context.Context, repo storage.SigningKeyRepository, cfg config.AuthConfig) (SigningKeyManager, error) {
+	m := &signingKeyManager{repo: repo, cfg: cfg}
+	if err := m.reload(ctx); err != nil {
+		return nil, err
+	}
+	if m.needsRotation(time.Now()) {
+		if err := m.rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// VerificationKey 按 kid 返回公钥。
+func (m *signingKeyManager) VerificationKey(ctx context.Context, kid, alg string) (interface{}, error) {
+	key := m.lookup(kid)
+	if key == nil && m.sinceLoad() > signingKeyMissReload {
+		// 可能是其他实例刚轮换出的新密钥
+		if err := m.reload(ctx); err != nil {
+			log.Printf("重新加载签名密钥失败: %v", err)
+		}
+		key = m.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", auth.ErrUnknownSigningKey, kid)
+	}
+	if key.Algorithm != alg {
+		return nil, fmt.Errorf("令牌算法 %s 与密钥 %s 的算法 %s 不一致", alg, kid, key.Algorithm)
+	}
+	return key.PublicKey, nil
+}
+
+// CurrentSigningKey 返回当前签名密钥。
+func (m *signingKeyManager) CurrentSigningKey(ctx context.Context) (*auth.SigningKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.current == nil {
+		return nil, fmt.Errorf("没有可用的签名密钥")
+	}
+	return m.current, nil
+}
+
+// JWKS 返回所有可用于验证的公钥。
+func (m *signingKeyManager) JWKS(ctx context.Context) (*auth.JWKS, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.jwks, nil
+}
+
+// Run 定期重新加载、轮换和清理密钥。
+func (m *signingKeyManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(signingKeyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.reload(ctx); err != nil {
+				log.Printf("重新加载签名密钥失败: %v", err)
+				continue
+			}
+			if m.needsRotation(time.Now()) {
+				if err := m.rotate(ctx); err != nil {
+					log.Printf("轮换签名密钥失败: %v", err)
+				}
+			}
+			if deleted, err := m.repo.DeleteExpiredSigningKeys(ctx, time.Now().Add(-signingKeyCleanupDelay)); err != nil {
+				log.Printf("清理过期签名密钥失败: %v", err)
+			} else if deleted > 0 {
+				log.Printf("已清理 %d 把过期的签名密钥", deleted)
+			}
+		}
+	}
+}
+
+// needsRotation 判断是否需要生成新的签名密钥。
+func (m *signingKeyManager) needsRotation(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.current == nil || m.current.Algorithm != m.cfg.JWTSigningAlgorithm {
+		return true
+	}
+	return m.cfg.JWTKeyRotationInterval > 0 && now.Sub(m.currentCreatedAt) >= m.cfg.JWTKeyRotationInterval
+}
+
+// rotate 生成并保存新的签名密钥，旧密钥退役但在其签发的令牌过期前仍可用于验证。
+func (m *signingKeyManager) rotate(ctx context.Context) error {
+	key, err := auth.GenerateSigningKey(m.cfg.JWTSigningAlgorithm)
+	if err != nil {
+		return err
+	}
+	privateKeyPEM, err := auth.EncodePrivateKeyPEM(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	record := &models.SigningKey{
+		KeyID:         key.ID,
+		Algorithm:     key.Algorithm,
+		PrivateKeyPEM: privateKeyPEM,
+	}
+	retiredExpiresAt := time.Now().Add(m.cfg.JWTExpiry + signingKeyExpiryLeeway)
+	if err := m.repo.RotateSigningKey(ctx, record, retiredExpiresAt); err != nil {
+		return fmt.Errorf("保存签名密钥失败: %w", err)
+	}
+	log.Printf("已生成新的 JWT 签名密钥 (kid=%s, alg=%s)", key.ID, key.Algorithm)
+	return m.reload(ctx)
+}
+
+// reload 从数据库加载所有可用于验证的密钥。
+func (m *signingKeyManager) reload(ctx context.Context) error {
+	records, err := m.repo.GetVerificationKeys(ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("加载签名密钥失败: %w", err)
+	}
+
+	keys := make(map[string]*auth.SigningKey, len(records))
+	jwks := &auth.JWKS{Keys: make([]auth.JWK, 0, len(records))}
+	var current *auth.SigningKey
+	var currentCreatedAt time.Time
+	for _, record := range records {
+		key, err := auth.ParseSigningKeyPEM(record.KeyID, record.Algorithm, record.PrivateKeyPEM)
+		if err != nil {
+			log.Printf("跳过无法解析的签名密钥: %v", err)
+			continue
+		}
+		jwk, err := auth.NewJWK(key)
+		if err != nil {
+			log.Printf("跳过无法发布的签名密钥: %v", err)
+			continue
+		}
+		keys[key.ID] = key
+		jwks.Keys = append(jwks.Keys, jwk)
+		// records 按创建时间倒序，第一把未退役的密钥用于签名
+		if current == nil && record.RetiredAt == nil {
+			current, currentCreatedAt = key, record.CreatedAt
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.jwks = jwks
+	m.current = current
+	m.currentCreatedAt = currentCreatedAt
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return nil
+}
+
+// lookup 在缓存中查找密钥。
+func (m *signingKeyManager) lookup(kid string) *auth.SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+// sinceLoad 返回距上次加载的时间。
+func (m *signingKeyManager) sinceLoad() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Since(m.loadedAt)
+}
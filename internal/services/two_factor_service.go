@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/ratelimit"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled   = errors.New("已开启两步验证")
+	ErrTwoFactorNotEnabled       = errors.New("未开启两步验证")
+	ErrTwoFactorNotEnrolling     = errors.New("请先获取两步验证密钥")
+	ErrInvalidTwoFactorCode      = errors.New("验证码无效")
+	ErrInvalidTwoFactorChallenge = errors.New("登录验证已失效，请重新登录")
+	// ErrTooManyAttempts 表示验证尝试过于频繁，具体信息见 AttemptLimitError。
+	ErrTooManyAttempts = errors.New("尝试次数过多")
+)
+
+const (
+	// recoveryCodeCount 是每次生成的恢复码数量。
+	recoveryCodeCount = 10
+	// recoveryCodeLength 是恢复码的字符数 (不含分隔符)，每个字符 5 位随机数。
+	recoveryCodeLength = 10
+)
+
+// recoveryCodeEncoding 是生成恢复码使用的小写 Base32 字母表。
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// AttemptLimitError 表示验证尝试被限流拒绝。
+type AttemptLimitError struct {
+	RetryAfter time.Duration
+}
+
+// Error 实现 error 接口。
+func (e *AttemptLimitError) Error() string {
+	return fmt.Sprintf("%v，请在 %d 秒后重试", ErrTooManyAttempts, e.RetryAfterSeconds())
+}
+
+// Unwrap 使 errors.Is(err, ErrTooManyAttempts) 成立。
+func (e *AttemptLimitError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// RetryAfterSeconds 返回向上取整的重试等待秒数，至少为 1。
+func (e *AttemptLimitError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// TwoFactorStatus 是用户两步验证的开启状态。
+type TwoFactorStatus struct {
+	Enabled                bool
+	EnabledAt              *time.Time
+	RecoveryCodesRemaining int
+}
+
+// TOTPEnrollment 是开始绑定验证器应用时返回的密钥，用户扫码或手动输入后提交验证码完成绑定。
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// TwoFactorChallenge 是开启两步验证的用户通过密码校验后得到的登录挑战，提交验证码后才签发令牌。
+type TwoFactorChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// TwoFactorService 定义了 TOTP 两步验证相关服务的接口。
+// 验证码既可以是验证器应用生成的 6 位 TOTP，也可以是一次性的恢复码 (绑定确认时除外)；
+// 每个用户提交验证码的次数受 AuthConfig.TwoFactorMaxAttempts 限制，超出时返回 *AttemptLimitError。
+type TwoFactorService interface {
+	Status(ctx context.Context, userID uint) (*TwoFactorStatus, error)
+	// IsEnabled 判断用户是否已开启两步验证。
+	IsEnabled(ctx context.Context, userID uint) (bool, error)
+	// BeginEnrollment 为用户生成新的 TOTP 密钥，未确认前不生效；重复调用会替换尚未确认的密钥。
+	BeginEnrollment(ctx context.Context, userID uint) (*TOTPEnrollment, error)
+	// ConfirmEnrollment 校验验证器应用生成的验证码并开启两步验证，返回一组新的恢复码 (只返回这一次)。
+	ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error)
+	// RegenerateRecoveryCodes 校验验证码后生成一组新的恢复码，旧的恢复码全部失效。
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error)
+	// Disable 校验验证码或恢复码后关闭两步验证。
+	Disable(ctx context.Context, userID uint, code string) error
+
+	// CreateChallenge 为通过密码校验的用户创建登录挑战。
+	CreateChallenge(ctx context.Context, user *models.User) (*TwoFactorChallenge, error)
+	// CompleteChallenge 校验验证码，通过后为客户端创建登录会话。
+	CompleteChallenge(ctx context.Context, challengeToken, code string, client SessionClientInfo) (*AuthTokens, *models.User, error)
+}
+
+// twoFactorService 是 TwoFactorService 的实现。
+type twoFactorService struct {
+	repo      storage.TwoFactorRepository
+	tokenRepo storage.UserTokenRepository
+	userRepo  storage.UserRepository
+	sessions  SessionService
+	limiter   ratelimit.Limiter
+	cfg       config.Config
+}
+
+// NewTwoFactorService 创建一个新的 TwoFactorService 实例。
+func NewTwoFactorService(repo storage.TwoFactorRepository, tokenRepo storage.UserTokenRepository, userRepo storage.UserRepository, sessions SessionService, limiter ratelimit.Limiter, cfg config.Config) TwoFactorService {
+	return &twoFactorService{
+		repo:      repo,
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+		sessions:  sessions,
+		limiter:   limiter,
+		cfg:       cfg,
+	}
+}
+
+// Status 返回两步验证状态。
+func (s *twoFactorService) Status(ctx context.Context, userID uint) (*TwoFactorStatus, error) {
+	credential, err := s.credential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !credential.IsEnabled() {
+		return &TwoFactorStatus{}, nil
+	}
+	codes, err := s.repo.GetUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户 %d 的恢复码失败: %w", userID, err)
+	}
+	return &TwoFactorStatus{Enabled: true, EnabledAt: credential.EnabledAt, RecoveryCodesRemaining: len(codes)}, nil
+}
+
+// IsEnabled 判断是否已开启两步验证。
+func (s *twoFactorService) IsEnabled(ctx context.Context, userID uint) (bool, error) {
+	credential, err := s.credential(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return credential.IsEnabled(), nil
+}
+
+// BeginEnrollment 生成待确认的 TOTP 密钥。
+func (s *twoFactorService) BeginEnrollment(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("获取用户 %d 失败: %w", userID, err)
+	}
+	credential, err := s.credential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.IsEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		credential = &models.TOTPCredential{UserID: userID}
+	}
+	credential.Secret = secret
+	credential.LastUsedStep = 0
+	if err := s.repo.SaveTOTPCredential(ctx, credential); err != nil {
+		return nil, fmt.Errorf("保存用户 %d 的 TOTP 密钥失败: %w", userID, err)
+	}
+
+	accountName := user.Username
+	if user.Email != "" {
+		accountName = user.Email
+	}
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(s.cfg.AppName, accountName, secret),
+	}, nil
+}
+
+// ConfirmEnrollment 开启两步验证。只接受 TOTP 验证码，以确认验证器应用已正确绑定。
+func (s *twoFactorService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	credential, err := s.credential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	if credential.IsEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if err := s.verifyCode(ctx, credential, code, false); err != nil {
+		return nil, err
+	}
+
+	codes, records, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = s.repo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := storage.NewGormTwoFactorRepository(tx)
+		credential.EnabledAt = &now
+		if err := txRepo.SaveTOTPCredential(ctx, credential); err != nil {
+			return err
+		}
+		return txRepo.ReplaceRecoveryCodes(ctx, userID, records)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("为用户 %d 开启两步验证失败: %w", userID, err)
+	}
+	log.Printf("用户 %d 开启了两步验证", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码。
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	credential, err := s.enabledCredential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyCode(ctx, credential, code, false); err != nil {
+		return nil, err
+	}
+	codes, records, err := generateRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, records); err != nil {
+		return nil, fmt.Errorf("保存用户 %d 的恢复码失败: %w", userID, err)
+	}
+	return codes, nil
+}
+
+// Disable 关闭两步验证，删除密钥和恢复码，并使未完成的登录挑战失效。
+func (s *twoFactorService) Disable(ctx context.Context, userID uint, code string) error {
+	credential, err := s.enabledCredential(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyCode(ctx, credential, code, true); err != nil {
+		return err
+	}
+	err = s.repo.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		txRepo := storage.NewGormTwoFactorRepository(tx)
+		if err := txRepo.DeleteTOTPCredential(ctx, userID); err != nil {
+			return err
+		}
+		if err := txRepo.DeleteRecoveryCodes(ctx, userID); err != nil {
+			return err
+		}
+		return storage.NewGormUserTokenRepository(tx).InvalidateTokens(ctx, userID, models.TwoFactorChallengeToken, time.Now())
+	})
+	if err != nil {
+		return fmt.Errorf("为用户 %d 关闭两步验证失败: %w", userID, err)
+	}
+	log.Printf("用户 %d 关闭了两步验证", userID)
+	return nil
+}
+
+// CreateChallenge 创建登录挑战，挑战令牌只保存哈希。
+func (s *twoFactorService) CreateChallenge(ctx context.Context, user *models.User) (*TwoFactorChallenge, error) {
+	token, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.Auth.TwoFactorChallengeExpiry)
+	if err := s.tokenRepo.CreateToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   models.TwoFactorChallengeToken,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("保存用户 %d 的登录挑战失败: %w", user.ID, err)
+	}
+	return &TwoFactorChallenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// CompleteChallenge 完成登录挑战。验证码错误时挑战仍然有效，可以在有效期和次数限制内重试。
+func (s *twoFactorService) CompleteChallenge(ctx context.Context, challengeToken, code string, client SessionClientInfo) (*AuthTokens, *models.User, error) {
+	if challengeToken == "" {
+		return nil, nil, ErrInvalidTwoFactorChallenge
+	}
+	challenge, err := s.tokenRepo.GetTokenByHash(ctx, hashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidTwoFactorChallenge
+		}
+		return nil, nil, fmt.Errorf("查找登录挑战失败: %w", err)
+	}
+	if challenge.Purpose != models.TwoFactorChallengeToken || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) {
+		return nil, nil, ErrInvalidTwoFactorChallenge
+	}
+
+	credential, err := s.credential(ctx, challenge.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !credential.IsEnabled() {
+		return nil, nil, ErrInvalidTwoFactorChallenge // 创建挑战后关闭了两步验证
+	}
+	if err := s.verifyCode(ctx, credential, code, true); err != nil {
+		return nil, nil, err
+	}
+
+	marked, err := s.tokenRepo.MarkTokenUsed(ctx, challenge.ID, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("标记登录挑战失败: %w", err)
+	}
+	if !marked {
+		return nil, nil, ErrInvalidTwoFactorChallenge // 并发请求已完成该挑战
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidTwoFactorChallenge
+		}
+		return nil, nil, fmt.Errorf("获取用户 %d 失败: %w", challenge.UserID, err)
+	}
+	tokens, err := s.sessions.StartSession(ctx, user, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建登录会话失败: %w", err)
+	}
+	return tokens, user, nil
+}
+
+// verifyCode 校验 TOTP 验证码，allowRecovery 为 true 时也接受恢复码。每次调用都计入尝试次数。
+func (s *twoFactorService) verifyCode(ctx context.Context, credential *models.TOTPCredential, code string, allowRecovery bool) error {
+	if err := s.allowAttempt(ctx, credential.UserID); err != nil {
+		return err
+	}
+
+	code = normalizeTwoFactorCode(code)
+	if step, ok := auth.ValidateTOTP(credential.Secret, code, time.Now()); ok {
+		updated, err := s.repo.UpdateTOTPLastUsedStep(ctx, credential.ID, step)
+		if err != nil {
+			return fmt.Errorf("记录验证码使用失败: %w", err)
+		}
+		if !updated {
+			return ErrInvalidTwoFactorCode // 该验证码已经使用过
+		}
+		credential.LastUsedStep = step
+		return nil
+	}
+	if !allowRecovery || len(code) != recoveryCodeLength {
+		return ErrInvalidTwoFactorCode
+	}
+
+	codes, err := s.repo.GetUnusedRecoveryCodes(ctx, credential.UserID)
+	if err != nil {
+		return fmt.Errorf("获取用户 %d 的恢复码失败: %w", credential.UserID, err)
+	}
+	codeHash := hashToken(code)
+	for _, recoveryCode := range codes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCode.CodeHash), []byte(codeHash)) != 1 {
+			continue
+		}
+		marked, err := s.repo.MarkRecoveryCodeUsed(ctx, recoveryCode.ID, time.Now())
+		if err != nil {
+			return fmt.Errorf("标记恢复码失败: %w", err)
+		}
+		if !marked {
+			return ErrInvalidTwoFactorCode
+		}
+		log.Printf("用户 %d 使用了一个恢复码，剩余 %d 个", credential.UserID, len(codes)-1)
+		return nil
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// allowAttempt 检查用户提交验证码的次数。限流存储不可用时放行，只记录日志。
+func (s *twoFactorService) allowAttempt(ctx context.Context, userID uint) error {
+	key := fmt.Sprintf("2fa:user:%d", userID)
+	result, err := s.limiter.Allow(ctx, key, s.cfg.Auth.TwoFactorMaxAttempts, s.cfg.Auth.TwoFactorAttemptWindow)
+	if err != nil {
+		log.Printf("两步验证限流检查失败，放行本次验证 (key=%s): %v", key, err)
+		return nil
+	}
+	if !result.Allowed {
+		return &AttemptLimitError{RetryAfter: result.RetryAfter}
+	}
+	return nil
+}
+
+// credential 获取用户的 TOTP 密钥，不存在时返回 nil。
+func (s *twoFactorService) credential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	credential, err := s.repo.GetTOTPCredential(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取用户 %d 的 TOTP 密钥失败: %w", userID, err)
+	}
+	return credential, nil
+}
+
+// enabledCredential 获取已开启的 TOTP 密钥，未开启时返回 ErrTwoFactorNotEnabled。
+func (s *twoFactorService) enabledCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	credential, err := s.credential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !credential.IsEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	return credential, nil
+}
+
+// generateRecoveryCodes 生成一组恢复码，返回展示给用户的明文 (形如 abcde-fghij) 和待保存的哈希记录。
+func generateRecoveryCodes(userID uint) ([]string, []*models.RecoveryCode, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]*models.RecoveryCode, 0, recoveryCodeCount)
+	buf := make([]byte, (recoveryCodeLength*5+7)/8)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("生成恢复码失败: %w", err)
+		}
+		code := recoveryCodeEncoding.EncodeToString(buf)[:recoveryCodeLength]
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		records = append(records, &models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+	}
+	return codes, records, nil
+}
+
+// normalizeTwoFactorCode 去掉用户输入中的空格和分隔符，恢复码不区分大小写。
+func normalizeTwoFactorCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	return strings.ToLower(code)
+}
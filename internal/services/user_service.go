@@ -12,6 +12,9 @@ import (
 // UserService 定义了用户相关服务的接口。
 type UserService interface {
 	GetUserProfile(ctx context.Context, userID uint) (*models.User, error)
+	// GetPublicProfile 获取 viewerID 看到的 userID 的资料，viewerID 为 0 表示未登录的访问者。
+	// 未登录的访问者和被该用户拉黑的用户看不到在线状态 (status、lastSeenAt)。
+	GetPublicProfile(ctx context.Context, viewerID, userID uint) (*models.User, error)
 	UpdateUserProfile(ctx context.Context, userID uint, nickname, avatarURL, bio string) (*models.User, error)
 	// UpdateUserStatus(ctx context.Context, userID uint, status string) error
 	// AddContact(ctx context.Context, userID, contactID uint) error
@@ -23,12 +26,13 @@ type UserService interface {
 // userService 是 UserService 的实现。
 type userService struct {
 	userRepo storage.UserRepository
+	privacy  PrivacyChecker
 	// 可能需要其他 repository，例如 ContactRepository
 }
 
 // NewUserService 创建一个新的 UserService 实例。
-func NewUserService(userRepo storage.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo storage.UserRepository, privacy PrivacyChecker) UserService {
+	return &userService{userRepo: userRepo, privacy: privacy}
 }
 
 // GetUserProfile 获取用户公开的个人资料。
@@ -43,6 +47,18 @@ func (s *userService) GetUserProfile(ctx context.Context, userID uint) (*models.
 	return user, nil
 }
 
+// GetPublicProfile 获取用户资料，并按拉黑关系隐藏在线状态。
+func (s *userService) GetPublicProfile(ctx context.Context, viewerID, userID uint) (*models.User, error) {
+	user, err := s.GetUserProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := hidePresence(ctx, s.privacy, viewerID, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // UpdateUserProfile 更新用户的个人资料。
 func (s *userService) UpdateUserProfile(ctx context.Context, userID uint, nickname, avatarURL, bio string) (*models.User, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
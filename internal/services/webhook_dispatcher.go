@@ -0,0 +1,457 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"im-go/internal/config"
+	"im-go/internal/imtypes"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Webhook 请求头。签名为 HMAC-SHA256(Secret, 时间戳 + "." + 请求体) 的十六进制形式，加上 "sha256=" 前缀。
+const (
+	WebhookEventHeader     = "X-IM-Webhook-Event"
+	WebhookDeliveryHeader  = "X-IM-Webhook-Delivery"
+	WebhookTimestampHeader = "X-IM-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-IM-Webhook-Signature"
+)
+
+const (
+	// webhookBatchSize 是投递任务每轮取出的到期记录数。
+	webhookBatchSize = 100
+	// webhookMaxResponseBytes 是读取事件投递响应体的上限，响应内容只用于记录错误。
+	webhookMaxResponseBytes = 1024
+	// webhookMaxErrorLength 是投递记录中错误信息的最大长度，与数据库字段一致。
+	webhookMaxErrorLength = 1024
+)
+
+// errWebhookAddressNotAllowed 表示端点解析到了不允许投递的地址。
+var errWebhookAddressNotAllowed = errors.New("Webhook 地址解析到了内网或保留地址")
+
+// WebhookEvent 是投递给 Webhook 的请求体。
+// 同一事件投递到多个 Webhook 时 ID 相同，重试时请求体不变，接收方可以按 ID 去重。
+type WebhookEvent struct {
+	ID             string                  `json:"id"`
+	Type           models.WebhookEventType `json:"type"`
+	CreatedAt      time.Time               `json:"createdAt"`
+	ConversationID uint                    `json:"conversationId"`
+	GroupID        uint                    `json:"groupId,omitempty"`
+	Message        *imtypes.Message        `json:"message,omitempty"` // message.created 事件的消息
+	UserID         uint                    `json:"userId,omitempty"`  // member.* 事件的成员，command.invoked 和 button.clicked 事件的操作者
+
+	Command   string `json:"command,omitempty"`   // command.invoked 和 button.clicked 事件的命令名
+	Args      string `json:"args,omitempty"`      // command.invoked 事件中命令名之后的文本
+	MessageID uint   `json:"messageId,omitempty"` // button.clicked 事件中被点击的消息
+	ButtonID  string `json:"buttonId,omitempty"`  // button.clicked 事件中被点击的按钮
+}
+
+// WebhookDispatcher 把 Kafka 上的会话事件转换为 Webhook 投递记录，并负责投递和重试。
+// HandleBroadcast 和 HandleOutgoing 作为 Kafka 消费者的处理函数，所有 API 服务器实例使用同一个消费组，
+// 每个事件只生成一次投递记录；Run 在每个实例上运行，通过条件更新认领到期的记录。
+// 处理函数返回的错误不会让消费者重新投递该消息，调用方应使用 kafka.RetryHandler 包装以重试暂时性错误。
+type WebhookDispatcher interface {
+	// HandleBroadcast 处理广播主题：群聊消息和成员变更。
+	HandleBroadcast(ctx context.Context, msg *kafka.Message) error
+	// HandleOutgoing 处理出站主题：发给机器人的私聊消息。
+	HandleOutgoing(ctx context.Context, msg *kafka.Message) error
+	// Run 按 PollInterval 投递到期的记录，直到 ctx 被取消。
+	Run(ctx context.Context)
+}
+
+// webhookDispatcher 是 WebhookDispatcher 的实现。
+type webhookDispatcher struct {
+	webhookRepo storage.WebhookRepository
+	convoRepo   storage.ConversationRepository
+	client      *http.Client
+	cfg         config.WebhookConfig
+}
+
+// NewWebhookDispatcher 创建一个新的 WebhookDispatcher 实例。
+func NewWebhookDispatcher(webhookRepo storage.WebhookRepository, convoRepo storage.ConversationRepository, cfg config.WebhookConfig) WebhookDispatcher {
+	return &webhookDispatcher{
+		webhookRepo: webhookRepo,
+		convoRepo:   convoRepo,
+		client:      newWebhookHTTPClient(cfg, cfg.Timeout),
+		cfg:         cfg,
+	}
+}
+
+// HandleBroadcast 为群聊消息和群成员变更生成投递记录，频道消息和其他广播忽略。
+func (d *webhookDispatcher) HandleBroadcast(ctx context.Context, msg *kafka.Message) error {
+	var envelope imtypes.BroadcastEnvelope
+	if err := json.Unmarshal(msg.Value, &envelope); err != nil {
+		log.Printf("Webhook: 无法解析广播信封，已跳过: %v", err)
+		return nil
+	}
+
+	event := &WebhookEvent{ConversationID: envelope.ConversationID}
+	switch envelope.Kind {
+	case imtypes.BroadcastConversation:
+		if !isWebhookMessage(envelope.Message) {
+			return nil
+		}
+		event.Type = models.WebhookEventMessageCreated
+		event.Message = webhookMessage(envelope.Message)
+	case imtypes.BroadcastMembership:
+		if envelope.UserID == 0 {
+			return nil
+		}
+		event.Type = models.WebhookEventMemberLeft
+		if envelope.Subscribed {
+			event.Type = models.WebhookEventMemberJoined
+		}
+		event.UserID = envelope.UserID
+	default:
+		return nil
+	}
+
+	conversation, err := d.convoRepo.GetConversationByID(ctx, envelope.ConversationID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("获取会话 %d 失败: %w", envelope.ConversationID, err)
+	}
+	if conversation.Type != models.GroupConversation {
+		return nil
+	}
+	event.GroupID = conversation.TargetID
+
+	groupHooks, err := d.webhookRepo.GetEnabledGroupWebhooks(ctx, conversation.TargetID)
+	if err != nil {
+		return fmt.Errorf("获取群组 %d 的 Webhook 失败: %w", conversation.TargetID, err)
+	}
+	botHooks, err := d.webhookRepo.GetEnabledBotWebhooks(ctx, conversation.ID)
+	if err != nil {
+		return fmt.Errorf("获取会话 %d 中机器人的 Webhook 失败: %w", conversation.ID, err)
+	}
+	return d.enqueue(ctx, event, append(groupHooks, botHooks...))
+}
+
+// HandleOutgoing 为发给机器人的私聊消息生成投递记录。群聊消息经广播主题处理，这里只会看到私聊。
+func (d *webhookDispatcher) HandleOutgoing(ctx context.Context, msg *kafka.Message) error {
+	var outgoing imtypes.Message
+	if err := json.Unmarshal(msg.Value, &outgoing); err != nil {
+		log.Printf("Webhook: 无法解析出站消息，已跳过: %v", err)
+		return nil
+	}
+	if !isWebhookMessage(&outgoing) {
+		return nil
+	}
+	receiverID, err := strconv.ParseUint(outgoing.ReceiverID, 10, 32)
+	if err != nil {
+		return nil
+	}
+	conversationID, _ := strconv.ParseUint(outgoing.ConversationID, 10, 32)
+
+	hooks, err := d.webhookRepo.GetEnabledWebhooksForBot(ctx, uint(receiverID))
+	if err != nil {
+		return fmt.Errorf("获取机器人 %d 的 Webhook 失败: %w", receiverID, err)
+	}
+	event := &WebhookEvent{
+		Type:           models.WebhookEventMessageCreated,
+		ConversationID: uint(conversationID),
+		Message:        webhookMessage(&outgoing),
+	}
+	return d.enqueue(ctx, event, hooks)
+}
+
+// enqueue 为订阅了事件的 Webhook 各生成一条待投递记录。机器人的 Webhook 不接收机器人自己发送的消息。
+func (d *webhookDispatcher) enqueue(ctx context.Context, event *WebhookEvent, hooks []*models.Webhook) error {
+	var senderID uint64
+	if event.Message != nil {
+		senderID, _ = strconv.ParseUint(event.Message.SenderID, 10, 32)
+	}
+
+	targets := make([]*models.Webhook, 0, len(hooks))
+	seen := make(map[uint]bool, len(hooks))
+	for _, hook := range hooks {
+		if seen[hook.ID] || !hook.Subscribes(event.Type) {
+			continue
+		}
+		if hook.BotID != nil && event.Message != nil && uint64(*hook.BotID) == senderID {
+			continue
+		}
+		seen[hook.ID] = true
+		targets = append(targets, hook)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	event.ID = uuid.NewString()
+	event.CreatedAt = now
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化 Webhook 事件失败: %w", err)
+	}
+
+	deliveries := make([]*models.WebhookDelivery, 0, len(targets))
+	for _, hook := range targets {
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		})
+	}
+	if err := d.webhookRepo.CreateDeliveries(ctx, deliveries); err != nil {
+		return fmt.Errorf("保存 Webhook 投递记录失败: %w", err)
+	}
+	return nil
+}
+
+// Run 定期取出到期的投递记录，最多 Workers 个并发投递。
+func (d *webhookDispatcher) Run(ctx context.Context) {
+	workers := d.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx, workers)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue 投递当前到期的记录，一批取满时继续取下一批。
+func (d *webhookDispatcher) deliverDue(ctx context.Context, workers int) {
+	for ctx.Err() == nil {
+		due, err := d.webhookRepo.GetDueDeliveries(ctx, time.Now(), webhookBatchSize)
+		if err != nil {
+			log.Printf("Webhook: 获取到期的投递记录失败: %v", err)
+			return
+		}
+
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+		for _, delivery := range due {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer func() { <-sem; wg.Done() }()
+				d.attempt(ctx, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(due) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attempt 认领一条投递记录并进行一次投递，根据结果安排重试或记录最终状态。
+func (d *webhookDispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	// 认领期限覆盖一次请求的超时，实例在投递中途退出时记录会在期限后被重新取出
+	lease := time.Now().Add(2 * d.cfg.Timeout)
+	claimed, err := d.webhookRepo.ClaimDelivery(ctx, delivery.ID, delivery.Attempts, lease)
+	if err != nil {
+		log.Printf("Webhook: 认领投递记录 %d 失败: %v", delivery.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	delivery.Attempts++
+
+	webhook, err := d.webhookRepo.GetWebhookByID(ctx, delivery.WebhookID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Webhook: 获取 Webhook %d 失败: %v", delivery.WebhookID, err)
+			return
+		}
+		d.finish(ctx, delivery, models.WebhookDeliveryFailed, "Webhook 已删除")
+		return
+	}
+	if !webhook.Enabled {
+		d.finish(ctx, delivery, models.WebhookDeliveryFailed, "Webhook 已停用")
+		return
+	}
+
+	start := time.Now()
+	statusCode, _, postErr := postWebhook(ctx, d.client, webhook, delivery.EventType, delivery.EventID, []byte(delivery.Payload), webhookMaxResponseBytes)
+	now := time.Now()
+	delivery.LastStatusCode = statusCode
+	delivery.LastDurationMs = now.Sub(start).Milliseconds()
+
+	if postErr == nil {
+		delivery.DeliveredAt = &now
+		d.finish(ctx, delivery, models.WebhookDeliverySucceeded, "")
+		if err := d.webhookRepo.RecordWebhookSuccess(ctx, webhook.ID, now); err != nil {
+			log.Printf("Webhook: 记录 Webhook %d 投递成功失败: %v", webhook.ID, err)
+		}
+		return
+	}
+
+	if delivery.Attempts < d.cfg.MaxAttempts {
+		delivery.NextAttemptAt = now.Add(d.retryDelay(delivery.Attempts))
+		d.finish(ctx, delivery, models.WebhookDeliveryPending, postErr.Error())
+		return
+	}
+
+	d.finish(ctx, delivery, models.WebhookDeliveryFailed, postErr.Error())
+	reason := fmt.Sprintf("连续 %d 个事件投递失败，最后一次错误: %s", d.cfg.DisableAfterFailures, postErr.Error())
+	disabled, err := d.webhookRepo.RecordWebhookFailure(ctx, webhook.ID, now, d.cfg.DisableAfterFailures, truncateWebhookError(reason, 255))
+	if err != nil {
+		log.Printf("Webhook: 记录 Webhook %d 投递失败失败: %v", webhook.ID, err)
+		return
+	}
+	if disabled {
+		log.Printf("Webhook: Webhook %d (%s) 连续投递失败，已自动停用", webhook.ID, webhook.URL)
+		if err := d.webhookRepo.FailPendingDeliveries(ctx, webhook.ID, "Webhook 已停用"); err != nil {
+			log.Printf("Webhook: 取消 Webhook %d 待投递的记录失败: %v", webhook.ID, err)
+		}
+	}
+}
+
+// finish 保存投递记录的状态和错误信息。
+func (d *webhookDispatcher) finish(ctx context.Context, delivery *models.WebhookDelivery, status models.WebhookDeliveryStatus, lastError string) {
+	delivery.Status = status
+	delivery.LastError = truncateWebhookError(lastError, webhookMaxErrorLength)
+	if err := d.webhookRepo.UpdateDeliveryResult(ctx, delivery); err != nil {
+		log.Printf("Webhook: 保存投递记录 %d 失败: %v", delivery.ID, err)
+	}
+}
+
+// postWebhook 向 Webhook 发送一次签名的请求，返回状态码和最多 maxResponseBytes 字节的响应体。
+// 端点返回 2xx 视为成功，重定向视为失败。
+func postWebhook(ctx context.Context, client *http.Client, webhook *models.Webhook, eventType models.WebhookEventType, eventID string, body []byte, maxResponseBytes int64) (int, []byte, error) {
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "im-go-webhook/1.0")
+	req.Header.Set(WebhookEventHeader, string(eventType))
+	req.Header.Set(WebhookDeliveryHeader, eventID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, respBody, fmt.Errorf("端点返回 HTTP %d: %s", resp.StatusCode, truncateWebhookError(string(respBody), webhookMaxResponseBytes))
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// retryDelay 返回第 attempts 次投递失败后的重试间隔：RetryBaseDelay 每次翻倍，最长 RetryMaxDelay。
+func (d *webhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.cfg.RetryBaseDelay
+	for i := 1; i < attempts && delay < d.cfg.RetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.cfg.RetryMaxDelay {
+		delay = d.cfg.RetryMaxDelay
+	}
+	return delay
+}
+
+// SignWebhookPayload 计算投递请求的签名，接收方用同样的方式计算并与 X-IM-Webhook-Signature 比较。
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookHTTPClient 创建投递用的 HTTP 客户端：不使用环境代理、不跟随重定向，
+// 并在建立连接时检查解析出的地址，防止通过域名投递到内网。
+func newWebhookHTTPClient(cfg config.WebhookConfig, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errWebhookAddressNotAllowed
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isWebhookMessage 判断推送的消息是否构成 message.created 事件，撤回通知和错误回执不算。
+func isWebhookMessage(msg *imtypes.Message) bool {
+	if msg == nil {
+		return false
+	}
+	switch msg.Type {
+	case imtypes.TextMessageType, imtypes.ImageMessageType, imtypes.FileMessageType,
+		imtypes.EmojiMessageType, imtypes.SystemMessageType:
+		return true
+	}
+	return false
+}
+
+// webhookMessage 复制消息并去掉只对 WebSocket 推送有意义的接收者字段。
+func webhookMessage(msg *imtypes.Message) *imtypes.Message {
+	copied := *msg
+	copied.ReceiverID = ""
+	return &copied
+}
+
+// truncateWebhookError 将错误信息截断到 limit 字节以内，不截断多字节字符。
+func truncateWebhookError(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	s = s[:limit]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
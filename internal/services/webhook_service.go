@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"im-go/internal/config"
+	"im-go/internal/models"
+	"im-go/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("Webhook 不存在")
+	ErrInvalidWebhookURL    = errors.New("Webhook 地址无效，必须是 https:// 开头的公网地址")
+	ErrInvalidWebhookEvent  = errors.New("无效的 Webhook 事件类型")
+	ErrWebhookLimitReached  = errors.New("Webhook 数量已达上限")
+	ErrWebhookTargetInvalid = errors.New("Webhook 必须属于群组或机器人")
+)
+
+const (
+	// maxWebhooksPerTarget 是每个群组或机器人可以登记的 Webhook 数量上限。
+	maxWebhooksPerTarget = 10
+	// maxWebhookURLLength 是 Webhook 地址的最大长度，与数据库字段一致。
+	maxWebhookURLLength = 2048
+	// webhookDeliveryListLimit 是查看投递记录时返回的最大条数。
+	webhookDeliveryListLimit = 50
+	// webhookSecretPrefix 是签名密钥的前缀，便于在日志和配置中识别。
+	webhookSecretPrefix = "whsec_"
+)
+
+// CreatedWebhook 是新登记的 Webhook，Secret 为签名密钥明文，只在创建时返回一次。
+type CreatedWebhook struct {
+	Secret  string
+	Webhook *models.Webhook
+}
+
+// WebhookUpdate 描述对 Webhook 的修改，为 nil 的字段保持不变。
+type WebhookUpdate struct {
+	URL     *string
+	Events  *[]models.WebhookEventType
+	Enabled *bool
+}
+
+// WebhookService 定义了管理群组和机器人 Webhook 的服务接口。
+// 群组 Webhook 需要 manage_webhooks 群组权限，机器人 Webhook 只能由机器人的创建者管理。
+// 事件的生成和投递见 WebhookDispatcher。
+type WebhookService interface {
+	// CreateGroupWebhook 为群组登记一个 Webhook。events 为空表示订阅全部事件。
+	CreateGroupWebhook(ctx context.Context, userID, groupID uint, rawURL string, events []models.WebhookEventType) (*CreatedWebhook, error)
+	// ListGroupWebhooks 返回群组的所有 Webhook。
+	ListGroupWebhooks(ctx context.Context, userID, groupID uint) ([]*models.Webhook, error)
+	// CreateBotWebhook 为机器人登记一个 Webhook，接收机器人所在会话的事件。
+	CreateBotWebhook(ctx context.Context, ownerID, botID uint, rawURL string, events []models.WebhookEventType) (*CreatedWebhook, error)
+	// ListBotWebhooks 返回机器人的所有 Webhook。
+	ListBotWebhooks(ctx context.Context, ownerID, botID uint) ([]*models.Webhook, error)
+
+	// UpdateWebhook 修改 Webhook 的地址、订阅的事件或启用状态，重新启用时清零连续失败次数。
+	UpdateWebhook(ctx context.Context, userID, webhookID uint, update WebhookUpdate) (*models.Webhook, error)
+	// DeleteWebhook 删除 Webhook，尚未投递的事件不再投递。
+	DeleteWebhook(ctx context.Context, userID, webhookID uint) error
+	// ListDeliveries 返回 Webhook 最近的投递记录。
+	ListDeliveries(ctx context.Context, userID, webhookID uint) ([]*models.WebhookDelivery, error)
+}
+
+// webhookService 是 WebhookService 的实现。
+type webhookService struct {
+	webhookRepo storage.WebhookRepository
+	userRepo    storage.UserRepository
+	perms       GroupPermissionChecker
+	cfg         config.WebhookConfig
+}
+
+// NewWebhookService 创建一个新的 WebhookService 实例。
+func NewWebhookService(webhookRepo storage.WebhookRepository, userRepo storage.UserRepository, perms GroupPermissionChecker, cfg config.WebhookConfig) WebhookService {
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		userRepo:    userRepo,
+		perms:       perms,
+		cfg:         cfg,
+	}
+}
+
+// CreateGroupWebhook 校验权限后为群组登记 Webhook。
+func (s *webhookService) CreateGroupWebhook(ctx context.Context, userID, groupID uint, rawURL string, events []models.WebhookEventType) (*CreatedWebhook, error) {
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermManageWebhooks); err != nil {
+		return nil, err
+	}
+	existing, err := s.webhookRepo.GetWebhooksByGroup(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("获取群组 %d 的 Webhook 失败: %w", groupID, err)
+	}
+	if len(existing) >= maxWebhooksPerTarget {
+		return nil, ErrWebhookLimitReached
+	}
+	return s.create(ctx, &models.Webhook{GroupID: &groupID, CreatedByID: userID}, rawURL, events)
+}
+
+// ListGroupWebhooks 校验权限后返回群组的 Webhook。
+func (s *webhookService) ListGroupWebhooks(ctx context.Context, userID, groupID uint) ([]*models.Webhook, error) {
+	if _, err := s.perms.Check(ctx, groupID, userID, models.PermManageWebhooks); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.webhookRepo.GetWebhooksByGroup(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("获取群组 %d 的 Webhook 失败: %w", groupID, err)
+	}
+	return webhooks, nil
+}
+
+// CreateBotWebhook 校验机器人归属后为机器人登记 Webhook。
+func (s *webhookService) CreateBotWebhook(ctx context.Context, ownerID, botID uint, rawURL string, events []models.WebhookEventType) (*CreatedWebhook, error) {
+	if _, err := findOwnedBot(ctx, s.userRepo, ownerID, botID); err != nil {
+		return nil, err
+	}
+	existing, err := s.webhookRepo.GetWebhooksByBot(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的 Webhook 失败: %w", botID, err)
+	}
+	if len(existing) >= maxWebhooksPerTarget {
+		return nil, ErrWebhookLimitReached
+	}
+	return s.create(ctx, &models.Webhook{BotID: &botID, CreatedByID: ownerID}, rawURL, events)
+}
+
+// ListBotWebhooks 校验机器人归属后返回机器人的 Webhook。
+func (s *webhookService) ListBotWebhooks(ctx context.Context, ownerID, botID uint) ([]*models.Webhook, error) {
+	if _, err := findOwnedBot(ctx, s.userRepo, ownerID, botID); err != nil {
+		return nil, err
+	}
+	webhooks, err := s.webhookRepo.GetWebhooksByBot(ctx, botID)
+	if err != nil {
+		return nil, fmt.Errorf("获取机器人 %d 的 Webhook 失败: %w", botID, err)
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook 校验权限后修改 Webhook。
+func (s *webhookService) UpdateWebhook(ctx context.Context, userID, webhookID uint, update WebhookUpdate) (*models.Webhook, error) {
+	webhook, err := s.authorizedWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.URL != nil {
+		normalized, err := s.validateURL(*update.URL)
+		if err != nil {
+			return nil, err
+		}
+		webhook.URL = normalized
+	}
+	if update.Events != nil {
+		if err := validateWebhookEvents(*update.Events); err != nil {
+			return nil, err
+		}
+		webhook.SetEvents(*update.Events)
+	}
+	if update.Enabled != nil {
+		if *update.Enabled && !webhook.Enabled {
+			webhook.ConsecutiveFailures = 0
+			webhook.DisabledAt = nil
+			webhook.DisabledReason = ""
+		}
+		webhook.Enabled = *update.Enabled
+	}
+
+	if err := s.webhookRepo.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("更新 Webhook %d 失败: %w", webhookID, err)
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook 校验权限后删除 Webhook。
+func (s *webhookService) DeleteWebhook(ctx context.Context, userID, webhookID uint) error {
+	if _, err := s.authorizedWebhook(ctx, userID, webhookID); err != nil {
+		return err
+	}
+	if err := s.webhookRepo.DeleteWebhook(ctx, webhookID); err != nil {
+		return fmt.Errorf("删除 Webhook %d 失败: %w", webhookID, err)
+	}
+	return nil
+}
+
+// ListDeliveries 校验权限后返回 Webhook 最近的投递记录。
+func (s *webhookService) ListDeliveries(ctx context.Context, userID, webhookID uint) ([]*models.WebhookDelivery, error) {
+	if _, err := s.authorizedWebhook(ctx, userID, webhookID); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.webhookRepo.GetDeliveriesByWebhook(ctx, webhookID, webhookDeliveryListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("获取 Webhook %d 的投递记录失败: %w", webhookID, err)
+	}
+	return deliveries, nil
+}
+
+// create 校验地址和事件类型，生成签名密钥并保存 Webhook。
+func (s *webhookService) create(ctx context.Context, webhook *models.Webhook, rawURL string, events []models.WebhookEventType) (*CreatedWebhook, error) {
+	normalized, err := s.validateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhookEvents(events); err != nil {
+		return nil, err
+	}
+	token, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = normalized
+	webhook.Secret = webhookSecretPrefix + token
+	webhook.Enabled = true
+	webhook.SetEvents(events)
+	if err := s.webhookRepo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("保存 Webhook 失败: %w", err)
+	}
+	return &CreatedWebhook{Secret: webhook.Secret, Webhook: webhook}, nil
+}
+
+// authorizedWebhook 获取 Webhook 并校验 userID 是否可以管理它。
+// 机器人 Webhook 不属于该用户时返回 ErrWebhookNotFound，不暴露其存在。
+func (s *webhookService) authorizedWebhook(ctx context.Context, userID, webhookID uint) (*models.Webhook, error) {
+	webhook, err := s.webhookRepo.GetWebhookByID(ctx, webhookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("获取 Webhook %d 失败: %w", webhookID, err)
+	}
+
+	switch {
+	case webhook.GroupID != nil:
+		if _, err := s.perms.Check(ctx, *webhook.GroupID, userID, models.PermManageWebhooks); err != nil {
+			if errors.Is(err, ErrNotGroupMember) {
+				return nil, ErrWebhookNotFound
+			}
+			return nil, err
+		}
+	case webhook.BotID != nil:
+		if _, err := findOwnedBot(ctx, s.userRepo, userID, *webhook.BotID); err != nil {
+			if errors.Is(err, ErrBotNotFound) {
+				return nil, ErrWebhookNotFound
+			}
+			return nil, err
+		}
+	default:
+		return nil, ErrWebhookTargetInvalid
+	}
+	return webhook, nil
+}
+
+// validateURL 检查 Webhook 地址的协议和主机。以域名登记的地址在投递时解析，解析结果同样受内网地址限制。
+func (s *webhookService) validateURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" || len(rawURL) > maxWebhookURLLength {
+		return "", ErrInvalidWebhookURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || parsed.User != nil {
+		return "", ErrInvalidWebhookURL
+	}
+	switch parsed.Scheme {
+	case "https":
+	case "http":
+		if !s.cfg.AllowInsecureURLs {
+			return "", ErrInvalidWebhookURL
+		}
+	default:
+		return "", ErrInvalidWebhookURL
+	}
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil && !s.cfg.AllowPrivateNetworks && !isPublicIP(ip) {
+		return "", ErrInvalidWebhookURL
+	}
+	parsed.Fragment = ""
+	return parsed.String(), nil
+}
+
+// validateWebhookEvents 检查订阅的事件类型是否都已定义。
+func validateWebhookEvents(events []models.WebhookEventType) error {
+	for _, event := range events {
+		if !event.IsValid() {
+			return fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+	return nil
+}
+
+// isPublicIP 判断地址是否可以作为 Webhook 的投递目标，回环、内网、链路本地等地址不允许。
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast())
+}
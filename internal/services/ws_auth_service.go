@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"im-go/internal/auth"
+	"im-go/internal/config"
+)
+
+var (
+	ErrWSCredentialsMissing = errors.New("缺少认证信息")
+	ErrWSCredentialsInvalid = errors.New("认证信息无效、已过期或已被吊销")
+)
+
+// defaultWSTicketTTL 是未配置 WEBSOCKET.TICKET_TTL_SECONDS 时连接票据的有效期。
+const defaultWSTicketTTL = 30 * time.Second
+
+// WSCredentials 是客户端建立 WebSocket 连接时提交的凭证，二者只需其一。
+type WSCredentials struct {
+	Token  string // 访问令牌 (JWT)
+	Ticket string // API 服务器签发的一次性连接票据
+}
+
+// WSConnectTicket 是签发给客户端的一次性连接票据。
+type WSConnectTicket struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// WSAuthService 定义了 WebSocket 连接认证的服务接口。
+// 浏览器无法为 WebSocket 握手设置 Authorization 头，客户端可以在 Sec-WebSocket-Protocol 中携带访问令牌，
+// 或者先通过 API 服务器换取短期有效、只能使用一次的连接票据，避免长期有效的令牌出现在 URL 和日志中。
+type WSAuthService interface {
+	// IssueTicket 为已认证的访问令牌签发连接票据。
+	IssueTicket(ctx context.Context, claims *auth.Claims) (*WSConnectTicket, error)
+	// Authenticate 校验连接凭证，返回连接所代表的身份。
+	Authenticate(ctx context.Context, creds WSCredentials) (*auth.WSTicket, error)
+}
+
+// wsAuthService 是 WSAuthService 的实现。
+type wsAuthService struct {
+	tickets   auth.WSTicketStore
+	keys      auth.KeySet // 只在 ChatServer 中用于校验访问令牌，API 服务器可以为 nil
+	blacklist auth.TokenBlacklist
+	ticketTTL time.Duration
+}
+
+// NewWSAuthService 创建一个新的 WSAuthService 实例。
+func NewWSAuthService(tickets auth.WSTicketStore, keys auth.KeySet, blacklist auth.TokenBlacklist, cfg config.WebSocketConfig) WSAuthService {
+	ttl := time.Duration(cfg.TicketTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultWSTicketTTL
+	}
+	return &wsAuthService{
+		tickets:   tickets,
+		keys:      keys,
+		blacklist: blacklist,
+		ticketTTL: ttl,
+	}
+}
+
+// IssueTicket 生成随机票据并保存令牌中的身份信息，票据的有效期不超过令牌本身。
+func (s *wsAuthService) IssueTicket(ctx context.Context, claims *auth.Claims) (*WSConnectTicket, error) {
+	if claims.ExpiresAt == nil || claims.ID == "" {
+		return nil, fmt.Errorf("令牌缺少 JTI 或过期时间，无法签发连接票据")
+	}
+	ticket, err := generateSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.ticketTTL)
+	if claims.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil, ErrWSCredentialsInvalid
+	}
+	data := &auth.WSTicket{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		SessionID: claims.SessionID,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := s.tickets.Save(ctx, ticket, data, ttl); err != nil {
+		return nil, err
+	}
+	return &WSConnectTicket{Ticket: ticket, ExpiresAt: expiresAt}, nil
+}
+
+// Authenticate 优先使用连接票据，其次是访问令牌。
+// 票据在签发后其令牌或会话可能已被吊销，因此取出后同样检查黑名单。
+func (s *wsAuthService) Authenticate(ctx context.Context, creds WSCredentials) (*auth.WSTicket, error) {
+	switch {
+	case creds.Ticket != "":
+		identity, err := s.tickets.Consume(ctx, creds.Ticket)
+		if errors.Is(err, auth.ErrWSTicketNotFound) {
+			return nil, ErrWSCredentialsInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !identity.ExpiresAt.After(time.Now()) {
+			return nil, ErrWSCredentialsInvalid
+		}
+		if err := s.checkRevoked(ctx, identity); err != nil {
+			return nil, err
+		}
+		return identity, nil
+
+	case creds.Token != "":
+		claims, err := auth.ValidateToken(ctx, creds.Token, s.keys, s.blacklist)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWSCredentialsInvalid, err)
+		}
+		if claims.ExpiresAt == nil {
+			return nil, fmt.Errorf("%w: 令牌缺少过期时间", ErrWSCredentialsInvalid)
+		}
+		return &auth.WSTicket{
+			UserID:    claims.UserID,
+			Username:  claims.Username,
+			SessionID: claims.SessionID,
+			TokenID:   claims.ID,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}, nil
+
+	default:
+		return nil, ErrWSCredentialsMissing
+	}
+}
+
+// checkRevoked 检查票据对应的访问令牌及其登录会话是否已被吊销。
+func (s *wsAuthService) checkRevoked(ctx context.Context, identity *auth.WSTicket) error {
+	if s.blacklist == nil {
+		return nil
+	}
+	ids := []string{identity.TokenID}
+	if identity.SessionID != 0 {
+		ids = append(ids, auth.SessionRevocationID(identity.SessionID))
+	}
+	for _, id := range ids {
+		revoked, err := s.blacklist.IsBlacklisted(ctx, id)
+		if err != nil {
+			return fmt.Errorf("检查令牌吊销状态失败: %w", err)
+		}
+		if revoked {
+			return ErrWSCredentialsInvalid
+		}
+	}
+	return nil
+}
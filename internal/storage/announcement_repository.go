@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"im-go/internal/models"
+)
+
+// AnnouncementRepository 定义了群公告及其确认记录的数据操作接口。
+type AnnouncementRepository interface {
+	Create(ctx context.Context, announcement *models.GroupAnnouncement) error
+	// GetLatest 获取群组当前 (最新) 的公告。
+	GetLatest(ctx context.Context, groupID uint) (*models.GroupAnnouncement, error)
+	// Ack 记录成员对公告的确认，重复确认不会报错。
+	Ack(ctx context.Context, ack *models.GroupAnnouncementAck) error
+	HasAcked(ctx context.Context, announcementID, userID uint) (bool, error)
+	CountAcks(ctx context.Context, announcementID uint) (int64, error)
+	GetAcks(ctx context.Context, announcementID uint) ([]*models.GroupAnnouncementAck, error)
+}
+
+// gormAnnouncementRepository 使用 GORM 实现 AnnouncementRepository。
+type gormAnnouncementRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAnnouncementRepository 创建一个新的基于 GORM 的 AnnouncementRepository。
+func NewGormAnnouncementRepository(db *gorm.DB) AnnouncementRepository {
+	return &gormAnnouncementRepository{db: db}
+}
+
+// Create 新增一条群公告。
+func (r *gormAnnouncementRepository) Create(ctx context.Context, announcement *models.GroupAnnouncement) error {
+	return r.db.WithContext(ctx).Create(announcement).Error
+}
+
+// GetLatest 获取群组最新的公告。
+func (r *gormAnnouncementRepository) GetLatest(ctx context.Context, groupID uint) (*models.GroupAnnouncement, error) {
+	var announcement models.GroupAnnouncement
+	err := r.db.WithContext(ctx).Where("group_id = ?", groupID).
+		Preload("Author").Order("created_at DESC").First(&announcement).Error
+	if err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+// Ack 记录成员对公告的确认。
+func (r *gormAnnouncementRepository) Ack(ctx context.Context, ack *models.GroupAnnouncementAck) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(ack).Error
+}
+
+// HasAcked 检查成员是否已确认公告。
+func (r *gormAnnouncementRepository) HasAcked(ctx context.Context, announcementID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.GroupAnnouncementAck{}).
+		Where("announcement_id = ? AND user_id = ?", announcementID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// CountAcks 统计公告的确认人数。
+func (r *gormAnnouncementRepository) CountAcks(ctx context.Context, announcementID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.GroupAnnouncementAck{}).
+		Where("announcement_id = ?", announcementID).Count(&count).Error
+	return count, err
+}
+
+// GetAcks 获取公告的所有确认记录，按确认时间排序。
+func (r *gormAnnouncementRepository) GetAcks(ctx context.Context, announcementID uint) ([]*models.GroupAnnouncementAck, error) {
+	var acks []*models.GroupAnnouncementAck
+	err := r.db.WithContext(ctx).Where("announcement_id = ?", announcementID).
+		Preload("User").Order("acked_at ASC").Find(&acks).Error
+	return acks, err
+}
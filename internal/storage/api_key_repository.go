@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// APIKeyRepository 定义了机器人 API Key 的数据操作接口。
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByID(ctx context.Context, id uint) (*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// GetAPIKeysByUser 返回机器人的所有 Key (包括已吊销的)，最新创建的在前。
+	GetAPIKeysByUser(ctx context.Context, userID uint) ([]*models.APIKey, error)
+	// RevokeAPIKey 吊销一个未吊销的 Key，Key 已被吊销时返回 false。
+	RevokeAPIKey(ctx context.Context, id uint, at time.Time) (bool, error)
+	// TouchAPIKey 更新 Key 的最后使用时间，距上次记录不足 minInterval 时不写入。
+	TouchAPIKey(ctx context.Context, id uint, at time.Time, minInterval time.Duration) error
+}
+
+// gormAPIKeyRepository 使用 GORM 实现 APIKeyRepository。
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAPIKeyRepository 创建一个新的基于 GORM 的 APIKeyRepository。
+func NewGormAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &gormAPIKeyRepository{db: db}
+}
+
+// CreateAPIKey 保存一个新的 API Key。
+func (r *gormAPIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+// GetAPIKeyByID 通过 ID 检索 API Key。
+func (r *gormAPIKeyRepository) GetAPIKeyByID(ctx context.Context, id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeyByHash 通过哈希检索 API Key。
+func (r *gormAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeysByUser 检索机器人的 API Key。
+func (r *gormAPIKeyRepository) GetAPIKeysByUser(ctx context.Context, userID uint) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey 以条件更新的方式吊销 API Key。
+func (r *gormAPIKeyRepository) RevokeAPIKey(ctx context.Context, id uint, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchAPIKey 更新最后使用时间，避免每个请求都写数据库。
+func (r *gormAPIKeyRepository) TouchAPIKey(ctx context.Context, id uint, at time.Time, minInterval time.Duration) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at.Add(-minInterval)).
+		Update("last_used_at", at).Error
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// AttachmentRepository 定义了附件记录的数据操作接口。
+type AttachmentRepository interface {
+	// Create 保存一条附件记录。
+	Create(ctx context.Context, attachment *models.Attachment) error
+	// GetByID 根据ID获取附件，不存在时返回 gorm.ErrRecordNotFound。
+	GetByID(ctx context.Context, id uint) (*models.Attachment, error)
+	// LinkMessage 把附件关联到消息。只有上传者本人、附件尚未被其他消息引用、
+	// 且附件未指定会话或指定的就是 conversationID 时才会关联，返回是否关联成功。
+	LinkMessage(ctx context.Context, id, uploaderID, conversationID, messageID uint) (bool, error)
+}
+
+// gormAttachmentRepository 使用 GORM 实现 AttachmentRepository。
+type gormAttachmentRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAttachmentRepository 创建一个新的基于 GORM 的 AttachmentRepository。
+func NewGormAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &gormAttachmentRepository{db: db}
+}
+
+// Create 保存一条附件记录。
+func (r *gormAttachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+// GetByID 根据ID获取附件。
+func (r *gormAttachmentRepository) GetByID(ctx context.Context, id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := r.db.WithContext(ctx).First(&attachment, id).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// LinkMessage 使用条件更新关联附件，并发发送引用同一附件的两条消息时只有一条能成功。
+func (r *gormAttachmentRepository) LinkMessage(ctx context.Context, id, uploaderID, conversationID, messageID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Attachment{}).
+		Where("id = ? AND uploader_id = ? AND message_id IS NULL AND (conversation_id IS NULL OR conversation_id = ?)", id, uploaderID, conversationID).
+		Updates(map[string]interface{}{"conversation_id": conversationID, "message_id": messageID})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// BotCommandRepository 定义了机器人斜杠命令的数据操作接口。
+type BotCommandRepository interface {
+	// ReplaceBotCommands 用 commands 替换机器人登记的全部命令。
+	ReplaceBotCommands(ctx context.Context, botID uint, commands []*models.BotCommand) error
+	// GetBotCommands 返回机器人登记的命令，按名称排序。
+	GetBotCommands(ctx context.Context, botID uint) ([]*models.BotCommand, error)
+	// GetConversationBotCommands 返回参与了会话的机器人登记的命令，预加载 Bot，按名称排序。
+	GetConversationBotCommands(ctx context.Context, conversationID uint) ([]*models.BotCommand, error)
+}
+
+// gormBotCommandRepository 使用 GORM 实现 BotCommandRepository。
+type gormBotCommandRepository struct {
+	db *gorm.DB
+}
+
+// NewGormBotCommandRepository 创建一个新的基于 GORM 的 BotCommandRepository。
+func NewGormBotCommandRepository(db *gorm.DB) BotCommandRepository {
+	return &gormBotCommandRepository{db: db}
+}
+
+// ReplaceBotCommands 在事务中删除旧命令并保存新命令。旧命令直接删除，避免软删除的记录占用唯一索引。
+func (r *gormBotCommandRepository) ReplaceBotCommands(ctx context.Context, botID uint, commands []*models.BotCommand) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("bot_id = ?", botID).Delete(&models.BotCommand{}).Error; err != nil {
+			return err
+		}
+		if len(commands) == 0 {
+			return nil
+		}
+		return tx.Create(&commands).Error
+	})
+}
+
+// GetBotCommands 检索机器人登记的命令。
+func (r *gormBotCommandRepository) GetBotCommands(ctx context.Context, botID uint) ([]*models.BotCommand, error) {
+	var commands []*models.BotCommand
+	err := r.db.WithContext(ctx).Where("bot_id = ?", botID).Order("name ASC").Find(&commands).Error
+	return commands, err
+}
+
+// GetConversationBotCommands 通过会话参与者检索机器人登记的命令。
+func (r *gormBotCommandRepository) GetConversationBotCommands(ctx context.Context, conversationID uint) ([]*models.BotCommand, error) {
+	var commands []*models.BotCommand
+	err := r.db.WithContext(ctx).
+		Joins("JOIN conversation_participants cp ON cp.user_id = bot_commands.bot_id").
+		Where("cp.conversation_id = ?", conversationID).
+		Preload("Bot").
+		Order("bot_commands.name ASC").
+		Find(&commands).Error
+	return commands, err
+}
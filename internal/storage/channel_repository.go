@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"im-go/internal/models"
+)
+
+// ChannelRepository 定义了广播频道及其订阅关系的数据操作接口。
+type ChannelRepository interface {
+	CreateChannel(ctx context.Context, channel *models.Channel) error
+	GetChannelByID(ctx context.Context, id uint) (*models.Channel, error)
+	// GetChannelByConversationID 通过频道对应的会话 ID 查找频道。
+	GetChannelByConversationID(ctx context.Context, conversationID uint) (*models.Channel, error)
+	UpdateChannel(ctx context.Context, channel *models.Channel) error
+	// SearchPublicChannels 按名称或描述搜索公开频道。
+	SearchPublicChannels(ctx context.Context, query string, limit int, offset int) ([]*models.Channel, error)
+
+	// AddSubscription 新增订阅，已订阅时返回 created=false 且不报错。
+	AddSubscription(ctx context.Context, subscription *models.ChannelSubscription) (created bool, err error)
+	// RemoveSubscription 取消订阅，返回是否确实删除了记录。
+	RemoveSubscription(ctx context.Context, channelID, userID uint) (removed bool, err error)
+	IsSubscribed(ctx context.Context, channelID, userID uint) (bool, error)
+	// GetUserChannels 获取用户订阅的频道列表。
+	GetUserChannels(ctx context.Context, userID uint, limit int, offset int) ([]*models.Channel, error)
+	// GetSubscribedConversationIDs 获取用户订阅的所有频道对应的会话 ID，用于 WebSocket 连接建立时订阅主题。
+	GetSubscribedConversationIDs(ctx context.Context, userID uint) ([]uint, error)
+
+	// GetDB 返回底层数据库连接，用于事务操作
+	GetDB() *gorm.DB
+}
+
+// gormChannelRepository 使用 GORM 实现 ChannelRepository。
+type gormChannelRepository struct {
+	db *gorm.DB
+}
+
+// NewGormChannelRepository 创建一个新的基于 GORM 的 ChannelRepository。
+func NewGormChannelRepository(db *gorm.DB) ChannelRepository {
+	return &gormChannelRepository{db: db}
+}
+
+// CreateChannel 创建一个新的频道。
+func (r *gormChannelRepository) CreateChannel(ctx context.Context, channel *models.Channel) error {
+	return r.db.WithContext(ctx).Create(channel).Error
+}
+
+// GetChannelByID 通过 ID 检索频道。
+func (r *gormChannelRepository) GetChannelByID(ctx context.Context, id uint) (*models.Channel, error) {
+	var channel models.Channel
+	err := r.db.WithContext(ctx).Preload("Owner").First(&channel, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// GetChannelByConversationID 通过会话 ID 检索频道。
+func (r *gormChannelRepository) GetChannelByConversationID(ctx context.Context, conversationID uint) (*models.Channel, error) {
+	var channel models.Channel
+	err := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID).First(&channel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// UpdateChannel 更新频道信息。
+func (r *gormChannelRepository) UpdateChannel(ctx context.Context, channel *models.Channel) error {
+	return r.db.WithContext(ctx).Omit("Owner").Save(channel).Error
+}
+
+// SearchPublicChannels 搜索公开频道，订阅人数多的排在前面。
+func (r *gormChannelRepository) SearchPublicChannels(ctx context.Context, query string, limit int, offset int) ([]*models.Channel, error) {
+	var channels []*models.Channel
+	dbQuery := r.db.WithContext(ctx).Model(&models.Channel{}).
+		Where("is_public = ?", true).
+		Where("name LIKE ? OR description LIKE ?", "%"+query+"%", "%"+query+"%").
+		Order("subscriber_count DESC").
+		Preload("Owner")
+
+	if limit > 0 {
+		dbQuery = dbQuery.Limit(limit)
+	}
+	if offset > 0 {
+		dbQuery = dbQuery.Offset(offset)
+	}
+
+	err := dbQuery.Find(&channels).Error
+	return channels, err
+}
+
+// AddSubscription 新增订阅并同步订阅人数。
+func (r *gormChannelRepository) AddSubscription(ctx context.Context, subscription *models.ChannelSubscription) (bool, error) {
+	created := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(subscription)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		created = true
+		return tx.Model(&models.Channel{}).Where("id = ?", subscription.ChannelID).
+			UpdateColumn("subscriber_count", gorm.Expr("subscriber_count + ?", 1)).Error
+	})
+	return created, err
+}
+
+// RemoveSubscription 取消订阅并同步订阅人数。使用硬删除，以便用户可以再次订阅。
+func (r *gormChannelRepository) RemoveSubscription(ctx context.Context, channelID, userID uint) (bool, error) {
+	removed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("channel_id = ? AND user_id = ?", channelID, userID).
+			Delete(&models.ChannelSubscription{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		removed = true
+		return tx.Model(&models.Channel{}).Where("id = ? AND subscriber_count > 0", channelID).
+			UpdateColumn("subscriber_count", gorm.Expr("subscriber_count - ?", 1)).Error
+	})
+	return removed, err
+}
+
+// IsSubscribed 检查用户是否订阅了频道。
+func (r *gormChannelRepository) IsSubscribed(ctx context.Context, channelID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.ChannelSubscription{}).
+		Where("channel_id = ? AND user_id = ?", channelID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetUserChannels 获取用户订阅的频道列表。
+func (r *gormChannelRepository) GetUserChannels(ctx context.Context, userID uint, limit int, offset int) ([]*models.Channel, error) {
+	var channels []*models.Channel
+	query := r.db.WithContext(ctx).
+		Joins("JOIN channel_subscriptions cs ON cs.channel_id = channels.id AND cs.deleted_at IS NULL").
+		Where("cs.user_id = ?", userID).
+		Order("cs.subscribed_at DESC").
+		Preload("Owner")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&channels).Error
+	return channels, err
+}
+
+// GetSubscribedConversationIDs 获取用户订阅的所有频道对应的会话 ID。
+func (r *gormChannelRepository) GetSubscribedConversationIDs(ctx context.Context, userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&models.Channel{}).
+		Joins("JOIN channel_subscriptions cs ON cs.channel_id = channels.id AND cs.deleted_at IS NULL").
+		Where("cs.user_id = ?", userID).
+		Pluck("channels.conversation_id", &ids).Error
+	return ids, err
+}
+
+// GetDB 返回底层数据库连接。
+func (r *gormChannelRepository) GetDB() *gorm.DB {
+	return r.db
+}
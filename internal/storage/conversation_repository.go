@@ -22,12 +22,16 @@ type ConversationRepository interface {
 	FindPrivateConversationByUsers(ctx context.Context, userID1 uint, userID2 uint) (*models.Conversation, error)
 	// FindOrCreatePrivateConversationWithTx 在事务中查找或创建两个用户之间的私聊会话
 	FindOrCreatePrivateConversationWithTx(ctx context.Context, tx *gorm.DB, senderID uint, receiverID uint) (*models.Conversation, error)
+	// FindGroupConversation 查找与群组关联的群聊会话
+	FindGroupConversation(ctx context.Context, groupID uint) (*models.Conversation, error)
 
 	AddParticipant(ctx context.Context, participant *models.ConversationParticipant) error
 	GetParticipant(ctx context.Context, conversationID uint, userID uint) (*models.ConversationParticipant, error)
 	UpdateParticipant(ctx context.Context, participant *models.ConversationParticipant) error
 	RemoveParticipant(ctx context.Context, conversationID uint, userID uint) error
 	GetConversationParticipants(ctx context.Context, conversationID uint) ([]*models.ConversationParticipant, error)
+	// GetParticipantUserIDs 只获取会话参与者的用户ID，用于大群消息扇出。
+	GetParticipantUserIDs(ctx context.Context, conversationID uint) ([]uint, error)
 
 	// GetDB 返回底层数据库连接，用于事务操作
 	GetDB() *gorm.DB
@@ -63,9 +67,15 @@ func (r *gormConversationRepository) GetConversationByID(ctx context.Context, id
 // GetUserConversations 获取用户参与的所有会话列表。
 func (r *gormConversationRepository) GetUserConversations(ctx context.Context, userID uint, limit int, offset int) ([]*models.Conversation, error) {
 	var conversations []*models.Conversation
-	// 此查询需要连接 conversation_participants 表
-	query := r.db.WithContext(ctx).Joins("JOIN conversation_participants cp ON cp.conversation_id = conversations.id").
-		Where("cp.user_id = ?", userID).Order("conversations.updated_at DESC") // 按会话更新时间排序
+	// 用户参与的会话来自 conversation_participants；订阅的频道不写入参与者表，需从 channel_subscriptions 单独查出。
+	participantConvos := r.db.Model(&models.ConversationParticipant{}).Select("conversation_id").Where("user_id = ?", userID)
+	subscribedChannels := r.db.Model(&models.ChannelSubscription{}).
+		Select("channels.conversation_id").
+		Joins("JOIN channels ON channels.id = channel_subscriptions.channel_id AND channels.deleted_at IS NULL").
+		Where("channel_subscriptions.user_id = ?", userID)
+	query := r.db.WithContext(ctx).
+		Where("conversations.id IN (?) OR conversations.id IN (?)", participantConvos, subscribedChannels).
+		Order("conversations.updated_at DESC") // 按会话更新时间排序
 
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -140,6 +150,15 @@ func (r *gormConversationRepository) GetConversationParticipants(ctx context.Con
 	return participants, err
 }
 
+// GetParticipantUserIDs 获取会话所有参与者的用户ID。
+func (r *gormConversationRepository) GetParticipantUserIDs(ctx context.Context, conversationID uint) ([]uint, error) {
+	var userIDs []uint
+	err := r.db.WithContext(ctx).Model(&models.ConversationParticipant{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
 // FindPrivateConversationByUsers 尝试查找两个特定用户之间的私聊会话。
 // 这对于防止重复创建相同的1v1会话很有用。
 func (r *gormConversationRepository) FindPrivateConversationByUsers(ctx context.Context, userID1 uint, userID2 uint) (*models.Conversation, error) {
@@ -234,6 +253,18 @@ func (r *gormConversationRepository) FindOrCreatePrivateConversationWithTx(ctx c
 	return &conversation, nil
 }
 
+// FindGroupConversation 查找与群组关联的群聊会话 (Type="group", TargetID=groupID)。
+func (r *gormConversationRepository) FindGroupConversation(ctx context.Context, groupID uint) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND target_id = ?", models.GroupConversation, groupID).
+		First(&conversation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
 // GetDB 返回底层数据库连接，用于事务操作
 func (r *gormConversationRepository) GetDB() *gorm.DB {
 	return r.db
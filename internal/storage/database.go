@@ -82,11 +82,43 @@ func AutoMigrateTables(db *gorm.DB) error {
 		&models.GroupMember{},
 		&models.FriendRequest{},
 		&models.Friendship{},
+		&models.GroupPermissionSetting{},
+		&models.GroupAnnouncement{},
+		&models.GroupAnnouncementAck{},
+		&models.PinnedMessage{},
+		&models.Channel{},
+		&models.ChannelSubscription{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.SigningKey{},
+		&models.UserToken{},
+		&models.TOTPCredential{},
+		&models.RecoveryCode{},
+		&models.LoginLockout{},
+		&models.ExternalIdentity{},
+		&models.APIKey{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.BotCommand{},
+		&models.UserBlock{},
+		&models.PrivacySettings{},
+		&models.FriendProfile{},
+		&models.ContactGroup{},
+		&models.OutboxEvent{},
+		&models.Attachment{},
 	)
 	if err != nil {
 		log.Printf("数据库迁移失败: %v", err)
 		return fmt.Errorf("数据库迁移失败: %w", err)
 	}
+
+	// 旧数据中群主以 admin 角色入群，这里将其修正为 owner，保证角色层级校验正确。
+	if err := db.Exec(`UPDATE group_members SET role = ? FROM groups
+		WHERE group_members.group_id = groups.id AND group_members.user_id = groups.owner_id AND group_members.role <> ?`,
+		models.OwnerRole, models.OwnerRole).Error; err != nil {
+		log.Printf("修正群主角色失败: %v", err)
+		return fmt.Errorf("修正群主角色失败: %w", err)
+	}
 	log.Println("数据库迁移完成。")
 	return nil
 }
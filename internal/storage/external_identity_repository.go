@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// ExternalIdentityRepository 定义了外部身份关联的数据操作接口。
+type ExternalIdentityRepository interface {
+	CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error)
+	GetIdentitiesByUser(ctx context.Context, userID uint) ([]*models.ExternalIdentity, error)
+	// UpdateLastLogin 记录一次通过该外部身份的登录。
+	UpdateLastLogin(ctx context.Context, id uint, email string, at time.Time) error
+
+	// GetDB 返回底层数据库连接，用于事务操作
+	GetDB() *gorm.DB
+}
+
+// gormExternalIdentityRepository 使用 GORM 实现 ExternalIdentityRepository。
+type gormExternalIdentityRepository struct {
+	db *gorm.DB
+}
+
+// NewGormExternalIdentityRepository 创建一个新的基于 GORM 的 ExternalIdentityRepository。
+func NewGormExternalIdentityRepository(db *gorm.DB) ExternalIdentityRepository {
+	return &gormExternalIdentityRepository{db: db}
+}
+
+// CreateIdentity 保存一个新的外部身份关联。
+func (r *gormExternalIdentityRepository) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+// GetIdentity 通过提供方和 Subject 检索外部身份。
+func (r *gormExternalIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	if err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetIdentitiesByUser 检索用户关联的所有外部身份。
+func (r *gormExternalIdentityRepository) GetIdentitiesByUser(ctx context.Context, userID uint) ([]*models.ExternalIdentity, error) {
+	var identities []*models.ExternalIdentity
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at ASC").Find(&identities).Error
+	return identities, err
+}
+
+// UpdateLastLogin 更新最近登录时间和邮箱。
+func (r *gormExternalIdentityRepository) UpdateLastLogin(ctx context.Context, id uint, email string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.ExternalIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"email": email, "last_login_at": at}).Error
+}
+
+// GetDB 返回底层数据库连接。
+func (r *gormExternalIdentityRepository) GetDB() *gorm.DB {
+	return r.db
+}
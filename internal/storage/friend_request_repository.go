@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"im-go/internal/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -16,6 +17,13 @@ type FriendRequestRepository interface {
 	GetRequestByID(ctx context.Context, requestID uint) (*models.FriendRequest, error)
 	UpdateRequestStatus(ctx context.Context, requestID uint, status models.FriendRequestStatus) error
 	GetPendingRequestsForUser(ctx context.Context, recipientUserID uint) ([]models.FriendRequest, error)
+	GetOutgoingPendingRequests(ctx context.Context, requesterUserID uint) ([]models.FriendRequest, error)
+	// CountSentSince counts the requests a user has sent since the given time, whatever their status now.
+	CountSentSince(ctx context.Context, requesterUserID uint, since time.Time) (int64, error)
+	// GetPendingCreatedBefore lists up to limit pending requests created before the given time, oldest first.
+	GetPendingCreatedBefore(ctx context.Context, before time.Time, limit int) ([]models.FriendRequest, error)
+	// UpdateStatusIfPending changes the status only if the request is still pending and reports whether it did.
+	UpdateStatusIfPending(ctx context.Context, requestID uint, status models.FriendRequestStatus) (bool, error)
 }
 
 type gormFriendRequestRepository struct {
@@ -63,3 +71,41 @@ func (r *gormFriendRequestRepository) GetPendingRequestsForUser(ctx context.Cont
 	err := r.db.WithContext(ctx).Where("recipient_user_id = ? AND status = ?", recipientUserID, models.FriendRequestStatusPending).Find(&requests).Error
 	return requests, err
 }
+
+// GetOutgoingPendingRequests lists the pending requests a user has sent, newest first.
+func (r *gormFriendRequestRepository) GetOutgoingPendingRequests(ctx context.Context, requesterUserID uint) ([]models.FriendRequest, error) {
+	var requests []models.FriendRequest
+	err := r.db.WithContext(ctx).
+		Where("requester_user_id = ? AND status = ?", requesterUserID, models.FriendRequestStatusPending).
+		Order("created_at DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// CountSentSince includes cancelled and processed requests, so cancelling and re-sending does not get around the daily limit.
+func (r *gormFriendRequestRepository) CountSentSince(ctx context.Context, requesterUserID uint, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.FriendRequest{}).
+		Where("requester_user_id = ? AND created_at >= ?", requesterUserID, since).
+		Count(&count).Error
+	return count, err
+}
+
+// GetPendingCreatedBefore finds stale pending requests for expiry.
+func (r *gormFriendRequestRepository) GetPendingCreatedBefore(ctx context.Context, before time.Time, limit int) ([]models.FriendRequest, error) {
+	var requests []models.FriendRequest
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND created_at < ?", models.FriendRequestStatusPending, before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&requests).Error
+	return requests, err
+}
+
+// UpdateStatusIfPending guards against overwriting a request that was accepted, rejected or cancelled concurrently.
+func (r *gormFriendRequestRepository) UpdateStatusIfPending(ctx context.Context, requestID uint, status models.FriendRequestStatus) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.FriendRequest{}).
+		Where("id = ? AND status = ?", requestID, models.FriendRequestStatusPending).
+		Update("status", status)
+	return result.RowsAffected > 0, result.Error
+}
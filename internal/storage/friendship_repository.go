@@ -5,6 +5,7 @@ import (
 	"im-go/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // FriendshipRepository defines the interface for friendship data operations.
@@ -12,7 +13,26 @@ type FriendshipRepository interface {
 	Create(ctx context.Context, friendship *models.Friendship) error
 	AreUsersFriends(ctx context.Context, userID1, userID2 uint) (bool, error)
 	GetFriendIDs(ctx context.Context, userID uint) ([]uint, error)
-	// TODO: Add other methods like ListFriends(userID uint), RemoveFriendship(userID1, userID2 uint) if needed
+	// Delete removes the friendship between two users, together with both users' FriendProfile
+	// about each other, and reports whether it existed.
+	Delete(ctx context.Context, userID1, userID2 uint) (bool, error)
+
+	// GetProfiles retrieves all FriendProfile rows owned by ownerID.
+	GetProfiles(ctx context.Context, ownerID uint) ([]*models.FriendProfile, error)
+	// SaveProfile creates or updates the owner's profile of a friend.
+	SaveProfile(ctx context.Context, profile *models.FriendProfile) error
+
+	// ListContactGroups retrieves the owner's contact groups ordered by name.
+	ListContactGroups(ctx context.Context, ownerID uint) ([]*models.ContactGroup, error)
+	// GetContactGroup retrieves one of the owner's contact groups, returning gorm.ErrRecordNotFound if it does not exist.
+	GetContactGroup(ctx context.Context, ownerID, groupID uint) (*models.ContactGroup, error)
+	// CreateContactGroup creates a contact group.
+	CreateContactGroup(ctx context.Context, group *models.ContactGroup) error
+	// RenameContactGroup changes the name of a contact group.
+	RenameContactGroup(ctx context.Context, groupID uint, name string) error
+	// DeleteContactGroup deletes one of the owner's contact groups, moves its friends out of it,
+	// and reports whether it existed.
+	DeleteContactGroup(ctx context.Context, ownerID, groupID uint) (bool, error)
 }
 
 type gormFriendshipRepository struct {
@@ -44,6 +64,88 @@ func (r *gormFriendshipRepository) AreUsersFriends(ctx context.Context, userID1,
 	return count > 0, nil
 }
 
+// Delete hard-deletes the friendship and the profiles in one transaction, so the unique indexes allow the
+// users to become friends again later and a new friendship starts without the old remarks and tags.
+func (r *gormFriendshipRepository) Delete(ctx context.Context, userID1, userID2 uint) (bool, error) {
+	u1, u2 := userID1, userID2
+	if u1 > u2 {
+		u1, u2 = u2, u1 // Ensure canonical order for query
+	}
+	var removed bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("user_id1 = ? AND user_id2 = ?", u1, u2).Delete(&models.Friendship{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected > 0
+		return tx.Unscoped().
+			Where("(owner_id = ? AND friend_id = ?) OR (owner_id = ? AND friend_id = ?)", u1, u2, u2, u1).
+			Delete(&models.FriendProfile{}).Error
+	})
+	return removed, err
+}
+
+// GetProfiles retrieves the owner's friend profiles.
+func (r *gormFriendshipRepository) GetProfiles(ctx context.Context, ownerID uint) ([]*models.FriendProfile, error) {
+	var profiles []*models.FriendProfile
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Find(&profiles).Error
+	return profiles, err
+}
+
+// SaveProfile upserts the profile using (owner_id, friend_id) as the conflict key.
+func (r *gormFriendshipRepository) SaveProfile(ctx context.Context, profile *models.FriendProfile) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "owner_id"}, {Name: "friend_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"remark", "tags", "contact_group_id", "updated_at"}),
+	}).Create(profile).Error
+}
+
+// ListContactGroups retrieves the owner's contact groups.
+func (r *gormFriendshipRepository) ListContactGroups(ctx context.Context, ownerID uint) ([]*models.ContactGroup, error) {
+	var groups []*models.ContactGroup
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("name ASC").Find(&groups).Error
+	return groups, err
+}
+
+// GetContactGroup retrieves a contact group, scoped to its owner.
+func (r *gormFriendshipRepository) GetContactGroup(ctx context.Context, ownerID, groupID uint) (*models.ContactGroup, error) {
+	var group models.ContactGroup
+	if err := r.db.WithContext(ctx).Where("id = ? AND owner_id = ?", groupID, ownerID).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateContactGroup inserts a new contact group.
+func (r *gormFriendshipRepository) CreateContactGroup(ctx context.Context, group *models.ContactGroup) error {
+	return r.db.WithContext(ctx).Create(group).Error
+}
+
+// RenameContactGroup updates the name of a contact group.
+func (r *gormFriendshipRepository) RenameContactGroup(ctx context.Context, groupID uint, name string) error {
+	return r.db.WithContext(ctx).Model(&models.ContactGroup{}).Where("id = ?", groupID).Update("name", name).Error
+}
+
+// DeleteContactGroup hard-deletes the group so its name can be reused, and clears contact_group_id
+// on the profiles that referenced it.
+func (r *gormFriendshipRepository) DeleteContactGroup(ctx context.Context, ownerID, groupID uint) (bool, error) {
+	var removed bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND owner_id = ?", groupID, ownerID).Delete(&models.ContactGroup{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected > 0
+		if !removed {
+			return nil
+		}
+		return tx.Model(&models.FriendProfile{}).
+			Where("owner_id = ? AND contact_group_id = ?", ownerID, groupID).
+			Update("contact_group_id", nil).Error
+	})
+	return removed, err
+}
+
 // GetFriendIDs retrieves a list of user IDs who are friends with the given userID.
 func (r *gormFriendshipRepository) GetFriendIDs(ctx context.Context, userID uint) ([]uint, error) {
 	var friendIDs []uint
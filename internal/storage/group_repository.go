@@ -24,6 +24,11 @@ type GroupRepository interface {
 	RemoveMember(ctx context.Context, groupID uint, userID uint) error
 	GetGroupMembers(ctx context.Context, groupID uint, limit int, offset int) ([]*models.GroupMember, error)
 	GetUserGroups(ctx context.Context, userID uint, limit int, offset int) ([]*models.Group, error)
+
+	// GetPermissionSettings 获取群组单独配置过的权限项。
+	GetPermissionSettings(ctx context.Context, groupID uint) ([]*models.GroupPermissionSetting, error)
+	// SavePermissionSetting 新增或覆盖群组某项权限所需的最低角色。
+	SavePermissionSetting(ctx context.Context, setting *models.GroupPermissionSetting) error
 }
 
 // gormGroupRepository 使用 GORM 实现 GroupRepository。
@@ -146,3 +151,18 @@ func (r *gormGroupRepository) GetUserGroups(ctx context.Context, userID uint, li
 	err := dbQuery.Find(&groups).Error
 	return groups, err
 }
+
+// GetPermissionSettings 获取群组单独配置过的权限项。
+func (r *gormGroupRepository) GetPermissionSettings(ctx context.Context, groupID uint) ([]*models.GroupPermissionSetting, error) {
+	var settings []*models.GroupPermissionSetting
+	err := r.db.WithContext(ctx).Where("group_id = ?", groupID).Find(&settings).Error
+	return settings, err
+}
+
+// SavePermissionSetting 新增或覆盖群组某项权限所需的最低角色。
+func (r *gormGroupRepository) SavePermissionSetting(ctx context.Context, setting *models.GroupPermissionSetting) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "permission"}},
+		DoUpdates: clause.AssignmentColumns([]string{"min_role", "updated_at"}),
+	}).Create(setting).Error
+}
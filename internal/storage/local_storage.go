@@ -2,8 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"mime"
 	"net/url"
 	"os"
@@ -78,7 +80,7 @@ func (s *LocalStorageService) UploadFile(ctx context.Context, reader io.Reader,
 
 	fileInfo := &imtypes.FileInfo{
 		URL:      fileURL,
-		Path:     dstPath, // 返回本地路径作为内部标识
+		Path:     uniqueFileName, // 返回相对于 basePath 的文件名作为内部标识
 		Size:     fileSize,
 		MimeType: mimeType,
 		FileName: fileName, // 返回原始文件名
@@ -87,7 +89,109 @@ func (s *LocalStorageService) UploadFile(ctx context.Context, reader io.Reader,
 	return fileInfo, nil
 }
 
-// DeleteFile (可选实现)
-// func (s *LocalStorageService) DeleteFile(ctx context.Context, pathOrIdentifier string) error {
-// 	 return os.Remove(pathOrIdentifier) // 假设 pathOrIdentifier 是本地文件路径
-// }
+// Open 打开本地文件，*os.File 本身支持 Seek。
+func (s *LocalStorageService) Open(ctx context.Context, path string) (io.ReadSeekCloser, *imtypes.ObjectInfo, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, nil, localFileError(path, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, localFileError(path, err)
+	}
+	if !stat.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, imtypes.ErrFileNotFound
+	}
+	return f, localObjectInfo(path, stat), nil
+}
+
+// Stat 返回本地文件的元数据。MIME 类型由扩展名推断。
+func (s *LocalStorageService) Stat(ctx context.Context, path string) (*imtypes.ObjectInfo, error) {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, localFileError(path, err)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, imtypes.ErrFileNotFound
+	}
+	return localObjectInfo(path, stat), nil
+}
+
+// Delete 删除本地文件。
+func (s *LocalStorageService) Delete(ctx context.Context, path string) error {
+	fullPath, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil {
+		return localFileError(path, err)
+	}
+	return nil
+}
+
+// List 列出 basePath 下以 prefix 开头的文件。上传的文件都直接保存在 basePath 下，因此不遍历子目录。
+func (s *LocalStorageService) List(ctx context.Context, prefix string, limit int) ([]*imtypes.ObjectInfo, error) {
+	entries, err := os.ReadDir(s.basePath) // 按文件名排序
+	if err != nil {
+		return nil, fmt.Errorf("读取本地存储目录失败 '%s': %w", s.basePath, err)
+	}
+	var result []*imtypes.ObjectInfo
+	for _, entry := range entries {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // 列出期间被删除
+			}
+			return nil, fmt.Errorf("读取文件信息失败 '%s': %w", entry.Name(), err)
+		}
+		result = append(result, localObjectInfo(entry.Name(), stat))
+	}
+	return result, nil
+}
+
+// resolve 把 path 转换为 basePath 下的本地路径。上传的文件名不含目录，因此拒绝任何带目录的路径，
+// 避免通过 ".." 等方式访问 basePath 之外的文件。
+func (s *LocalStorageService) resolve(path string) (string, error) {
+	if path == "" || path == "." || path == ".." || strings.ContainsAny(path, `/\`) {
+		return "", imtypes.ErrInvalidFilePath
+	}
+	return filepath.Join(s.basePath, path), nil
+}
+
+// localFileError 把文件不存在的错误转换为 imtypes.ErrFileNotFound。
+func localFileError(path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return imtypes.ErrFileNotFound
+	}
+	return fmt.Errorf("访问文件失败 '%s': %w", path, err)
+}
+
+// localObjectInfo 由文件信息构造 ObjectInfo。
+func localObjectInfo(path string, stat fs.FileInfo) *imtypes.ObjectInfo {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &imtypes.ObjectInfo{
+		Path:     path,
+		Size:     stat.Size(),
+		MimeType: mimeType,
+		ModTime:  stat.ModTime(),
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// LoginLockoutRepository 定义了登录锁定记录的数据操作接口。
+type LoginLockoutRepository interface {
+	CreateLockout(ctx context.Context, lockout *models.LoginLockout) error
+	// GetActiveLockout 返回登录标识在 now 时仍然生效的锁定中解除时间最晚的一条。
+	GetActiveLockout(ctx context.Context, identifier string, now time.Time) (*models.LoginLockout, error)
+	// ClearActiveLockouts 提前解除用户所有仍然生效的锁定。
+	ClearActiveLockouts(ctx context.Context, userID uint, at time.Time) error
+}
+
+// gormLoginLockoutRepository 使用 GORM 实现 LoginLockoutRepository。
+type gormLoginLockoutRepository struct {
+	db *gorm.DB
+}
+
+// NewGormLoginLockoutRepository 创建一个新的基于 GORM 的 LoginLockoutRepository。
+func NewGormLoginLockoutRepository(db *gorm.DB) LoginLockoutRepository {
+	return &gormLoginLockoutRepository{db: db}
+}
+
+// CreateLockout 保存一条锁定记录。
+func (r *gormLoginLockoutRepository) CreateLockout(ctx context.Context, lockout *models.LoginLockout) error {
+	return r.db.WithContext(ctx).Create(lockout).Error
+}
+
+// GetActiveLockout 检索仍然生效的锁定。
+func (r *gormLoginLockoutRepository) GetActiveLockout(ctx context.Context, identifier string, now time.Time) (*models.LoginLockout, error) {
+	var lockout models.LoginLockout
+	err := r.db.WithContext(ctx).
+		Where("identifier = ? AND locked_until > ? AND cleared_at IS NULL", identifier, now).
+		Order("locked_until DESC").
+		First(&lockout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// ClearActiveLockouts 解除仍然生效的锁定。
+func (r *gormLoginLockoutRepository) ClearActiveLockouts(ctx context.Context, userID uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.LoginLockout{}).
+		Where("user_id = ? AND locked_until > ? AND cleared_at IS NULL", userID, at).
+		Update("cleared_at", at).Error
+}
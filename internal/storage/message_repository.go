@@ -13,7 +13,9 @@ type MessageRepository interface {
 	Create(ctx context.Context, message *models.Message) error
 	GetByID(ctx context.Context, id uint) (*models.Message, error)
 	GetByConversationID(ctx context.Context, conversationID uint, limit int, offset int) ([]*models.Message, error)
-	// Update(ctx context.Context, message *models.Message) error // 一般消息创建后不直接更新内容，可能更新状态
+	Update(ctx context.Context, message *models.Message) error // 一般消息创建后不直接更新内容，用于更新状态 (例如撤回)
+	// HasSentPrivateMessage 检查 fromID 是否在与 toID 的私聊会话中发送过消息。
+	HasSentPrivateMessage(ctx context.Context, fromID, toID uint) (bool, error)
 	// Delete(ctx context.Context, id uint) error // 消息通常是软删除或逻辑删除，较少物理删除
 	// UpdateStatus(ctx context.Context, messageIDs []uint, status string) error // 批量更新消息状态，例如已读
 }
@@ -33,6 +35,11 @@ func (r *gormMessageRepository) Create(ctx context.Context, message *models.Mess
 	return r.db.WithContext(ctx).Create(message).Error
 }
 
+// Update 更新消息记录。
+func (r *gormMessageRepository) Update(ctx context.Context, message *models.Message) error {
+	return r.db.WithContext(ctx).Omit("Sender", "Conversation").Save(message).Error
+}
+
 // GetByID 通过ID检索消息。
 func (r *gormMessageRepository) GetByID(ctx context.Context, id uint) (*models.Message, error) {
 	var message models.Message
@@ -63,3 +70,14 @@ func (r *gormMessageRepository) GetByConversationID(ctx context.Context, convers
 	}
 	return messages, nil
 }
+
+// HasSentPrivateMessage 通过 toID 的参与者记录定位两人之间的私聊会话，统计 fromID 在其中发送的消息。
+func (r *gormMessageRepository) HasSentPrivateMessage(ctx context.Context, fromID, toID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Message{}).
+		Joins("JOIN conversations c ON c.id = messages.conversation_id AND c.type = ?", models.PrivateConversation).
+		Joins("JOIN conversation_participants cp ON cp.conversation_id = messages.conversation_id AND cp.user_id = ?", toID).
+		Where("messages.sender_id = ?", fromID).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// OutboxRepository 定义了事务性发件箱的数据操作接口。
+// 写入事件时应使用业务事务的 *gorm.DB 创建实例 (NewGormOutboxRepository(tx))，使事件与业务数据一同提交或回滚。
+type OutboxRepository interface {
+	// Create 保存一条待发布的事件。
+	Create(ctx context.Context, event *models.OutboxEvent) error
+	// GetDueEvents 返回到期待发布的事件，最早写入的在前。
+	GetDueEvents(ctx context.Context, now time.Time, limit int) ([]*models.OutboxEvent, error)
+	// ClaimEvent 认领一条待发布事件：发布次数加一并把下次尝试时间推迟到 leaseUntil，
+	// 返回 false 表示事件已被其他实例认领。
+	ClaimEvent(ctx context.Context, id uint, attempts int, leaseUntil time.Time) (bool, error)
+	// MarkPublished 将事件标记为已发布。
+	MarkPublished(ctx context.Context, id uint, publishedAt time.Time) error
+	// MarkFailedAttempt 记录一次失败的发布，status 为 pending 时在 nextAttemptAt 重试，为 failed 时不再重试。
+	MarkFailedAttempt(ctx context.Context, id uint, status models.OutboxEventStatus, nextAttemptAt time.Time, lastError string) error
+	// DeletePublishedBefore 硬删除在 before 之前发布的事件，返回删除的条数。
+	DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error)
+	// CountByStatus 返回指定状态的事件数，用于观察积压和失败情况。
+	CountByStatus(ctx context.Context, status models.OutboxEventStatus) (int64, error)
+}
+
+// gormOutboxRepository 使用 GORM 实现 OutboxRepository。
+type gormOutboxRepository struct {
+	db *gorm.DB
+}
+
+// NewGormOutboxRepository 创建一个新的基于 GORM 的 OutboxRepository。
+func NewGormOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &gormOutboxRepository{db: db}
+}
+
+// Create 保存事件。
+func (r *gormOutboxRepository) Create(ctx context.Context, event *models.OutboxEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// GetDueEvents 检索到期的待发布事件。按 ID 排序，尽量保持同一业务对象的事件按写入顺序发布。
+func (r *gormOutboxRepository) GetDueEvents(ctx context.Context, now time.Time, limit int) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// ClaimEvent 以发布次数作为版本号认领事件。
+func (r *gormOutboxRepository) ClaimEvent(ctx context.Context, id uint, attempts int, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.OutboxEvent{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, models.OutboxPending, attempts).
+		Updates(map[string]interface{}{"attempts": attempts + 1, "next_attempt_at": leaseUntil})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkPublished 保存发布成功的结果。
+func (r *gormOutboxRepository) MarkPublished(ctx context.Context, id uint, publishedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": models.OutboxPublished, "published_at": publishedAt, "last_error": ""}).Error
+}
+
+// MarkFailedAttempt 保存发布失败的结果。
+func (r *gormOutboxRepository) MarkFailedAttempt(ctx context.Context, id uint, status models.OutboxEventStatus, nextAttemptAt time.Time, lastError string) error {
+	return r.db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "next_attempt_at": nextAttemptAt, "last_error": lastError}).Error
+}
+
+// DeletePublishedBefore 清理过期的已发布事件。
+func (r *gormOutboxRepository) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("status = ? AND published_at < ?", models.OutboxPublished, before).
+		Delete(&models.OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// CountByStatus 统计指定状态的事件数。
+func (r *gormOutboxRepository) CountByStatus(ctx context.Context, status models.OutboxEventStatus) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("status = ?", status).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// PinnedMessageRepository 定义了置顶消息的数据操作接口。
+type PinnedMessageRepository interface {
+	Create(ctx context.Context, pin *models.PinnedMessage) error
+	Get(ctx context.Context, conversationID, messageID uint) (*models.PinnedMessage, error)
+	Delete(ctx context.Context, conversationID, messageID uint) error
+	// ListByConversation 获取会话的置顶消息，最近置顶的排在最前。
+	ListByConversation(ctx context.Context, conversationID uint) ([]*models.PinnedMessage, error)
+}
+
+// gormPinnedMessageRepository 使用 GORM 实现 PinnedMessageRepository。
+type gormPinnedMessageRepository struct {
+	db *gorm.DB
+}
+
+// NewGormPinnedMessageRepository 创建一个新的基于 GORM 的 PinnedMessageRepository。
+func NewGormPinnedMessageRepository(db *gorm.DB) PinnedMessageRepository {
+	return &gormPinnedMessageRepository{db: db}
+}
+
+// Create 新增一条置顶记录。
+func (r *gormPinnedMessageRepository) Create(ctx context.Context, pin *models.PinnedMessage) error {
+	return r.db.WithContext(ctx).Create(pin).Error
+}
+
+// Get 获取会话中某条消息的置顶记录。
+func (r *gormPinnedMessageRepository) Get(ctx context.Context, conversationID, messageID uint) (*models.PinnedMessage, error) {
+	var pin models.PinnedMessage
+	err := r.db.WithContext(ctx).Where("conversation_id = ? AND message_id = ?", conversationID, messageID).First(&pin).Error
+	if err != nil {
+		return nil, err
+	}
+	return &pin, nil
+}
+
+// Delete 移除置顶记录。使用硬删除，以便同一条消息可以再次被置顶。
+func (r *gormPinnedMessageRepository) Delete(ctx context.Context, conversationID, messageID uint) error {
+	return r.db.WithContext(ctx).Unscoped().
+		Where("conversation_id = ? AND message_id = ?", conversationID, messageID).
+		Delete(&models.PinnedMessage{}).Error
+}
+
+// ListByConversation 获取会话的置顶消息列表。
+func (r *gormPinnedMessageRepository) ListByConversation(ctx context.Context, conversationID uint) ([]*models.PinnedMessage, error) {
+	var pins []*models.PinnedMessage
+	err := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID).
+		Preload("Message.Sender").Preload("PinnedBy").
+		Order("pinned_at DESC").Find(&pins).Error
+	return pins, err
+}
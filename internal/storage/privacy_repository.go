@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"im-go/internal/models"
+)
+
+// PrivacyRepository 定义了拉黑名单和隐私设置的数据操作接口。
+type PrivacyRepository interface {
+	// AddBlock 保存拉黑记录，已拉黑时不做任何事。
+	AddBlock(ctx context.Context, block *models.UserBlock) error
+	// RemoveBlock 删除拉黑记录，返回记录是否存在。
+	RemoveBlock(ctx context.Context, blockerID, blockedID uint) (bool, error)
+	// ListBlocks 返回用户拉黑的所有用户，预加载 Blocked，最近拉黑的在前。
+	ListBlocks(ctx context.Context, blockerID uint) ([]*models.UserBlock, error)
+	// HasBlocked 检查 blockerID 是否拉黑了 blockedID。
+	HasBlocked(ctx context.Context, blockerID, blockedID uint) (bool, error)
+	// IsBlockedEitherWay 检查两个用户之间是否存在任一方向的拉黑。
+	IsBlockedEitherWay(ctx context.Context, userID1, userID2 uint) (bool, error)
+
+	// GetSettings 获取用户的隐私设置，用户从未修改过设置时返回 gorm.ErrRecordNotFound。
+	GetSettings(ctx context.Context, userID uint) (*models.PrivacySettings, error)
+	// SaveSettings 创建或更新用户的隐私设置。
+	SaveSettings(ctx context.Context, settings *models.PrivacySettings) error
+}
+
+// gormPrivacyRepository 使用 GORM 实现 PrivacyRepository。
+type gormPrivacyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormPrivacyRepository 创建一个新的基于 GORM 的 PrivacyRepository。
+func NewGormPrivacyRepository(db *gorm.DB) PrivacyRepository {
+	return &gormPrivacyRepository{db: db}
+}
+
+// AddBlock 使用 ON CONFLICT DO NOTHING 保存拉黑记录，重复拉黑不会报错。
+func (r *gormPrivacyRepository) AddBlock(ctx context.Context, block *models.UserBlock) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error
+}
+
+// RemoveBlock 硬删除拉黑记录，避免软删除的记录占用唯一索引导致无法再次拉黑。
+func (r *gormPrivacyRepository) RemoveBlock(ctx context.Context, blockerID, blockedID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Delete(&models.UserBlock{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListBlocks 检索用户的拉黑名单。
+func (r *gormPrivacyRepository) ListBlocks(ctx context.Context, blockerID uint) ([]*models.UserBlock, error) {
+	var blocks []*models.UserBlock
+	err := r.db.WithContext(ctx).
+		Where("blocker_id = ?", blockerID).
+		Preload("Blocked").
+		Order("created_at DESC").
+		Find(&blocks).Error
+	return blocks, err
+}
+
+// HasBlocked 检查单向的拉黑关系。
+func (r *gormPrivacyRepository) HasBlocked(ctx context.Context, blockerID, blockedID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.UserBlock{}).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsBlockedEitherWay 检查双向的拉黑关系。
+func (r *gormPrivacyRepository) IsBlockedEitherWay(ctx context.Context, userID1, userID2 uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userID1, userID2, userID2, userID1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetSettings 检索用户的隐私设置。
+func (r *gormPrivacyRepository) GetSettings(ctx context.Context, userID uint) (*models.PrivacySettings, error) {
+	var settings models.PrivacySettings
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SaveSettings 以 user_id 为冲突键写入隐私设置。
+func (r *gormPrivacyRepository) SaveSettings(ctx context.Context, settings *models.PrivacySettings) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"search_visibility", "message_permission", "group_invite_permission", "updated_at"}),
+	}).Create(settings).Error
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/imtypes"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minPartSize 是 S3 允许的最小分片大小 (最后一个分片除外)。
+const minPartSize = 5 << 20
+
+// S3StorageService 实现了 imtypes.StorageService 和 imtypes.PresignedURLProvider 接口，
+// 把文件保存到 AWS S3 或 MinIO 等兼容 S3 的对象存储中。
+type S3StorageService struct {
+	client        *minio.Client
+	bucket        string
+	baseURL       string // 返回给客户端的文件 URL 前缀，API 服务器把该前缀下的请求重定向到预签名 URL
+	partSize      uint64
+	presignExpiry time.Duration
+}
+
+// NewS3StorageService 创建一个新的 S3StorageService 实例，并检查存储桶是否存在。
+// 总是使用路径风格 (endpoint/bucket/key) 访问，以兼容没有配置泛域名的 MinIO 部署。
+func NewS3StorageService(ctx context.Context, cfg config.StorageConfig, baseURL string) (*S3StorageService, error) {
+	s3Cfg := cfg.S3
+	if s3Cfg.BucketName == "" {
+		return nil, fmt.Errorf("未配置 S3 存储桶名称")
+	}
+	endpoint, secure, err := parseS3Endpoint(s3Cfg.Endpoint, s3Cfg.UseSSL)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(s3Cfg.AccessKeyID, s3Cfg.SecretAccessKey, ""),
+		Secure:       secure,
+		Region:       s3Cfg.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 S3 客户端失败: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, s3Cfg.BucketName)
+	if err != nil {
+		return nil, fmt.Errorf("检查 S3 存储桶 '%s' 失败: %w", s3Cfg.BucketName, err)
+	}
+	if !exists {
+		if !s3Cfg.CreateBucket {
+			return nil, fmt.Errorf("S3 存储桶 '%s' 不存在", s3Cfg.BucketName)
+		}
+		if err := client.MakeBucket(ctx, s3Cfg.BucketName, minio.MakeBucketOptions{Region: s3Cfg.Region}); err != nil {
+			return nil, fmt.Errorf("创建 S3 存储桶 '%s' 失败: %w", s3Cfg.BucketName, err)
+		}
+	}
+
+	partSize := uint64(s3Cfg.PartSizeMB) << 20
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	presignExpiry := s3Cfg.PresignExpiry
+	if presignExpiry <= 0 {
+		presignExpiry = 15 * time.Minute
+	}
+	return &S3StorageService{
+		client:        client,
+		bucket:        s3Cfg.BucketName,
+		baseURL:       baseURL,
+		partSize:      partSize,
+		presignExpiry: presignExpiry,
+	}, nil
+}
+
+// parseS3Endpoint 把配置中的 Endpoint 拆分为主机和是否使用 HTTPS。Endpoint 可以带 http:// 或 https:// 前缀，
+// 不带前缀时由 useSSL 决定；为空时使用 AWS S3。
+func parseS3Endpoint(endpoint string, useSSL bool) (string, bool, error) {
+	if endpoint == "" {
+		return "s3.amazonaws.com", true, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/"), useSSL, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("无效的 S3 Endpoint '%s'", endpoint)
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("S3 Endpoint '%s' 的协议必须是 http 或 https", endpoint)
+	}
+}
+
+// UploadFile 把文件上传到存储桶。超过分片大小的文件由客户端库自动使用分片上传，
+// 失败时未完成的分片上传会被中止。
+func (s *S3StorageService) UploadFile(ctx context.Context, reader io.Reader, fileSize int64, fileName string, mimeType string) (*imtypes.FileInfo, error) {
+	// 与本地存储相同，生成唯一的对象名并保留原始扩展名
+	ext := filepath.Ext(fileName)
+	if ext == "" {
+		extensions, _ := mime.ExtensionsByType(mimeType)
+		if len(extensions) > 0 {
+			ext = extensions[0]
+		}
+	}
+	key := uuid.New().String() + ext
+
+	contentType := mimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	// 数据比声明的大小少时，客户端库会按声明的大小反复重试同一个请求。不超过一个分片的文件先读入内存
+	// (分片上传时客户端库同样按分片缓冲)，大小不符时不发起请求；更大的文件在数据提前结束时立即报错并中止分片上传
+	switch {
+	case fileSize >= 0 && uint64(fileSize) <= s.partSize:
+		data, err := io.ReadAll(io.LimitReader(reader, fileSize))
+		if err != nil {
+			return nil, fmt.Errorf("读取上传文件失败: %w", err)
+		}
+		if int64(len(data)) != fileSize {
+			return nil, fmt.Errorf("文件大小不匹配: 预期 %d, 实际 %d", fileSize, len(data))
+		}
+		reader = bytes.NewReader(data)
+	case fileSize > 0:
+		reader = &sizedReader{r: reader, remaining: fileSize}
+	}
+	info, err := s.client.PutObject(ctx, s.bucket, key, reader, fileSize, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s.partSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("上传文件到 S3 失败: %w", err)
+	}
+	if info.Size != fileSize {
+		_ = s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+		return nil, fmt.Errorf("文件大小不匹配: 预期 %d, 实际上传 %d", fileSize, info.Size)
+	}
+
+	return &imtypes.FileInfo{
+		// URL 指向 API 服务器而不是预签名 URL，因为预签名 URL 会过期，而 URL 会保存在消息中
+		URL:      strings.TrimSuffix(s.baseURL, "/") + "/" + url.PathEscape(key),
+		Path:     key, // 对象键作为内部标识
+		Size:     fileSize,
+		MimeType: mimeType,
+		FileName: fileName,
+	}, nil
+}
+
+// PresignedGetURL 为对象生成预签名的下载 URL，expiry <= 0 时使用配置的有效期。
+func (s *S3StorageService) PresignedGetURL(ctx context.Context, path string, expiry time.Duration, contentDisposition string) (string, error) {
+	if err := validateS3Key(path); err != nil {
+		return "", err
+	}
+	if expiry <= 0 {
+		expiry = s.presignExpiry
+	}
+	var reqParams url.Values
+	if contentDisposition != "" {
+		// 由 S3 在响应中返回指定的头，签名覆盖该参数，客户端无法修改
+		reqParams = url.Values{"response-content-disposition": {contentDisposition}}
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, path, expiry, reqParams)
+	if err != nil {
+		return "", fmt.Errorf("生成预签名 URL 失败: %w", err)
+	}
+	return u.String(), nil
+}
+
+// Open 打开对象用于读取。minio.Object 按需发起带 Range 的请求，因此 Seek 不会下载整个对象。
+func (s *S3StorageService) Open(ctx context.Context, path string) (io.ReadSeekCloser, *imtypes.ObjectInfo, error) {
+	if err := validateS3Key(path); err != nil {
+		return nil, nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3ObjectError(path, err)
+	}
+	// GetObject 不会立即发起请求，通过 Stat 确认对象存在
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s3ObjectError(path, err)
+	}
+	return obj, s3ObjectInfo(stat), nil
+}
+
+// Stat 返回对象的元数据。
+func (s *S3StorageService) Stat(ctx context.Context, path string) (*imtypes.ObjectInfo, error) {
+	if err := validateS3Key(path); err != nil {
+		return nil, err
+	}
+	stat, err := s.client.StatObject(ctx, s.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3ObjectError(path, err)
+	}
+	return s3ObjectInfo(stat), nil
+}
+
+// Delete 删除对象。S3 删除不存在的对象不会报错，因此先确认对象存在，使行为与本地存储一致。
+func (s *S3StorageService) Delete(ctx context.Context, path string) error {
+	if _, err := s.Stat(ctx, path); err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, path, minio.RemoveObjectOptions{}); err != nil {
+		return s3ObjectError(path, err)
+	}
+	return nil
+}
+
+// List 列出以 prefix 开头的对象，S3 按键的字典序返回。
+func (s *S3StorageService) List(ctx context.Context, prefix string, limit int) ([]*imtypes.ObjectInfo, error) {
+	// 提前结束遍历时取消 ctx，让客户端库停止分页请求
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var result []*imtypes.ObjectInfo
+	for obj := range s.client.ListObjects(listCtx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("列出 S3 对象失败: %w", obj.Err)
+		}
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		result = append(result, s3ObjectInfo(obj))
+	}
+	return result, nil
+}
+
+// sizedReader 在读到 remaining 个字节之前遇到 EOF 时返回错误，而不是 io.EOF。
+type sizedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF && r.remaining > 0 {
+		return n, fmt.Errorf("文件数据不完整: 还差 %d 字节", r.remaining)
+	}
+	return n, err
+}
+
+// validateS3Key 拒绝不可能由 UploadFile 生成的对象键。
+func validateS3Key(path string) error {
+	if path == "" || strings.Contains(path, "/") {
+		return imtypes.ErrInvalidFilePath
+	}
+	return nil
+}
+
+// s3ObjectError 把对象不存在的错误转换为 imtypes.ErrFileNotFound。
+func s3ObjectError(path string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return imtypes.ErrFileNotFound
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("访问 S3 对象失败 '%s': %w", path, err)
+}
+
+// s3ObjectInfo 由对象信息构造 ObjectInfo。
+func s3ObjectInfo(obj minio.ObjectInfo) *imtypes.ObjectInfo {
+	mimeType := obj.ContentType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &imtypes.ObjectInfo{
+		Path:     obj.Key,
+		Size:     obj.Size,
+		MimeType: mimeType,
+		ModTime:  obj.LastModified,
+	}
+}
@@ -0,0 +1,508 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"im-go/internal/config"
+	"im-go/internal/imtypes"
+)
+
+const testBucket = "im-test"
+
+// fakeS3 是一个进程内的 S3 服务端，只实现 S3StorageService 用到的路径风格请求：
+// 存储桶的 HEAD/PUT，对象的 PUT/GET/HEAD/DELETE，以及分片上传的初始化、上传分片、完成和中止。
+// 不校验签名。
+type fakeS3 struct {
+	mu       sync.Mutex
+	buckets  map[string]map[string]*fakeObject
+	uploads  map[string]*fakeUpload // uploadId -> 未完成的分片上传
+	requests []string               // 按顺序记录的 "METHOD Host Path"
+	nextID   int
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+	parts       int // 分片上传的分片数，普通上传为 0
+}
+
+type fakeUpload struct {
+	bucket, key string
+	contentType string
+	parts       map[int][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]map[string]*fakeObject{}, uploads: map[string]*fakeUpload{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.Host+" "+r.URL.Path)
+	f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	if key == "" {
+		f.serveBucket(w, r, bucket, query)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.initiateUpload(w, r, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		f.uploadPart(w, r, query)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeUpload(w, r, bucket, key, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.mu.Lock()
+		delete(f.uploads, query.Get("uploadId"))
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		f.mu.Lock()
+		delete(f.buckets[bucket], key)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method+" "+r.URL.String())
+	}
+}
+
+func (f *fakeS3) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, query url.Values) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, exists := f.buckets[bucket]
+	switch {
+	case r.Method == http.MethodPut:
+		f.buckets[bucket] = map[string]*fakeObject{}
+	case r.Method == http.MethodGet && query.Has("location"):
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`)
+	case !exists:
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", bucket)
+	}
+}
+
+func (f *fakeS3) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	data, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects, ok := f.buckets[bucket]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+	objects[key] = &fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func (f *fakeS3) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	f.mu.Lock()
+	obj, ok := f.buckets[bucket][key]
+	f.mu.Unlock()
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+	w.Header().Set("ETag", `"etag"`)
+	w.Header().Set("Content-Type", obj.contentType)
+	if disposition := r.URL.Query().Get("response-content-disposition"); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	http.ServeContent(w, r, key, obj.modTime, bytes.NewReader(obj.data))
+}
+
+func (f *fakeS3) initiateUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	f.mu.Lock()
+	f.nextID++
+	uploadID := "upload-" + strconv.Itoa(f.nextID)
+	f.uploads[uploadID] = &fakeUpload{bucket: bucket, key: key, contentType: r.Header.Get("Content-Type"), parts: map[int][]byte{}}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, key, uploadID)
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	data, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload, ok := f.uploads[query.Get("uploadId")]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", query.Get("uploadId"))
+		return
+	}
+	upload.parts[partNumber] = data
+	w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, partNumber))
+}
+
+func (f *fakeS3) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) {
+	var complete struct {
+		Parts []struct {
+			PartNumber int
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+	var data []byte
+	for _, part := range complete.Parts {
+		data = append(data, upload.parts[part.PartNumber]...)
+	}
+	f.buckets[bucket][key] = &fakeObject{data: data, contentType: upload.contentType, modTime: time.Now().UTC(), parts: len(complete.Parts)}
+	delete(f.uploads, uploadID)
+
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"etag-%d"</ETag></CompleteMultipartUploadResult>`, bucket, key, len(complete.Parts))
+}
+
+func (f *fakeS3) object(key string) (*fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.buckets[testBucket][key]
+	return obj, ok
+}
+
+func (f *fakeS3) counts() (objects, uploads int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.buckets[testBucket]), len(f.uploads)
+}
+
+// readS3Body 读取请求体，客户端通过 HTTP 上传时使用 aws-chunked 编码的流式签名。
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		data, err := io.ReadAll(r.Body)
+		if err == nil && r.ContentLength >= 0 && int64(len(data)) != r.ContentLength {
+			err = io.ErrUnexpectedEOF
+		}
+		return data, err
+	}
+
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的分块大小 %q", line)
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size+2) // 数据后跟 "\r\n"
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" && decoded != strconv.Itoa(len(data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+}
+
+func newTestS3Storage(t *testing.T, fake *fakeS3, configure func(*config.S3Config)) *S3StorageService {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := config.StorageConfig{S3: config.S3Config{
+		BucketName:      testBucket,
+		Region:          "us-east-1",
+		AccessKeyID:     "test-access-key",
+		SecretAccessKey: "test-secret-key",
+		Endpoint:        server.URL,
+		PartSizeMB:      5,
+		CreateBucket:    true,
+	}}
+	if configure != nil {
+		configure(&cfg.S3)
+	}
+	s, err := NewS3StorageService(context.Background(), cfg, "http://api.example.com/files")
+	if err != nil {
+		t.Fatalf("NewS3StorageService: %v", err)
+	}
+	return s
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNewS3StorageServiceUsesPathStyle(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3Storage(t, fake, nil)
+
+	if _, ok := fake.buckets[testBucket]; !ok {
+		t.Fatalf("存储桶 %s 没有被创建", testBucket)
+	}
+	if _, err := s.UploadFile(context.Background(), strings.NewReader("hello"), 5, "a.txt", "text/plain"); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for _, req := range fake.requests {
+		fields := strings.Fields(req)
+		host, path := fields[1], fields[2]
+		if strings.HasPrefix(host, testBucket+".") {
+			t.Errorf("请求 %q 使用了虚拟主机风格", req)
+		}
+		if path != "/"+testBucket && !strings.HasPrefix(path, "/"+testBucket+"/") {
+			t.Errorf("请求 %q 的路径不以存储桶开头", req)
+		}
+	}
+}
+
+func TestNewS3StorageServiceMissingBucket(t *testing.T) {
+	server := httptest.NewServer(newFakeS3())
+	defer server.Close()
+
+	cfg := config.StorageConfig{S3: config.S3Config{
+		BucketName: testBucket, Region: "us-east-1", AccessKeyID: "k", SecretAccessKey: "s", Endpoint: server.URL,
+	}}
+	if _, err := NewS3StorageService(context.Background(), cfg, ""); err == nil {
+		t.Fatal("存储桶不存在且未开启 CreateBucket 时应返回错误")
+	}
+}
+
+func TestS3UploadFileSinglePart(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3Storage(t, fake, nil)
+
+	data := randomBytes(t, 1024)
+	info, err := s.UploadFile(context.Background(), bytes.NewReader(data), int64(len(data)), "photo.png", "image/png")
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if !strings.HasSuffix(info.Path, ".png") || strings.Contains(info.Path, "/") {
+		t.Errorf("对象键 %q 应为带原扩展名的 UUID", info.Path)
+	}
+	if want := "http://api.example.com/files/" + info.Path; info.URL != want {
+		t.Errorf("URL = %q, want %q", info.URL, want)
+	}
+	obj, ok := fake.object(info.Path)
+	if !ok {
+		t.Fatal("对象没有保存")
+	}
+	if obj.parts != 0 || !bytes.Equal(obj.data, data) || obj.contentType != "image/png" {
+		t.Errorf("保存的对象不正确: parts=%d size=%d contentType=%q", obj.parts, len(obj.data), obj.contentType)
+	}
+}
+
+func TestS3UploadFileMultipart(t *testing.T) {
+	fake := newFakeS3()
+	s := newTestS3Storage(t, fake, nil)
+
+	// 分片大小为 5 MB，11 MB 的文件分为 3 个分片
+	data := randomBytes(t, 11<<20)
+	info, err := s.UploadFile(context.Background(), bytes.NewReader(data), int64(len(data)), "video.mp4", "video/mp4")
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", info.Size, len(data))
+	}
+	obj, ok := fake.object(info.Path)
+	if !ok {
+		t.Fatal("对象没有保存")
+	}
+	if obj.parts != 3 {
+		t.Errorf("分片数 = %d, want 3", obj.parts)
+	}
+	if !bytes.Equal(obj.data, data) {
+		t.Error("合并后的对象内容与上传的不一致")
+	}
+	if _, uploads := fake.counts(); uploads != 0 {
+		t.Errorf("还有 %d 个未完成的分片上传", uploads)
+	}
+}
+
+func TestS3UploadFileSizeMismatchLeavesNothing(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared int64
+		actual   int
+	}{
+		{"single part", 4096, 1024},
+		{"multipart", 12 << 20, 7 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3()
+			s := newTestS3Storage(t, fake, nil)
+
+			// 上传流提供的数据比声明的大小少，例如客户端在上传中途断开
+			reader := io.MultiReader(bytes.NewReader(randomBytes(t, tt.actual)))
+			if _, err := s.UploadFile(context.Background(), reader, tt.declared, "short.bin", "application/octet-stream"); err == nil {
+				t.Fatal("数据少于声明的大小时应返回错误")
+			}
+			objects, uploads := fake.counts()
+			if objects != 0 || uploads != 0 {
+				t.Errorf("上传失败后留下了 %d 个对象和 %d 个未完成的分片上传", objects, uploads)
+			}
+		})
+	}
+}
+
+func TestS3MissingObjectReturnsErrFileNotFound(t *testing.T) {
+	s := newTestS3Storage(t, newFakeS3(), nil)
+	ctx := context.Background()
+	const key = "00000000-0000-0000-0000-000000000000.txt"
+
+	if _, err := s.Stat(ctx, key); !errors.Is(err, imtypes.ErrFileNotFound) {
+		t.Errorf("Stat: err = %v, want ErrFileNotFound", err)
+	}
+	if _, _, err := s.Open(ctx, key); !errors.Is(err, imtypes.ErrFileNotFound) {
+		t.Errorf("Open: err = %v, want ErrFileNotFound", err)
+	}
+	if err := s.Delete(ctx, key); !errors.Is(err, imtypes.ErrFileNotFound) {
+		t.Errorf("Delete: err = %v, want ErrFileNotFound", err)
+	}
+	if _, err := s.Stat(ctx, "../"+key); !errors.Is(err, imtypes.ErrInvalidFilePath) {
+		t.Errorf("Stat 带路径分隔符的键: err = %v, want ErrInvalidFilePath", err)
+	}
+}
+
+func TestS3OpenStatDelete(t *testing.T) {
+	s := newTestS3Storage(t, newFakeS3(), nil)
+	ctx := context.Background()
+
+	info, err := s.UploadFile(ctx, strings.NewReader("hello, world"), 12, "note.txt", "text/plain")
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	stat, err := s.Stat(ctx, info.Path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if stat.Size != 12 || stat.MimeType != "text/plain" || stat.Path != info.Path {
+		t.Errorf("Stat = %+v", stat)
+	}
+
+	file, _, err := s.Open(ctx, info.Path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := file.Seek(7, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	rest, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(rest) != "world" {
+		t.Errorf("Seek 后读取 = %q, %v, want \"world\"", rest, err)
+	}
+
+	if err := s.Delete(ctx, info.Path); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Stat(ctx, info.Path); !errors.Is(err, imtypes.ErrFileNotFound) {
+		t.Errorf("删除后 Stat: err = %v, want ErrFileNotFound", err)
+	}
+}
+
+func TestS3PresignedGetURLContentDisposition(t *testing.T) {
+	s := newTestS3Storage(t, newFakeS3(), func(cfg *config.S3Config) { cfg.PresignExpiry = 10 * time.Minute })
+	ctx := context.Background()
+
+	info, err := s.UploadFile(ctx, strings.NewReader("report"), 6, "report.pdf", "application/pdf")
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	const disposition = `attachment; filename="report.pdf"`
+	raw, err := s.PresignedGetURL(ctx, info.Path, 0, disposition)
+	if err != nil {
+		t.Fatalf("PresignedGetURL: %v", err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/"+testBucket+"/"+info.Path {
+		t.Errorf("预签名 URL 路径 = %q, 应为路径风格", u.Path)
+	}
+	query := u.Query()
+	if got := query.Get("response-content-disposition"); got != disposition {
+		t.Errorf("response-content-disposition = %q, want %q", got, disposition)
+	}
+	if got := query.Get("X-Amz-Expires"); got != "600" {
+		t.Errorf("X-Amz-Expires = %q, want 600", got)
+	}
+	if query.Get("X-Amz-Signature") == "" {
+		t.Error("预签名 URL 缺少签名")
+	}
+
+	resp, err := http.Get(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Disposition"); got != disposition {
+		t.Errorf("下载响应的 Content-Disposition = %q, want %q", got, disposition)
+	}
+
+	if _, err := s.PresignedGetURL(ctx, "a/b", 0, ""); !errors.Is(err, imtypes.ErrInvalidFilePath) {
+		t.Errorf("带路径分隔符的键: err = %v, want ErrInvalidFilePath", err)
+	}
+}
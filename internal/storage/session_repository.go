@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// SessionRepository 定义了登录会话及刷新令牌的数据操作接口。
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSessionByID(ctx context.Context, id uint) (*models.Session, error)
+	// GetActiveSessions 获取用户所有未吊销且未过期的会话，按最近使用时间倒序。
+	GetActiveSessions(ctx context.Context, userID uint, now time.Time) ([]*models.Session, error)
+	// UpdateSessionTokens 记录会话最近一次签发的令牌信息及客户端信息。
+	UpdateSessionTokens(ctx context.Context, session *models.Session) error
+	// RevokeSession 吊销会话，返回是否确实从有效状态变为吊销状态。
+	RevokeSession(ctx context.Context, id uint, revokedAt time.Time) (bool, error)
+
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// GetRefreshTokenByHash 通过令牌哈希查找刷新令牌 (包括已使用的)。
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// MarkRefreshTokenUsed 将未使用的刷新令牌标记为已使用。令牌已被使用过时返回 false，用于检测重放。
+	MarkRefreshTokenUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error)
+
+	// GetDB 返回底层数据库连接，用于事务操作
+	GetDB() *gorm.DB
+}
+
+// gormSessionRepository 使用 GORM 实现 SessionRepository。
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSessionRepository 创建一个新的基于 GORM 的 SessionRepository。
+func NewGormSessionRepository(db *gorm.DB) SessionRepository {
+	return &gormSessionRepository{db: db}
+}
+
+// CreateSession 创建一个新的会话。
+func (r *gormSessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+// GetSessionByID 通过 ID 检索会话。
+func (r *gormSessionRepository) GetSessionByID(ctx context.Context, id uint) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).First(&session, id).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessions 获取用户的有效会话。
+func (r *gormSessionRepository) GetActiveSessions(ctx context.Context, userID uint, now time.Time) ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// UpdateSessionTokens 更新会话的令牌及客户端信息。
+func (r *gormSessionRepository) UpdateSessionTokens(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Model(session).Updates(map[string]interface{}{
+		"ip_address":              session.IPAddress,
+		"user_agent":              session.UserAgent,
+		"last_used_at":            session.LastUsedAt,
+		"expires_at":              session.ExpiresAt,
+		"access_token_id":         session.AccessTokenID,
+		"access_token_expires_at": session.AccessTokenExpiresAt,
+	}).Error
+}
+
+// RevokeSession 吊销会话。
+func (r *gormSessionRepository) RevokeSession(ctx context.Context, id uint, revokedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateRefreshToken 保存一个新的刷新令牌。
+func (r *gormSessionRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// GetRefreshTokenByHash 通过哈希检索刷新令牌。
+func (r *gormSessionRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed 以条件更新的方式标记刷新令牌已使用，保证并发刷新时只有一个请求成功。
+func (r *gormSessionRepository) MarkRefreshTokenUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetDB 返回底层数据库连接。
+func (r *gormSessionRepository) GetDB() *gorm.DB {
+	return r.db
+}
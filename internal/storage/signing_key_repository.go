@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// SigningKeyRepository 定义了 JWT 签名密钥的数据操作接口。
+type SigningKeyRepository interface {
+	// GetVerificationKeys 获取所有在 now 时刻仍可用于验证的密钥，按创建时间倒序。
+	GetVerificationKeys(ctx context.Context, now time.Time) ([]*models.SigningKey, error)
+	// RotateSigningKey 保存新密钥，并将其余仍在签名的密钥标记为退役，退役密钥在 retiredExpiresAt 之后不再用于验证。
+	RotateSigningKey(ctx context.Context, key *models.SigningKey, retiredExpiresAt time.Time) error
+	// DeleteExpiredSigningKeys 物理删除在 before 之前已过期的密钥。
+	DeleteExpiredSigningKeys(ctx context.Context, before time.Time) (int64, error)
+}
+
+// gormSigningKeyRepository 使用 GORM 实现 SigningKeyRepository。
+type gormSigningKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSigningKeyRepository 创建一个新的基于 GORM 的 SigningKeyRepository。
+func NewGormSigningKeyRepository(db *gorm.DB) SigningKeyRepository {
+	return &gormSigningKeyRepository{db: db}
+}
+
+// GetVerificationKeys 获取仍有效的密钥。
+func (r *gormSigningKeyRepository) GetVerificationKeys(ctx context.Context, now time.Time) ([]*models.SigningKey, error) {
+	var keys []*models.SigningKey
+	err := r.db.WithContext(ctx).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RotateSigningKey 在事务中退役旧密钥并保存新密钥。
+func (r *gormSigningKeyRepository) RotateSigningKey(ctx context.Context, key *models.SigningKey, retiredExpiresAt time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SigningKey{}).
+			Where("retired_at IS NULL").
+			Updates(map[string]interface{}{"retired_at": time.Now(), "expires_at": retiredExpiresAt}).Error; err != nil {
+			return err
+		}
+		return tx.Create(key).Error
+	})
+}
+
+// DeleteExpiredSigningKeys 清理过期密钥。
+func (r *gormSigningKeyRepository) DeleteExpiredSigningKeys(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("expires_at IS NOT NULL AND expires_at < ?", before).
+		Delete(&models.SigningKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// SuggestionRepository defines the queries behind friend suggestions.
+type SuggestionRepository interface {
+	// FindCandidates ranks non-friends of userID by mutual friend count, then by shared group count.
+	// Groups with more than maxGroupSize members are not counted. Blocked users (either way), users with a
+	// pending request with userID (either direction), bots and users whose search visibility is not
+	// "everyone" are excluded.
+	FindCandidates(ctx context.Context, userID uint, maxGroupSize, limit int) ([]models.SuggestionCandidate, error)
+	// GetExcludedUserIDs returns the users that must never be suggested to userID right now:
+	// friends, blocked users (either way) and users with a pending request with userID (either direction).
+	GetExcludedUserIDs(ctx context.Context, userID uint) ([]uint, error)
+}
+
+// gormSuggestionRepository implements SuggestionRepository with raw SQL over friendships and group_members.
+type gormSuggestionRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSuggestionRepository creates a new GORM-based SuggestionRepository.
+func NewGormSuggestionRepository(db *gorm.DB) SuggestionRepository {
+	return &gormSuggestionRepository{db: db}
+}
+
+// excludedUsersSQL selects the IDs that GetExcludedUserIDs returns; @uid is the user asking for suggestions.
+const excludedUsersSQL = `
+	SELECT user_id2 FROM friendships WHERE user_id1 = @uid AND deleted_at IS NULL
+	UNION SELECT user_id1 FROM friendships WHERE user_id2 = @uid AND deleted_at IS NULL
+	UNION SELECT blocked_id FROM user_blocks WHERE blocker_id = @uid AND deleted_at IS NULL
+	UNION SELECT blocker_id FROM user_blocks WHERE blocked_id = @uid AND deleted_at IS NULL
+	UNION SELECT recipient_user_id FROM friend_requests WHERE requester_user_id = @uid AND status = 'pending' AND deleted_at IS NULL
+	UNION SELECT requester_user_id FROM friend_requests WHERE recipient_user_id = @uid AND status = 'pending' AND deleted_at IS NULL`
+
+// FindCandidates counts, in one query, the friends of friends and the co-members of the user's groups.
+// Large groups are skipped because sharing them says little about knowing someone and their
+// self-join would dominate the query cost.
+func (r *gormSuggestionRepository) FindCandidates(ctx context.Context, userID uint, maxGroupSize, limit int) ([]models.SuggestionCandidate, error) {
+	query := `
+WITH my_friends AS (
+	SELECT user_id2 AS id FROM friendships WHERE user_id1 = @uid AND deleted_at IS NULL
+	UNION SELECT user_id1 FROM friendships WHERE user_id2 = @uid AND deleted_at IS NULL
+),
+mutual AS (
+	SELECT CASE WHEN f.user_id1 = mf.id THEN f.user_id2 ELSE f.user_id1 END AS user_id, COUNT(*) AS cnt
+	FROM friendships f
+	JOIN my_friends mf ON f.user_id1 = mf.id OR f.user_id2 = mf.id
+	WHERE f.deleted_at IS NULL
+	GROUP BY 1
+),
+shared AS (
+	SELECT other.user_id, COUNT(DISTINCT other.group_id) AS cnt
+	FROM group_members mine
+	JOIN groups g ON g.id = mine.group_id AND g.deleted_at IS NULL AND g.member_count <= @maxGroupSize
+	JOIN group_members other ON other.group_id = mine.group_id AND other.user_id <> mine.user_id AND other.deleted_at IS NULL
+	WHERE mine.user_id = @uid AND mine.deleted_at IS NULL
+	GROUP BY other.user_id
+),
+candidates AS (
+	SELECT user_id FROM mutual UNION SELECT user_id FROM shared
+)
+SELECT c.user_id, COALESCE(m.cnt, 0) AS mutual_friends, COALESCE(s.cnt, 0) AS shared_groups
+FROM candidates c
+JOIN users u ON u.id = c.user_id AND u.deleted_at IS NULL AND u.is_bot = false
+LEFT JOIN mutual m ON m.user_id = c.user_id
+LEFT JOIN shared s ON s.user_id = c.user_id
+LEFT JOIN user_privacy_settings ps ON ps.user_id = c.user_id AND ps.deleted_at IS NULL
+WHERE c.user_id <> @uid
+	AND COALESCE(ps.search_visibility, 'everyone') = 'everyone'
+	AND c.user_id NOT IN (` + excludedUsersSQL + `)
+ORDER BY mutual_friends DESC, shared_groups DESC, c.user_id
+LIMIT @limit`
+
+	var candidates []models.SuggestionCandidate
+	err := r.db.WithContext(ctx).Raw(query, map[string]interface{}{
+		"uid":          userID,
+		"maxGroupSize": maxGroupSize,
+		"limit":        limit,
+	}).Scan(&candidates).Error
+	return candidates, err
+}
+
+// GetExcludedUserIDs runs the exclusion part of FindCandidates on its own; it only touches indexed
+// lookups for one user, so it is cheap enough to run on every request.
+func (r *gormSuggestionRepository) GetExcludedUserIDs(ctx context.Context, userID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Raw(excludedUsersSQL, map[string]interface{}{"uid": userID}).Scan(&ids).Error
+	return ids, err
+}
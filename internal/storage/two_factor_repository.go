@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// TwoFactorRepository 定义了 TOTP 密钥和恢复码的数据操作接口。
+type TwoFactorRepository interface {
+	GetTOTPCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error)
+	// SaveTOTPCredential 创建或更新用户的 TOTP 密钥 (每个用户只有一条记录)。
+	SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error
+	// UpdateTOTPLastUsedStep 仅当 step 大于已记录的步长时更新，返回 false 表示验证码已被使用过。
+	UpdateTOTPLastUsedStep(ctx context.Context, credentialID uint, step int64) (bool, error)
+	DeleteTOTPCredential(ctx context.Context, userID uint) error
+
+	// ReplaceRecoveryCodes 删除用户现有的恢复码并保存新的一组。
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codes []*models.RecoveryCode) error
+	GetUnusedRecoveryCodes(ctx context.Context, userID uint) ([]*models.RecoveryCode, error)
+	// MarkRecoveryCodeUsed 将未使用的恢复码标记为已使用，恢复码已被使用时返回 false。
+	MarkRecoveryCodeUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error)
+	DeleteRecoveryCodes(ctx context.Context, userID uint) error
+
+	// GetDB 返回底层数据库连接，用于事务操作
+	GetDB() *gorm.DB
+}
+
+// gormTwoFactorRepository 使用 GORM 实现 TwoFactorRepository。
+type gormTwoFactorRepository struct {
+	db *gorm.DB
+}
+
+// NewGormTwoFactorRepository 创建一个新的基于 GORM 的 TwoFactorRepository。
+func NewGormTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &gormTwoFactorRepository{db: db}
+}
+
+// GetTOTPCredential 检索用户的 TOTP 密钥。
+func (r *gormTwoFactorRepository) GetTOTPCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// SaveTOTPCredential 保存 TOTP 密钥。
+func (r *gormTwoFactorRepository) SaveTOTPCredential(ctx context.Context, credential *models.TOTPCredential) error {
+	return r.db.WithContext(ctx).Save(credential).Error
+}
+
+// UpdateTOTPLastUsedStep 以条件更新的方式记录验证码步长，防止同一验证码被并发或重复使用。
+func (r *gormTwoFactorRepository) UpdateTOTPLastUsedStep(ctx context.Context, credentialID uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("id = ? AND last_used_step < ?", credentialID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteTOTPCredential 物理删除用户的 TOTP 密钥。
+func (r *gormTwoFactorRepository) DeleteTOTPCredential(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error
+}
+
+// ReplaceRecoveryCodes 在事务中替换恢复码。
+func (r *gormTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codes []*models.RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// GetUnusedRecoveryCodes 检索用户所有未使用的恢复码。
+func (r *gormTwoFactorRepository) GetUnusedRecoveryCodes(ctx context.Context, userID uint) ([]*models.RecoveryCode, error) {
+	var codes []*models.RecoveryCode
+	err := r.db.WithContext(ctx).Where("user_id = ? AND used_at IS NULL", userID).Find(&codes).Error
+	return codes, err
+}
+
+// MarkRecoveryCodeUsed 以条件更新的方式标记恢复码已使用，保证每个恢复码只能成功使用一次。
+func (r *gormTwoFactorRepository) MarkRecoveryCodeUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteRecoveryCodes 物理删除用户的所有恢复码。
+func (r *gormTwoFactorRepository) DeleteRecoveryCodes(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// GetDB 返回底层数据库连接。
+func (r *gormTwoFactorRepository) GetDB() *gorm.DB {
+	return r.db
+}
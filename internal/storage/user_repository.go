@@ -20,6 +20,8 @@ type UserRepository interface {
 	SearchUsers(ctx context.Context, query string, currentUserID uint) ([]models.User, error)
 	GetBasicInfoByID(ctx context.Context, id uint) (*models.UserBasicInfo, error)
 	GetMultipleBasicInfoByIDs(ctx context.Context, userIDs []uint) ([]*models.UserBasicInfo, error)
+	// GetBotsByOwner 返回用户创建的机器人账号。
+	GetBotsByOwner(ctx context.Context, ownerID uint) ([]*models.User, error)
 	GetDB() *gorm.DB
 	// Delete(ctx context.Context, id uint) error // Depending on soft delete or hard delete preference
 	// List(ctx context.Context, offset, limit int) ([]*models.User, error)
@@ -83,6 +85,7 @@ func (r *gormUserRepository) Update(ctx context.Context, user *models.User) erro
 }
 
 // SearchUsers implements the SearchUsers method for the UserRepository interface.
+// 搜索结果排除拉黑了当前用户的用户，并遵守被搜索用户的 search_visibility 隐私设置 (没有设置记录时视为 everyone)。
 func (r *gormUserRepository) SearchUsers(ctx context.Context, query string, currentUserID uint) ([]models.User, error) {
 	var users []models.User
 	// 使用 strings.ToLower 来准备大小写不敏感的搜索词
@@ -90,11 +93,17 @@ func (r *gormUserRepository) SearchUsers(ctx context.Context, query string, curr
 
 	// 执行查询
 	err := r.db.WithContext(ctx).
+		Joins("LEFT JOIN user_privacy_settings ps ON ps.user_id = users.id AND ps.deleted_at IS NULL").
 		// 在 username 和 nickname 字段上进行大小写不敏感的模糊匹配
 		// 并排除当前用户自己
-		Where("(LOWER(username) LIKE ? OR LOWER(nickname) LIKE ?) AND id != ?", searchTerm, searchTerm, currentUserID).
+		Where("(LOWER(users.username) LIKE ? OR LOWER(users.nickname) LIKE ?) AND users.id != ?", searchTerm, searchTerm, currentUserID).
+		Where("NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = users.id AND b.blocked_id = ? AND b.deleted_at IS NULL)", currentUserID).
+		Where("(COALESCE(ps.search_visibility, ?) = ? OR (ps.search_visibility = ? AND EXISTS ("+
+			"SELECT 1 FROM friendships f WHERE f.deleted_at IS NULL AND "+
+			"((f.user_id1 = users.id AND f.user_id2 = ?) OR (f.user_id2 = users.id AND f.user_id1 = ?)))))",
+			models.PrivacyEveryone, models.PrivacyEveryone, models.PrivacyFriends, currentUserID, currentUserID).
 		//明确选择需要的字段，避免泄露敏感信息，同时提高查询效率
-		Select("id", "username", "nickname", "avatar_url").
+		Select("users.id", "users.username", "users.nickname", "users.avatar_url").
 		Limit(10). // 限制返回结果的数量，例如最多10条
 		Find(&users).Error
 
@@ -146,6 +155,16 @@ func (r *gormUserRepository) GetMultipleBasicInfoByIDs(ctx context.Context, user
 	return basicInfos, nil
 }
 
+// GetBotsByOwner retrieves the bot accounts owned by a user, oldest first.
+func (r *gormUserRepository) GetBotsByOwner(ctx context.Context, ownerID uint) ([]*models.User, error) {
+	var bots []*models.User
+	err := r.db.WithContext(ctx).
+		Where("is_bot = ? AND bot_owner_id = ?", true, ownerID).
+		Order("id ASC").
+		Find(&bots).Error
+	return bots, err
+}
+
 // GetDB returns the underlying gorm.DB instance
 func (r *gormUserRepository) GetDB() *gorm.DB {
 	return r.db
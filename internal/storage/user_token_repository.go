@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// UserTokenRepository 定义了一次性用户令牌 (邮箱验证、密码重置) 的数据操作接口。
+type UserTokenRepository interface {
+	CreateToken(ctx context.Context, token *models.UserToken) error
+	GetTokenByHash(ctx context.Context, tokenHash string) (*models.UserToken, error)
+	// MarkTokenUsed 将未使用的令牌标记为已使用，令牌已被使用时返回 false。
+	MarkTokenUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error)
+	// InvalidateTokens 使用户某一用途下所有未使用的令牌失效，用于重新发送或令牌用过之后。
+	InvalidateTokens(ctx context.Context, userID uint, purpose models.UserTokenPurpose, usedAt time.Time) error
+
+	// GetDB 返回底层数据库连接，用于事务操作
+	GetDB() *gorm.DB
+}
+
+// gormUserTokenRepository 使用 GORM 实现 UserTokenRepository。
+type gormUserTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserTokenRepository 创建一个新的基于 GORM 的 UserTokenRepository。
+func NewGormUserTokenRepository(db *gorm.DB) UserTokenRepository {
+	return &gormUserTokenRepository{db: db}
+}
+
+// CreateToken 保存一个新的令牌。
+func (r *gormUserTokenRepository) CreateToken(ctx context.Context, token *models.UserToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// GetTokenByHash 通过哈希检索令牌。
+func (r *gormUserTokenRepository) GetTokenByHash(ctx context.Context, tokenHash string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkTokenUsed 以条件更新的方式标记令牌已使用，保证令牌只能成功使用一次。
+func (r *gormUserTokenRepository) MarkTokenUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+// InvalidateTokens 使未使用的令牌失效。
+func (r *gormUserTokenRepository) InvalidateTokens(ctx context.Context, userID uint, purpose models.UserTokenPurpose, usedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", usedAt).Error
+}
+
+// GetDB 返回底层数据库连接。
+func (r *gormUserTokenRepository) GetDB() *gorm.DB {
+	return r.db
+}
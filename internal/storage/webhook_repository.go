@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"im-go/internal/models"
+)
+
+// WebhookRepository 定义了 Webhook 及其投递日志的数据操作接口。
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhookByID(ctx context.Context, id uint) (*models.Webhook, error)
+	GetWebhooksByGroup(ctx context.Context, groupID uint) ([]*models.Webhook, error)
+	GetWebhooksByBot(ctx context.Context, botID uint) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, id uint) error
+
+	// GetEnabledGroupWebhooks 返回群组上启用的 Webhook。
+	GetEnabledGroupWebhooks(ctx context.Context, groupID uint) ([]*models.Webhook, error)
+	// GetEnabledBotWebhooks 返回参与了会话的机器人上启用的 Webhook。
+	GetEnabledBotWebhooks(ctx context.Context, conversationID uint) ([]*models.Webhook, error)
+	// GetEnabledWebhooksForBot 返回某个机器人上启用的 Webhook。
+	GetEnabledWebhooksForBot(ctx context.Context, botID uint) ([]*models.Webhook, error)
+
+	// RecordWebhookSuccess 记录一次成功投递并清零连续失败次数。
+	RecordWebhookSuccess(ctx context.Context, id uint, at time.Time) error
+	// RecordWebhookFailure 增加连续失败次数，达到 disableAfter (>0) 时停用 Webhook，本次调用将其停用时返回 true。
+	RecordWebhookFailure(ctx context.Context, id uint, at time.Time, disableAfter int, reason string) (bool, error)
+
+	CreateDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error
+	// GetDueDeliveries 返回到期待投递的记录，最早到期的在前。
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	// ClaimDelivery 认领一条待投递记录：投递次数加一并把下次尝试时间推迟到 leaseUntil，
+	// 记录已被其他实例认领 (投递次数已变化) 时返回 false。
+	ClaimDelivery(ctx context.Context, id uint, attempts int, leaseUntil time.Time) (bool, error)
+	// UpdateDeliveryResult 保存一次投递尝试的结果。
+	UpdateDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error
+	// FailPendingDeliveries 将 Webhook 所有待投递的记录标记为失败。
+	FailPendingDeliveries(ctx context.Context, webhookID uint, reason string) error
+	// GetDeliveriesByWebhook 返回 Webhook 最近的投递记录，最新的在前。
+	GetDeliveriesByWebhook(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error)
+}
+
+// gormWebhookRepository 使用 GORM 实现 WebhookRepository。
+type gormWebhookRepository struct {
+	db *gorm.DB
+}
+
+// NewGormWebhookRepository 创建一个新的基于 GORM 的 WebhookRepository。
+func NewGormWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &gormWebhookRepository{db: db}
+}
+
+// CreateWebhook 保存一个新的 Webhook。
+func (r *gormWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return r.db.WithContext(ctx).Create(webhook).Error
+}
+
+// GetWebhookByID 通过 ID 检索 Webhook。
+func (r *gormWebhookRepository) GetWebhookByID(ctx context.Context, id uint) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := r.db.WithContext(ctx).First(&webhook, id).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooksByGroup 检索群组上的所有 Webhook。
+func (r *gormWebhookRepository) GetWebhooksByGroup(ctx context.Context, groupID uint) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := r.db.WithContext(ctx).Where("group_id = ?", groupID).Order("id ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetWebhooksByBot 检索机器人上的所有 Webhook。
+func (r *gormWebhookRepository) GetWebhooksByBot(ctx context.Context, botID uint) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := r.db.WithContext(ctx).Where("bot_id = ?", botID).Order("id ASC").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// UpdateWebhook 更新 Webhook。
+func (r *gormWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	return r.db.WithContext(ctx).Save(webhook).Error
+}
+
+// DeleteWebhook 删除 Webhook，投递记录保留。
+func (r *gormWebhookRepository) DeleteWebhook(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Webhook{}, id).Error
+}
+
+// GetEnabledGroupWebhooks 检索群组上启用的 Webhook。
+func (r *gormWebhookRepository) GetEnabledGroupWebhooks(ctx context.Context, groupID uint) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := r.db.WithContext(ctx).Where("group_id = ? AND enabled = ?", groupID, true).Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetEnabledBotWebhooks 通过会话参与者检索机器人上启用的 Webhook。
+func (r *gormWebhookRepository) GetEnabledBotWebhooks(ctx context.Context, conversationID uint) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := r.db.WithContext(ctx).
+		Joins("JOIN conversation_participants cp ON cp.user_id = webhooks.bot_id").
+		Where("cp.conversation_id = ? AND webhooks.enabled = ?", conversationID, true).
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetEnabledWebhooksForBot 检索机器人上启用的 Webhook。
+func (r *gormWebhookRepository) GetEnabledWebhooksForBot(ctx context.Context, botID uint) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := r.db.WithContext(ctx).Where("bot_id = ? AND enabled = ?", botID, true).Find(&webhooks).Error
+	return webhooks, err
+}
+
+// RecordWebhookSuccess 清零连续失败次数。
+func (r *gormWebhookRepository) RecordWebhookSuccess(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Webhook{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"consecutive_failures": 0, "last_delivery_at": at}).Error
+}
+
+// RecordWebhookFailure 增加连续失败次数并在达到上限时以条件更新停用 Webhook。
+func (r *gormWebhookRepository) RecordWebhookFailure(ctx context.Context, id uint, at time.Time, disableAfter int, reason string) (bool, error) {
+	err := r.db.WithContext(ctx).Model(&models.Webhook{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"consecutive_failures": gorm.Expr("consecutive_failures + 1"),
+			"last_delivery_at":     at,
+		}).Error
+	if err != nil || disableAfter <= 0 {
+		return false, err
+	}
+	result := r.db.WithContext(ctx).Model(&models.Webhook{}).
+		Where("id = ? AND enabled = ? AND consecutive_failures >= ?", id, true, disableAfter).
+		Updates(map[string]interface{}{"enabled": false, "disabled_at": at, "disabled_reason": reason})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateDeliveries 批量保存投递记录。
+func (r *gormWebhookRepository) CreateDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&deliveries).Error
+}
+
+// GetDueDeliveries 检索到期的待投递记录。
+func (r *gormWebhookRepository) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimDelivery 以投递次数作为版本号认领记录。
+func (r *gormWebhookRepository) ClaimDelivery(ctx context.Context, id uint, attempts int, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", id, models.WebhookDeliveryPending, attempts).
+		Updates(map[string]interface{}{"attempts": attempts + 1, "next_attempt_at": leaseUntil})
+	return result.RowsAffected > 0, result.Error
+}
+
+// UpdateDeliveryResult 保存投递结果。
+func (r *gormWebhookRepository) UpdateDeliveryResult(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).
+		Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"last_duration_ms": delivery.LastDurationMs,
+			"delivered_at":     delivery.DeliveredAt,
+		}).Error
+}
+
+// FailPendingDeliveries 将待投递的记录标记为失败。
+func (r *gormWebhookRepository) FailPendingDeliveries(ctx context.Context, webhookID uint, reason string) error {
+	return r.db.WithContext(ctx).Model(&models.WebhookDelivery{}).
+		Where("webhook_id = ? AND status = ?", webhookID, models.WebhookDeliveryPending).
+		Updates(map[string]interface{}{"status": models.WebhookDeliveryFailed, "last_error": reason}).Error
+}
+
+// GetDeliveriesByWebhook 检索 Webhook 最近的投递记录。
+func (r *gormWebhookRepository) GetDeliveriesByWebhook(ctx context.Context, webhookID uint, limit int) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	err := r.db.WithContext(ctx).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -34,6 +35,26 @@ var (
 	space   = []byte(" ")
 )
 
+// Close codes sent to clients when the server ends a connection (private-use range 4000-4999).
+const (
+	// CloseSessionRevoked means the login session or token was revoked (e.g. logout); the client must log in again.
+	CloseSessionRevoked = 4001
+	// CloseTokenExpired means the access token expired without re-authentication; refresh it and reconnect.
+	CloseTokenExpired = 4002
+	// CloseReplaced means the same user opened a newer connection.
+	CloseReplaced = 4003
+)
+
+// Identity is who a connection is authenticated as, and until when.
+type Identity struct {
+	UserID    uint
+	SessionID uint
+	ExpiresAt time.Time // expiry of the access token the connection was authenticated with
+}
+
+// Reauthenticator validates a fresh access token sent over an open connection (imtypes.AuthMessageType).
+type Reauthenticator func(ctx context.Context, token string) (Identity, error)
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -52,8 +73,30 @@ type Client struct {
 	// Authenticated User ID for this client.
 	UserID uint `json:"userId"`
 
+	// Login session the connection was authenticated with, used to disconnect it when the session is revoked.
+	SessionID uint `json:"sessionId"`
+
 	// Callback to handle incoming messages, converting them to RawMessageInput
 	handleMessage func(ctx context.Context, input imtypes.RawMessageInput) error `json:"-"`
+
+	// Validates tokens sent with imtypes.AuthMessageType. Nil disables re-authentication.
+	reauthenticate Reauthenticator
+
+	// Token expiry the connection was opened with. Owned by writePump after it starts;
+	// readPump hands extended expiries over through reauthed.
+	expiresAt time.Time
+	reauthed  chan time.Time
+
+	// Close frame writePump sends once send is closed. Set by the hub right before closing send.
+	closeCode int
+	closeText string
+}
+
+// closeWithCode closes the connection with the given close frame. Must be called from Hub.Run, like close(c.send).
+func (c *Client) closeWithCode(code int, text string) {
+	c.closeCode = code
+	c.closeText = text
+	close(c.send)
 }
 
 // readPump pumps messages from the websocket connection to the handleMessage callback.
@@ -116,6 +159,15 @@ func (c *Client) readPump(wsCfg config.WebSocketConfig) {
 			log.Printf("收到文件数据，大小: %d bytes, 文件名: %s", len(fileData), clientReceivedWsMsg.FileName)
 			// ... 处理文件字节 ...
 
+		case imtypes.CallbackMessageType:
+			// 按钮回调，Metadata 中是被点击的消息和按钮 (imtypes.CallbackPayload)，由服务端路由给命令处理器
+			log.Printf("收到按钮回调 (客户端: %d)", c.UserID)
+
+		case imtypes.AuthMessageType:
+			// 重新认证，Content 是刷新后的访问令牌，不转发
+			c.handleReauth(clientReceivedWsMsg)
+			continue
+
 		default:
 			log.Printf("收到未知类型的消息: %s", clientReceivedWsMsg.Type)
 		}
@@ -130,7 +182,9 @@ func (c *Client) readPump(wsCfg config.WebSocketConfig) {
 			Timestamp:      time.Now(), // 服务端接收时间
 			FileName:       clientReceivedWsMsg.FileName,
 			FileSize:       clientReceivedWsMsg.FileSize,
+			AttachmentID:   clientReceivedWsMsg.AttachmentID,
 			ConversationID: clientReceivedWsMsg.ConversationID, // 添加会话ID映射
+			Metadata:       clientReceivedWsMsg.Metadata,
 		}
 
 		// 日志记录，用于调试
@@ -140,6 +194,7 @@ func (c *Client) readPump(wsCfg config.WebSocketConfig) {
 		if c.handleMessage != nil {
 			if err := c.handleMessage(context.Background(), rawInputDto); err != nil {
 				log.Printf("错误: 客户端 %d 通过 handleMessage 发送消息失败: %v", c.UserID, err)
+				c.reportSendError(clientReceivedWsMsg, err)
 			}
 		} else {
 			log.Printf("警告: Client %d 的 handleMessage 未初始化，消息未处理。", c.UserID)
@@ -147,12 +202,69 @@ func (c *Client) readPump(wsCfg config.WebSocketConfig) {
 	}
 }
 
+// handleReauth validates a fresh access token and extends the connection's expiry.
+// The token must belong to the same user and login session the connection was opened with.
+func (c *Client) handleReauth(msg imtypes.Message) {
+	if c.reauthenticate == nil {
+		c.reportSendError(msg, &imtypes.ClientError{Code: imtypes.ErrorCodeAuthFailed, Message: "服务器不支持重新认证"})
+		return
+	}
+	identity, err := c.reauthenticate(context.Background(), msg.Content)
+	if err == nil && (identity.UserID != c.UserID || identity.SessionID != c.SessionID) {
+		err = errors.New("令牌不属于当前连接的用户或登录会话")
+	}
+	if err != nil {
+		log.Printf("客户端 %d 重新认证失败: %v", c.UserID, err)
+		c.reportSendError(msg, &imtypes.ClientError{Code: imtypes.ErrorCodeAuthFailed, Message: "重新认证失败"})
+		return
+	}
+	// 只保留最新的过期时间，writePump 收到后重置计时器并回复确认
+	select {
+	case <-c.reauthed:
+	default:
+	}
+	c.reauthed <- identity.ExpiresAt
+}
+
+// reportSendError sends an error frame back to this client for a message that was not accepted.
+// The frame is routed through the hub so it never races with the hub closing c.send.
+func (c *Client) reportSendError(original imtypes.Message, err error) {
+	payload := imtypes.ErrorPayload{Code: imtypes.ErrorCodeSendFailed}
+	content := "消息发送失败"
+	var clientErr *imtypes.ClientError
+	if errors.As(err, &clientErr) {
+		payload.Code = clientErr.Code
+		payload.RetryAfterMs = clientErr.RetryAfter.Milliseconds()
+		content = clientErr.Message
+	}
+	metadata, _ := json.Marshal(payload)
+
+	userID := strconv.FormatUint(uint64(c.UserID), 10)
+	c.hub.DeliverDirectMessage(&imtypes.Message{
+		ID:             original.ID, // 客户端生成的消息ID，便于客户端定位失败的消息
+		Type:           imtypes.ErrorMessageType,
+		Content:        content,
+		SenderID:       userID,
+		ReceiverID:     userID,
+		Timestamp:      time.Now(),
+		ConversationID: original.ConversationID,
+		Metadata:       metadata,
+	})
+}
+
 // writePump pumps messages from the hub to the websocket connection.
+// It also enforces the token expiry: a reauth_required notice is sent ReauthNoticeSeconds before expiry,
+// and the connection is closed with CloseTokenExpired unless readPump reports a successful re-authentication.
 func (c *Client) writePump(wsCfg config.WebSocketConfig) {
 	ticker := time.NewTicker(time.Duration(wsCfg.PingPeriodSeconds) * time.Second)
 	newlineBytes := []byte("\n") // 定义 newline
+	noticeBefore := time.Duration(wsCfg.ReauthNoticeSeconds) * time.Second
+	expireTimer := time.NewTimer(time.Until(c.expiresAt))
+	noticeTimer := time.NewTimer(time.Until(c.expiresAt.Add(-noticeBefore)))
 	defer func() {
 		ticker.Stop()
+		expireTimer.Stop()
+		noticeTimer.Stop()
 		c.conn.Close()
 	}()
 	for {
@@ -160,7 +272,11 @@ func (c *Client) writePump(wsCfg config.WebSocketConfig) {
 		case message, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(time.Duration(wsCfg.WriteWaitSeconds) * time.Second))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeFrame := []byte{}
+				if c.closeCode != 0 {
+					closeFrame = websocket.FormatCloseMessage(c.closeCode, c.closeText)
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
 				return
 			}
 			w, err := c.conn.NextWriter(websocket.TextMessage)
@@ -184,19 +300,53 @@ func (c *Client) writePump(wsCfg config.WebSocketConfig) {
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case expiresAt := <-c.reauthed:
+			c.expiresAt = expiresAt
+			expireTimer.Reset(time.Until(expiresAt))
+			noticeTimer.Reset(time.Until(expiresAt.Add(-noticeBefore)))
+			if err := c.writeAuthFrame(wsCfg, imtypes.AuthMessageType); err != nil {
+				return
+			}
+		case <-noticeTimer.C:
+			if err := c.writeAuthFrame(wsCfg, imtypes.ReauthRequiredMessageType); err != nil {
+				return
+			}
+		case <-expireTimer.C:
+			log.Printf("客户端 %d 的访问令牌已过期，关闭连接", c.UserID)
+			c.conn.SetWriteDeadline(time.Now().Add(time.Duration(wsCfg.WriteWaitSeconds) * time.Second))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(CloseTokenExpired, "token expired"))
+			return
 		}
 	}
 }
 
-// ServeWsPerConnection 处理来自对等方的 websocket 请求。
-func ServeWsPerConnection(hub *Hub, rawInputHandler func(ctx context.Context, input imtypes.RawMessageInput) error, userID uint, w http.ResponseWriter, r *http.Request, wsCfg config.WebSocketConfig) {
+// writeAuthFrame writes a frame carrying the connection's current expiry (imtypes.ReauthPayload). Only called from writePump.
+func (c *Client) writeAuthFrame(wsCfg config.WebSocketConfig, msgType imtypes.MessageType) error {
+	metadata, _ := json.Marshal(imtypes.ReauthPayload{ExpiresAt: c.expiresAt})
+	userID := strconv.FormatUint(uint64(c.UserID), 10)
+	frame, err := json.Marshal(&imtypes.Message{
+		Type:       msgType,
+		SenderID:   userID,
+		ReceiverID: userID,
+		Timestamp:  time.Now(),
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(time.Duration(wsCfg.WriteWaitSeconds) * time.Second))
+	return c.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// ServeWsPerConnection 处理来自对等方的 websocket 请求。调用方需要在此之前完成认证，identity 是认证的结果。
+// checkOrigin 校验握手请求的来源，见 NewOriginChecker；客户端声明了 Subprotocol 时服务端回显该子协议。
+// reauth 校验连接期间客户端提交的新访问令牌，令牌过期且未重新认证的连接会被关闭。
+func ServeWsPerConnection(hub *Hub, rawInputHandler func(ctx context.Context, input imtypes.RawMessageInput) error, identity Identity, reauth Reauthenticator, w http.ResponseWriter, r *http.Request, wsCfg config.WebSocketConfig, checkOrigin func(r *http.Request) bool) {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  int(wsCfg.MaxMessageSizeBytes),
 		WriteBufferSize: int(wsCfg.MaxMessageSizeBytes),
-		// 生产侧控制源
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		Subprotocols:    []string{Subprotocol},
+		CheckOrigin:     checkOrigin,
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -205,18 +355,22 @@ func ServeWsPerConnection(hub *Hub, rawInputHandler func(ctx context.Context, in
 		return
 	}
 	client := &Client{
-		hub:           hub,
-		conn:          conn,
-		send:          make(chan []byte, 256),
-		UserID:        userID,
-		handleMessage: rawInputHandler, // 使用新的回调函数
+		hub:            hub,
+		conn:           conn,
+		send:           make(chan []byte, 256),
+		UserID:         identity.UserID,
+		SessionID:      identity.SessionID,
+		handleMessage:  rawInputHandler, // 使用新的回调函数
+		reauthenticate: reauth,
+		expiresAt:      identity.ExpiresAt,
+		reauthed:       make(chan time.Time, 1),
 	}
 	client.hub.register <- client
 
 	go client.writePump(wsCfg)
 	go client.readPump(wsCfg)
 
-	log.Printf("客户端已连接: UserID %d", userID)
+	log.Printf("客户端已连接: UserID %d", identity.UserID)
 }
 
 // 注意：旧的 ServeWs 函数如果不再使用，可以移除或标记为弃用。
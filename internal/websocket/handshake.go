@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Subprotocol 是客户端在 Sec-WebSocket-Protocol 中声明的应用子协议，握手成功时服务端回显该值。
+	// 通过子协议携带凭证的客户端必须同时声明它，否则浏览器会因为服务端没有选择任何子协议而关闭连接。
+	Subprotocol = "im-go.v1"
+	// TokenSubprotocolPrefix 和 TicketSubprotocolPrefix 是在 Sec-WebSocket-Protocol 中携带凭证的前缀，
+	// 例如 "im-go.token.<JWT>" 或 "im-go.ticket.<票据>"，服务端不会回显这两类值。
+	TokenSubprotocolPrefix  = "im-go.token."
+	TicketSubprotocolPrefix = "im-go.ticket."
+)
+
+// RequestCredentials 从握手请求中取出凭证：访问令牌只接受 Sec-WebSocket-Protocol，
+// 一次性票据还可以放在 ?ticket= 查询参数中 (票据很快失效且只能使用一次，出现在日志中也无法被重放)。
+func RequestCredentials(r *http.Request) (token, ticket string) {
+	for _, protocol := range websocket.Subprotocols(r) {
+		switch {
+		case strings.HasPrefix(protocol, TokenSubprotocolPrefix):
+			token = strings.TrimPrefix(protocol, TokenSubprotocolPrefix)
+		case strings.HasPrefix(protocol, TicketSubprotocolPrefix):
+			ticket = strings.TrimPrefix(protocol, TicketSubprotocolPrefix)
+		}
+	}
+	if ticket == "" {
+		ticket = r.URL.Query().Get("ticket")
+	}
+	return token, ticket
+}
+
+// NewOriginChecker 返回校验握手请求 Origin 头的函数，allowedOrigins 中的 "*" 表示允许任意来源。
+// 不带 Origin 头的请求来自非浏览器客户端，不受跨站 WebSocket 劫持的影响，因此放行。
+func NewOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[normalizeOrigin(origin)] = true
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed["*"] {
+			return true
+		}
+		return allowed[normalizeOrigin(origin)]
+	}
+}
+
+// normalizeOrigin 统一来源的大小写并去掉末尾的斜杠，便于与配置比较。
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
@@ -25,6 +25,49 @@ type Hub struct {
 
 	// Messages aimed at a specific user.
 	direct chan *imtypes.Message // Added channel for direct messages
+
+	// topics maps a topic name (e.g. imtypes.ChannelTopic) to the locally connected users subscribed to it.
+	// userTopics is the reverse index used to clean up when a client goes away.
+	// Both maps are only touched from the Run goroutine.
+	topics     map[string]map[uint]struct{}
+	userTopics map[uint]map[string]struct{}
+
+	// Topic subscription changes and topic messages, processed by Run.
+	topicOps      chan topicOp
+	topicMessages chan topicMessage
+
+	// Messages for an explicit recipient list (e.g. group members expanded from the membership cache).
+	multicast chan multicastMessage
+
+	// Requests to close connections whose login session was revoked.
+	disconnects chan sessionDisconnect
+}
+
+// sessionDisconnect closes userID's connection if it was authenticated by sessionID (0 matches any session).
+type sessionDisconnect struct {
+	userID    uint
+	sessionID uint
+}
+
+// topicOp subscribes or unsubscribes a connected user to/from a topic.
+type topicOp struct {
+	userID    uint
+	topics    []string
+	subscribe bool
+}
+
+// multicastMessage is a message to deliver to whichever of userIDs are connected to this hub.
+type multicastMessage struct {
+	userIDs       []uint
+	msg           *imtypes.Message
+	excludeUserID uint
+}
+
+// topicMessage is a message to deliver to every local subscriber of a topic.
+type topicMessage struct {
+	topic         string
+	msg           *imtypes.Message
+	excludeUserID uint
 }
 
 // NewHub creates a new Hub.
@@ -35,6 +78,165 @@ func NewHub() *Hub {
 		unregister: make(chan *Client),
 		clients:    make(map[uint]*Client),           // Initialize map with uint key
 		direct:     make(chan *imtypes.Message, 256), // Initialize direct channel with buffer
+
+		topics:        make(map[string]map[uint]struct{}),
+		userTopics:    make(map[uint]map[string]struct{}),
+		topicOps:      make(chan topicOp, 256),
+		topicMessages: make(chan topicMessage, 256),
+		multicast:     make(chan multicastMessage, 256),
+		disconnects:   make(chan sessionDisconnect, 256),
+	}
+}
+
+// DisconnectSession closes the user's connection on this hub if it belongs to the given login session.
+// A sessionID of 0 closes the user's connection regardless of session.
+func (h *Hub) DisconnectSession(userID, sessionID uint) {
+	h.disconnects <- sessionDisconnect{userID: userID, sessionID: sessionID}
+}
+
+// disconnectSession closes a matching client. Closing send makes writePump send a CloseSessionRevoked frame
+// and tear down the connection; readPump then unregisters the (already removed) client. Must be called from Run.
+func (h *Hub) disconnectSession(d sessionDisconnect) {
+	client, ok := h.clients[d.userID]
+	if !ok || (d.sessionID != 0 && client.SessionID != d.sessionID) {
+		return
+	}
+	client.closeWithCode(CloseSessionRevoked, "session revoked")
+	delete(h.clients, d.userID)
+	h.dropUserTopics(d.userID)
+	log.Printf("会话 %d 已被吊销，断开 UserID %d 的连接", d.sessionID, d.userID)
+}
+
+// DeliverToUsers delivers a message to the given users that are connected to this hub, except excludeUserID.
+// Users without a local connection are skipped; the message is serialized once for all recipients.
+func (h *Hub) DeliverToUsers(userIDs []uint, msg *imtypes.Message, excludeUserID uint) {
+	select {
+	case h.multicast <- multicastMessage{userIDs: userIDs, msg: msg, excludeUserID: excludeUserID}:
+	default:
+		log.Printf("警告: Hub multicast channel is full. Dropping message for conversation %s", msg.ConversationID)
+	}
+}
+
+// sendToClient queues pre-serialized bytes for a connected user. Slow clients are dropped. Must be called from Run.
+func (h *Hub) sendToClient(userID uint, msgBytes []byte) {
+	client, ok := h.clients[userID]
+	if !ok {
+		return
+	}
+	select {
+	case client.send <- msgBytes:
+	default:
+		log.Printf("警告: UserID %d 的发送通道已满或关闭，移除客户端。", userID)
+		close(client.send)
+		delete(h.clients, userID)
+		h.dropUserTopics(userID)
+	}
+}
+
+// deliverMulticast fans a message out to the connected users in the recipient list. Must be called from Run.
+func (h *Hub) deliverMulticast(mm multicastMessage) {
+	var msgBytes []byte
+	for _, userID := range mm.userIDs {
+		if userID == mm.excludeUserID {
+			continue
+		}
+		if _, ok := h.clients[userID]; !ok {
+			continue
+		}
+		if msgBytes == nil {
+			var err error
+			if msgBytes, err = json.Marshal(mm.msg); err != nil {
+				log.Printf("错误: 无法序列化会话 %s 的消息: %v", mm.msg.ConversationID, err)
+				return
+			}
+		}
+		h.sendToClient(userID, msgBytes)
+	}
+}
+
+// SubscribeTopics subscribes a connected user to the given topics on this hub instance.
+// Subscriptions for users without a live connection are ignored.
+func (h *Hub) SubscribeTopics(userID uint, topics ...string) {
+	if len(topics) == 0 {
+		return
+	}
+	h.topicOps <- topicOp{userID: userID, topics: topics, subscribe: true}
+}
+
+// UnsubscribeTopics removes a user's subscription to the given topics.
+func (h *Hub) UnsubscribeTopics(userID uint, topics ...string) {
+	if len(topics) == 0 {
+		return
+	}
+	h.topicOps <- topicOp{userID: userID, topics: topics, subscribe: false}
+}
+
+// PublishToTopic delivers a message to every local subscriber of a topic, except excludeUserID.
+// The message is serialized once and the same bytes are shared by all recipients.
+func (h *Hub) PublishToTopic(topic string, msg *imtypes.Message, excludeUserID uint) {
+	select {
+	case h.topicMessages <- topicMessage{topic: topic, msg: msg, excludeUserID: excludeUserID}:
+	default:
+		log.Printf("警告: Hub topic channel is full. Dropping message for topic %s", topic)
+	}
+}
+
+// dropUserTopics removes all topic subscriptions held by a user. Must be called from Run.
+func (h *Hub) dropUserTopics(userID uint) {
+	for topic := range h.userTopics[userID] {
+		if subscribers, ok := h.topics[topic]; ok {
+			delete(subscribers, userID)
+			if len(subscribers) == 0 {
+				delete(h.topics, topic)
+			}
+		}
+	}
+	delete(h.userTopics, userID)
+}
+
+// applyTopicOp applies a subscription change. Must be called from Run.
+func (h *Hub) applyTopicOp(op topicOp) {
+	if _, connected := h.clients[op.userID]; !connected {
+		return
+	}
+	for _, topic := range op.topics {
+		if op.subscribe {
+			if h.topics[topic] == nil {
+				h.topics[topic] = make(map[uint]struct{})
+			}
+			h.topics[topic][op.userID] = struct{}{}
+			if h.userTopics[op.userID] == nil {
+				h.userTopics[op.userID] = make(map[string]struct{})
+			}
+			h.userTopics[op.userID][topic] = struct{}{}
+			continue
+		}
+		if subscribers, ok := h.topics[topic]; ok {
+			delete(subscribers, op.userID)
+			if len(subscribers) == 0 {
+				delete(h.topics, topic)
+			}
+		}
+		delete(h.userTopics[op.userID], topic)
+	}
+}
+
+// deliverTopicMessage fans a topic message out to local subscribers. Must be called from Run.
+func (h *Hub) deliverTopicMessage(tm topicMessage) {
+	subscribers := h.topics[tm.topic]
+	if len(subscribers) == 0 {
+		return
+	}
+	msgBytes, err := json.Marshal(tm.msg)
+	if err != nil {
+		log.Printf("错误: 无法序列化主题 %s 的消息: %v", tm.topic, err)
+		return
+	}
+	for userID := range subscribers {
+		if userID == tm.excludeUserID {
+			continue
+		}
+		h.sendToClient(userID, msgBytes)
 	}
 }
 
@@ -58,9 +260,10 @@ func (h *Hub) Run() {
 			// Handle potential collisions if multiple connections are not allowed or overwrite is desired.
 			if existingClient, ok := h.clients[client.UserID]; ok {
 				log.Printf("警告: 用户 %d 已有连接，关闭旧连接并注册新连接。", client.UserID)
-				// Close the old connection's send channel
-				close(existingClient.send)
-				// Optionally, could send a close message to the old client first
+				// Close the old connection, telling it why so it does not reconnect and replace the new one
+				existingClient.closeWithCode(CloseReplaced, "replaced by a new connection")
+				// The new connection re-subscribes its own topics after registering.
+				h.dropUserTopics(client.UserID)
 			}
 			h.clients[client.UserID] = client
 			log.Printf("客户端已注册: UserID %d", client.UserID)
@@ -70,6 +273,7 @@ func (h *Hub) Run() {
 			if storedClient, ok := h.clients[client.UserID]; ok && storedClient == client {
 				delete(h.clients, client.UserID)
 				close(client.send)
+				h.dropUserTopics(client.UserID)
 				log.Printf("客户端已注销: UserID %d", client.UserID)
 			} else {
 				// If the client isn't the stored one (e.g., an old connection already replaced), just close its send channel.
@@ -90,6 +294,7 @@ func (h *Hub) Run() {
 					log.Printf("广播时客户端 %d 的发送通道已满或关闭，移除客户端。", userID)
 					close(client.send)
 					delete(h.clients, userID)
+					h.dropUserTopics(userID)
 				}
 			}
 
@@ -119,11 +324,24 @@ func (h *Hub) Run() {
 					log.Printf("警告: UserID %d 的发送通道已满或关闭，移除客户端。", receiverID)
 					close(client.send)
 					delete(h.clients, receiverID)
+					h.dropUserTopics(receiverID)
 				}
 			} else {
 				// User is not connected to this hub instance.
 				// log.Printf("用户 %d 未连接到此 Hub，无法投递直接消息。", receiverID) // Can be noisy
 			}
+
+		case op := <-h.topicOps:
+			h.applyTopicOp(op)
+
+		case tm := <-h.topicMessages:
+			h.deliverTopicMessage(tm)
+
+		case mm := <-h.multicast:
+			h.deliverMulticast(mm)
+
+		case d := <-h.disconnects:
+			h.disconnectSession(d)
 		}
 	}
 }
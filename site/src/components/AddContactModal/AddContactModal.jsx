@@ -47,7 +47,7 @@ const AddContactModal = ({ isOpen, onClose }) => {
     setAddingContactId(userId);
     setMessage('');
 
-    const result = await sendFriendRequest(userId);
+    const result = await sendFriendRequest(userId, { source: 'search' });
 
     setAddingContactId(null);
     if (result.success) {
@@ -1,29 +1,88 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { useAuth } from '../../contexts/AuthContext';
 import './AuthForm.css'; // Shared CSS for auth forms
 import { useTranslation } from 'react-i18next';
+import { getOIDCConfig } from '../../services/api';
 
 const LoginForm = ({ onSwitchToRegister, onSuccess }) => {
   const [usernameOrEmail, setUsernameOrEmail] = useState('');
   const [password, setPassword] = useState('');
   const [error, setError] = useState('');
+  const [challengeToken, setChallengeToken] = useState(null);
+  const [code, setCode] = useState('');
   const [isLoading, setIsLoading] = useState(false);
-  const { login } = useAuth();
+  const [sso, setSso] = useState(null);
+  const { login, verifyTwoFactor, loginWithSSO, ssoChallengeToken, clearSsoChallenge } = useAuth();
   const { t } = useTranslation();
 
+  useEffect(() => {
+    if (ssoChallengeToken) {
+      setChallengeToken(ssoChallengeToken);
+      clearSsoChallenge();
+    }
+  }, [ssoChallengeToken, clearSsoChallenge]);
+
+  useEffect(() => {
+    getOIDCConfig().then((response) => {
+      if (response.success && response.data?.enabled) {
+        setSso(response.data);
+      }
+    });
+  }, []);
+
+  const handleSSO = async () => {
+    setError('');
+    const result = await loginWithSSO();
+    if (!result.success) {
+      setError(result.error || t('login_failed_message'));
+    }
+  };
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     setError('');
     setIsLoading(true);
-    const result = await login({ username: usernameOrEmail, password });
+    const result = challengeToken
+      ? await verifyTwoFactor(challengeToken, code)
+      : await login({ username: usernameOrEmail, password });
     setIsLoading(false);
     if (result.success) {
       if(onSuccess) onSuccess();
+    } else if (result.twoFactorRequired) {
+      setChallengeToken(result.challengeToken);
     } else {
       setError(result.error || t('login_failed_message'));
     }
   };
 
+  if (challengeToken) {
+    return (
+      <form onSubmit={handleSubmit} className="auth-form">
+        <h2>{t('two_factor_title')}</h2>
+        {error && <p className="auth-form__error">{error}</p>}
+        <div className="auth-form__field">
+          <label htmlFor="login-2fa-code">{t('two_factor_code')}</label>
+          <input 
+            type="text" 
+            id="login-2fa-code" 
+            value={code} 
+            onChange={(e) => setCode(e.target.value)} 
+            required 
+            autoFocus
+            autoComplete="one-time-code"
+            placeholder={t('two_factor_code_placeholder')}
+          />
+        </div>
+        <button type="submit" className="auth-form__button" disabled={isLoading}>
+          {isLoading ? t('logging_in') : t('two_factor_verify_button')}
+        </button>
+        <p className="auth-form__switch">
+          <button type="button" onClick={() => { setChallengeToken(null); setCode(''); setError(''); }} className="auth-form__switch-button">{t('two_factor_back')}</button>
+        </p>
+      </form>
+    );
+  }
+
   return (
     <form onSubmit={handleSubmit} className="auth-form">
       <h2>{t('login')}</h2>
@@ -52,6 +111,11 @@ const LoginForm = ({ onSwitchToRegister, onSuccess }) => {
       <button type="submit" className="auth-form__button" disabled={isLoading}>
         {isLoading ? t('logging_in') : t('login_button')}
       </button>
+      {sso && (
+        <button type="button" className="auth-form__button" onClick={handleSSO}>
+          {t('login_with_sso', { name: sso.displayName })}
+        </button>
+      )}
       <p className="auth-form__switch">
         {t('dont_have_account')} <button type="button" onClick={onSwitchToRegister} className="auth-form__switch-button">{t('register')}</button>
       </p>
@@ -53,7 +53,10 @@ const ContactList = ({ onSelectContact, isActive }) => {
               {/* Basic display - enhance with avatar later */} 
               <div className="contact-avatar">{/* Avatar Placeholder */}</div>
               <div className="contact-info">
-                <span className="contact-name">{contact.nickname || contact.username}</span>
+                <span className="contact-name">{contact.remark || contact.nickname || contact.username}</span>
+                {contact.tags && contact.tags.length > 0 && (
+                  <span className="contact-tags">{contact.tags.join(' · ')}</span>
+                )}
                 {/* Maybe add status later */} 
               </div>
             </li>
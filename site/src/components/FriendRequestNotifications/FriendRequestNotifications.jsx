@@ -30,6 +30,12 @@ const FriendRequestNotifications = ({ isActive, onClose }) => {
     fetchRequests();
   }, [fetchRequests]);
 
+  // 收到新的或被撤回的好友请求时刷新列表
+  useEffect(() => {
+    window.addEventListener('friend-request', fetchRequests);
+    return () => window.removeEventListener('friend-request', fetchRequests);
+  }, [fetchRequests]);
+
   const handleAccept = async (requestId) => {
     setProcessingId(requestId);
     const result = await acceptFriendRequest(requestId);
@@ -83,6 +89,8 @@ const FriendRequestNotifications = ({ isActive, onClose }) => {
                 <span className="requester-name">
                   {req.requester?.nickname || req.requester?.username || t('unknown_user')}
                 </span>
+                {req.SourceGroupName && <span className="request-source">{req.SourceGroupName}</span>}
+                {req.RequestMessage && <span className="request-message">{req.RequestMessage}</span>}
                 <span className="request-time">{new Date(req.createdAt).toLocaleDateString()}</span>
               </div>
               <div className="notification-actions">
@@ -1,5 +1,8 @@
 import React, { createContext, useState, useEffect, useContext } from 'react';
-import { registerUser, loginUser, getCurrentUserProfile } from '../services/api';
+import { registerUser, loginUser, logoutUser, verifyTwoFactorLogin, startOIDCLogin, completeOIDCLogin, getCurrentUserProfile } from '../services/api';
+
+// 单点登录回调页面的路径，需与后端 OIDC.REDIRECT_URL 一致
+const OIDC_CALLBACK_PATH = '/oidc/callback';
 
 const AuthContext = createContext();
 
@@ -10,6 +13,34 @@ export const AuthProvider = ({ children }) => {
   const [token, setToken] = useState(localStorage.getItem('jwtToken'));
   const [isLoading, setIsLoading] = useState(true); // Start with loading true to check initial auth status
   const [authError, setAuthError] = useState(null);
+  // 单点登录的用户开启了两步验证时，由登录表单继续提交验证码
+  const [ssoChallengeToken, setSsoChallengeToken] = useState(null);
+
+  // 处理身份提供方跳转回来的单点登录回调
+  useEffect(() => {
+    if (window.location.pathname !== OIDC_CALLBACK_PATH) {
+      return;
+    }
+    const params = new URLSearchParams(window.location.search);
+    const expectedState = sessionStorage.getItem('oidcState');
+    sessionStorage.removeItem('oidcState');
+    window.history.replaceState(null, '', '/');
+
+    const code = params.get('code');
+    const state = params.get('state');
+    if (params.get('error') || !code || !state || state !== expectedState) {
+      setAuthError(params.get('error_description') || 'SSO login failed.');
+      return;
+    }
+    completeOIDCLogin(code, state).then((response) => {
+      if (response.success && response.data.twoFactorRequired) {
+        setSsoChallengeToken(response.data.challengeToken);
+        return;
+      }
+      completeLogin(response, 'SSO login failed.');
+    });
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
 
   useEffect(() => {
     const initializeAuth = async () => {
@@ -18,9 +49,15 @@ export const AuthProvider = ({ children }) => {
         const response = await getCurrentUserProfile();
         if (response.success && response.data) {
           setCurrentUser(response.data);
+          // 请求过程中访问令牌可能已被刷新
+          const refreshedToken = localStorage.getItem('jwtToken');
+          if (refreshedToken && refreshedToken !== token) {
+            setToken(refreshedToken);
+          }
         } else {
           // Token might be invalid or expired
           localStorage.removeItem('jwtToken');
+          localStorage.removeItem('refreshToken');
           setToken(null);
           setCurrentUser(null);
           if(response.status === 401) {
@@ -41,15 +78,45 @@ export const AuthProvider = ({ children }) => {
     setIsLoading(true);
     setAuthError(null);
     const response = await loginUser(credentials);
+    if (response.success && response.data.twoFactorRequired) {
+      // 开启了两步验证，等待用户输入验证码
+      setIsLoading(false);
+      return { success: false, twoFactorRequired: true, challengeToken: response.data.challengeToken };
+    }
+    return completeLogin(response, 'Login failed.');
+  };
+
+  const handleVerifyTwoFactor = async (challengeToken, code) => {
+    setIsLoading(true);
+    setAuthError(null);
+    const response = await verifyTwoFactorLogin(challengeToken, code);
+    return completeLogin(response, 'Verification failed.');
+  };
+
+  const handleLoginWithSSO = async () => {
+    setAuthError(null);
+    const response = await startOIDCLogin();
+    if (!response.success) {
+      setAuthError(response.error || 'SSO login failed.');
+      return { success: false, error: response.error || 'SSO login failed.' };
+    }
+    // 回调时核对 state，防止登录 CSRF
+    sessionStorage.setItem('oidcState', response.data.state);
+    window.location.assign(response.data.authorizationUrl);
+    return { success: true };
+  };
+
+  const completeLogin = (response, fallbackError) => {
     if (response.success && response.data.token) {
+      localStorage.setItem('refreshToken', response.data.refreshToken);
       setToken(response.data.token);
       // User profile will be fetched by the useEffect due to token change
       return { success: true };
     } else {
       setCurrentUser(null);
-      setAuthError(response.error || 'Login failed.');
+      setAuthError(response.error || fallbackError);
       setIsLoading(false);
-      return { success: false, error: response.error || 'Login failed.' };
+      return { success: false, error: response.error || fallbackError };
     }
   };
 
@@ -72,9 +139,13 @@ export const AuthProvider = ({ children }) => {
   const handleLogout = () => {
     setIsLoading(true);
     setAuthError(null);
+    if (token) {
+      logoutUser(); // 结束服务端会话，不等待结果
+    }
     setToken(null);
     setCurrentUser(null);
     localStorage.removeItem('jwtToken');
+    localStorage.removeItem('refreshToken');
     setIsLoading(false);
     // Here you might want to also clear other user-related state in your app
   };
@@ -85,9 +156,13 @@ export const AuthProvider = ({ children }) => {
     isLoading,
     authError,
     login: handleLogin,
+    verifyTwoFactor: handleVerifyTwoFactor,
+    loginWithSSO: handleLoginWithSSO,
     register: handleRegister,
     logout: handleLogout,
     clearAuthError: () => setAuthError(null),
+    ssoChallengeToken,
+    clearSsoChallenge: () => setSsoChallengeToken(null),
   };
 
   return <AuthContext.Provider value={value}>{children}</AuthContext.Provider>;
@@ -1,5 +1,6 @@
 import { useState, useEffect, useCallback, useRef } from 'react';
 import { useAuth } from '../contexts/AuthContext';
+import { refreshAccessToken } from '../services/api';
 
 // 检查是否为开发环境
 const isDevEnvironment = window.location.hostname === 'localhost' || window.location.hostname === '127.0.0.1';
@@ -10,6 +11,14 @@ const CHAT_SERVER_URL = isDevEnvironment
   : 'ws://124.71.77.122:8080';   // 生产环境使用配置的服务器
 
 const WEBSOCKET_PATH = '/ws/chat';
+// 访问令牌通过 Sec-WebSocket-Protocol 传递，不出现在 URL 中
+const WEBSOCKET_SUBPROTOCOL = 'im-go.v1';
+const TOKEN_SUBPROTOCOL_PREFIX = 'im-go.token.';
+
+// 服务端主动关闭连接的关闭码：会话被吊销或被新连接替换时不再重连
+const CLOSE_SESSION_REVOKED = 4001;
+const CLOSE_TOKEN_EXPIRED = 4002;
+const CLOSE_REPLACED = 4003;
 
 // 重连配置
 const MAX_RECONNECT_ATTEMPTS = 10;  // 最大重连次数
@@ -32,10 +41,12 @@ function useWebSocket(showNotification) {
   const connectWebSocket = useCallback(() => {
     if (!token || !currentUser) return null;
 
-    const wsUrl = `${CHAT_SERVER_URL}${WEBSOCKET_PATH}?token=${token}`;
+    const wsUrl = `${CHAT_SERVER_URL}${WEBSOCKET_PATH}`;
     console.log('[useWebSocket] 连接WebSocket. URL:', wsUrl, '尝试次数:', reconnectAttemptsRef.current);
     
-    const wsInstance = new WebSocket(wsUrl);
+    // 优先使用最近一次刷新得到的访问令牌
+    const accessToken = localStorage.getItem('jwtToken') || token;
+    const wsInstance = new WebSocket(wsUrl, [WEBSOCKET_SUBPROTOCOL, `${TOKEN_SUBPROTOCOL_PREFIX}${accessToken}`]);
 
     wsInstance.onopen = () => {
       console.log('[useWebSocket] WebSocket连接已建立. ReadyState:', wsInstance.readyState);
@@ -49,6 +60,28 @@ function useWebSocket(showNotification) {
       try {
         const message = JSON.parse(event.data);
         console.log('[useWebSocket] 收到WebSocket消息:', message);
+
+        // 访问令牌即将过期：刷新令牌后在当前连接上重新认证
+        if (message.type === 'reauth_required') {
+          refreshAccessToken().then((ok) => {
+            const freshToken = localStorage.getItem('jwtToken');
+            if (ok && freshToken && wsInstance.readyState === WebSocket.OPEN) {
+              wsInstance.send(JSON.stringify({ type: 'auth', content: freshToken }));
+            }
+          });
+          return;
+        }
+        if (message.type === 'auth') {
+          return;
+        }
+        // 好友请求通知不属于任何会话，转发给好友请求列表等组件自行刷新
+        if (message.type === 'friend_request') {
+          window.dispatchEvent(new CustomEvent('friend-request', { detail: message.metadata }));
+          if (showNotification && document.visibilityState !== 'visible') {
+            showNotification('好友请求', { body: message.content, tag: `friend-request-${message.metadata?.requestId}` });
+          }
+          return;
+        }
         setLastMessage(message); // 更新收到的最新消息
         
         // 如果有提供通知功能，并且是新消息，则发送通知
@@ -99,6 +132,10 @@ function useWebSocket(showNotification) {
       setWebsocket(null);
       setIsConnected(false);
       
+      if (event.code === CLOSE_SESSION_REVOKED || event.code === CLOSE_REPLACED) {
+        manualCloseRef.current = true;
+      }
+
       // 只有在非手动关闭且用户已登录时尝试重连
       if (!manualCloseRef.current && token && currentUser) {
         // 计算重连延迟时间（指数退避算法）
@@ -116,8 +153,11 @@ function useWebSocket(showNotification) {
         
         // 如果未达到最大重连次数，设置重连定时器
         if (reconnectAttemptsRef.current < MAX_RECONNECT_ATTEMPTS) {
-          reconnectTimeoutRef.current = setTimeout(() => {
+          reconnectTimeoutRef.current = setTimeout(async () => {
             reconnectAttemptsRef.current += 1;
+            if (event.code === CLOSE_TOKEN_EXPIRED) {
+              await refreshAccessToken();
+            }
             connectWebSocket();
           }, delay);
         } else {
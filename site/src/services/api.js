@@ -1,4 +1,35 @@
-async function request(endpoint, options = {}) {
+// 使用刷新令牌换取新的访问令牌，并发的 401 请求共享同一次刷新
+let refreshPromise = null;
+export async function refreshAccessToken() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return false;
+  }
+  if (!refreshPromise) {
+    refreshPromise = fetch('/auth/refresh', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken }),
+    })
+      .then(async (response) => {
+        const data = await response.json().catch(() => null);
+        if (!response.ok || !data?.token) {
+          localStorage.removeItem('refreshToken');
+          return false;
+        }
+        localStorage.setItem('jwtToken', data.token);
+        localStorage.setItem('refreshToken', data.refreshToken);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+}
+
+async function request(endpoint, options = {}, retried = false) {
   // Use relative path for endpoints if proxy is configured
   // const url = `${API_BASE_URL}${endpoint}`;
   const url = endpoint; // Assuming proxy handles the full path now
@@ -20,6 +51,10 @@ async function request(endpoint, options = {}) {
     // Try to parse JSON even for non-ok responses, as API might return error details
     const responseData = await response.json().catch(() => null); 
 
+    if (response.status === 401 && !retried && !endpoint.startsWith('/auth/') && await refreshAccessToken()) {
+      return request(endpoint, options, true);
+    }
+
     if (!response.ok) {
       const errorMsg = responseData?.error || `HTTP error! status: ${response.status}`;
       return { error: errorMsg, status: response.status };
@@ -37,19 +72,59 @@ async function request(endpoint, options = {}) {
 // --- 认证 API ---
 export const registerUser = (userData) => request('/auth/register', { method: 'POST', body: JSON.stringify(userData) });
 export const loginUser = (credentials) => request('/auth/login', { method: 'POST', body: JSON.stringify(credentials) });
+export const logoutUser = () => request('/api/v1/auth/logout', { method: 'POST' });
+export const verifyTwoFactorLogin = (challengeToken, code) => request('/auth/2fa/verify', { method: 'POST', body: JSON.stringify({ challengeToken, code }) });
+
+// --- 单点登录 (OIDC) API ---
+export const getOIDCConfig = () => request('/auth/oidc', { method: 'GET' });
+export const startOIDCLogin = () => request('/auth/oidc/authorize', { method: 'POST' });
+export const completeOIDCLogin = (code, state) => request('/auth/oidc/callback', { method: 'POST', body: JSON.stringify({ code, state }) });
+export const startOIDCLink = () => request('/api/v1/users/me/identities/oidc', { method: 'POST' });
+export const getExternalIdentities = () => request('/api/v1/users/me/identities', { method: 'GET' });
+
+// --- 两步验证 API ---
+export const getTwoFactorStatus = () => request('/api/v1/users/me/2fa', { method: 'GET' });
+export const beginTwoFactorEnrollment = () => request('/api/v1/users/me/2fa/totp', { method: 'POST' });
+export const confirmTwoFactorEnrollment = (code) => request('/api/v1/users/me/2fa/totp/confirm', { method: 'POST', body: JSON.stringify({ code }) });
+export const regenerateRecoveryCodes = (code) => request('/api/v1/users/me/2fa/recovery-codes', { method: 'POST', body: JSON.stringify({ code }) });
+export const disableTwoFactor = (code) => request('/api/v1/users/me/2fa/disable', { method: 'POST', body: JSON.stringify({ code }) });
+
+// --- 登录会话 API ---
+export const getSessions = () => request('/api/v1/sessions', { method: 'GET' });
+export const revokeSession = (sessionId) => request(`/api/v1/sessions/${sessionId}`, { method: 'DELETE' });
+export const revokeOtherSessions = () => request('/api/v1/sessions', { method: 'DELETE' });
 
 // --- 用户 API ---
 export const getCurrentUserProfile = () => request('/api/v1/users/me', { method: 'GET' });
 export const searchUsers = (query) => request(`/api/v1/users/search?query=${encodeURIComponent(query)}`, { method: 'GET' });
 
 // --- 好友请求 API ---
-export const sendFriendRequest = (recipientId) => request('/api/v1/friend-requests', { method: 'POST', body: JSON.stringify({ recipientId }) });
+// options: { message, source: 'search' | 'group' | 'suggestion' | 'profile', sourceGroupId }
+export const sendFriendRequest = (recipientId, options = {}) => request('/api/v1/friend-requests', { method: 'POST', body: JSON.stringify({ recipientId, ...options }) });
 export const getPendingFriendRequests = () => request('/api/v1/friend-requests/pending', { method: 'GET' });
 export const acceptFriendRequest = (requestId) => request(`/api/v1/friend-requests/${requestId}/accept`, { method: 'POST' });
 export const rejectFriendRequest = (requestId) => request(`/api/v1/friend-requests/${requestId}/reject`, { method: 'POST' }); // Or 'DELETE' or 'PUT' depending on API design
+export const cancelFriendRequest = (requestId) => request(`/api/v1/friend-requests/${requestId}/cancel`, { method: 'POST' });
+export const getSentFriendRequests = () => request('/api/v1/friend-requests/sent', { method: 'GET' });
 
 // --- Contacts/Friends API --- 
-export const getFriendsList = () => request('/api/v1/friends', { method: 'GET' });
+export const getFriendsList = (filters = {}) => {
+  const params = new URLSearchParams();
+  if (filters.q) params.append('q', filters.q);
+  if (filters.tag) params.append('tag', filters.tag);
+  if (filters.contactGroupId) params.append('contactGroupId', filters.contactGroupId);
+  const query = params.toString();
+  return request(`/api/v1/friends${query ? `?${query}` : ''}`, { method: 'GET' });
+};
+export const removeFriend = (userId) => request(`/api/v1/friends/${userId}`, { method: 'DELETE' });
+// changes: { remark?, tags?, contactGroupId? }，contactGroupId 为 0 表示移出分组
+export const updateFriend = (userId, changes) => request(`/api/v1/friends/${userId}`, { method: 'PUT', body: JSON.stringify(changes) });
+export const getFriendTags = () => request('/api/v1/friends/tags', { method: 'GET' });
+export const getFriendSuggestions = (limit = 20) => request(`/api/v1/friends/suggestions?limit=${limit}`, { method: 'GET' });
+export const getContactGroups = () => request('/api/v1/contact-groups', { method: 'GET' });
+export const createContactGroup = (name) => request('/api/v1/contact-groups', { method: 'POST', body: JSON.stringify({ name }) });
+export const renameContactGroup = (groupId, name) => request(`/api/v1/contact-groups/${groupId}`, { method: 'PUT', body: JSON.stringify({ name }) });
+export const deleteContactGroup = (groupId) => request(`/api/v1/contact-groups/${groupId}`, { method: 'DELETE' });
 
 // --- 群组 API ---
 export const createGroup = async (groupData) => {